@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gentoomaniac/go64/pkg/host"
+)
+
+// frontend is a host presenting the system, Run handles it on the main goroutine until the user closes it
+type frontend interface {
+	host.Host
+	Run() error
+}
+
+// frontendFlags configure the frontend
+type frontendFlags struct {
+	Frontend string `help:"Frontend presenting the machine, none or one of the compiled in ones" default:"none"`
+	Scale    int    `help:"Scale of the screen in the window of graphical frontends" default:"2"`
+}
+
+// frontends holds the constructors of the compiled in frontends, they register themselves when their build tag
+// is set
+var frontends = map[string]func(flags frontendFlags) frontend{}
+
+// newFrontend returns the frontend selected by the flags, nil for none
+func newFrontend(flags frontendFlags) (frontend, error) {
+	if flags.Frontend == "none" {
+		return nil, nil
+	}
+	create, ok := frontends[flags.Frontend]
+	if !ok {
+		names := []string{"none"}
+		for name := range frontends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown frontend %q, available are %s", flags.Frontend, strings.Join(names, ", "))
+	}
+	return create(flags), nil
+}
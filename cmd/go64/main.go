@@ -1,6 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
@@ -10,7 +19,13 @@ import (
 	"github.com/gentoomaniac/gocli"
 	"github.com/gentoomaniac/logging"
 
+	"github.com/gentoomaniac/go64/pkg/binmon"
 	"github.com/gentoomaniac/go64/pkg/c64"
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/gdb"
+	"github.com/gentoomaniac/go64/pkg/monitor"
+	"github.com/gentoomaniac/go64/pkg/trace"
+	"github.com/gentoomaniac/go64/pkg/vsf"
 )
 
 var (
@@ -21,15 +36,41 @@ var (
 	date    = "unknown"
 )
 
+// machineFlags configure the emulated machine
+type machineFlags struct {
+	BasicRom     string `help:"Path to the BASIC ROM" type:"existingfile" required:""`
+	KernalRom    string `help:"Path to the Kernal ROM" type:"existingfile" required:""`
+	CharacterRom string `help:"Path to the character ROM" type:"existingfile" required:""`
+	DriveRom     string `help:"Path to the 1541 DOS ROM, attaches a 1541 as device 8" type:"existingfile"`
+	Disk         string `help:"D64 or G64 image to insert into device 8" type:"existingfile"`
+	Tape         string `help:"TAP or T64 image to insert into the datasette, PLAY is pressed on start" type:"existingfile"`
+	Cartridge    string `help:"CRT image to plug into the expansion port, changes to EasyFlash cartridges are written back on exit" type:"existingfile"`
+	REU          int    `help:"Size of the RAM expansion unit in kB (128, 256, 512 up to 16384), 0 for none" default:"0"`
+	Prg          string `help:"PRG or T64 file to load and run once BASIC is ready" type:"existingfile"`
+	Snapshot     string `help:"go64 snapshot to resume, the drives have to match the ones of the snapshot" type:"existingfile"`
+	VSF          string `help:"VICE snapshot to import, modules which can't be imported are reported" type:"existingfile"`
+	Trace        string `help:"File to write a line for every executed instruction to" type:"path"`
+	TraceFormat  string `help:"Format of the trace lines, default or vice" enum:"default,vice" default:"default"`
+	TraceRange   string `help:"Only trace the instructions in a hexadecimal address range, e.g. e000-ffff"`
+	TraceStart   string `help:"Start the trace when the instruction at the hexadecimal address is executed"`
+	Speed        int    `help:"Speed of the emulation in percent of a PAL C64" default:"100"`
+	Warp         bool   `help:"Run the emulation as fast as possible"`
+}
+
 var cli struct {
 	logging.LoggingConfig
 
 	Run struct {
-		BasicRom     string `help:"Path to the BASIC ROM" type:"existingfile" required:""`
-		KernalRom    string `help:"Path to the Kernal ROM" type:"existingfile" required:""`
-		CharacterRom string `help:"Path to the character ROM" type:"existingfile" required:""`
+		machineFlags
+		frontendFlags
+		GDB           int `name:"gdb" help:"Serve the GDB remote protocol on the TCP port of localhost, 0 disables it" default:"0"`
+		BinaryMonitor int `name:"binary-monitor" help:"Serve the VICE binary monitor protocol on the TCP port of localhost, 0 disables it" default:"0"`
 	} `cmd:"" help:"Run the application (default)." default:"1" hidden:""`
 
+	Monitor struct {
+		machineFlags
+	} `cmd:"" help:"Start the machine stopped in the machine language monitor, Ctrl-C breaks back into it."`
+
 	Version gocli.VersionFlag `short:"V" help:"Display version."`
 }
 
@@ -48,11 +89,243 @@ func main() {
 	switch ctx.Command() {
 	case "foo":
 		log.Info().Msg("foo command")
+	case "monitor":
+		system := newMachine(cli.Monitor.machineFlags)
+		runMonitor(system)
+		system.Quit()
+		system.Shutdown()
 	default:
-		system := &c64.C64{}
+		presenter, err := newFrontend(cli.Run.frontendFlags)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not start the frontend")
+		}
+		system := newMachine(cli.Run.machineFlags)
+
+		// the media are only written back once Run returned, whichever way the emulator is ended first. A frontend
+		// owning the terminal restores it first, os.Exit skips the cleanup of its Run.
+		var saved sync.Once
+		shutdown := func() {
+			system.Quit()
+			if closer, ok := presenter.(io.Closer); ok {
+				closer.Close()
+			}
+			saved.Do(system.Shutdown)
+			os.Exit(0)
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			shutdown()
+		}()
+
+		// the break key Ctrl-\ opens the monitor on the terminal, leaving it resumes the emulation. Inside the
+		// monitor it stops g and the stepping commands. The terminal frontend reads the terminal in raw mode
+		// itself, there is no break key then.
+		if _, ok := presenter.(*rawTerminal); !ok {
+			mon := monitor.New(system, os.Stdin, os.Stdout)
+			var active atomic.Bool
+			breakKey := make(chan os.Signal, 1)
+			signal.Notify(breakKey, syscall.SIGQUIT)
+			go func() {
+				for range breakKey {
+					if active.Swap(true) {
+						mon.Interrupt()
+						continue
+					}
+					go func() {
+						system.Stop()
+						if err := mon.Run(); err == monitor.ErrQuit {
+							shutdown()
+						}
+						system.Resume()
+						active.Store(false)
+					}()
+				}
+			}()
+		}
 
-		system.Init(cli.Run.BasicRom, cli.Run.BasicRom, cli.Run.CharacterRom)
-		system.Run()
+		if cli.Run.GDB != 0 {
+			go func() {
+				if err := gdb.NewServer(system).ListenAndServe(cli.Run.GDB); err != nil {
+					log.Error().Err(err).Msg("GDB server failed")
+				}
+			}()
+		}
+		if cli.Run.BinaryMonitor != 0 {
+			server := binmon.NewServer(system)
+			server.Quit = shutdown
+			go func() {
+				if err := server.ListenAndServe(cli.Run.BinaryMonitor); err != nil {
+					log.Error().Err(err).Msg("binary monitor failed")
+				}
+			}()
+		}
+
+		if presenter == nil {
+			system.Run()
+			shutdown()
+		} else {
+			// the frontend needs the main goroutine, the emulation runs on another one until it is closed
+			system.Host = presenter
+			go system.Run()
+			if err := presenter.Run(); err != nil {
+				log.Error().Err(err).Msg("frontend failed")
+			}
+			shutdown()
+		}
 	}
 	ctx.Exit(0)
 }
+
+// newMachine sets up the C64 with the peripherals and media given by the flags
+func newMachine(flags machineFlags) *c64.C64 {
+	system := &c64.C64{}
+
+	system.Init(flags.BasicRom, flags.KernalRom, flags.CharacterRom)
+	if err := system.Speed().SetPercent(flags.Speed); err != nil {
+		log.Fatal().Err(err).Msg("could not set speed")
+	}
+	system.Speed().SetWarp(flags.Warp)
+	if flags.DriveRom != "" {
+		if _, err := system.AttachDrive(8, flags.DriveRom); err != nil {
+			log.Fatal().Err(err).Msg("could not attach drive")
+		}
+		if flags.Disk != "" {
+			if err := system.InsertDisk(8, flags.Disk); err != nil {
+				log.Fatal().Err(err).Msg("could not insert disk")
+			}
+		}
+	}
+
+	if flags.Cartridge != "" {
+		if err := system.AttachCartridge(flags.Cartridge); err != nil {
+			log.Fatal().Err(err).Msg("could not attach cartridge")
+		}
+	}
+	if flags.REU != 0 {
+		if err := system.AttachREU(flags.REU * 1024); err != nil {
+			log.Fatal().Err(err).Msg("could not attach REU")
+		}
+	}
+	if flags.Tape != "" {
+		if err := system.InsertTape(flags.Tape); err != nil {
+			log.Fatal().Err(err).Msg("could not insert tape")
+		}
+		system.PlayTape()
+	}
+	if flags.Prg != "" {
+		if err := system.Autostart(flags.Prg); err != nil {
+			log.Fatal().Err(err).Msg("could not load program")
+		}
+	}
+
+	if flags.Snapshot != "" {
+		if err := loadSnapshot(system, flags.Snapshot); err != nil {
+			log.Fatal().Err(err).Msg("could not load snapshot")
+		}
+	}
+	if flags.VSF != "" {
+		snapshot, err := vsf.Load(flags.VSF)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not read VICE snapshot")
+		}
+		skipped, err := system.ImportVSF(snapshot)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not import VICE snapshot")
+		}
+		for _, module := range skipped {
+			log.Warn().Str("module", module.Name).Str("reason", module.Reason).Msg("VICE snapshot module not imported")
+		}
+	}
+
+	if flags.Trace != "" {
+		if err := setupTrace(system, flags); err != nil {
+			log.Fatal().Err(err).Msg("could not set up the trace")
+		}
+	}
+
+	return system
+}
+
+// setupTrace writes the trace to the file given by the flags, it is flushed on shutdown
+func setupTrace(system *c64.C64, flags machineFlags) error {
+	format, err := trace.ParseFormat(flags.TraceFormat)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(flags.Trace)
+	if err != nil {
+		return err
+	}
+	tracer := trace.New(f, format)
+
+	if flags.TraceRange != "" {
+		start, end, ok := strings.Cut(flags.TraceRange, "-")
+		if !ok {
+			return fmt.Errorf("invalid trace range %q", flags.TraceRange)
+		}
+		if tracer.Start, err = parseAddress(start); err != nil {
+			return err
+		}
+		if tracer.End, err = parseAddress(end); err != nil {
+			return err
+		}
+	}
+	if flags.TraceStart != "" {
+		addr, err := parseAddress(flags.TraceStart)
+		if err != nil {
+			return err
+		}
+		b, err := system.Debugger().Add(debugger.Exec, addr, addr, nil)
+		if err != nil {
+			return err
+		}
+		b.Trace = true
+		tracer.Triggered = true
+	}
+
+	system.SetTracer(tracer)
+	return nil
+}
+
+// parseAddress parses a hexadecimal address with an optional $ prefix
+func parseAddress(s string) (uint16, error) {
+	value, err := strconv.ParseUint(strings.TrimPrefix(s, "$"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return uint16(value), nil
+}
+
+// runMonitor runs the machine under the control of the monitor until it is quit. Leaving the monitor
+// resumes the emulation until Ctrl-C is pressed.
+func runMonitor(system *c64.C64) {
+	go system.Run()
+	system.Stop()
+
+	mon := monitor.New(system, os.Stdin, os.Stdout)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			system.Break()
+			mon.Interrupt()
+		}
+	}()
+
+	for mon.Run() == nil {
+		system.Continue()
+	}
+}
+
+func loadSnapshot(system *c64.C64, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return system.LoadSnapshot(f)
+}
@@ -0,0 +1,11 @@
+//go:build sdl
+
+package main
+
+import "github.com/gentoomaniac/go64/pkg/sdl"
+
+func init() {
+	frontends["sdl"] = func(flags frontendFlags) frontend {
+		return sdl.New(flags.Scale)
+	}
+}
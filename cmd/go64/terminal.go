@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/gentoomaniac/go64/pkg/terminal"
+)
+
+func init() {
+	frontends["terminal"] = func(flags frontendFlags) frontend {
+		return &rawTerminal{Terminal: terminal.New(os.Stdin, os.Stdout)}
+	}
+}
+
+// rawTerminal puts the terminal into raw mode while it shows the text screen, Ctrl-D closes it. It owns the
+// terminal, so the break key monitor is disabled with it.
+type rawTerminal struct {
+	*terminal.Terminal
+
+	// mutex protects the state of the terminal before Run, it is restored by whichever of Run and Close ends first
+	mutex sync.Mutex
+	state *term.State
+}
+
+func (t *rawTerminal) Run() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	t.state = state
+	t.mutex.Unlock()
+	defer t.Close()
+
+	return t.Terminal.Run()
+}
+
+// Close leaves the raw mode and restores the terminal, the emulator calls it before it exits while Run still
+// waits for a keystroke
+func (t *rawTerminal) Close() error {
+	t.Terminal.Close()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.state == nil {
+		return nil
+	}
+	state := t.state
+	t.state = nil
+	return term.Restore(int(os.Stdin.Fd()), state)
+}
@@ -8,11 +8,13 @@ require (
 	github.com/gentoomaniac/gocli v0.0.0-20210503153723-bf433779ccf3
 	github.com/gentoomaniac/logging v0.0.2
 	github.com/rs/zerolog v1.29.1
+	github.com/veandco/go-sdl2 v0.4.39
+	golang.org/x/term v0.5.0
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.12 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
 	github.com/stretchr/testify v1.8.0 // indirect
-	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
+	golang.org/x/sys v0.5.0 // indirect
 )
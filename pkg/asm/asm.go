@@ -0,0 +1,392 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// A two pass assembler for the 6502 using the opcode table of the MPU. The first pass assigns the addresses
+// of all statements, the second one evaluates the operands and emits the code.
+//
+// Syntax:
+//
+//	label:  lda #<text      ; labels end with a colon, comments start with a semicolon
+//	        *= $c000        ; sets the address of the following code
+//	screen = $0400          ; defines a symbol
+//	        .byte 1, $02, %11, 'a', "text"
+//	        .word label, *+2
+//	        .text "hello"
+//
+// Numbers are decimal, hexadecimal with $ or binary with %. Expressions add and subtract numbers, symbols and *
+// for the address of the current statement, < and > in front of an expression select its low or high byte.
+// The zeropage addressing modes are used if the operand is known in the first pass and fits into a byte.
+
+// Program is the result of the assembly
+type Program struct {
+	Segments []Segment
+	Symbols  map[string]uint16
+}
+
+// Segment is a block of code starting at an origin set with *=
+type Segment struct {
+	Address uint16
+	Data    []byte
+}
+
+// Store writes all segments with the given function, e.g. the Set method of a memory
+func (p *Program) Store(set func(addr uint16, value byte)) {
+	for _, segment := range p.Segments {
+		for i, value := range segment.Data {
+			set(segment.Address+uint16(i), value)
+		}
+	}
+}
+
+// Assembler translates source code into machine code
+type Assembler struct {
+	// HexNumbers treats numbers without prefix as hexadecimal like machine language monitors do
+	HexNumbers bool
+	// Symbols are predefined for the source
+	Symbols map[string]uint16
+}
+
+// Assemble assembles the source with the default settings
+func Assemble(source string) (*Program, error) {
+	return (&Assembler{}).Assemble(source)
+}
+
+// statement is a parsed line of source
+type statement struct {
+	line      int
+	label     string
+	operation string
+	operand   string
+
+	// set by the first pass
+	address uint16
+	mode    mpu.AddressingMode
+	size    int
+	// expression is the operand without the addressing mode
+	expression string
+}
+
+type assembly struct {
+	*Assembler
+	statements []*statement
+	symbols    map[string]uint16
+	pc         int
+	// final is set for the second pass, undefined symbols are errors then
+	final bool
+}
+
+func (a *Assembler) newAssembly() *assembly {
+	s := &assembly{Assembler: a, symbols: map[string]uint16{}}
+	for name, value := range a.Symbols {
+		s.symbols[name] = value
+	}
+	return s
+}
+
+// AssembleLine assembles a single statement at addr, e.g. for the assemble command of a monitor
+func (a *Assembler) AssembleLine(addr uint16, source string) ([]byte, error) {
+	st, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+	switch st.operation {
+	case "", "=", "*=":
+		return nil, fmt.Errorf("expected an instruction or data")
+	}
+
+	s := a.newAssembly()
+	s.pc = int(addr)
+	if err := s.layout(st); err != nil {
+		return nil, err
+	}
+	s.final = true
+	return s.code(st)
+}
+
+// Assemble assembles the source
+func (a *Assembler) Assemble(source string) (*Program, error) {
+	s := a.newAssembly()
+
+	for n, line := range strings.Split(source, "\n") {
+		st, err := parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		st.line = n + 1
+		s.statements = append(s.statements, st)
+	}
+
+	if err := s.pass(); err != nil {
+		return nil, err
+	}
+	s.final = true
+	p := &Program{Symbols: s.symbols}
+	if err := s.emit(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parse splits a line into label, operation and operand
+func parse(line string) (*statement, error) {
+	st := &statement{}
+	line = strings.TrimSpace(stripComment(line))
+
+	if i := strings.IndexByte(line, ':'); i > 0 && isSymbol(line[:i]) {
+		st.label, line = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	if line == "" {
+		return st, nil
+	}
+
+	// symbol definitions and the origin
+	if i := strings.IndexByte(line, '='); i > 0 && !strings.ContainsAny(line[:i], `"'`) {
+		name := strings.TrimSpace(line[:i])
+		if name != "*" && !isSymbol(name) {
+			return nil, fmt.Errorf("invalid symbol %q", name)
+		}
+		st.operation, st.operand = "=", strings.TrimSpace(line[i+1:])
+		st.label = name
+		if name == "*" {
+			st.operation, st.label = "*=", ""
+		}
+		return st, nil
+	}
+
+	st.operation = line
+	if i := strings.IndexAny(line, " \t"); i > 0 {
+		st.operation, st.operand = line[:i], strings.TrimSpace(line[i:])
+	}
+	st.operation = strings.ToUpper(st.operation)
+	return st, nil
+}
+
+// stripComment removes everything after a semicolon outside of quotes
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch {
+		case quote != 0 && line[i] == quote:
+			quote = 0
+		case quote != 0:
+		case line[i] == '"' || line[i] == '\'':
+			quote = line[i]
+		case line[i] == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isSymbol(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// pass assigns the addresses of all statements and defines the labels
+func (s *assembly) pass() error {
+	s.pc = -1
+	for _, st := range s.statements {
+		if err := s.layout(st); err != nil {
+			return fmt.Errorf("line %d: %w", st.line, err)
+		}
+	}
+	return nil
+}
+
+func (s *assembly) layout(st *statement) error {
+	if s.pc >= 0 {
+		st.address = uint16(s.pc)
+	}
+	if st.label != "" && st.operation != "=" {
+		if s.pc < 0 {
+			return fmt.Errorf("label %s before the origin is set with *=", st.label)
+		}
+		if err := s.define(st.label, s.pc); err != nil {
+			return err
+		}
+	}
+
+	switch st.operation {
+	case "":
+		return nil
+	case "*=":
+		value, known, err := s.evaluate(st.operand)
+		if err != nil {
+			return err
+		}
+		if !known {
+			return fmt.Errorf("the origin has to be known in the first pass")
+		}
+		s.pc = value
+		return nil
+	case "=":
+		value, known, err := s.evaluate(st.operand)
+		if err != nil || !known {
+			return err
+		}
+		return s.define(st.label, value)
+	}
+
+	if s.pc < 0 {
+		return fmt.Errorf("code before the origin is set with *=")
+	}
+
+	var err error
+	switch st.operation {
+	case ".BYTE", ".TEXT":
+		var data []byte
+		data, err = s.bytes(st)
+		st.size = len(data)
+	case ".WORD":
+		st.size = 2 * len(splitList(st.operand))
+	default:
+		st.mode, st.size, err = s.selectMode(st)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.pc += st.size
+	if s.pc > 0x10000 {
+		return fmt.Errorf("code beyond $ffff")
+	}
+	return nil
+}
+
+func (s *assembly) define(name string, value int) error {
+	if _, ok := s.symbols[name]; ok {
+		return fmt.Errorf("symbol %s already defined", name)
+	}
+	if value < 0 || value > 0xffff {
+		return fmt.Errorf("value %d of %s out of range", value, name)
+	}
+	s.symbols[name] = uint16(value)
+	return nil
+}
+
+// emit evaluates all operands and writes the code
+func (s *assembly) emit(p *Program) error {
+	var segment *Segment
+	for _, st := range s.statements {
+		s.pc = int(st.address)
+		var data []byte
+		var err error
+		switch st.operation {
+		case "":
+			continue
+		case "=":
+			// constants referring to later labels are only known now
+			if _, ok := s.symbols[st.label]; !ok {
+				var value int
+				if value, _, err = s.evaluate(st.operand); err == nil {
+					err = s.define(st.label, value)
+				}
+			}
+		case "*=":
+			segment = nil
+			continue
+		default:
+			data, err = s.code(st)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", st.line, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		if segment == nil {
+			p.Segments = append(p.Segments, Segment{Address: st.address})
+			segment = &p.Segments[len(p.Segments)-1]
+		}
+		segment.Data = append(segment.Data, data...)
+	}
+	return nil
+}
+
+// code returns the bytes of an instruction or a data directive
+func (s *assembly) code(st *statement) ([]byte, error) {
+	switch st.operation {
+	case ".BYTE", ".TEXT":
+		return s.bytes(st)
+	case ".WORD":
+		return s.words(st)
+	}
+	return s.instruction(st)
+}
+
+// bytes returns the data of .byte and .text, unknown values are 0 in the first pass
+func (s *assembly) bytes(st *statement) ([]byte, error) {
+	var data []byte
+	for _, item := range splitList(st.operand) {
+		if len(item) >= 2 && item[0] == '"' && item[len(item)-1] == '"' {
+			data = append(data, item[1:len(item)-1]...)
+			continue
+		}
+		if st.operation == ".TEXT" {
+			return nil, fmt.Errorf("expected a string instead of %q", item)
+		}
+		value, _, err := s.evaluate(item)
+		if err != nil {
+			return nil, err
+		}
+		if value < -0x80 || value > 0xff {
+			return nil, fmt.Errorf("value %d doesn't fit into a byte", value)
+		}
+		data = append(data, byte(value))
+	}
+	return data, nil
+}
+
+func (s *assembly) words(st *statement) ([]byte, error) {
+	var data []byte
+	for _, item := range splitList(st.operand) {
+		value, _, err := s.evaluate(item)
+		if err != nil {
+			return nil, err
+		}
+		if value < -0x8000 || value > 0xffff {
+			return nil, fmt.Errorf("value %d doesn't fit into a word", value)
+		}
+		data = append(data, byte(value), byte(value>>8))
+	}
+	return data, nil
+}
+
+// splitList splits the comma separated operands of a directive, commas in quotes are kept
+func splitList(operand string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(operand); i++ {
+		switch {
+		case quote != 0 && operand[i] == quote:
+			quote = 0
+		case quote != 0:
+		case operand[i] == '"' || operand[i] == '\'':
+			quote = operand[i]
+		case operand[i] == ',':
+			items = append(items, strings.TrimSpace(operand[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(operand[start:]); rest != "" || len(items) > 0 {
+		items = append(items, rest)
+	}
+	return items
+}
@@ -0,0 +1,142 @@
+package asm
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestAssembler(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Assembler", func() {
+		g.It("assembles every addressing mode", func() {
+			p, err := Assemble(`
+				*= $1000
+				nop
+				asl
+				rol a
+				lda #$01
+				lda $fb
+				lda $fb,x
+				ldx $fb,y
+				lda $d020
+				lda $0400,x
+				lda $0400,y
+				jmp ($fffc)
+				lda ($fb,x)
+				lda ($fb),y
+				bne *
+				lax $10
+			`)
+			g.Assert(err).IsNil()
+			g.Assert(p.Segments).Equal([]Segment{{0x1000, []byte{
+				0xea,
+				0x0a,
+				0x2a,
+				0xa9, 0x01,
+				0xa5, 0xfb,
+				0xb5, 0xfb,
+				0xb6, 0xfb,
+				0xad, 0x20, 0xd0,
+				0xbd, 0x00, 0x04,
+				0xb9, 0x00, 0x04,
+				0x6c, 0xfc, 0xff,
+				0xa1, 0xfb,
+				0xb1, 0xfb,
+				0xd0, 0xfe,
+				0xa7, 0x10,
+			}}})
+		})
+
+		g.It("resolves labels and symbols in two passes", func() {
+			p, err := Assemble(`
+screen = $0400
+		*= $c000
+start:	ldx #0
+loop:	lda text,x      ; forward reference, absolute addressing
+		beq done
+		sta screen,x
+		inx
+		bne loop
+done:	rts
+text:	.text "hi"
+		.byte 0
+		.word start, done+1
+			`)
+			g.Assert(err).IsNil()
+			g.Assert(p.Segments).Equal([]Segment{{0xc000, []byte{
+				0xa2, 0x00,
+				0xbd, 0x0e, 0xc0,
+				0xf0, 0x06,
+				0x9d, 0x00, 0x04,
+				0xe8,
+				0xd0, 0xf5,
+				0x60,
+				'h', 'i', 0x00,
+				0x00, 0xc0, 0x0e, 0xc0,
+			}}})
+			g.Assert(p.Symbols).Equal(map[string]uint16{
+				"screen": 0x0400, "start": 0xc000, "loop": 0xc002, "done": 0xc00d, "text": 0xc00e,
+			})
+		})
+
+		g.It("evaluates expressions", func() {
+			p, err := Assemble(`
+				vector = $0314
+				*= $2000
+				lda #<handler
+				ldx #>handler
+				sta vector
+				stx vector+1
+				.byte %1010, 'a', -1, 10-3, <$1234, >$1234, "a;b"
+			handler:
+				jmp *-3
+			`)
+			g.Assert(err).IsNil()
+			g.Assert(p.Segments[0].Data).Equal([]byte{
+				0xa9, 0x13, 0xa2, 0x20, 0x8d, 0x14, 0x03, 0x8e, 0x15, 0x03,
+				0x0a, 'a', 0xff, 0x07, 0x34, 0x12, 'a', ';', 'b',
+				0x4c, 0x10, 0x20,
+			})
+		})
+
+		g.It("creates a segment for every origin", func() {
+			p, err := Assemble("*=$1000\nnop\n* = $2000\nrts\n")
+			g.Assert(err).IsNil()
+			g.Assert(p.Segments).Equal([]Segment{{0x1000, []byte{0xea}}, {0x2000, []byte{0x60}}})
+
+			var memory [0x10000]byte
+			p.Store(func(addr uint16, value byte) { memory[addr] = value })
+			g.Assert(memory[0x2000]).Equal(byte(0x60))
+		})
+
+		g.It("reads hexadecimal numbers like a monitor", func() {
+			a := &Assembler{HexNumbers: true, Symbols: map[string]uint16{"chrout": 0xffd2}}
+			p, err := a.Assemble("*=c000\nlda #10\njsr chrout\nsta 0400")
+			g.Assert(err).IsNil()
+			g.Assert(p.Segments[0].Data).Equal([]byte{0xa9, 0x10, 0x20, 0xd2, 0xff, 0x8d, 0x00, 0x04})
+		})
+
+		g.It("reports errors with their line", func() {
+			for source, message := range map[string]string{
+				"nop":                     "line 1: code before the origin is set with *=",
+				"*=$1000\nfoo":            "line 2: unknown instruction FOO",
+				"*=$1000\nlda #256":       "line 2: value 256 doesn't fit into a byte",
+				"*=$1000\nbne $2000":      "line 2: branch target $2000 out of range",
+				"*=$1000\njmp nowhere":    "line 2: undefined symbol nowhere",
+				"*=$1000\na:\na:":         "line 3: symbol a already defined",
+				"*=$1000\nstx $1234,y":    "line 2: address $1234 out of range",
+				"*=$1000\nlda ($fb),x":    "line 2: invalid addressing mode for LDA",
+				"*=$1000\n.byte 1+":       `line 2: incomplete expression "1+"`,
+				"*=$1000\n.text $01":      `line 2: expected a string instead of "$01"`,
+				"*=later\nlater = $1000":  "line 1: the origin has to be known in the first pass",
+				"*=$fffe\n.word 1\nnop\n": "line 3: code beyond $ffff",
+			} {
+				_, err := Assemble(source)
+				g.Assert(err == nil).IsFalse()
+				g.Assert(err.Error()).Equal(message)
+			}
+		})
+	})
+}
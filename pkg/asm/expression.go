@@ -0,0 +1,113 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// evaluate returns the value of an expression. Symbols which aren't defined yet are unknown during the first
+// pass and errors during the second one.
+func (s *assembly) evaluate(expression string) (int, bool, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return 0, false, fmt.Errorf("missing value")
+	}
+	switch expression[0] {
+	case '<':
+		value, known, err := s.evaluate(expression[1:])
+		return value & 0xff, known, err
+	case '>':
+		value, known, err := s.evaluate(expression[1:])
+		return (value >> 8) & 0xff, known, err
+	}
+
+	value, known := 0, true
+	sign, expectTerm := 1, true
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ':
+			i++
+		case expectTerm && (c == '-' || c == '+'):
+			if c == '-' {
+				sign = -sign
+			}
+			i++
+		case expectTerm:
+			end := termEnd(expression, i)
+			term, termKnown, err := s.term(expression[i:end])
+			if err != nil {
+				return 0, false, err
+			}
+			value += sign * term
+			known = known && termKnown
+			sign, expectTerm = 1, false
+			i = end
+		case c == '+' || c == '-':
+			if c == '-' {
+				sign = -1
+			}
+			expectTerm = true
+			i++
+		default:
+			return 0, false, fmt.Errorf("unexpected %q in %q", c, expression)
+		}
+	}
+	if expectTerm {
+		return 0, false, fmt.Errorf("incomplete expression %q", expression)
+	}
+	return value, known, nil
+}
+
+// termEnd returns the end of the term starting at i
+func termEnd(expression string, i int) int {
+	if expression[i] == '\'' && i+3 <= len(expression) {
+		return i + 3
+	}
+	end := i + 1
+	for end < len(expression) && !strings.ContainsRune("+- ", rune(expression[end])) {
+		end++
+	}
+	return end
+}
+
+// term returns the value of a number, a character, a symbol or * for the current address
+func (s *assembly) term(term string) (int, bool, error) {
+	switch {
+	case term == "*":
+		return s.pc, s.pc >= 0, nil
+	case term[0] == '$':
+		return parseNumber(term[1:], 16)
+	case term[0] == '%':
+		return parseNumber(term[1:], 2)
+	case term[0] == '\'':
+		if len(term) != 3 || term[2] != '\'' {
+			return 0, false, fmt.Errorf("invalid character %s", term)
+		}
+		return int(term[1]), true, nil
+	case s.HexNumbers:
+		if value, known, err := parseNumber(term, 16); err == nil {
+			return value, known, nil
+		}
+	case term[0] >= '0' && term[0] <= '9':
+		return parseNumber(term, 10)
+	}
+
+	if !isSymbol(term) {
+		return 0, false, fmt.Errorf("invalid value %q", term)
+	}
+	value, ok := s.symbols[term]
+	if !ok && s.final {
+		return 0, false, fmt.Errorf("undefined symbol %s", term)
+	}
+	return int(value), ok, nil
+}
+
+func parseNumber(s string, base int) (int, bool, error) {
+	value, err := strconv.ParseUint(s, base, 16)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid number %q", s)
+	}
+	return int(value), true, nil
+}
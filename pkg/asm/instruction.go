@@ -0,0 +1,126 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// selectMode determines the addressing mode of an instruction from the syntax of its operand
+func (s *assembly) selectMode(st *statement) (mpu.AddressingMode, int, error) {
+	if !IsMnemonic(st.operation) {
+		return 0, 0, fmt.Errorf("unknown instruction %s", st.operation)
+	}
+
+	operand := strings.TrimSpace(st.operand)
+	upper := strings.ToUpper(operand)
+	var modes []mpu.AddressingMode
+	switch {
+	case operand == "":
+		modes = []mpu.AddressingMode{mpu.Implied, mpu.Accumulator}
+	case upper == "A" && hasOpcode(st.operation, mpu.Accumulator):
+		modes = []mpu.AddressingMode{mpu.Accumulator}
+	case operand[0] == '#':
+		modes, st.expression = []mpu.AddressingMode{mpu.Immediate}, operand[1:]
+	case operand[0] == '(' && strings.HasSuffix(strings.ReplaceAll(upper, " ", ""), ",X)"):
+		modes, st.expression = []mpu.AddressingMode{mpu.IndexedIndirect}, operand[1:strings.LastIndexByte(operand, ',')]
+	case operand[0] == '(' && strings.HasSuffix(strings.ReplaceAll(upper, " ", ""), "),Y"):
+		modes, st.expression = []mpu.AddressingMode{mpu.IndirectIndexed}, operand[1:strings.LastIndexByte(operand, ')')]
+	case operand[0] == '(' && operand[len(operand)-1] == ')':
+		modes, st.expression = []mpu.AddressingMode{mpu.Indirect}, operand[1:len(operand)-1]
+	case operand[0] == '(':
+		return 0, 0, fmt.Errorf("invalid addressing mode for %s", st.operation)
+	case strings.HasSuffix(strings.ReplaceAll(upper, " ", ""), ",X"):
+		modes, st.expression = []mpu.AddressingMode{mpu.ZeropageX, mpu.AbsoluteX}, operand[:strings.LastIndexByte(operand, ',')]
+	case strings.HasSuffix(strings.ReplaceAll(upper, " ", ""), ",Y"):
+		modes, st.expression = []mpu.AddressingMode{mpu.ZeropageY, mpu.AbsoluteY}, operand[:strings.LastIndexByte(operand, ',')]
+	default:
+		modes, st.expression = []mpu.AddressingMode{mpu.Relative, mpu.Zeropage, mpu.Absolute}, operand
+	}
+
+	// the zeropage is only used for operands known in the first pass so that the size doesn't change
+	zeropage := false
+	if st.expression != "" {
+		value, known, err := s.evaluate(st.expression)
+		if err != nil {
+			return 0, 0, err
+		}
+		zeropage = known && value >= 0 && value <= 0xff
+	}
+
+	for _, mode := range modes {
+		isZeropage := mode == mpu.Zeropage || mode == mpu.ZeropageX || mode == mpu.ZeropageY
+		if isZeropage && !zeropage && len(modes) > 1 && hasOpcode(st.operation, modes[len(modes)-1]) {
+			continue
+		}
+		if hasOpcode(st.operation, mode) {
+			return mode, 1 + mode.Operands(), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid addressing mode for %s", st.operation)
+}
+
+// instruction returns the code of an instruction
+func (s *assembly) instruction(st *statement) ([]byte, error) {
+	opcode, _ := findOpcode(st.operation, st.mode)
+	if st.mode.Operands() == 0 {
+		return []byte{opcode}, nil
+	}
+
+	value, _, err := s.evaluate(st.expression)
+	if err != nil {
+		return nil, err
+	}
+
+	switch st.mode {
+	case mpu.Relative:
+		offset := value - int(st.address) - 2
+		if offset < -128 || offset > 127 {
+			return nil, fmt.Errorf("branch target $%04x out of range", value)
+		}
+		return []byte{opcode, byte(offset)}, nil
+	case mpu.Immediate:
+		if value < -0x80 || value > 0xff {
+			return nil, fmt.Errorf("value %d doesn't fit into a byte", value)
+		}
+		return []byte{opcode, byte(value)}, nil
+	}
+
+	if value < 0 || value > 0xffff || st.mode.Operands() == 1 && value > 0xff {
+		return nil, fmt.Errorf("address $%x out of range", value)
+	}
+	if st.mode.Operands() == 1 {
+		return []byte{opcode, byte(value)}, nil
+	}
+	return []byte{opcode, byte(value), byte(value >> 8)}, nil
+}
+
+// IsMnemonic returns true if s is the mnemonic of an instruction, ignoring the case
+func IsMnemonic(s string) bool {
+	s = strings.ToUpper(s)
+	for _, opcode := range mpu.Opcodes {
+		if opcode.Mnemonic == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOpcode(mnemonic string, mode mpu.AddressingMode) bool {
+	_, ok := findOpcode(mnemonic, mode)
+	return ok
+}
+
+// findOpcode returns the opcode of the instruction, undocumented opcodes are only used if there is no
+// documented one
+func findOpcode(mnemonic string, mode mpu.AddressingMode) (byte, bool) {
+	for _, illegal := range []bool{false, true} {
+		for i, opcode := range mpu.Opcodes {
+			if opcode.Mnemonic == mnemonic && opcode.Mode == mode && opcode.Illegal == illegal {
+				return byte(i), true
+			}
+		}
+	}
+	return 0, false
+}
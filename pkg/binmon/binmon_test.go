@@ -0,0 +1,265 @@
+package binmon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/c64"
+	"github.com/gentoomaniac/go64/pkg/internal/machinetest"
+)
+
+// client is a minimal binary monitor client
+type client struct {
+	conn   net.Conn
+	lastID uint32
+}
+
+// frame is a response or an event
+type frame struct {
+	responseType byte
+	errorCode    byte
+	id           uint32
+	body         []byte
+}
+
+func (c *client) send(command byte, body ...byte) uint32 {
+	c.lastID++
+	header := []byte{stx, apiVersion}
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(body)))
+	header = binary.LittleEndian.AppendUint32(header, c.lastID)
+	c.conn.Write(append(append(header, command), body...))
+	return c.lastID
+}
+
+func (c *client) receive() frame {
+	header := make([]byte, 12)
+	io.ReadFull(c.conn, header)
+	f := frame{header[6], header[7], binary.LittleEndian.Uint32(header[8:]), make([]byte, binary.LittleEndian.Uint32(header[2:]))}
+	io.ReadFull(c.conn, f.body)
+	return f
+}
+
+// request sends a command and returns its response, events received before are skipped
+func (c *client) request(command byte, body ...byte) frame {
+	id := c.send(command, body...)
+	for {
+		if f := c.receive(); f.id == id {
+			return f
+		}
+	}
+}
+
+func newTestServer(program ...byte) (*client, *machinetest.Machine) {
+	machine := machinetest.New(program...)
+	// the emulation runs until the first request, it starts at a BRK to leave the program untouched
+	machine.CPU().SetPC(0x0f00)
+	c := serve(machine)
+	c.request(cmdPing)
+	machine.CPU().SetPC(0x1000)
+	return c, machine
+}
+
+// serve connects a client to a server for the machine
+func serve(machine *machinetest.Machine) *client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go NewServer(machine).Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	return &client{conn: conn}
+}
+
+func TestServer(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Binary monitor", func() {
+		g.It("stops the running emulation on attach and on requests", func() {
+			machine := machinetest.New(0xe8, 0x4c, 0x00, 0x10) // INX, JMP $1000
+			machine.Resume()
+			c := serve(machine)
+			defer c.conn.Close()
+
+			g.Assert(c.request(cmdPing).errorCode).Equal(errOK)
+			g.Assert(machine.Running()).IsFalse()
+		})
+
+		g.It("gets and sets memory", func() {
+			c, machine := newTestServer(0xa9, 0x01)
+			defer c.conn.Close()
+
+			f := c.request(cmdMemoryGet, 0, 0x00, 0x10, 0x02, 0x10, memspaceMain, 0, 0)
+			g.Assert(f.errorCode).Equal(errOK)
+			g.Assert(f.body).Equal([]byte{3, 0, 0xa9, 0x01, 0x00})
+
+			f = c.request(cmdMemorySet, 0, 0x00, 0x20, 0x01, 0x20, memspaceMain, 0, 0, 0xca, 0xfe)
+			g.Assert(f.errorCode).Equal(errOK)
+			g.Assert(machine.Memory[0x2000:0x2002]).Equal([]byte{0xca, 0xfe})
+
+			g.Assert(c.request(cmdMemoryGet, 0, 0, 0, 0, 0, 1, 0, 0).errorCode).Equal(errInvalidMemspace)
+			g.Assert(c.request(cmdMemoryGet, 0, 0, 0x10).errorCode).Equal(errInvalidLength)
+		})
+
+		g.It("gets and sets registers", func() {
+			c, machine := newTestServer()
+			defer c.conn.Close()
+			machine.CPU().SetA(0x12)
+
+			f := c.request(cmdRegistersGet, memspaceMain)
+			g.Assert(f.body[:10]).Equal([]byte{8, 0, 3, regA, 0x12, 0, 3, regX, 0, 0})
+
+			f = c.request(cmdRegistersSet, memspaceMain, 2, 0, 3, regPC, 0x34, 0x12, 3, regY, 0x07, 0)
+			g.Assert(f.errorCode).Equal(errOK)
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1234))
+			g.Assert(machine.CPU().Y()).Equal(uint8(7))
+
+			f = c.request(cmdRegistersAvailable, memspaceMain)
+			g.Assert(f.body[:11]).Equal([]byte{8, 0, 4, regA, 8, 1, 'A', 4, regX, 8, 1})
+		})
+
+		g.It("stops at checkpoints", func() {
+			c, machine := newTestServer(0xe8, 0xe8, 0xe8, 0xe8, 0x00)
+			defer c.conn.Close()
+
+			f := c.request(cmdCheckpointSet, 0x03, 0x10, 0x03, 0x10, 1, 1, opExec, 1)
+			g.Assert(f.errorCode).Equal(errOK)
+			g.Assert(binary.LittleEndian.Uint32(f.body)).Equal(uint32(1))
+
+			g.Assert(c.request(cmdExit).errorCode).Equal(errOK)
+			g.Assert(c.receive().responseType).Equal(eventResumed)
+			hit := c.receive()
+			g.Assert(hit.responseType).Equal(cmdCheckpointGet)
+			g.Assert(hit.id).Equal(uint32(eventID))
+			g.Assert(hit.body[4]).Equal(byte(1))
+			stopped := c.receive()
+			g.Assert(stopped.responseType).Equal(eventStopped)
+			g.Assert(stopped.body).Equal([]byte{0x03, 0x10})
+
+			// temporary checkpoints are removed once they are hit
+			g.Assert(len(machine.Debugger().Breakpoints())).Equal(0)
+		})
+
+		g.It("lists, toggles and deletes checkpoints", func() {
+			c, machine := newTestServer()
+			defer c.conn.Close()
+
+			c.request(cmdCheckpointSet, 0x20, 0xd0, 0x21, 0xd0, 1, 1, opStore, 0)
+			c.request(cmdCheckpointSet, 0x00, 0x04, 0x00, 0x04, 0, 1, opLoad|opStore, 0)
+			g.Assert(c.request(cmdConditionSet, 2, 0, 0, 0, 6, 'A', ' ', '=', '=', ' ', '1').errorCode).Equal(errOK)
+			g.Assert(c.request(cmdCheckpointToggle, 1, 0, 0, 0, 0).errorCode).Equal(errOK)
+
+			id := c.send(cmdCheckpointList)
+			first, second, list := c.receive(), c.receive(), c.receive()
+			g.Assert(first.id).Equal(id)
+			g.Assert(first.body[10]).Equal(byte(0)) // disabled
+			g.Assert(second.body[9:12]).Equal([]byte{0, 1, opLoad | opStore})
+			g.Assert(second.body[21]).Equal(byte(1)) // has a condition
+			g.Assert(list.responseType).Equal(cmdCheckpointList)
+			g.Assert(list.body).Equal([]byte{2, 0, 0, 0})
+			g.Assert(machine.Debugger().Breakpoints()[1].String()).Equal("2: trace access $0400 if A == 1, 0 hits")
+
+			g.Assert(c.request(cmdCheckpointDelete, 1, 0, 0, 0).errorCode).Equal(errOK)
+			g.Assert(c.request(cmdCheckpointGet, 1, 0, 0, 0).errorCode).Equal(errObjectMissing)
+		})
+
+		g.It("steps over subroutines and until they return", func() {
+			c, machine := newTestServer(
+				0x20, 0x10, 0x10, // JSR $1010
+				0xe8, // INX
+			)
+			copy(machine.Memory[0x1010:], []byte{0xc8, 0xc8, 0x60}) // INY INY RTS
+
+			g.Assert(c.request(cmdAdvanceInstructions, 0, 1, 0).errorCode).Equal(errOK)
+			g.Assert(c.receive().body).Equal([]byte{0x10, 0x10})
+
+			g.Assert(c.request(cmdExecuteUntilReturn).errorCode).Equal(errOK)
+			g.Assert(c.receive().body).Equal([]byte{0x03, 0x10})
+			g.Assert(machine.CPU().Y()).Equal(uint8(2))
+
+			machine.CPU().SetPC(0x1000)
+			c.request(cmdAdvanceInstructions, 1, 2, 0)
+			g.Assert(c.receive().body).Equal([]byte{0x04, 0x10})
+			g.Assert(machine.CPU().Y()).Equal(uint8(4))
+		})
+
+		g.It("stops stepping over subroutines at checkpoints", func() {
+			c, machine := newTestServer(
+				0x20, 0x10, 0x10, // JSR $1010
+				0xe8, // INX
+			)
+			copy(machine.Memory[0x1010:], []byte{0xc8, 0xc8, 0x60}) // INY INY RTS
+			c.request(cmdCheckpointSet, 0x11, 0x10, 0x11, 0x10, 1, 1, opExec, 0)
+
+			g.Assert(c.request(cmdAdvanceInstructions, 1, 1, 0).errorCode).Equal(errOK)
+			g.Assert(c.receive().responseType).Equal(cmdCheckpointGet)
+			g.Assert(c.receive().body).Equal([]byte{0x11, 0x10})
+
+			machine.CPU().SetPC(0x1010)
+			g.Assert(c.request(cmdExecuteUntilReturn).errorCode).Equal(errOK)
+			g.Assert(c.receive().responseType).Equal(cmdCheckpointGet)
+			g.Assert(c.receive().body).Equal([]byte{0x11, 0x10})
+			g.Assert(machine.CPU().Y()).Equal(uint8(2))
+		})
+
+		g.It("stops the running emulation on a request", func() {
+			c, machine := newTestServer(0x4c, 0x00, 0x10) // JMP $1000
+			defer c.conn.Close()
+
+			c.request(cmdExit)
+			f := c.request(cmdPing)
+			g.Assert(f.errorCode).Equal(errOK)
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1000))
+		})
+
+		g.It("captures the display and the palette", func() {
+			c, _ := newTestServer()
+			defer c.conn.Close()
+
+			f := c.request(cmdDisplayGet, 1, 0)
+			g.Assert(f.body[:17]).Equal([]byte{13, 0, 0, 0, 0x80, 1, 0x10, 1, 32, 0, 36, 0, 0x40, 1, 200, 0, 8})
+			g.Assert(len(f.body)).Equal(21 + c64.ScreenWidth*c64.ScreenHeight)
+
+			f = c.request(cmdPaletteGet, 0)
+			g.Assert(f.body[:10]).Equal([]byte{16, 0, 3, 0, 0, 0, 3, 0xff, 0xff, 0xff})
+		})
+
+		g.It("resets and autostarts", func() {
+			c, machine := newTestServer()
+			defer c.conn.Close()
+
+			g.Assert(c.request(cmdReset, 1).errorCode).Equal(errOK)
+			g.Assert(c.request(cmdReset, 8).errorCode).Equal(errInvalidParameter)
+
+			path := filepath.Join(t.TempDir(), "test.prg")
+			os.WriteFile(path, []byte{0x00, 0xc0, 0x60}, 0o644)
+			name := []byte(path)
+			g.Assert(c.request(cmdAutostart, append([]byte{0, 0, 0, byte(len(name))}, name...)...).errorCode).Equal(errOK)
+			g.Assert(machine.Memory[0xc000]).Equal(byte(0x60))
+			g.Assert(c.request(cmdAutostart, append([]byte{1, 0, 0, byte(len(name))}, name...)...).errorCode).Equal(errOK)
+			g.Assert(machine.Autostarted).Equal(path)
+			g.Assert(machine.Resets).Equal([]bool{true, false})
+		})
+
+		g.It("rejects unsupported commands and versions", func() {
+			c, _ := newTestServer()
+			defer c.conn.Close()
+
+			g.Assert(c.request(0x72, 0).errorCode).Equal(errUnsupportedCommand)
+
+			c.conn.Write([]byte{stx, 0x7f, 0, 0, 0, 0, 9, 0, 0, 0, cmdPing})
+			f := c.receive()
+			g.Assert(f.id).Equal(uint32(9))
+			g.Assert(f.errorCode).Equal(errUnsupportedVersion)
+			g.Assert(bytes.Equal(f.body, nil) || len(f.body) == 0).IsTrue()
+		})
+	})
+}
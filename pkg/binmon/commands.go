@@ -0,0 +1,584 @@
+package binmon
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/gentoomaniac/go64/pkg/c64"
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/disasm"
+)
+
+// command types, responses have the type of their request
+const (
+	cmdMemoryGet           byte = 0x01
+	cmdMemorySet           byte = 0x02
+	cmdCheckpointGet       byte = 0x11
+	cmdCheckpointSet       byte = 0x12
+	cmdCheckpointDelete    byte = 0x13
+	cmdCheckpointList      byte = 0x14
+	cmdCheckpointToggle    byte = 0x15
+	cmdConditionSet        byte = 0x22
+	cmdRegistersGet        byte = 0x31
+	cmdRegistersSet        byte = 0x32
+	cmdAdvanceInstructions byte = 0x71
+	cmdExecuteUntilReturn  byte = 0x73
+	cmdPing                byte = 0x81
+	cmdBanksAvailable      byte = 0x82
+	cmdRegistersAvailable  byte = 0x83
+	cmdDisplayGet          byte = 0x84
+	cmdViceInfo            byte = 0x85
+	cmdPaletteGet          byte = 0x91
+	cmdExit                byte = 0xaa
+	cmdQuit                byte = 0xbb
+	cmdReset               byte = 0xcc
+	cmdAutostart           byte = 0xdd
+
+	eventStopped byte = 0x62
+	eventResumed byte = 0x63
+)
+
+// CPU operations of checkpoints
+const (
+	opLoad  byte = 0x01
+	opStore byte = 0x02
+	opExec  byte = 0x04
+)
+
+// memspaceMain is the memory of the computer, the drives aren't supported
+const memspaceMain = 0x00
+
+// register IDs as used by VICE for the 6502
+const (
+	regA     = 0x00
+	regX     = 0x01
+	regY     = 0x02
+	regPC    = 0x03
+	regSP    = 0x04
+	regFlags = 0x05
+	regPort0 = 0x37
+	regPort1 = 0x38
+)
+
+// registerNames lists the registers in the order they are reported
+var registerNames = []struct {
+	id   byte
+	bits byte
+	name string
+}{
+	{regA, 8, "A"},
+	{regX, 8, "X"},
+	{regY, 8, "Y"},
+	{regPC, 16, "PC"},
+	{regSP, 8, "SP"},
+	{regFlags, 8, "FL"},
+	{regPort0, 8, "00"},
+	{regPort1, 8, "01"},
+}
+
+// response is the reply to a request
+type response struct {
+	errorCode byte
+	body      []byte
+}
+
+func failed(errorCode byte) response {
+	return response{errorCode: errorCode}
+}
+
+// execute executes a request and sends the response
+func (c *session) execute(r request) error {
+	if r.version != 0x01 && r.version != apiVersion {
+		return c.send(r.command, errUnsupportedVersion, r.id, nil)
+	}
+
+	var resp response
+	switch r.command {
+	case cmdMemoryGet:
+		resp = c.memoryGet(r.body)
+	case cmdMemorySet:
+		resp = c.memorySet(r.body)
+	case cmdCheckpointGet:
+		resp = c.checkpointGet(r.body)
+	case cmdCheckpointSet:
+		resp = c.checkpointSet(r.body)
+	case cmdCheckpointDelete:
+		resp = c.checkpointDelete(r.body)
+	case cmdCheckpointList:
+		return c.checkpointList(r.id)
+	case cmdCheckpointToggle:
+		resp = c.checkpointToggle(r.body)
+	case cmdConditionSet:
+		resp = c.conditionSet(r.body)
+	case cmdRegistersGet:
+		resp = c.registersGet(r.body)
+	case cmdRegistersSet:
+		resp = c.registersSet(r.body)
+	case cmdAdvanceInstructions:
+		return c.advance(r)
+	case cmdExecuteUntilReturn:
+		return c.executeUntilReturn(r)
+	case cmdPing:
+	case cmdBanksAvailable:
+		// a single bank with the ID 0, the memory as seen by the MPU
+		resp.body = appendString([]byte{1, 0, 6, 0, 0}, "cpu")
+	case cmdRegistersAvailable:
+		resp = c.registersAvailable(r.body)
+	case cmdDisplayGet:
+		resp = c.displayGet(r.body)
+	case cmdViceInfo:
+		resp.body = []byte{4, 3, 7, 0, 0, 4, 0, 0, 0, 0}
+	case cmdPaletteGet:
+		resp = paletteGet()
+	case cmdExit:
+		if err := c.send(r.command, errOK, r.id, nil); err != nil {
+			return err
+		}
+		// the PC can only be read while the emulation is stopped
+		if err := c.sendPC(eventResumed); err != nil {
+			return err
+		}
+		c.resume()
+		return nil
+	case cmdQuit:
+		c.quit = true
+		if err := c.send(r.command, errOK, r.id, nil); err != nil {
+			return err
+		}
+		if c.server.Quit != nil {
+			c.server.Quit()
+		}
+		return nil
+	case cmdReset:
+		resp = c.reset(r.body)
+	case cmdAutostart:
+		resp = c.autostart(r.body)
+	default:
+		resp = failed(errUnsupportedCommand)
+	}
+	return c.send(r.command, resp.errorCode, r.id, resp.body)
+}
+
+// appendString appends a string prefixed by its length
+func appendString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s))), s...)
+}
+
+// memoryRange parses side effects, start, end and memspace of the memory commands
+func memoryRange(body []byte) (sideEffects bool, start uint16, end uint16, resp response, ok bool) {
+	if len(body) < 8 {
+		return false, 0, 0, failed(errInvalidLength), false
+	}
+	start, end = binary.LittleEndian.Uint16(body[1:]), binary.LittleEndian.Uint16(body[3:])
+	switch {
+	case body[5] != memspaceMain:
+		return false, 0, 0, failed(errInvalidMemspace), false
+	case binary.LittleEndian.Uint16(body[6:]) != 0:
+		return false, 0, 0, failed(errObjectMissing), false
+	case end < start:
+		return false, 0, 0, failed(errInvalidParameter), false
+	}
+	return body[0] != 0, start, end, response{}, true
+}
+
+func (c *session) memoryGet(body []byte) response {
+	sideEffects, start, end, resp, ok := memoryRange(body)
+	if !ok {
+		return resp
+	}
+
+	read := c.machine.Peek
+	if sideEffects {
+		read = c.machine.Get
+	}
+	length := int(end) - int(start) + 1
+	data := binary.LittleEndian.AppendUint16(make([]byte, 0, 2+length), uint16(length))
+	for addr := int(start); addr <= int(end); addr++ {
+		data = append(data, read(uint16(addr)))
+	}
+	return response{body: data}
+}
+
+func (c *session) memorySet(body []byte) response {
+	_, start, end, resp, ok := memoryRange(body)
+	if !ok {
+		return resp
+	}
+	data := body[8:]
+	if len(data) != int(end)-int(start)+1 {
+		return failed(errInvalidLength)
+	}
+
+	for i, value := range data {
+		c.machine.Set(start+uint16(i), value)
+	}
+	return response{}
+}
+
+// owned returns true if the breakpoint was set by the client
+func (c *session) owned(id int) bool {
+	for _, checkpoint := range c.checkpoints {
+		if checkpoint == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkpoint returns the breakpoint of the client with the checkpoint number at the start of the body
+func (c *session) checkpoint(body []byte) (*debugger.Breakpoint, response, bool) {
+	if len(body) < 4 {
+		return nil, failed(errInvalidLength), false
+	}
+	id := int(binary.LittleEndian.Uint32(body))
+	for _, b := range c.machine.Debugger().Breakpoints() {
+		if b.ID == id && c.owned(id) {
+			return b, response{}, true
+		}
+	}
+	return nil, failed(errObjectMissing), false
+}
+
+// checkpointInfo returns the body describing a checkpoint
+func (c *session) checkpointInfo(b *debugger.Breakpoint, hit bool) []byte {
+	var op byte
+	if b.Kind&debugger.Exec != 0 {
+		op |= opExec
+	}
+	if b.Kind&debugger.Read != 0 {
+		op |= opLoad
+	}
+	if b.Kind&debugger.Write != 0 {
+		op |= opStore
+	}
+
+	body := binary.LittleEndian.AppendUint32(nil, uint32(b.ID))
+	body = append(body, boolByte(hit))
+	body = binary.LittleEndian.AppendUint16(body, b.Start)
+	body = binary.LittleEndian.AppendUint16(body, b.End)
+	body = append(body, boolByte(!b.Trace), boolByte(!b.Disabled), op, boolByte(c.temporary[b.ID]))
+	body = binary.LittleEndian.AppendUint32(body, uint32(b.Hits))
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	return append(body, boolByte(b.Condition != nil), memspaceMain)
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (c *session) checkpointGet(body []byte) response {
+	b, resp, ok := c.checkpoint(body)
+	if !ok {
+		return resp
+	}
+	return response{body: c.checkpointInfo(b, false)}
+}
+
+// checkpointSet adds a checkpoint, checkpoints which don't stop start the trace log like a trace breakpoint
+func (c *session) checkpointSet(body []byte) response {
+	if len(body) < 8 {
+		return failed(errInvalidLength)
+	}
+	if len(body) > 8 && body[8] != memspaceMain {
+		return failed(errInvalidMemspace)
+	}
+
+	var kind debugger.Kind
+	switch body[6] {
+	case opExec:
+		kind = debugger.Exec
+	case opLoad:
+		kind = debugger.Read
+	case opStore:
+		kind = debugger.Write
+	case opLoad | opStore:
+		kind = debugger.Access
+	default:
+		return failed(errInvalidParameter)
+	}
+
+	start, end := binary.LittleEndian.Uint16(body), binary.LittleEndian.Uint16(body[2:])
+	b, err := c.machine.Debugger().Add(kind, start, end, nil)
+	if err != nil {
+		return failed(errInvalidParameter)
+	}
+	b.Trace = body[4] == 0
+	if body[5] == 0 {
+		c.machine.Debugger().Enable(b.ID, false)
+	}
+	c.checkpoints = append(c.checkpoints, b.ID)
+	c.temporary[b.ID] = body[7] != 0
+	return response{body: c.checkpointInfo(b, false)}
+}
+
+func (c *session) checkpointDelete(body []byte) response {
+	b, resp, ok := c.checkpoint(body)
+	if !ok {
+		return resp
+	}
+	c.deleteCheckpoint(b.ID)
+	return response{}
+}
+
+func (c *session) deleteCheckpoint(id int) {
+	c.machine.Debugger().Delete(id)
+	delete(c.temporary, id)
+	for i, checkpoint := range c.checkpoints {
+		if checkpoint == id {
+			c.checkpoints = append(c.checkpoints[:i], c.checkpoints[i+1:]...)
+			break
+		}
+	}
+}
+
+// checkpointList sends the info of every checkpoint followed by their number
+func (c *session) checkpointList(id uint32) error {
+	count := 0
+	for _, b := range c.machine.Debugger().Breakpoints() {
+		if !c.owned(b.ID) {
+			continue
+		}
+		if err := c.send(cmdCheckpointGet, errOK, id, c.checkpointInfo(b, false)); err != nil {
+			return err
+		}
+		count++
+	}
+	return c.send(cmdCheckpointList, errOK, id, binary.LittleEndian.AppendUint32(nil, uint32(count)))
+}
+
+func (c *session) checkpointToggle(body []byte) response {
+	b, resp, ok := c.checkpoint(body)
+	if !ok {
+		return resp
+	}
+	if len(body) < 5 {
+		return failed(errInvalidLength)
+	}
+	c.machine.Debugger().Enable(b.ID, body[4] != 0)
+	return response{}
+}
+
+func (c *session) conditionSet(body []byte) response {
+	b, resp, ok := c.checkpoint(body)
+	if !ok {
+		return resp
+	}
+	if len(body) < 5 || len(body) != 5+int(body[4]) {
+		return failed(errInvalidLength)
+	}
+	condition, err := debugger.ParseCondition(string(body[5:]))
+	if err != nil {
+		return failed(errInvalidParameter)
+	}
+	b.Condition = condition
+	return response{}
+}
+
+// registers returns the body with all registers
+func (c *session) registers() []byte {
+	cpu := c.machine.CPU()
+	values := map[byte]uint16{
+		regA:     uint16(cpu.A()),
+		regX:     uint16(cpu.X()),
+		regY:     uint16(cpu.Y()),
+		regPC:    cpu.PC(),
+		regSP:    uint16(cpu.S()),
+		regFlags: uint16(cpu.P()),
+		regPort0: uint16(c.machine.Peek(0x0000)),
+		regPort1: uint16(c.machine.Peek(0x0001)),
+	}
+
+	body := binary.LittleEndian.AppendUint16(nil, uint16(len(registerNames)))
+	for _, r := range registerNames {
+		body = append(body, 3, r.id)
+		body = binary.LittleEndian.AppendUint16(body, values[r.id])
+	}
+	return body
+}
+
+func (c *session) registersGet(body []byte) response {
+	if len(body) < 1 {
+		return failed(errInvalidLength)
+	}
+	if body[0] != memspaceMain {
+		return failed(errInvalidMemspace)
+	}
+	return response{body: c.registers()}
+}
+
+func (c *session) registersSet(body []byte) response {
+	if len(body) < 3 {
+		return failed(errInvalidLength)
+	}
+	if body[0] != memspaceMain {
+		return failed(errInvalidMemspace)
+	}
+
+	count := int(binary.LittleEndian.Uint16(body[1:]))
+	items := body[3:]
+	cpu := c.machine.CPU()
+	for i := 0; i < count; i++ {
+		if len(items) < 4 || items[0] < 3 || len(items) < 1+int(items[0]) {
+			return failed(errInvalidLength)
+		}
+		value := binary.LittleEndian.Uint16(items[2:])
+		switch items[1] {
+		case regA:
+			cpu.SetA(byte(value))
+		case regX:
+			cpu.SetX(byte(value))
+		case regY:
+			cpu.SetY(byte(value))
+		case regPC:
+			cpu.SetPC(value)
+		case regSP:
+			cpu.SetS(byte(value))
+		case regFlags:
+			cpu.SetP(byte(value))
+		case regPort0:
+			c.machine.Set(0x0000, byte(value))
+		case regPort1:
+			c.machine.Set(0x0001, byte(value))
+		default:
+			return failed(errObjectMissing)
+		}
+		items = items[1+int(items[0]):]
+	}
+	return response{body: c.registers()}
+}
+
+func (c *session) registersAvailable(body []byte) response {
+	if len(body) < 1 {
+		return failed(errInvalidLength)
+	}
+	if body[0] != memspaceMain {
+		return failed(errInvalidMemspace)
+	}
+
+	data := binary.LittleEndian.AppendUint16(nil, uint16(len(registerNames)))
+	for _, r := range registerNames {
+		data = append(data, byte(3+len(r.name)), r.id, r.bits)
+		data = appendString(data, r.name)
+	}
+	return response{body: data}
+}
+
+// advance executes instructions, subroutine calls are executed as a whole if requested
+func (c *session) advance(r request) error {
+	if len(r.body) < 3 {
+		return c.send(r.command, errInvalidLength, r.id, nil)
+	}
+	if err := c.send(r.command, errOK, r.id, nil); err != nil {
+		return err
+	}
+
+	over, count := r.body[0] != 0, int(binary.LittleEndian.Uint16(r.body[1:]))
+	cpu, d := c.machine.CPU(), c.machine.Debugger()
+	d.Hit = 0
+	for i := 0; i < count && d.Hit == 0; i++ {
+		if over && disasm.Decode(c.machine.Peek, cpu.PC()).Mnemonic == "JSR" {
+			// the subroutine returns when the stack is back at the level before the call, a checkpoint stops early
+			returnAddr, stack := cpu.PC()+3, cpu.S()
+			c.machine.Step()
+			for !(cpu.PC() == returnAddr && cpu.S() == stack) && d.Hit == 0 {
+				c.machine.Step()
+			}
+		} else {
+			c.machine.Step()
+		}
+	}
+	return c.reportStop()
+}
+
+// executeUntilReturn executes instructions until the current subroutine or interrupt handler returns
+func (c *session) executeUntilReturn(r request) error {
+	if err := c.send(r.command, errOK, r.id, nil); err != nil {
+		return err
+	}
+
+	cpu, d := c.machine.CPU(), c.machine.Debugger()
+	stack := cpu.S()
+	d.Hit = 0
+	for d.Hit == 0 {
+		mnemonic := disasm.Decode(c.machine.Peek, cpu.PC()).Mnemonic
+		c.machine.Step()
+		// returns of nested calls only bring the stack back to the level of the start
+		if (mnemonic == "RTS" || mnemonic == "RTI") && cpu.S() > stack {
+			break
+		}
+	}
+	return c.reportStop()
+}
+
+func (c *session) displayGet(body []byte) response {
+	if len(body) < 2 {
+		return failed(errInvalidLength)
+	}
+	// only 8 bit indexed colors are supported
+	if body[1] != 0 {
+		return failed(errInvalidParameter)
+	}
+
+	screen := c.machine.Screen()
+	data := binary.LittleEndian.AppendUint32(nil, 13)
+	for _, value := range []uint16{
+		c64.ScreenWidth, c64.ScreenHeight, c64.DisplayLeft, c64.DisplayTop, c64.DisplayWidth, c64.DisplayHeight,
+	} {
+		data = binary.LittleEndian.AppendUint16(data, value)
+	}
+	data = append(data, 8)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(screen)))
+	return response{body: append(data, screen...)}
+}
+
+func paletteGet() response {
+	data := binary.LittleEndian.AppendUint16(nil, uint16(len(c64.Palette)))
+	for _, color := range c64.Palette {
+		data = append(data, 3, color.R, color.G, color.B)
+	}
+	return response{body: data}
+}
+
+// reset resets the computer with type 0 or 1, the drives can't be reset on their own
+func (c *session) reset(body []byte) response {
+	if len(body) < 1 {
+		return failed(errInvalidLength)
+	}
+	switch body[0] {
+	case 0x00:
+		c.machine.Reset(false)
+	case 0x01:
+		c.machine.Reset(true)
+	default:
+		return failed(errInvalidParameter)
+	}
+	return response{}
+}
+
+// autostart resets the computer and runs the program once BASIC is ready, or only loads it into memory
+func (c *session) autostart(body []byte) response {
+	if len(body) < 4 || len(body) != 4+int(body[3]) {
+		return failed(errInvalidLength)
+	}
+	path := string(body[4:])
+
+	if body[0] != 0 {
+		c.machine.Reset(false)
+		if err := c.machine.Autostart(path); err != nil {
+			return failed(errGeneralFailure)
+		}
+		return response{}
+	}
+
+	prg, err := os.ReadFile(path)
+	if err != nil {
+		return failed(errObjectMissing)
+	}
+	if _, err := c.machine.LoadPRG(prg); err != nil {
+		return failed(errGeneralFailure)
+	}
+	return response{}
+}
@@ -0,0 +1,272 @@
+package binmon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// The server speaks the binary remote monitor protocol of VICE over TCP:
+// https://vice-emu.sourceforge.io/vice_13.html
+// Requests and responses are little endian frames with a header. While the emulation runs, any request stops
+// it and it is resumed with the exit command like in VICE.
+
+// Machine is the emulated system controlled by the client
+type Machine interface {
+	// Get reads from the address space of the MPU including the side effects of I/O registers
+	Get(addr uint16) byte
+	// Peek reads from the address space of the MPU without side effects
+	Peek(addr uint16) byte
+	// Set writes to the address space of the MPU
+	Set(addr uint16, value byte)
+	// CPU returns the MPU to read and change its registers
+	CPU() *mpu.MOS6502
+	// Step executes a single instruction of the stopped emulation
+	Step()
+	// Break requests the running emulation to stop
+	Break()
+	// Stop stops the emulation and returns once it is stopped
+	Stop()
+	// Resume resumes the stopped emulation, a break requested while it was stopped is ignored
+	Resume()
+	// Wait returns once the resumed emulation stopped again
+	Wait()
+	// Reset resets the stopped emulation, a hard reset clears the memory
+	Reset(hard bool)
+	// Autostart loads and runs a program once BASIC is ready
+	Autostart(path string) error
+	// LoadPRG copies a PRG file to its load address
+	LoadPRG(prg []byte) (uint16, error)
+	// Screen returns the color indexes of the rendered screen
+	Screen() []byte
+	// Debugger returns the breakpoints stopping the emulation
+	Debugger() *debugger.Debugger
+}
+
+const (
+	stx        = 0x02
+	apiVersion = 0x02
+
+	// requestHeaderSize is the size of STX, API version, body length, request ID and command
+	requestHeaderSize = 11
+	// eventID is the request ID of responses which aren't replies to a request
+	eventID = 0xffffffff
+)
+
+// error codes of responses
+const (
+	errOK                 byte = 0x00
+	errObjectMissing      byte = 0x01
+	errInvalidMemspace    byte = 0x02
+	errInvalidLength      byte = 0x80
+	errInvalidParameter   byte = 0x81
+	errUnsupportedVersion byte = 0x82
+	errUnsupportedCommand byte = 0x83
+	errGeneralFailure     byte = 0x8f
+)
+
+// Server serves one client at a time. Its checkpoints are removed when it disconnects.
+type Server struct {
+	machine Machine
+	// Quit is called for the quit command, it should shut down the emulator
+	Quit func()
+}
+
+// NewServer returns a server controlling the machine
+func NewServer(machine Machine) *Server {
+	return &Server{machine: machine}
+}
+
+// ListenAndServe serves clients on the TCP port of the loopback interface, it only returns on errors
+func (s *Server) ListenAndServe(port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return err
+	}
+	log.Info().Str("address", l.Addr().String()).Msg("binary monitor listening")
+	return s.Serve(l)
+}
+
+// Serve serves the clients connecting to the listener, it only returns on errors
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		log.Info().Str("client", conn.RemoteAddr().String()).Msg("binary monitor client connected")
+		if err := s.handle(conn); err != nil && err != io.EOF {
+			log.Error().Err(err).Msg("binary monitor connection failed")
+		}
+		conn.Close()
+		log.Info().Str("client", conn.RemoteAddr().String()).Msg("binary monitor client disconnected")
+	}
+}
+
+// request is a command received from the client
+type request struct {
+	version byte
+	id      uint32
+	command byte
+	body    []byte
+}
+
+// handle executes the requests of a client until the connection is closed
+func (s *Server) handle(conn net.Conn) error {
+	c := &session{
+		server:    s,
+		machine:   s.machine,
+		conn:      conn,
+		requests:  make(chan request),
+		done:      make(chan struct{}),
+		temporary: make(map[int]bool),
+	}
+	go c.read(bufio.NewReader(conn))
+
+	// the emulation keeps running until the client sends a request
+	s.machine.Stop()
+	c.resume()
+	defer func() {
+		close(c.done)
+		if c.running != nil {
+			s.machine.Break()
+			<-c.running
+		}
+		for _, b := range s.machine.Debugger().Breakpoints() {
+			if c.owned(b.ID) {
+				s.machine.Debugger().Delete(b.ID)
+			}
+		}
+		s.machine.Resume()
+	}()
+
+	for {
+		select {
+		case r, ok := <-c.requests:
+			if !ok {
+				return c.readErr
+			}
+			if c.running != nil {
+				s.machine.Break()
+				if err := c.stopped(); err != nil {
+					return err
+				}
+			}
+			if err := c.execute(r); err != nil {
+				return err
+			}
+			if c.quit {
+				return nil
+			}
+		case <-c.running:
+			if err := c.stopped(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// session is the state of a connection
+type session struct {
+	server  *Server
+	machine Machine
+	conn    net.Conn
+
+	// requests delivers the received requests and is closed when reading fails with readErr
+	requests chan request
+	readErr  error
+	// done is closed when the session ends
+	done chan struct{}
+
+	// running is closed when the emulation resumed by the client stops, it is nil while stopped
+	running chan struct{}
+	// checkpoints holds the IDs of the breakpoints set by the client, temporary ones are deleted once hit
+	checkpoints []int
+	temporary   map[int]bool
+	quit        bool
+}
+
+// read receives the requests of the client
+func (c *session) read(r *bufio.Reader) {
+	defer close(c.requests)
+	header := make([]byte, requestHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			c.readErr = err
+			return
+		}
+		if header[0] != stx {
+			c.readErr = fmt.Errorf("invalid start of request 0x%02x", header[0])
+			return
+		}
+		body := make([]byte, binary.LittleEndian.Uint32(header[2:]))
+		if _, err := io.ReadFull(r, body); err != nil {
+			c.readErr = err
+			return
+		}
+
+		select {
+		case c.requests <- request{header[1], binary.LittleEndian.Uint32(header[6:]), header[10], body}:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send sends a response, events have the request ID eventID
+func (c *session) send(responseType byte, errorCode byte, id uint32, body []byte) error {
+	frame := make([]byte, 12, 12+len(body))
+	frame[0], frame[1] = stx, apiVersion
+	binary.LittleEndian.PutUint32(frame[2:], uint32(len(body)))
+	frame[6], frame[7] = responseType, errorCode
+	binary.LittleEndian.PutUint32(frame[8:], id)
+	_, err := c.conn.Write(append(frame, body...))
+	return err
+}
+
+// resume runs the emulation until a checkpoint or a request stops it. It is resumed before the next request
+// can break it, a break while it is stopped would be ignored.
+func (c *session) resume() {
+	c.machine.Resume()
+	c.running = make(chan struct{})
+	go func(running chan struct{}) {
+		c.machine.Wait()
+		close(running)
+	}(c.running)
+}
+
+// stopped waits for the emulation to stop and reports the checkpoint which stopped it
+func (c *session) stopped() error {
+	<-c.running
+	c.running = nil
+	return c.reportStop()
+}
+
+// reportStop reports the checkpoint which stopped the emulation if the client set it, and the PC
+func (c *session) reportStop() error {
+	d := c.machine.Debugger()
+	for _, b := range d.Breakpoints() {
+		if b.ID != d.Hit || !c.owned(b.ID) {
+			continue
+		}
+		if err := c.send(cmdCheckpointGet, errOK, eventID, c.checkpointInfo(b, true)); err != nil {
+			return err
+		}
+		if c.temporary[b.ID] {
+			c.deleteCheckpoint(b.ID)
+		}
+	}
+	return c.sendPC(eventStopped)
+}
+
+// sendPC sends an event with the PC
+func (c *session) sendPC(event byte) error {
+	return c.send(event, errOK, eventID, binary.LittleEndian.AppendUint16(nil, c.machine.CPU().PC()))
+}
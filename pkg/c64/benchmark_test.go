@@ -0,0 +1,43 @@
+package c64
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// newBenchmarkC64 returns a C64 with the original ROMs of the repository
+func newBenchmarkC64(b *testing.B) *C64 {
+	c := &C64{}
+	for _, rom := range []struct {
+		file string
+		data *[]byte
+	}{
+		{"../../rom/basic.rom", &c.BasicRom},
+		{"../../rom/kernal.rom", &c.KernalRom},
+		{"../../rom/character.rom", &c.CharacterRom},
+	} {
+		data, err := os.ReadFile(rom.file)
+		if err != nil {
+			b.Skip("ROMs not available:", err)
+		}
+		*rom.data = data
+	}
+	c.initChips()
+	return c
+}
+
+// BenchmarkRunFrame boots BASIC frame by frame without waiting for the wall clock and reports the clock rate
+// achieved by the whole system
+func BenchmarkRunFrame(b *testing.B) {
+	c := newBenchmarkC64(b)
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		c.RunFrame()
+	}
+	rate := float64(c.Cycles()) / time.Since(start).Seconds()
+	b.ReportMetric(rate/1e6, "MHz")
+	b.ReportMetric(rate/ClockRate*100, "%realtime")
+}
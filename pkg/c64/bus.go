@@ -0,0 +1,321 @@
+package c64
+
+import (
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/iec"
+)
+
+// The address space as seen by the MPU, switched by the PLA depending on the processor port
+// http://www.zimmers.net/anonftp/pub/cbm/maps/C64.MemoryMap
+
+// ColorRAMSize is the size of the color RAM at $d800
+const ColorRAMSize = 0x400
+
+// the raster beam of a PAL VIC-II
+const (
+	cyclesPerLine = 63
+	linesPerFrame = 312
+)
+
+// processor port bits besides the memory configuration
+const (
+	cassetteSense byte = 0x10
+	cassetteMotor byte = 0x20
+)
+
+// sources of the IRQ and NMI lines
+const (
+	ciaIRQ       uint = 0
+	reuIRQ       uint = 1
+	ciaNMI       uint = 0
+	cartridgeNMI uint = 1
+)
+
+// processorPort is the I/O port of the 6510 at $00 (data direction) and $01 (data)
+type processorPort struct {
+	ddr  byte
+	data byte
+}
+
+// output returns the levels of the port pins, inputs are pulled up
+func (p processorPort) output() byte {
+	return p.data | ^p.ddr
+}
+
+// readPort returns the value of $01: the cassette sense is low while a button is pressed, the motor
+// control pulls bit 5 low if it is an input
+func (c *C64) readPort() byte {
+	pins := byte(0xff) &^ cassetteMotor
+	if c.Datasette.Sense() {
+		pins &^= cassetteSense
+	}
+	return c.port.data&c.port.ddr | pins&^c.port.ddr
+}
+
+func (c *C64) writePort(addr uint16, value byte) {
+	if addr == 0x0000 {
+		c.port.ddr = value
+	} else {
+		c.port.data = value
+	}
+	// the motor is switched on by a low output on bit 5
+	c.Datasette.SetMotor(c.port.ddr&cassetteMotor != 0 && c.port.data&cassetteMotor == 0)
+}
+
+// memoryConfiguration returns LORAM, HIRAM and CHAREN as seen by the PLA
+func (c *C64) memoryConfiguration() byte {
+	return c.port.output() & (LORAM | HIRAM | CHAREN)
+}
+
+// cartridgeLines returns the levels of GAME and EXROM, both are pulled up without a cartridge
+func (c *C64) cartridgeLines() (game bool, exrom bool) {
+	if c.Cartridge == nil {
+		return true, true
+	}
+	return c.Cartridge.GAME(), c.Cartridge.EXROM()
+}
+
+// memoryBank is the source of a byte selected by the PLA
+type memoryBank int
+
+const (
+	bankRAM memoryBank = iota
+	bankBASIC
+	bankKERNAL
+	bankCharacter
+	bankIO
+	bankROML
+	bankROMH
+	// bankOpen is not connected in Ultimax mode
+	bankOpen
+)
+
+// bankAt decodes an address like the PLA
+// https://www.c64-wiki.com/wiki/Bank_Switching
+func (c *C64) bankAt(addr uint16) memoryBank {
+	game, exrom := c.cartridgeLines()
+	if !game && exrom {
+		// Ultimax mode ignores the processor port
+		switch {
+		case addr < 0x1000:
+			return bankRAM
+		case addr < 0x8000:
+			return bankOpen
+		case addr < 0xa000:
+			return bankROML
+		case addr < 0xd000:
+			return bankOpen
+		case addr < 0xe000:
+			return bankIO
+		}
+		return bankROMH
+	}
+
+	config := c.memoryConfiguration()
+	loram, hiram := config&LORAM != 0, config&HIRAM != 0
+	switch addr >> 12 {
+	case 0x8, 0x9:
+		if !exrom && loram && hiram {
+			return bankROML
+		}
+	case 0xa, 0xb:
+		if !game && !exrom && hiram {
+			return bankROMH
+		}
+		if game && loram && hiram {
+			return bankBASIC
+		}
+	case 0xd:
+		if loram || hiram {
+			if config&CHAREN != 0 {
+				return bankIO
+			}
+			return bankCharacter
+		}
+	case 0xe, 0xf:
+		if hiram {
+			return bankKERNAL
+		}
+	}
+	return bankRAM
+}
+
+// Get reads a byte from the address space of the MPU
+func (c *C64) Get(addr uint16) byte {
+	return c.read(addr, false)
+}
+
+// Peek reads a byte like the MPU but without the side effects of reading I/O registers, e.g. for the monitor
+func (c *C64) Peek(addr uint16) byte {
+	return c.read(addr, true)
+}
+
+func (c *C64) read(addr uint16, peek bool) byte {
+	if !peek && c.debugger.Active(debugger.Read) {
+		c.breakOn(debugger.Read, addr)
+	}
+
+	switch addr {
+	case 0x0000:
+		return c.port.ddr
+	case 0x0001:
+		return c.readPort()
+	}
+
+	switch c.bankAt(addr) {
+	case bankBASIC:
+		return c.BasicRom[addr-0xa000]
+	case bankKERNAL:
+		return c.KernalRom[addr-0xe000]
+	case bankCharacter:
+		return c.CharacterRom[addr-0xd000]
+	case bankIO:
+		return c.readIO(addr, peek)
+	case bankROML:
+		return c.Cartridge.ReadROML(addr - 0x8000)
+	case bankROMH:
+		return c.Cartridge.ReadROMH(addr & 0x1fff)
+	case bankOpen:
+		return byte(addr >> 8)
+	}
+	return c.Memory[addr]
+}
+
+// Set writes a byte to the address space of the MPU. Writes to the ROMs end up in the RAM below, writes to
+// the cartridge windows are seen by the cartridge and the RAM unless in Ultimax mode.
+func (c *C64) Set(addr uint16, value byte) {
+	if c.debugger.Active(debugger.Write) {
+		c.breakOn(debugger.Write, addr)
+	}
+	if addr <= 0x0001 {
+		c.writePort(addr, value)
+	}
+
+	switch c.bankAt(addr) {
+	case bankIO:
+		c.writeIO(addr, value)
+		return
+	case bankOpen:
+		return
+	case bankROML:
+		c.Cartridge.WriteROML(addr-0x8000, value)
+	case bankROMH:
+		c.Cartridge.WriteROMH(addr&0x1fff, value)
+	}
+
+	if addr == 0xff00 && c.REU != nil {
+		c.REU.TriggerFF00()
+	}
+
+	if game, exrom := c.cartridgeLines(); !game && exrom && addr >= 0x1000 {
+		return
+	}
+	c.Memory[addr] = value
+}
+
+func (c *C64) readIO(addr uint16, peek bool) byte {
+	switch {
+	case addr < 0xd400:
+		return c.readVIC(addr & 0x3f)
+	case addr < 0xd800:
+		return c.sidRegisters[addr&0x1f]
+	case addr < 0xdc00:
+		return c.ColorRAM[addr-0xd800] & 0x0f
+	case addr < 0xdd00 && peek:
+		return c.CIA1.Peek(addr)
+	case addr < 0xdd00:
+		return c.CIA1.Read(addr)
+	case addr < 0xde00 && peek:
+		return c.CIA2.Peek(addr)
+	case addr < 0xde00:
+		return c.CIA2.Read(addr)
+	}
+
+	// IO1 and IO2 are open unless a cartridge drives the bus, the REU sits in front of the cartridge port
+	if c.REU != nil && addr >= 0xdf00 {
+		if peek {
+			return c.REU.Peek(addr)
+		}
+		return c.REU.Read(addr)
+	}
+	if c.Cartridge != nil {
+		if value, ok := c.Cartridge.ReadIO(addr); ok {
+			return value
+		}
+	}
+	return byte(addr >> 8)
+}
+
+func (c *C64) writeIO(addr uint16, value byte) {
+	switch {
+	case addr < 0xd400:
+		c.vicRegisters[addr&0x3f] = value
+		if addr&0x3f == vicControl1 {
+			c.updateBadline()
+		}
+	case addr < 0xd800:
+		c.sidRegisters[addr&0x1f] = value
+	case addr < 0xdc00:
+		c.ColorRAM[addr-0xd800] = value & 0x0f
+	case addr < 0xdd00:
+		c.CIA1.Write(addr, value)
+	case addr < 0xde00:
+		c.CIA2.Write(addr, value)
+	case c.REU != nil && addr >= 0xdf00:
+		c.REU.Write(addr, value)
+	case c.Cartridge != nil:
+		c.Cartridge.WriteIO(addr, value)
+	}
+}
+
+// readVIC returns the stored VIC-II registers, only the raster counter in $d011 and $d012 is running
+func (c *C64) readVIC(register uint16) byte {
+	switch register {
+	case 0x11:
+		return c.vicRegisters[register]&0x7f | byte(c.rasterLine>>1)&0x80
+	case 0x12:
+		return byte(c.rasterLine)
+	}
+	return c.vicRegisters[register]
+}
+
+// advanceRaster moves the raster beam by one cycle and halts the MPU while the VIC-II needs the bus
+func (c *C64) advanceRaster() {
+	c.rasterCycle++
+	if c.rasterCycle == cyclesPerLine {
+		c.rasterCycle = 0
+		c.rasterLine = (c.rasterLine + 1) % linesPerFrame
+		if c.debugger.Active(debugger.Raster) {
+			c.breakOn(debugger.Raster, c.rasterLine)
+		}
+		c.updateBadline()
+	}
+	c.updateBA()
+}
+
+// serialPortOut drives the serial bus with PA3-PA5 of CIA2, the outputs are inverted
+func (c *C64) serialPortOut(value byte) {
+	var lines iec.Line
+	if value&0x08 != 0 {
+		lines |= iec.ATN
+	}
+	if value&0x10 != 0 {
+		lines |= iec.CLK
+	}
+	if value&0x20 != 0 {
+		lines |= iec.DATA
+	}
+	c.IEC.Pull(0, lines)
+}
+
+// serialPortIn returns the levels of CLK and DATA on PA6 and PA7 of CIA2
+func (c *C64) serialPortIn() byte {
+	value := byte(0xff)
+	if c.IEC.IsLow(iec.CLK) {
+		value &^= 0x40
+	}
+	if c.IEC.IsLow(iec.DATA) {
+		value &^= 0x80
+	}
+	return value
+}
@@ -0,0 +1,259 @@
+package c64
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/cia"
+	"github.com/gentoomaniac/go64/pkg/iec"
+	"github.com/gentoomaniac/go64/pkg/reu"
+	"github.com/gentoomaniac/go64/pkg/tape"
+)
+
+func newTestC64() *C64 {
+	c := &C64{
+		BasicRom:     make([]byte, 0x2000),
+		KernalRom:    make([]byte, 0x2000),
+		CharacterRom: make([]byte, 0x1000),
+	}
+	c.BasicRom[0] = 0xba
+	c.KernalRom[0] = 0xea
+	c.CharacterRom[0] = 0xc4
+	c.initChips()
+	return c
+}
+
+// testCartridge returns the high byte of the window address and has one register in IO2
+type testCartridge struct {
+	game, exrom bool
+	written     uint16
+	register    byte
+}
+
+func (t *testCartridge) GAME() bool                          { return t.game }
+func (t *testCartridge) EXROM() bool                         { return t.exrom }
+func (t *testCartridge) ReadROML(offset uint16) byte         { return byte((0x8000 + offset) >> 8) }
+func (t *testCartridge) ReadROMH(offset uint16) byte         { return byte(offset>>8) | 0xa0 }
+func (t *testCartridge) WriteROML(offset uint16, value byte) { t.written = 0x8000 + offset }
+func (t *testCartridge) WriteROMH(offset uint16, value byte) {}
+func (t *testCartridge) Reset()                              {}
+
+func (t *testCartridge) ReadIO(addr uint16) (byte, bool) {
+	return t.register, addr >= 0xdf00
+}
+
+func (t *testCartridge) WriteIO(addr uint16, value byte) {
+	t.register = value
+}
+
+func TestBanking(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("PLA", func() {
+		g.It("maps the ROMs and I/O by default", func() {
+			c := newTestC64()
+			c.Set(0xd020, 0x0e)
+			g.Assert(c.Get(0xa000)).Equal(uint8(0xba))
+			g.Assert(c.Get(0xe000)).Equal(uint8(0xea))
+			g.Assert(c.Get(0xd020)).Equal(uint8(0x0e))
+			g.Assert(c.Memory[0xd020]).Equal(uint8(0x00))
+		})
+
+		g.It("writes to the RAM below the ROMs", func() {
+			c := newTestC64()
+			c.Set(0xa000, 0x11)
+			c.Set(0xe000, 0x22)
+			g.Assert(c.Get(0xa000)).Equal(uint8(0xba))
+
+			c.Set(0x0000, 0x07)
+			c.Set(0x0001, 0x00)
+			g.Assert(c.Get(0xa000)).Equal(uint8(0x11))
+			g.Assert(c.Get(0xe000)).Equal(uint8(0x22))
+			g.Assert(c.Get(0xd000)).Equal(uint8(0x00))
+		})
+
+		g.It("switches between I/O and the character ROM", func() {
+			c := newTestC64()
+			c.Set(0x0000, 0x07)
+			c.Set(0x0001, 0x03)
+			g.Assert(c.Get(0xd000)).Equal(uint8(0xc4))
+			c.Set(0x0001, 0x02)
+			g.Assert(c.Get(0xa000)).Equal(uint8(0x00))
+			g.Assert(c.Get(0xe000)).Equal(uint8(0xea))
+		})
+
+		g.It("maps the CIAs", func() {
+			c := newTestC64()
+			c.Set(0xdc02, 0xaa)
+			c.Set(0xdd13, 0x55)
+			g.Assert(c.CIA1.Peek(cia.DDRA)).Equal(uint8(0xaa))
+			g.Assert(c.CIA2.Peek(cia.DDRB)).Equal(uint8(0x55))
+		})
+
+		g.It("peeks without side effects", func() {
+			c := newTestC64()
+			c.Set(0xdc0d, 0x90)
+			c.Datasette.Pulse()
+			g.Assert(c.Peek(0xdc0d)).Equal(uint8(0x90))
+			g.Assert(c.Mpu.IRQ()).IsTrue()
+			g.Assert(c.Get(0xdc0d)).Equal(uint8(0x90))
+			g.Assert(c.Mpu.IRQ()).IsFalse()
+			g.Assert(c.Peek(0xe000)).Equal(uint8(0xea))
+		})
+	})
+
+	g.Describe("PLA with cartridges", func() {
+		g.It("maps ROML in 8kB mode", func() {
+			c := newTestC64()
+			c.Cartridge = &testCartridge{game: true, exrom: false}
+			g.Assert(c.Get(0x8000)).Equal(uint8(0x80))
+			g.Assert(c.Get(0xa000)).Equal(uint8(0xba))
+
+			c.Set(0x8000, 0x12)
+			g.Assert(c.Memory[0x8000]).Equal(uint8(0x12))
+			g.Assert(c.Cartridge.(*testCartridge).written).Equal(uint16(0x8000))
+		})
+
+		g.It("maps ROMH instead of BASIC in 16kB mode", func() {
+			c := newTestC64()
+			c.Cartridge = &testCartridge{game: false, exrom: false}
+			g.Assert(c.Get(0x8000)).Equal(uint8(0x80))
+			g.Assert(c.Get(0xa000)).Equal(uint8(0xa0))
+			g.Assert(c.Get(0xe000)).Equal(uint8(0xea))
+		})
+
+		g.It("leaves most of the memory unmapped in Ultimax mode", func() {
+			c := newTestC64()
+			c.Cartridge = &testCartridge{game: false, exrom: true}
+			c.Set(0x0800, 0x42)
+			c.Set(0x2000, 0x43)
+			c.Set(0xe000, 0x44)
+			g.Assert(c.Get(0x0800)).Equal(uint8(0x42))
+			g.Assert(c.Get(0x2000)).Equal(uint8(0x20))
+			g.Assert(c.Memory[0x2000]).Equal(uint8(0x00))
+			g.Assert(c.Memory[0xe000]).Equal(uint8(0x00))
+			g.Assert(c.Get(0xe100)).Equal(uint8(0xa1))
+			g.Assert(c.Get(0x8000)).Equal(uint8(0x80))
+
+			// the processor port can't switch off I/O
+			c.Set(0x0000, 0x07)
+			c.Set(0x0001, 0x00)
+			c.Set(0xd020, 0x01)
+			g.Assert(c.Get(0xd020)).Equal(uint8(0x01))
+		})
+
+		g.It("passes IO1 and IO2 to the cartridge", func() {
+			c := newTestC64()
+			g.Assert(c.Get(0xde00)).Equal(uint8(0xde))
+			c.Cartridge = &testCartridge{game: true, exrom: true}
+			c.Set(0xdf10, 0x77)
+			g.Assert(c.Get(0xdf10)).Equal(uint8(0x77))
+			g.Assert(c.Get(0xde00)).Equal(uint8(0xde))
+		})
+	})
+
+	g.Describe("Serial port", func() {
+		g.It("drives the bus with inverted outputs", func() {
+			c := newTestC64()
+			c.Set(0xdd02, 0x3f)
+			c.Set(0xdd00, 0x08)
+			g.Assert(c.IEC.Low()).Equal(iec.ATN)
+			g.Assert(c.Get(0xdd00) & 0xc0).Equal(uint8(0xc0))
+
+			c.IEC.Pull(8, iec.DATA)
+			g.Assert(c.Get(0xdd00) & 0xc0).Equal(uint8(0x40))
+		})
+	})
+}
+
+func TestCassettePort(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Cassette port", func() {
+		g.It("reads the sense line", func() {
+			c := newTestC64()
+			c.Datasette.Insert(&tape.TAP{Pulses: []uint32{8}})
+			c.Set(0x0000, 0x2f)
+			g.Assert(c.Get(0x0001) & cassetteSense).Equal(cassetteSense)
+			c.PlayTape()
+			g.Assert(c.Get(0x0001) & cassetteSense).Equal(uint8(0x00))
+			c.StopTape()
+			g.Assert(c.Get(0x0001) & cassetteSense).Equal(cassetteSense)
+		})
+
+		g.It("feeds the pulses to the FLAG input while the motor runs", func() {
+			c := newTestC64()
+			c.Datasette.Insert(&tape.TAP{Pulses: []uint32{0x100, 0x100}})
+			c.Set(0x0000, 0x2f)
+			c.Set(0x0001, 0x37)
+			c.PlayTape()
+			for i := 0; i < 0x400; i++ {
+				c.tick()
+			}
+			g.Assert(c.CIA1.Peek(cia.ICR) & cia.InterruptFLAG).Equal(uint8(0))
+
+			c.Set(0x0001, 0x17)
+			for i := 0; i < 0x101; i++ {
+				c.tick()
+			}
+			g.Assert(c.CIA1.Read(cia.ICR) & cia.InterruptFLAG).Equal(cia.InterruptFLAG)
+			for i := 0; i < 0xff; i++ {
+				c.tick()
+			}
+			g.Assert(c.CIA1.Read(cia.ICR) & cia.InterruptFLAG).Equal(uint8(0))
+			c.tick()
+			g.Assert(c.CIA1.Read(cia.ICR) & cia.InterruptFLAG).Equal(cia.InterruptFLAG)
+		})
+
+		g.It("raises an IRQ for enabled FLAG interrupts", func() {
+			c := newTestC64()
+			c.Set(0xdc0d, 0x90)
+			c.Datasette.Pulse()
+			g.Assert(c.Mpu.IRQ()).IsTrue()
+			c.Get(0xdc0d)
+			g.Assert(c.Mpu.IRQ()).IsFalse()
+		})
+	})
+}
+
+func TestREU(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("REU", func() {
+		g.It("is mapped to IO2 in front of the cartridge", func() {
+			c := newTestC64()
+			c.Cartridge = &testCartridge{game: true, exrom: true}
+			g.Assert(c.AttachREU(reu.Size1700)).IsNil()
+			c.Set(0xdf02, 0x34)
+			g.Assert(c.Get(0xdf02)).Equal(uint8(0x34))
+			g.Assert(c.Get(0xdf22)).Equal(uint8(0x34))
+			g.Assert(c.Cartridge.(*testCartridge).register).Equal(uint8(0x00))
+		})
+
+		g.It("halts the MPU during the transfer", func() {
+			c := newTestC64()
+			g.Assert(c.AttachREU(reu.Size1700)).IsNil()
+			copy(c.Memory[0x1000:], "DMA")
+			c.Set(0xdf03, 0x10)
+			c.Set(0xdf07, 0x03)
+			c.Set(0xdf08, 0x00)
+			c.Set(0xdf01, reu.CommandExecute|reu.CommandImmediately|reu.TransferStash)
+
+			c.mpuLock.ResetCycleCount()
+			c.mpuLock.Unlock()
+			c.mpuLock.EnterCycle()
+			g.Assert(c.mpuLock.CycleCount()).Equal(4)
+			g.Assert(string(c.REU.RAM()[:3])).Equal("DMA")
+		})
+
+		g.It("starts a transfer on a write to $ff00", func() {
+			c := newTestC64()
+			g.Assert(c.AttachREU(reu.Size1700)).IsNil()
+			c.Set(0xdf07, 0x01)
+			c.Set(0xdf01, reu.CommandExecute|reu.TransferStash)
+			g.Assert(c.REU.Active()).IsFalse()
+			c.Set(0xff00, 0x00)
+			g.Assert(c.REU.Active()).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,195 @@
+package c64
+
+import (
+	"sync/atomic"
+
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/memory"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+	"github.com/gentoomaniac/go64/pkg/trace"
+)
+
+// The emulation can be stopped between two instructions, e.g. to inspect it with the monitor. While it is
+// stopped the goroutine running the frames only executes single steps on request, so the state can be read
+// and changed from the goroutine controlling the emulation.
+
+// control holds the requests exchanged with the goroutine of the emulation
+type control struct {
+	// stopRequested is checked by the emulation before every instruction
+	stopRequested atomic.Bool
+	// halted is set while the emulation waits for requests
+	halted atomic.Bool
+	// stopped is signalled every time the emulation halts
+	stopped chan struct{}
+	// requests are executed by the halted emulation
+	requests chan request
+	// quitting is set by a quit request on the goroutine of the emulation, Run returns afterwards
+	quitting bool
+	// done is closed once Run returned
+	done chan struct{}
+}
+
+// request is sent to the halted emulation
+type request int
+
+const (
+	resumeRequest request = iota
+	stepRequest
+	resetRequest
+	quitRequest
+)
+
+func (c *control) init() {
+	c.stopped = make(chan struct{})
+	c.requests = make(chan request)
+	c.done = make(chan struct{})
+}
+
+// CPU returns the MPU of the C64
+func (c *C64) CPU() *mpu.MOS6502 {
+	return &c.Mpu
+}
+
+// Break requests the emulation to stop before the next instruction without waiting for it, e.g. from the
+// break key while another goroutine waits in Continue
+func (c *C64) Break() {
+	c.control.stopRequested.Store(true)
+}
+
+// Stop stops the emulation before the next instruction and returns once it is stopped
+func (c *C64) Stop() {
+	c.Break()
+	<-c.control.stopped
+}
+
+// Step executes a single instruction of the stopped emulation
+func (c *C64) Step() {
+	c.control.requests <- stepRequest
+	<-c.control.stopped
+}
+
+// Resume resumes the stopped emulation, a break requested while it was stopped is ignored
+func (c *C64) Resume() {
+	c.control.stopRequested.Store(false)
+	c.debugger.Hit = 0
+	c.control.requests <- resumeRequest
+}
+
+// Wait returns once the resumed emulation stopped again at a breakpoint or on request
+func (c *C64) Wait() {
+	<-c.control.stopped
+}
+
+// Continue resumes the stopped emulation and returns once it is stopped again
+func (c *C64) Continue() {
+	c.Resume()
+	c.Wait()
+}
+
+// Quit stops the emulation and makes Run return, it returns once Run returned. Unlike Stop it can also be called
+// while the emulation is stopped or after Run returned.
+func (c *C64) Quit() {
+	c.Break()
+	for {
+		select {
+		case c.control.requests <- quitRequest:
+			<-c.control.done
+			return
+		case <-c.control.stopped:
+			// halted now, the next iteration sends the request
+		case <-c.control.done:
+			return
+		}
+	}
+}
+
+// Reset resets the stopped emulation like the reset button, a hard reset also clears the memory like a power
+// cycle. The emulation is still stopped afterwards with the PC at the reset vector.
+func (c *C64) Reset(hard bool) {
+	if hard {
+		c.Memory = memory.Memory{}
+		c.ColorRAM = [ColorRAMSize]byte{}
+	}
+	c.control.requests <- resetRequest
+	<-c.control.stopped
+}
+
+// reset pulls the reset line of the chips on the goroutine of the emulation
+func (c *C64) reset() {
+	c.port = processorPort{}
+	c.vicRegisters = [0x40]byte{}
+	c.sidRegisters = [0x20]byte{}
+	c.dma = dma{}
+	c.Mpu.SetRDY(true)
+	c.CIA1.Reset()
+	c.CIA2.Reset()
+	if c.REU != nil {
+		c.REU.Reset()
+	}
+	if c.Cartridge != nil {
+		c.Cartridge.Reset()
+	}
+	c.Mpu.Reset()
+}
+
+// halt parks the goroutine of the emulation until it is resumed or quit
+func (c *C64) halt() {
+	c.control.stopRequested.Store(false)
+	for {
+		c.control.halted.Store(true)
+		c.control.stopped <- struct{}{}
+		r := <-c.control.requests
+		c.control.halted.Store(false)
+		switch r {
+		case resumeRequest:
+			return
+		case quitRequest:
+			c.control.quitting = true
+			return
+		case stepRequest:
+			c.step()
+		case resetRequest:
+			c.reset()
+		}
+	}
+}
+
+// step executes the next instruction, it is written to the trace log first
+func (c *C64) step() {
+	if c.tracer != nil && (!c.tracer.Triggered || c.debugger.Tracing) {
+		c.tracer.Trace(c.Cycles(), &c.Mpu, c.Peek, int(c.rasterLine), c.rasterCycle)
+	}
+	c.Mpu.Step()
+}
+
+// SetTracer logs the executed instructions to the tracer, nil stops the trace. It may only be called before
+// Run or while the emulation is stopped.
+func (c *C64) SetTracer(t *trace.Tracer) {
+	c.tracer = t
+}
+
+// Debugger returns the breakpoints, they may only be changed while the emulation is stopped
+func (c *C64) Debugger() *debugger.Debugger {
+	return &c.debugger
+}
+
+// breakOn stops the emulation before the next instruction if a watchpoint or raster breakpoint triggers.
+// Accesses of the monitor while the emulation is stopped are ignored.
+func (c *C64) breakOn(kind debugger.Kind, value uint16) {
+	if !c.control.halted.Load() && c.debugger.Check(kind, value, c.debugState) {
+		c.control.stopRequested.Store(true)
+	}
+}
+
+// debugState returns the values used by the conditions of breakpoints
+func (c *C64) debugState() debugger.State {
+	return debugger.State{
+		A:          c.Mpu.A(),
+		X:          c.Mpu.X(),
+		Y:          c.Mpu.Y(),
+		S:          c.Mpu.S(),
+		P:          c.Mpu.P(),
+		PC:         c.Mpu.PC(),
+		RasterLine: c.rasterLine,
+	}
+}
@@ -0,0 +1,103 @@
+package c64
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+func TestControl(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Control", func() {
+		g.It("stops, steps and continues the MPU", func() {
+			c := newSnapshotC64()
+			c.restored = true
+			go c.Run()
+
+			c.Stop()
+			g.Assert(c.Mpu.PC()).Equal(uint16(0x1000))
+			c.Step()
+			c.Step()
+			g.Assert(c.Mpu.PC()).Equal(uint16(0x1002))
+			g.Assert(c.Mpu.X()).Equal(uint8(1))
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				c.Break()
+			}()
+			c.Continue()
+			g.Assert(c.Mpu.X() != 1).IsTrue()
+		})
+
+		g.It("resets the stopped emulation", func() {
+			c := newSnapshotC64()
+			c.restored = true
+			c.KernalRom[0x1ffc], c.KernalRom[0x1ffd] = 0x00, 0x10
+			go c.Run()
+
+			c.Stop()
+			c.Step()
+			c.Set(0xdc0d, 0x81)
+			c.Reset(false)
+			g.Assert(c.Mpu.PC()).Equal(uint16(0x1000))
+			g.Assert(c.Memory[0x1001]).Equal(uint8(0xe8))
+			g.Assert(c.Mpu.P() & mpu.I).Equal(uint8(mpu.I))
+
+			c.Reset(true)
+			g.Assert(c.Memory[0x1001]).Equal(uint8(0x00))
+		})
+
+		g.It("runs until the end of the frame", func() {
+			c := newSnapshotC64()
+			c.restored = true
+
+			c.RunFrame()
+			g.Assert(c.Cycles() >= CyclesPerFrame && c.Cycles() < CyclesPerFrame+8).IsTrue()
+			g.Assert(c.rasterLine).Equal(uint16(0))
+			c.RunFrame()
+			g.Assert(c.Cycles() >= 2*CyclesPerFrame && c.Cycles() < 2*CyclesPerFrame+8).IsTrue()
+		})
+
+		g.It("runs until the cycle", func() {
+			c := newSnapshotC64()
+			c.restored = true
+
+			c.RunUntil(100)
+			g.Assert(c.Cycles() >= 100 && c.Cycles() < 108).IsTrue()
+			c.RunUntil(50)
+			g.Assert(c.Cycles() < 108).IsTrue()
+		})
+
+		g.It("quits the running and the stopped emulation", func() {
+			c := newSnapshotC64()
+			c.restored = true
+			go c.Run()
+			c.Quit()
+			c.Quit()
+
+			c = newSnapshotC64()
+			c.restored = true
+			go c.Run()
+			c.Stop()
+			cycles := c.Cycles()
+			c.Quit()
+			g.Assert(c.Cycles()).Equal(cycles)
+		})
+
+		g.It("ignores breaks requested while stopped", func() {
+			c := newSnapshotC64()
+			c.restored = true
+			go c.Run()
+
+			c.Stop()
+			c.Break()
+			c.Resume()
+			time.Sleep(10 * time.Millisecond)
+			c.Stop()
+			g.Assert(c.Cycles() > 100).IsTrue()
+		})
+	})
+}
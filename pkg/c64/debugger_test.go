@@ -0,0 +1,84 @@
+package c64
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/trace"
+)
+
+func TestDebugger(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Debugger", func() {
+		var c *C64
+		g.BeforeEach(func() {
+			c = newSnapshotC64()
+			c.restored = true
+			go c.Run()
+			c.Stop()
+		})
+
+		g.It("breaks before executing an address", func() {
+			b, _ := c.debugger.Add(debugger.Exec, 0x1005, 0x1005, nil)
+			c.Continue()
+			g.Assert(c.Mpu.PC()).Equal(uint16(0x1005))
+			g.Assert(c.debugger.Hit).Equal(b.ID)
+
+			// continuing executes the instruction at the breakpoint before checking again
+			c.Continue()
+			g.Assert(c.Mpu.PC()).Equal(uint16(0x1005))
+			g.Assert(b.Hits).Equal(2)
+		})
+
+		g.It("breaks after an instruction writing a watched address", func() {
+			c.debugger.Add(debugger.Write, 0x0502, 0x0502, nil)
+			c.Continue()
+			g.Assert(c.Mpu.PC()).Equal(uint16(0x100b))
+			g.Assert(c.Mpu.X()).Equal(uint8(2))
+		})
+
+		g.It("breaks only if the condition is true", func() {
+			cond, _ := debugger.ParseCondition("X == 3")
+			c.debugger.Add(debugger.Exec, 0x1002, 0x1002, cond)
+			c.Continue()
+			g.Assert(c.Mpu.PC()).Equal(uint16(0x1002))
+			g.Assert(c.Mpu.X()).Equal(uint8(3))
+		})
+
+		g.It("breaks at the start of a raster line", func() {
+			c.debugger.Add(debugger.Raster, 100, 100, nil)
+			c.Continue()
+			g.Assert(c.rasterLine).Equal(uint16(100))
+			g.Assert(c.rasterCycle < 8).IsTrue()
+		})
+
+		g.It("starts the trace at a trace breakpoint", func() {
+			out := &bytes.Buffer{}
+			tracer := trace.New(out, trace.Default)
+			tracer.Triggered = true
+			c.SetTracer(tracer)
+			b, _ := c.debugger.Add(debugger.Exec, 0x1005, 0x1005, nil)
+			b.Trace = true
+			c.debugger.Add(debugger.Exec, 0x100b, 0x100b, nil)
+
+			c.Continue()
+			g.Assert(tracer.Flush()).IsNil()
+			lines := strings.Split(out.String(), "\n")
+			g.Assert(len(lines)).Equal(3)
+			g.Assert(strings.Contains(lines[0], "1005  6d 00 04  ADC $0400")).IsTrue()
+			g.Assert(strings.Contains(lines[1], "1008  9d 00 05  STA $0500,X")).IsTrue()
+		})
+
+		g.It("ignores accesses while stopped", func() {
+			c.debugger.Add(debugger.Access, 0xd020, 0xd020, nil)
+			c.Set(0xd020, 1)
+			c.Get(0xd020)
+			g.Assert(c.debugger.Hit).Equal(0)
+			g.Assert(c.control.stopRequested.Load()).IsFalse()
+		})
+	})
+}
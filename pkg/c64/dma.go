@@ -0,0 +1,131 @@
+package c64
+
+// The VIC-II steals cycles from the MPU for the character pointers of badlines and for the sprite data. It pulls
+// BA low three cycles before it takes over the bus, BA is connected to RDY of the 6510 which halts on its next
+// read cycle. Writes still pass, the MPU never does more than three writes in a row.
+// http://www.zimmers.net/cbmpics/cbm/c64/vic-ii.txt (Christian Bauer, chapter 3.6)
+
+const (
+	vicSpriteY      = 0x01
+	vicSpriteEnable = 0x15
+	vicSpriteExpand = 0x17
+
+	// yScroll is the vertical fine scroll in vicControl1
+	yScroll byte = 0x07
+
+	// firstDMALine and lastDMALine limit the raster lines in which badlines can occur
+	firstDMALine = 0x30
+	lastDMALine  = 0xf7
+	// badlineBAStart and badlineBAEnd are the cycles of a badline with BA low, numbered from 1 like the
+	// article. The character pointers are read in the cycles 15 to 54.
+	badlineBAStart = 12
+	badlineBAEnd   = 54
+	// spriteDMACheck is the cycle in which the VIC-II turns on the DMA of sprites starting in the next line
+	spriteDMACheck = 55
+	// spriteLines is the number of lines of sprite data
+	spriteLines = 21
+)
+
+var (
+	// spriteBA has a bit for every sprite holding BA low in the cycle, it starts three cycles before the
+	// two cycles in which the sprite data is read
+	spriteBA [cyclesPerLine]uint8
+	// spriteFetched has the bit of the sprite whose data was read once the cycle is done, both tables are
+	// indexed by the cycle counted from 0
+	spriteFetched [cyclesPerLine]uint8
+)
+
+func init() {
+	for sprite := 0; sprite < 8; sprite++ {
+		// sprites 0 to 2 are read at the end of the line, 3 to 7 at the start of the next one
+		first := 58 + 2*sprite
+		if sprite >= 3 {
+			first = 2*sprite - 5
+		}
+		for cycle := first - 3; cycle <= first+1; cycle++ {
+			spriteBA[(cycle-1+cyclesPerLine)%cyclesPerLine] |= 1 << sprite
+		}
+		spriteFetched[first] |= 1 << sprite
+	}
+}
+
+// dma holds the state of the VIC-II deciding which cycles are stolen
+type dma struct {
+	// badlines is set if the display was enabled in the first line of the display window, only then
+	// badlines occur in the frame
+	badlines bool
+	// badline is set if the current raster line is a badline, it only changes with the line and $d011
+	badline bool
+	// sprites counts the lines of data left to read for every sprite
+	sprites [8]int
+	// active has a bit for every sprite with data left to read
+	active uint8
+}
+
+// badline returns true if the VIC-II reads the character pointers in the current raster line
+func (c *C64) badline() bool {
+	return c.dma.badlines && c.rasterLine >= firstDMALine && c.rasterLine <= lastDMALine &&
+		byte(c.rasterLine)&yScroll == c.vicRegisters[vicControl1]&yScroll
+}
+
+// updateBadline is called at the start of every raster line and for writes to $d011
+func (c *C64) updateBadline() {
+	if c.rasterLine == firstDMALine && c.vicRegisters[vicControl1]&displayEnable != 0 {
+		c.dma.badlines = true
+	} else if c.rasterLine == 0 {
+		c.dma.badlines = false
+	}
+	c.dma.badline = c.badline()
+}
+
+// updateBA decides whether the VIC-II needs the bus in the current cycle and pulls RDY of the MPU
+func (c *C64) updateBA() {
+	cycle := c.rasterCycle + 1
+	if cycle == spriteDMACheck || cycle == spriteDMACheck+1 {
+		c.startSpriteDMA()
+	}
+
+	ba := c.dma.badline && cycle >= badlineBAStart && cycle <= badlineBAEnd ||
+		spriteBA[c.rasterCycle]&c.dma.active != 0
+	c.Mpu.SetRDY(!ba)
+
+	if fetched := spriteFetched[c.rasterCycle] & c.dma.active; fetched != 0 {
+		c.spriteFetched(fetched)
+	}
+}
+
+// startSpriteDMA turns on the DMA of the enabled sprites starting in the next line
+func (c *C64) startSpriteDMA() {
+	enabled := c.vicRegisters[vicSpriteEnable] &^ c.dma.active
+	for sprite := 0; enabled != 0; sprite++ {
+		bit := uint8(1) << sprite
+		if enabled&bit == 0 {
+			continue
+		}
+		enabled &^= bit
+		if c.vicRegisters[vicSpriteY+2*sprite] != byte(c.rasterLine) {
+			continue
+		}
+		c.dma.sprites[sprite] = spriteLines
+		if c.vicRegisters[vicSpriteExpand]&bit != 0 {
+			// every line of an expanded sprite is read twice
+			c.dma.sprites[sprite] *= 2
+		}
+		c.dma.active |= bit
+	}
+}
+
+// spriteFetched counts down the lines of the sprites whose data was read in the current cycle
+func (c *C64) spriteFetched(sprites uint8) {
+	for sprite := 0; sprites != 0; sprite++ {
+		bit := uint8(1) << sprite
+		if sprites&bit == 0 {
+			continue
+		}
+		sprites &^= bit
+		c.dma.sprites[sprite]--
+		if c.dma.sprites[sprite] == 0 {
+			c.dma.active &^= bit
+		}
+	}
+}
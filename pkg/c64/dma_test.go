@@ -0,0 +1,119 @@
+package c64
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+// newDMAC64 returns a C64 running NOPs from $1000, the next cycle is the first one of the raster line
+func newDMAC64(line uint16, program ...byte) *C64 {
+	c := newTestC64()
+	for i := 0; i < 0x100; i++ {
+		c.Memory[0x1000+i] = 0xea
+	}
+	copy(c.Memory[0x1000:], program)
+	c.Mpu.SetPC(0x1000)
+	c.rasterLine, c.rasterCycle = line-1, cyclesPerLine-1
+	return c
+}
+
+// cyclesOf returns the number of cycles the given number of instructions took
+func cyclesOf(c *C64, instructions int) uint64 {
+	start := c.Cycles()
+	for i := 0; i < instructions; i++ {
+		c.Mpu.Step()
+	}
+	return c.Cycles() - start
+}
+
+func TestDMA(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Badlines", func() {
+		g.It("halt the MPU from cycle 12 to 54", func() {
+			c := newDMAC64(0x33)
+			c.vicRegisters[vicControl1] = 0x1b
+			c.dma.badlines = true
+			g.Assert(cyclesOf(c, 32)).Equal(uint64(64 + 43))
+		})
+
+		g.It("let the writes of the MPU pass", func() {
+			// 4 NOPs, INC $10 writes in the cycles 12 and 13
+			c := newDMAC64(0x33, 0xea, 0xea, 0xea, 0xea, 0xe6, 0x10)
+			c.vicRegisters[vicControl1] = 0x1b
+			c.dma.badlines = true
+			g.Assert(cyclesOf(c, 15)).Equal(uint64(8 + 5 + 20 + 41))
+		})
+
+		g.It("only occur if the line matches the vertical scroll", func() {
+			c := newDMAC64(0x34)
+			c.vicRegisters[vicControl1] = 0x1b
+			c.dma.badlines = true
+			g.Assert(cyclesOf(c, 32)).Equal(uint64(64))
+		})
+
+		g.It("start with a write of the vertical scroll inside the line", func() {
+			// 8 NOPs, LDA #$1c, STA $d011 writes in cycle 22, the MPU is halted from cycle 23 to 54
+			c := newDMAC64(0x34, 0xea, 0xea, 0xea, 0xea, 0xea, 0xea, 0xea, 0xea, 0xa9, 0x1c, 0x8d, 0x11, 0xd0)
+			c.vicRegisters[vicControl1] = 0x1b
+			c.dma.badlines = true
+			g.Assert(cyclesOf(c, 30)).Equal(uint64(16 + 2 + 4 + 40 + 32))
+		})
+
+		g.It("are cancelled by a write of the vertical scroll before cycle 12", func() {
+			// LDA #$1c, STA $d011 writes in cycle 6 and moves the badline to the next line like FLD
+			c := newDMAC64(0x33, 0xa9, 0x1c, 0x8d, 0x11, 0xd0)
+			c.vicRegisters[vicControl1] = 0x1b
+			c.dma.badlines = true
+			g.Assert(cyclesOf(c, 22)).Equal(uint64(2 + 4 + 40))
+		})
+
+		g.It("require the display to be enabled in line $30", func() {
+			c := newDMAC64(0x30)
+			c.vicRegisters[vicControl1] = 0x0b
+			g.Assert(cyclesOf(c, 32)).Equal(uint64(64))
+			g.Assert(c.dma.badlines).IsFalse()
+
+			c = newDMAC64(0x30)
+			c.vicRegisters[vicControl1] = 0x18
+			g.Assert(cyclesOf(c, 32)).Equal(uint64(64 + 43))
+			g.Assert(c.dma.badlines).IsTrue()
+		})
+	})
+
+	g.Describe("Sprite DMA", func() {
+		g.It("steals two cycles per sprite and three for BA", func() {
+			c := newDMAC64(0x80)
+			c.vicRegisters[vicSpriteEnable] = 0x01
+			c.vicRegisters[vicSpriteY] = 0x80
+			g.Assert(cyclesOf(c, 40)).Equal(uint64(80 + 5))
+
+			c = newDMAC64(0x80)
+			c.vicRegisters[vicSpriteEnable] = 0x03
+			c.vicRegisters[vicSpriteY] = 0x80
+			c.vicRegisters[vicSpriteY+2] = 0x80
+			g.Assert(cyclesOf(c, 40)).Equal(uint64(80 + 7))
+		})
+
+		g.It("reads the sprite data for 21 lines", func() {
+			c := newDMAC64(0x80)
+			c.vicRegisters[vicSpriteEnable] = 0x08
+			c.vicRegisters[vicSpriteY+6] = 0x80
+			// sprite 3 is read at the start of the 21 lines after the first one
+			c.RunUntil(c.Cycles() + 20*cyclesPerLine)
+			g.Assert(c.dma.active).Equal(uint8(0x08))
+			c.RunUntil(c.Cycles() + 2*cyclesPerLine)
+			g.Assert(c.dma.active).Equal(uint8(0))
+
+			c = newDMAC64(0x80)
+			c.vicRegisters[vicSpriteEnable] = 0x01
+			c.vicRegisters[vicSpriteExpand] = 0x01
+			c.vicRegisters[vicSpriteY] = 0x80
+			c.RunUntil(c.Cycles() + 41*cyclesPerLine)
+			g.Assert(c.dma.active).Equal(uint8(0x01))
+			c.RunUntil(c.Cycles() + cyclesPerLine)
+			g.Assert(c.dma.active).Equal(uint8(0))
+		})
+	})
+}
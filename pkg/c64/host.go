@@ -0,0 +1,52 @@
+package c64
+
+import "github.com/gentoomaniac/go64/pkg/host"
+
+// audio holds the samples of the current frame. The SID isn't emulated yet, so they are silent for now.
+type audio struct {
+	samples []int16
+	// fraction accumulates the parts of samples left over at the end of the frames
+	fraction int
+}
+
+// frameSamples returns the samples of a frame, the number varies to match host.AudioRate over time
+func (a *audio) frameSamples() []int16 {
+	a.fraction += host.AudioRate * CyclesPerFrame
+	count := a.fraction / ClockRate
+	a.fraction %= ClockRate
+	if cap(a.samples) < count {
+		a.samples = make([]int16, count)
+	}
+	return a.samples[:count]
+}
+
+// handleInput applies the input events of the host
+func (c *C64) handleInput() {
+	for _, event := range c.Host.Events() {
+		switch event.Type {
+		case host.KeyDown:
+			c.Keyboard.Press(event.Key)
+		case host.KeyUp:
+			c.Keyboard.Release(event.Key)
+		case host.AllKeysUp:
+			c.Keyboard.ReleaseAll()
+		}
+	}
+}
+
+// present passes the finished frame to the host and returns false if the host ends the emulation
+func (c *C64) present() bool {
+	if c.frame.Pixels == nil {
+		c.frame = host.Frame{
+			Pixels: make([]byte, ScreenWidth*ScreenHeight),
+			Width:  ScreenWidth,
+			Height: ScreenHeight,
+			Text:   &host.Text{},
+		}
+	}
+	c.renderScreen(c.frame.Pixels)
+	*c.frame.Text = c.Text()
+	c.Host.FrameReady(&c.frame)
+	c.Host.Samples(c.audio.frameSamples())
+	return c.Host.FrameDone()
+}
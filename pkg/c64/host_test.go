@@ -0,0 +1,63 @@
+package c64
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+
+	"github.com/gentoomaniac/go64/pkg/host"
+)
+
+// testHost presses a key in the first frame and ends the emulation after the given number of frames
+type testHost struct {
+	host.Headless
+	frames  int
+	samples int
+	stop    int
+	text    host.Text
+}
+
+func (h *testHost) FrameReady(frame *host.Frame) {
+	h.frames++
+	h.text = *frame.Text
+}
+
+func (h *testHost) Samples(samples []int16) { h.samples += len(samples) }
+
+func (h *testHost) Events() []host.Event {
+	if h.frames == 0 {
+		return []host.Event{{Type: host.KeyDown, Key: KeyA}, {Type: host.KeyDown, Key: KeyB}, {Type: host.KeyUp, Key: KeyB}}
+	}
+	return nil
+}
+
+func (h *testHost) FrameDone() bool { return h.frames < h.stop }
+
+func TestHost(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Host", func() {
+		g.It("gets the samples of the audio rate", func() {
+			a := &audio{}
+			samples := 0
+			for i := 0; i < 200; i++ {
+				samples += len(a.frameSamples())
+			}
+			g.Assert(samples).Equal(200 * host.AudioRate * CyclesPerFrame / ClockRate)
+		})
+
+		g.It("is driven by Run until it ends the emulation", func() {
+			c := newTestC64()
+			c.Speed().SetWarp(true)
+			h := &testHost{stop: 2}
+			c.Host = h
+			c.Run()
+
+			g.Assert(h.frames).Equal(2)
+			g.Assert(h.samples > 1700 && h.samples < 1800).IsTrue()
+			g.Assert(h.text).Equal(c.Text())
+			g.Assert(c.Keyboard.Pressed(KeyA)).IsTrue()
+			g.Assert(c.Keyboard.Pressed(KeyB)).IsFalse()
+		})
+	})
+}
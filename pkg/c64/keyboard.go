@@ -0,0 +1,149 @@
+package c64
+
+import (
+	"sync/atomic"
+
+	"github.com/gentoomaniac/go64/pkg/host"
+)
+
+// The keyboard is a matrix of 8 columns driven by port A of CIA1 and 8 rows read on port B. A pressed key
+// connects its column with its row, so the KERNAL sees the row pulled low while it drives the column low.
+// RESTORE isn't part of the matrix.
+// https://www.c64-wiki.com/wiki/Keyboard#Hardware
+
+// Key is a key of the keyboard matrix, bits 3 to 5 are the column and bits 0 to 2 the row
+type Key = host.Key
+
+const (
+	KeyDelete Key = iota
+	KeyReturn
+	KeyCursorRight
+	KeyF7
+	KeyF1
+	KeyF3
+	KeyF5
+	KeyCursorDown
+
+	Key3
+	KeyW
+	KeyA
+	Key4
+	KeyZ
+	KeyS
+	KeyE
+	KeyLeftShift
+
+	Key5
+	KeyR
+	KeyD
+	Key6
+	KeyC
+	KeyF
+	KeyT
+	KeyX
+
+	Key7
+	KeyY
+	KeyG
+	Key8
+	KeyB
+	KeyH
+	KeyU
+	KeyV
+
+	Key9
+	KeyI
+	KeyJ
+	Key0
+	KeyM
+	KeyK
+	KeyO
+	KeyN
+
+	KeyPlus
+	KeyP
+	KeyL
+	KeyMinus
+	KeyPeriod
+	KeyColon
+	KeyAt
+	KeyComma
+
+	KeyPound
+	KeyAsterisk
+	KeySemicolon
+	KeyHome
+	KeyRightShift
+	KeyEquals
+	KeyUpArrow
+	KeySlash
+
+	Key1
+	KeyLeftArrow
+	KeyControl
+	Key2
+	KeySpace
+	KeyCommodore
+	KeyQ
+	KeyRunStop
+)
+
+// Keyboard holds the pressed keys of the matrix, keys can be pressed and released from any goroutine
+type Keyboard struct {
+	// pressed has the bit column*8+row set for every pressed key
+	pressed atomic.Uint64
+}
+
+// Press holds the key down until it is released
+func (k *Keyboard) Press(key Key) {
+	k.update(func(pressed uint64) uint64 { return pressed | 1<<(key&0x3f) })
+}
+
+// Release lets the key go
+func (k *Keyboard) Release(key Key) {
+	k.update(func(pressed uint64) uint64 { return pressed &^ (1 << (key & 0x3f)) })
+}
+
+// ReleaseAll lets all keys go, e.g. when the window of a frontend loses the focus
+func (k *Keyboard) ReleaseAll() {
+	k.pressed.Store(0)
+}
+
+// Pressed returns true if the key is held down
+func (k *Keyboard) Pressed(key Key) bool {
+	return k.pressed.Load()&(1<<(key&0x3f)) != 0
+}
+
+func (k *Keyboard) update(change func(uint64) uint64) {
+	for {
+		pressed := k.pressed.Load()
+		if k.pressed.CompareAndSwap(pressed, change(pressed)) {
+			return
+		}
+	}
+}
+
+// rows returns the rows connected to the given columns by pressed keys
+func (k *Keyboard) rows(columns byte) byte {
+	pressed := k.pressed.Load()
+	var rows byte
+	for column := 0; column < 8; column++ {
+		if columns&(1<<column) != 0 {
+			rows |= byte(pressed >> (column * 8))
+		}
+	}
+	return rows
+}
+
+// columns returns the columns connected to the given rows by pressed keys, programs scanning the keyboard
+// backwards drive the rows with port B
+func (k *Keyboard) columns(rows byte) byte {
+	pressed := k.pressed.Load()
+	var columns byte
+	for column := 0; column < 8; column++ {
+		if byte(pressed>>(column*8))&rows != 0 {
+			columns |= 1 << column
+		}
+	}
+	return columns
+}
@@ -0,0 +1,50 @@
+package c64
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestKeyboard(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Keyboard", func() {
+		g.It("connects the columns of port A with the rows of port B", func() {
+			c := newTestC64()
+			c.Set(0xdc02, 0xff)
+			c.Set(0xdc03, 0x00)
+			c.Keyboard.Press(KeyA)
+			c.Keyboard.Press(KeyRunStop)
+
+			c.Set(0xdc00, 0x00)
+			g.Assert(c.Get(0xdc01)).Equal(uint8(0x7b))
+			c.Set(0xdc00, 0xfd)
+			g.Assert(c.Get(0xdc01)).Equal(uint8(0xfb))
+			c.Set(0xdc00, 0x7f)
+			g.Assert(c.Get(0xdc01)).Equal(uint8(0x7f))
+			c.Set(0xdc00, 0xfe)
+			g.Assert(c.Get(0xdc01)).Equal(uint8(0xff))
+
+			c.Keyboard.Release(KeyRunStop)
+			c.Set(0xdc00, 0x7f)
+			g.Assert(c.Get(0xdc01)).Equal(uint8(0xff))
+			g.Assert(c.Keyboard.Pressed(KeyA)).IsTrue()
+			c.Keyboard.ReleaseAll()
+			g.Assert(c.Keyboard.Pressed(KeyA)).IsFalse()
+		})
+
+		g.It("connects the rows of port B with the columns of port A", func() {
+			c := newTestC64()
+			c.Set(0xdc02, 0x00)
+			c.Set(0xdc03, 0xff)
+			c.Keyboard.Press(KeyA)
+
+			c.Set(0xdc01, 0xfb)
+			g.Assert(c.Get(0xdc00)).Equal(uint8(0xfd))
+			c.Set(0xdc01, 0xfd)
+			g.Assert(c.Get(0xdc00)).Equal(uint8(0xff))
+		})
+	})
+
+}
@@ -0,0 +1,170 @@
+package c64
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/gentoomaniac/go64/pkg/tape"
+)
+
+// KERNAL and BASIC addresses used to load programs without emulating the slow original routines
+// http://unusedino.de/ec64/technical/aay/c64/romindex.htm
+const (
+	// kernalLoad is the LOAD routine behind the ILOAD vector at $0330
+	kernalLoad uint16 = 0xf4a5
+	// kernalLoadDone returns from LOAD with the end address in X/Y
+	kernalLoadDone uint16 = 0xf5a9
+	// kernalFileNotFound returns from LOAD with error 4
+	kernalFileNotFound uint16 = 0xf704
+	// kernalWaitForKey is the loop of the screen editor waiting for key presses
+	kernalWaitForKey uint16 = 0xe5cd
+
+	basicStart    uint16 = 0x0801
+	keyboardQueue uint16 = 0x0277
+)
+
+// zero page locations of the KERNAL and BASIC
+const (
+	zpVarTab     uint16 = 0x2d
+	zpAryTab     uint16 = 0x2f
+	zpStrEnd     uint16 = 0x31
+	zpStatus     uint16 = 0x90
+	zpVerify     uint16 = 0x93
+	zpEndAddress uint16 = 0xae
+	zpNameLength uint16 = 0xb7
+	zpSecondary  uint16 = 0xb9
+	zpDevice     uint16 = 0xba
+	zpName       uint16 = 0xbb
+	zpLoadAddr   uint16 = 0xc3
+	zpKeyCount   uint16 = 0xc6
+)
+
+func (c *C64) getWord(addr uint16) uint16 {
+	return uint16(c.Get(addr)) | uint16(c.Get(addr+1))<<8
+}
+
+func (c *C64) setWord(addr uint16, value uint16) {
+	c.Set(addr, byte(value))
+	c.Set(addr+1, byte(value>>8))
+}
+
+// LoadPRG copies a PRG file into the RAM and returns the address behind the last byte. Programs loaded to the
+// start of BASIC get their variable pointers set like after a LOAD command.
+func (c *C64) LoadPRG(prg []byte) (uint16, error) {
+	if len(prg) < 2 {
+		return 0, fmt.Errorf("PRG file too short")
+	}
+	start := binary.LittleEndian.Uint16(prg)
+	if !fitsIntoMemory(start, prg) {
+		return 0, fmt.Errorf("PRG file doesn't fit into memory")
+	}
+
+	copy(c.Memory[start:], prg[2:])
+	end := start + uint16(len(prg)-2)
+	if start == basicStart {
+		c.setWord(zpVarTab, end)
+		c.setWord(zpAryTab, end)
+		c.setWord(zpStrEnd, end)
+	}
+	c.setWord(zpEndAddress, end)
+
+	return end, nil
+}
+
+// fitsIntoMemory returns true if the PRG file loaded to start doesn't wrap around, the end address behind the last
+// byte has to fit into 16 bits as well
+func fitsIntoMemory(start uint16, prg []byte) bool {
+	return int(start)+len(prg)-2 <= 0xffff
+}
+
+// Autostart loads a PRG or the first file of a T64 image once the KERNAL is ready for input and runs it if it
+// is a BASIC program
+func (c *C64) Autostart(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	prg := data
+	if archive, err := tape.ParseT64(data); err == nil {
+		if len(archive.Entries) == 0 {
+			return fmt.Errorf("%s: T64 image is empty", path)
+		}
+		prg = archive.PRG(&archive.Entries[0])
+	}
+	if len(prg) < 2 {
+		return fmt.Errorf("%s: PRG file too short", path)
+	}
+	// LoadPRG can't fail any more once the trap is installed
+	if !fitsIntoMemory(binary.LittleEndian.Uint16(prg), prg) {
+		return fmt.Errorf("%s: PRG file doesn't fit into memory", path)
+	}
+
+	c.Mpu.SetTrap(kernalWaitForKey, func() bool {
+		c.Mpu.RemoveTrap(kernalWaitForKey)
+		c.LoadPRG(prg)
+		if binary.LittleEndian.Uint16(prg) == basicStart {
+			c.typeKeys("RUN\r")
+		}
+		return false
+	})
+	return nil
+}
+
+// typeKeys puts up to 10 PETSCII characters into the keyboard queue of the KERNAL
+func (c *C64) typeKeys(keys string) {
+	for i := 0; i < len(keys) && i < 10; i++ {
+		c.Set(keyboardQueue+uint16(i), keys[i])
+	}
+	c.Set(zpKeyCount, byte(len(keys)))
+}
+
+// trapTapeLoad replaces the KERNAL LOAD for the datasette (device 1) while a T64 image is inserted
+func (c *C64) trapTapeLoad() bool {
+	if c.Get(zpDevice) != 1 || c.tapeArchive == nil {
+		return false
+	}
+
+	verify := c.Mpu.A() != 0
+	c.Set(zpVerify, c.Mpu.A())
+	name := make([]byte, c.Get(zpNameLength))
+	for i := range name {
+		name[i] = c.Get(c.getWord(zpName) + uint16(i))
+	}
+
+	entry, ok := c.tapeArchive.Find(string(name))
+	if !ok {
+		c.Mpu.SetPC(kernalFileNotFound)
+		return true
+	}
+
+	// secondary address 0 loads to the address given to LOAD, usually the start of BASIC
+	prg := c.tapeArchive.PRG(entry)
+	addr := entry.StartAddress
+	if c.Get(zpSecondary) == 0 {
+		addr = c.getWord(zpLoadAddr)
+	}
+
+	// a file wrapping around past $ffff ends the load with a read error instead of overwriting the zero page
+	if !fitsIntoMemory(addr, prg) {
+		c.Set(zpStatus, 0x10)
+		c.setWord(zpEndAddress, addr)
+		c.Mpu.SetPC(kernalLoadDone)
+		return true
+	}
+
+	status := byte(0)
+	for _, value := range prg[2:] {
+		if !verify {
+			c.Set(addr, value)
+		} else if c.Get(addr) != value {
+			status |= 0x10
+		}
+		addr++
+	}
+	c.Set(zpStatus, status)
+	c.setWord(zpEndAddress, addr)
+	c.Mpu.SetPC(kernalLoadDone)
+	return true
+}
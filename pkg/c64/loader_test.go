@@ -0,0 +1,140 @@
+package c64
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/tape"
+)
+
+// newTestArchive returns a T64 image with one BASIC program and one machine code file
+func newTestArchive() *tape.T64 {
+	image := make([]byte, 0x80)
+	copy(image, "C64 tape image file")
+	binary.LittleEndian.PutUint16(image[0x22:], 2)
+	binary.LittleEndian.PutUint16(image[0x24:], 2)
+	for i, entry := range []struct {
+		name  string
+		start uint16
+	}{{"BASIC", 0x0801}, {"CODE", 0xc000}} {
+		raw := image[0x40+i*0x20 : 0x60+i*0x20]
+		raw[0] = tape.EntryNormal
+		raw[1] = 0x82
+		binary.LittleEndian.PutUint16(raw[2:], entry.start)
+		binary.LittleEndian.PutUint16(raw[4:], entry.start+4)
+		binary.LittleEndian.PutUint32(raw[8:], uint32(0x80+i*4))
+		copy(raw[0x10:], entry.name)
+	}
+	image = append(image, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88)
+
+	archive, _ := tape.ParseT64(image)
+	return archive
+}
+
+// setLoadParameters sets up the zero page like SETLFS and SETNAM
+func setLoadParameters(c *C64, device byte, secondary byte, name string) {
+	copy(c.Memory[0x0200:], name)
+	c.Memory[zpNameLength] = byte(len(name))
+	c.setWord(zpName, 0x0200)
+	c.Memory[zpDevice] = device
+	c.Memory[zpSecondary] = secondary
+	c.setWord(zpLoadAddr, basicStart)
+	c.Mpu.SetA(0)
+}
+
+func TestLoader(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("PRG loader", func() {
+		g.It("sets the BASIC pointers for BASIC programs", func() {
+			c := newTestC64()
+			end, err := c.LoadPRG([]byte{0x01, 0x08, 0xaa, 0xbb, 0xcc})
+			g.Assert(err).IsNil()
+			g.Assert(end).Equal(uint16(0x0804))
+			g.Assert(c.Memory[0x0801:0x0804]).Equal([]byte{0xaa, 0xbb, 0xcc})
+			g.Assert(c.getWord(zpVarTab)).Equal(uint16(0x0804))
+			g.Assert(c.getWord(zpStrEnd)).Equal(uint16(0x0804))
+		})
+
+		g.It("rejects programs not fitting into memory", func() {
+			c := newTestC64()
+			_, err := c.LoadPRG([]byte{0xff, 0xff, 0x01, 0x02})
+			g.Assert(err != nil).IsTrue()
+			_, err = c.LoadPRG([]byte{0xfe, 0xff, 0x01, 0x02})
+			g.Assert(err != nil).IsTrue()
+
+			end, err := c.LoadPRG([]byte{0xfe, 0xff, 0x01})
+			g.Assert(err).IsNil()
+			g.Assert(end).Equal(uint16(0xffff))
+		})
+
+		g.It("rejects autostarting programs not fitting into memory", func() {
+			c := newTestC64()
+			path := filepath.Join(t.TempDir(), "wrap.prg")
+			g.Assert(os.WriteFile(path, []byte{0xfe, 0xff, 0x01, 0x02}, 0o644)).IsNil()
+			g.Assert(c.Autostart(path) != nil).IsTrue()
+		})
+	})
+
+	g.Describe("KERNAL tape trap", func() {
+		g.It("loads files from the T64 image", func() {
+			c := newTestC64()
+			c.tapeArchive = newTestArchive()
+			setLoadParameters(c, 1, 0, "CODE")
+
+			g.Assert(c.trapTapeLoad()).IsTrue()
+			g.Assert(c.Mpu.PC()).Equal(kernalLoadDone)
+			g.Assert(c.Memory[0x0801:0x0805]).Equal([]byte{0x55, 0x66, 0x77, 0x88})
+			g.Assert(c.getWord(zpEndAddress)).Equal(uint16(0x0805))
+		})
+
+		g.It("loads to the address of the file with a secondary address", func() {
+			c := newTestC64()
+			c.tapeArchive = newTestArchive()
+			setLoadParameters(c, 1, 1, "")
+
+			g.Assert(c.trapTapeLoad()).IsTrue()
+			g.Assert(c.Memory[0x0801:0x0805]).Equal([]byte{0x11, 0x22, 0x33, 0x44})
+			setLoadParameters(c, 1, 1, "C*")
+			g.Assert(c.trapTapeLoad()).IsTrue()
+			g.Assert(c.Memory[0xc000:0xc004]).Equal([]byte{0x55, 0x66, 0x77, 0x88})
+		})
+
+		g.It("reports a read error for files wrapping around", func() {
+			c := newTestC64()
+			c.tapeArchive = newTestArchive()
+			setLoadParameters(c, 1, 0, "CODE")
+			c.setWord(zpLoadAddr, 0xfffe)
+			c.Memory[0x0000] = 0x2f
+
+			g.Assert(c.trapTapeLoad()).IsTrue()
+			g.Assert(c.Mpu.PC()).Equal(kernalLoadDone)
+			g.Assert(c.Memory[zpStatus]).Equal(uint8(0x10))
+			g.Assert(c.Memory[0xfffe:]).Equal([]byte{0x00, 0x00})
+			g.Assert(c.Memory[0x0000]).Equal(uint8(0x2f))
+		})
+
+		g.It("reports missing files", func() {
+			c := newTestC64()
+			c.tapeArchive = newTestArchive()
+			setLoadParameters(c, 1, 0, "MISSING")
+
+			g.Assert(c.trapTapeLoad()).IsTrue()
+			g.Assert(c.Mpu.PC()).Equal(kernalFileNotFound)
+		})
+
+		g.It("leaves other devices to the KERNAL", func() {
+			c := newTestC64()
+			c.tapeArchive = newTestArchive()
+			setLoadParameters(c, 8, 0, "CODE")
+			g.Assert(c.trapTapeLoad()).IsFalse()
+
+			c.tapeArchive = nil
+			setLoadParameters(c, 1, 0, "CODE")
+			g.Assert(c.trapTapeLoad()).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,23 @@
+package c64
+
+import "github.com/gentoomaniac/go64/pkg/cyclelock"
+
+// cycleLock advances the rest of the system whenever the MPU enters a cycle, so that it runs in lockstep with
+// the MPU on the goroutine of the emulation without handing over to other goroutines
+type cycleLock struct {
+	cyclelock.AlwaysOpenLock
+	c64 *C64
+}
+
+// EnterCycle advances the rest of the system by one cycle. While the REU is transferring data the MPU is
+// halted, the DMA uses the cycles until the transfer is done.
+func (l *cycleLock) EnterCycle() {
+	l.AlwaysOpenLock.EnterCycle()
+	l.c64.tick()
+
+	for l.c64.REU != nil && l.c64.REU.Active() {
+		l.c64.REU.Cycle()
+		l.AlwaysOpenLock.EnterCycle()
+		l.c64.tick()
+	}
+}
@@ -0,0 +1,123 @@
+package c64
+
+import (
+	"image/color"
+
+	"github.com/gentoomaniac/go64/pkg/host"
+)
+
+// The VIC-II isn't emulated yet, so the screen is rendered from the video matrix in the standard character
+// mode whenever it is requested, e.g. by the remote monitor. Bitmap and multicolor modes aren't shown.
+
+const (
+	// ScreenWidth and ScreenHeight are the size of the rendered screen including the border
+	ScreenWidth  = 384
+	ScreenHeight = 272
+	// DisplayLeft and DisplayTop are the position of the 320x200 display window inside the border
+	DisplayLeft   = 32
+	DisplayTop    = 36
+	DisplayWidth  = 320
+	DisplayHeight = 200
+)
+
+// Palette holds the colors of the VIC-II as measured by Philip Timmermann (pepto)
+var Palette = [16]color.RGBA{
+	{0x00, 0x00, 0x00, 0xff}, // black
+	{0xff, 0xff, 0xff, 0xff}, // white
+	{0x68, 0x37, 0x2b, 0xff}, // red
+	{0x70, 0xa4, 0xb2, 0xff}, // cyan
+	{0x6f, 0x3d, 0x86, 0xff}, // purple
+	{0x58, 0x8d, 0x43, 0xff}, // green
+	{0x35, 0x28, 0x79, 0xff}, // blue
+	{0xb8, 0xc7, 0x6f, 0xff}, // yellow
+	{0x6f, 0x4f, 0x25, 0xff}, // orange
+	{0x43, 0x39, 0x00, 0xff}, // brown
+	{0x9a, 0x67, 0x59, 0xff}, // light red
+	{0x44, 0x44, 0x44, 0xff}, // dark grey
+	{0x6c, 0x6c, 0x6c, 0xff}, // grey
+	{0x9a, 0xd2, 0x84, 0xff}, // light green
+	{0x6c, 0x5e, 0xb5, 0xff}, // light blue
+	{0x95, 0x95, 0x95, 0xff}, // light grey
+}
+
+// VIC-II registers used to render the screen
+const (
+	vicControl1   = 0x11
+	vicMemory     = 0x18
+	vicBorder     = 0x20
+	vicBackground = 0x21
+
+	// displayEnable blanks the screen with the border color if it is cleared
+	displayEnable byte = 0x10
+)
+
+// Screen renders the screen, every byte holds the index of a color in the VIC-II palette
+func (c *C64) Screen() []byte {
+	pixels := make([]byte, ScreenWidth*ScreenHeight)
+	c.renderScreen(pixels)
+	return pixels
+}
+
+// renderScreen renders the screen into the pixels of the size ScreenWidth*ScreenHeight
+func (c *C64) renderScreen(pixels []byte) {
+	border := c.vicRegisters[vicBorder] & 0x0f
+	for i := range pixels {
+		pixels[i] = border
+	}
+	if c.vicRegisters[vicControl1]&displayEnable == 0 {
+		return
+	}
+
+	matrix, charset := c.videoMemory()
+	background := c.vicRegisters[vicBackground] & 0x0f
+
+	for row := 0; row < host.TextRows; row++ {
+		for column := 0; column < host.TextColumns; column++ {
+			offset := row*host.TextColumns + column
+			code := uint16(c.vicRead(matrix + uint16(offset)))
+			color := c.ColorRAM[offset] & 0x0f
+			for line := 0; line < 8; line++ {
+				bits := c.vicRead(charset + code*8 + uint16(line))
+				start := (DisplayTop+row*8+line)*ScreenWidth + DisplayLeft + column*8
+				for x := 0; x < 8; x++ {
+					if bits&(0x80>>x) != 0 {
+						pixels[start+x] = color
+					} else {
+						pixels[start+x] = background
+					}
+				}
+			}
+		}
+	}
+}
+
+// Text returns the text screen from the video matrix and the color RAM
+func (c *C64) Text() host.Text {
+	text := host.Text{
+		Border:     c.vicRegisters[vicBorder] & 0x0f,
+		Background: c.vicRegisters[vicBackground] & 0x0f,
+		Blank:      c.vicRegisters[vicControl1]&displayEnable == 0,
+	}
+	matrix, charset := c.videoMemory()
+	for offset := range text.Codes {
+		text.Codes[offset] = c.vicRead(matrix + uint16(offset))
+		text.Colors[offset] = c.ColorRAM[offset] & 0x0f
+	}
+	text.Lowercase = charset&0x7800 == 0x1800
+	return text
+}
+
+// videoMemory returns the addresses of the video matrix and the character set selected by $d018
+func (c *C64) videoMemory() (matrix uint16, charset uint16) {
+	// the VIC-II bank is selected by the inverted PA0 and PA1 of CIA2
+	bank := uint16(^c.CIA2.OutputA()&0x03) << 14
+	return bank | uint16(c.vicRegisters[vicMemory]&0xf0)<<6, bank | uint16(c.vicRegisters[vicMemory]&0x0e)<<10
+}
+
+// vicRead reads from the address space of the VIC-II, the character ROM appears at $1000 in the banks 0 and 2
+func (c *C64) vicRead(addr uint16) byte {
+	if addr&0x7000 == 0x1000 {
+		return c.CharacterRom[addr&0x0fff]
+	}
+	return c.Memory[addr]
+}
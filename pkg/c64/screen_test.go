@@ -0,0 +1,78 @@
+package c64
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestScreen(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Screen", func() {
+		g.It("shows only the border while the display is disabled", func() {
+			c := newTestC64()
+			c.Set(0xd020, 0x0e)
+			screen := c.Screen()
+			g.Assert(len(screen)).Equal(ScreenWidth * ScreenHeight)
+			g.Assert(screen[ScreenWidth*ScreenHeight/2+ScreenWidth/2]).Equal(byte(0x0e))
+		})
+
+		g.It("renders characters from the video matrix", func() {
+			c := newTestC64()
+			// the KERNAL defaults: screen at $0400 and the character ROM at $1000
+			c.Set(0xd011, 0x1b)
+			c.Set(0xd018, 0x14)
+			c.Set(0xd020, 0x0e)
+			c.Set(0xd021, 0x06)
+			c.CharacterRom[8*1] = 0x81
+			c.Memory[0x0400+41] = 0x01
+			c.ColorRAM[41] = 0x01
+
+			screen := c.Screen()
+			top := (DisplayTop+8)*ScreenWidth + DisplayLeft + 8
+			g.Assert(screen[top-1]).Equal(byte(0x06))
+			g.Assert(screen[top : top+8]).Equal([]byte{1, 6, 6, 6, 6, 6, 6, 1})
+			g.Assert(screen[top+ScreenWidth]).Equal(byte(0x06))
+			g.Assert(screen[DisplayLeft-1]).Equal(byte(0x0e))
+		})
+
+		g.It("reads the video matrix from the selected bank", func() {
+			c := newTestC64()
+			c.Set(0xd011, 0x1b)
+			c.Set(0xd018, 0x02)
+			c.CIA2.Write(0xdd02, 0x03)
+			c.CIA2.Write(0xdd00, 0x00)
+			c.Memory[0xc000] = 0x01
+			c.Memory[0xc800+8] = 0xff
+			c.ColorRAM[0] = 0x05
+
+			screen := c.Screen()
+			top := DisplayTop*ScreenWidth + DisplayLeft
+			g.Assert(screen[top : top+8]).Equal([]byte{5, 5, 5, 5, 5, 5, 5, 5})
+		})
+
+		g.It("returns the text screen", func() {
+			c := newTestC64()
+			c.Set(0xd011, 0x1b)
+			c.Set(0xd018, 0x16)
+			c.Set(0xd020, 0x0e)
+			c.Set(0xd021, 0x06)
+			c.Memory[0x0400+40] = 0x12
+			c.ColorRAM[40] = 0x0d
+
+			text := c.Text()
+			g.Assert(text.Codes[40]).Equal(byte(0x12))
+			g.Assert(text.Colors[40]).Equal(byte(0x0d))
+			g.Assert(text.Border).Equal(byte(0x0e))
+			g.Assert(text.Background).Equal(byte(0x06))
+			g.Assert(text.Lowercase).IsTrue()
+			g.Assert(text.Blank).IsFalse()
+
+			c.Set(0xd018, 0x14)
+			g.Assert(c.Text().Lowercase).IsFalse()
+			c.Set(0xd011, 0x0b)
+			g.Assert(c.Text().Blank).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,195 @@
+package c64
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gentoomaniac/go64/pkg/cartridge"
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+// SnapshotVersion is the version of the snapshot format, snapshots of other versions are rejected
+const SnapshotVersion uint16 = 3
+
+// module names of the snapshot, the drives are stored as DRIVE followed by their device number
+const (
+	moduleC64       = "C64"
+	moduleMPU       = "MPU"
+	moduleCIA1      = "CIA1"
+	moduleCIA2      = "CIA2"
+	moduleIEC       = "IEC"
+	moduleDatasette = "DATASETTE"
+	moduleREU       = "REU"
+	moduleCartridge = "CARTRIDGE"
+	moduleDrive     = "DRIVE"
+)
+
+// state saves or restores the memory and the parts of the system without their own module
+func (c *C64) state(s *snapshot.State) {
+	s.Bytes(c.Memory[:])
+	s.Bytes(c.ColorRAM[:])
+	s.Byte(&c.port.ddr)
+	s.Byte(&c.port.data)
+	// the TOD clock is stored as the cycles since its last tick
+	cycles := c.Cycles()
+	todClock := todPeriod - int(c.todEvent.Cycle()-cycles)
+	s.Uint64(&cycles)
+	s.Int(&todClock)
+	s.Bytes(c.vicRegisters[:])
+	s.Bytes(c.sidRegisters[:])
+	s.Int(&c.rasterCycle)
+	s.Uint16(&c.rasterLine)
+	s.Bool(&c.dma.badlines)
+	for i := range c.dma.sprites {
+		s.Int(&c.dma.sprites[i])
+	}
+	s.Int(&c.driveClock)
+
+	if !s.Loading() {
+		return
+	}
+	if c.rasterCycle >= cyclesPerLine || c.rasterLine >= linesPerFrame {
+		s.Fail(fmt.Errorf("invalid raster position %d/%d", c.rasterLine, c.rasterCycle))
+	}
+	if todClock < 0 || todClock >= todPeriod {
+		s.Fail(fmt.Errorf("invalid TOD clock %d", todClock))
+		return
+	}
+	c.dma.active = 0
+	for sprite, lines := range c.dma.sprites {
+		if lines < 0 || lines > 2*spriteLines {
+			s.Fail(fmt.Errorf("invalid sprite DMA %d", lines))
+			return
+		}
+		if lines > 0 {
+			c.dma.active |= 1 << sprite
+		}
+	}
+	c.dma.badline = c.badline()
+	c.scheduler.SetCycle(cycles)
+	c.scheduleTOD(todPeriod - todClock)
+}
+
+// SaveSnapshot writes the state of the whole machine including the cartridge, the REU and the drives. The
+// ROMs are not stored. The emulation must not be running and the MPU has to be between two instructions.
+func (c *C64) SaveSnapshot(w io.Writer) error {
+	sw := snapshot.NewWriter(w, SnapshotVersion)
+	sw.Module(moduleC64, c.state)
+	sw.Module(moduleMPU, c.Mpu.State)
+	sw.Module(moduleCIA1, c.CIA1.State)
+	sw.Module(moduleCIA2, c.CIA2.State)
+	sw.Module(moduleIEC, c.IEC.State)
+	sw.Module(moduleDatasette, c.Datasette.State)
+
+	if c.REU != nil {
+		sw.Module(moduleREU, func(s *snapshot.State) {
+			size := uint32(c.REU.Size())
+			s.Uint32(&size)
+			c.REU.State(s)
+		})
+	}
+	if c.Cartridge != nil {
+		sw.Module(moduleCartridge, func(s *snapshot.State) {
+			if err := cartridge.SaveState(c.Cartridge, s); err != nil {
+				s.Fail(err)
+			}
+		})
+	}
+	for _, d := range c.Drives {
+		sw.Module(moduleDrive+strconv.Itoa(d.Device), d.State)
+	}
+
+	return sw.Err()
+}
+
+// LoadSnapshot restores the state written by SaveSnapshot. Cartridge and REU are replaced by the ones of the
+// snapshot, the drives of the snapshot have to be attached already. If loading fails the state of the machine
+// is undefined.
+func (c *C64) LoadSnapshot(r io.Reader) error {
+	snap, err := snapshot.Read(r)
+	if err != nil {
+		return err
+	}
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d, expected %d", snap.Version, SnapshotVersion)
+	}
+
+	if err := c.checkDrives(snap); err != nil {
+		return err
+	}
+
+	modules := map[string]func(s *snapshot.State){
+		moduleC64:       c.state,
+		moduleMPU:       c.Mpu.State,
+		moduleCIA1:      c.CIA1.State,
+		moduleCIA2:      c.CIA2.State,
+		moduleIEC:       c.IEC.State,
+		moduleDatasette: c.Datasette.State,
+	}
+	for _, d := range c.Drives {
+		modules[moduleDrive+strconv.Itoa(d.Device)] = d.State
+	}
+	for name, load := range modules {
+		if err := snap.Load(name, load); err != nil {
+			return err
+		}
+	}
+
+	c.REU = nil
+	if snap.Has(moduleREU) {
+		err := snap.Load(moduleREU, func(s *snapshot.State) {
+			var size uint32
+			s.Uint32(&size)
+			if s.Err() != nil {
+				return
+			}
+			if err := c.AttachREU(int(size)); err != nil {
+				s.Fail(err)
+				return
+			}
+			c.REU.State(s)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.Cartridge = nil
+	if snap.Has(moduleCartridge) {
+		err := snap.Load(moduleCartridge, func(s *snapshot.State) {
+			cart, err := cartridge.LoadState(s)
+			if err != nil {
+				s.Fail(err)
+				return
+			}
+			c.Cartridge = cart
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.restored, c.drivesRestored = true, true
+	return nil
+}
+
+// checkDrives makes sure the snapshot contains exactly the attached drives
+func (c *C64) checkDrives(snap *snapshot.Snapshot) error {
+	for _, name := range snap.Modules {
+		if !strings.HasPrefix(name, moduleDrive) {
+			continue
+		}
+		device, err := strconv.Atoi(strings.TrimPrefix(name, moduleDrive))
+		if err != nil || c.drive(device) == nil {
+			return fmt.Errorf("snapshot contains %s, but no such drive is attached", name)
+		}
+	}
+	for _, d := range c.Drives {
+		if !snap.Has(moduleDrive + strconv.Itoa(d.Device)) {
+			return fmt.Errorf("drive %d is not part of the snapshot", d.Device)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package c64
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/cartridge"
+	"github.com/gentoomaniac/go64/pkg/disk"
+	"github.com/gentoomaniac/go64/pkg/drive"
+	"github.com/gentoomaniac/go64/pkg/reu"
+)
+
+// newSnapshotC64 returns a C64 running a loop which mixes the CIA1 timer into memory while a timer IRQ counts
+// in $0400
+func newSnapshotC64() *C64 {
+	c := newTestC64()
+	c.KernalRom[0x1ffe], c.KernalRom[0x1fff] = 0x00, 0x20
+	copy(c.Memory[0x1000:], []byte{
+		0x58,             // CLI
+		0xe8,             // INX
+		0xad, 0x04, 0xdc, // LDA $DC04
+		0x6d, 0x00, 0x04, // ADC $0400
+		0x9d, 0x00, 0x05, // STA $0500,X
+		0x4c, 0x01, 0x10, // JMP $1001
+	})
+	copy(c.Memory[0x2000:], []byte{
+		0xee, 0x00, 0x04, // INC $0400
+		0xad, 0x0d, 0xdc, // LDA $DC0D
+		0x40, // RTI
+	})
+	c.Mpu.SetPC(0x1000)
+	return c
+}
+
+// runTrace runs the given number of instructions and records the registers after each of them
+func runTrace(c *C64, instructions int) []string {
+	var result []string
+	for i := 0; i < instructions; i++ {
+		c.Mpu.Step()
+		result = append(result, fmt.Sprintf("%04x %02x %02x %02x %02x %02x %d",
+			c.Mpu.PC(), c.Mpu.A(), c.Mpu.X(), c.Mpu.Y(), c.Mpu.P(), c.Mpu.S(), c.Cycles()))
+	}
+	return result
+}
+
+func TestSnapshot(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Snapshot", func() {
+		g.It("continues with identical execution after loading", func() {
+			c := newSnapshotC64()
+			c.Set(0xdc04, 0x40)
+			c.Set(0xdc05, 0x00)
+			c.Set(0xdc0d, 0x81)
+			c.Set(0xdc0e, 0x11)
+			runTrace(c, 1000)
+
+			var buffer bytes.Buffer
+			g.Assert(c.SaveSnapshot(&buffer)).IsNil()
+			expected := runTrace(c, 2000)
+
+			restored := newSnapshotC64()
+			g.Assert(restored.LoadSnapshot(&buffer)).IsNil()
+			g.Assert(runTrace(restored, 2000)).Equal(expected)
+			g.Assert(restored.Memory).Equal(c.Memory)
+			g.Assert(restored.Memory[0x0400] > 0).IsTrue()
+		})
+
+		g.It("restores the REU and the cartridge", func() {
+			c := newSnapshotC64()
+			g.Assert(c.AttachREU(reu.Size1764)).IsNil()
+			c.REU.RAM()[0x30000] = 0x42
+			c.Set(0xdf02, 0x34)
+			crt := &cartridge.CRT{HardwareType: cartridge.TypeOcean, EXROM: 0, GAME: 0}
+			for bank := uint16(0); bank < 2; bank++ {
+				data := make([]byte, cartridge.BankSize)
+				data[0] = byte(0x10 + bank)
+				crt.Chips = append(crt.Chips, cartridge.Chip{Bank: bank, LoadAddress: 0x8000, Data: data})
+			}
+			c.Cartridge, _ = cartridge.New(crt)
+			c.Set(0xde00, 0x01)
+
+			var buffer bytes.Buffer
+			g.Assert(c.SaveSnapshot(&buffer)).IsNil()
+
+			restored := newSnapshotC64()
+			g.Assert(restored.LoadSnapshot(&buffer)).IsNil()
+			g.Assert(restored.REU.Size()).Equal(reu.Size1764)
+			g.Assert(restored.REU.RAM()[0x30000]).Equal(uint8(0x42))
+			g.Assert(restored.Get(0xdf02)).Equal(uint8(0x34))
+			g.Assert(restored.Get(0x8000)).Equal(uint8(0x11))
+		})
+
+		g.It("restores the drives with their disks", func() {
+			attach := func(c *C64) *drive.Drive1541 {
+				d := &drive.Drive1541{}
+				d.Init(8, make([]byte, drive.ROMSize), &c.IEC)
+				c.Drives = append(c.Drives, d)
+				return d
+			}
+			// driveTrace runs the C64 and the drive and records the drive registers after each C64 instruction
+			driveTrace := func(c *C64, d *drive.Drive1541, instructions int) []string {
+				var result []string
+				for i := 0; i < instructions; i++ {
+					c.Mpu.Step()
+					result = append(result, fmt.Sprintf("%04x %02x %02x %02x", d.Mpu.PC(), d.Mpu.A(), d.Mpu.X(), d.Mpu.P()))
+				}
+				return result
+			}
+
+			c := newSnapshotC64()
+			d := attach(c)
+			image, _ := disk.ParseD64(make([]byte, 683*disk.SectorSize))
+			d.InsertDisk(disk.FromD64(image))
+			// mix the free running timer 1 of VIA1 into the drive RAM
+			copy(d.RAM[0x0300:], []byte{
+				0xad, 0x04, 0x18, // LDA $1804
+				0x65, 0x10, // ADC $10
+				0x85, 0x10, // STA $10
+				0x9d, 0x00, 0x04, // STA $0400,X
+				0xe8,             // INX
+				0x4c, 0x00, 0x03, // JMP $0300
+			})
+			d.Set(0x180b, 0x40)
+			d.Set(0x1804, 0x37)
+			d.Set(0x1805, 0x01)
+			d.Mpu.SetPC(0x0300)
+			driveTrace(c, d, 1000)
+			// save in the middle of a drive instruction
+			for d.Mpu.InstructionStart() {
+				c.Mpu.Step()
+			}
+
+			var buffer bytes.Buffer
+			g.Assert(c.SaveSnapshot(&buffer)).IsNil()
+			data := buffer.Bytes()
+			expected := driveTrace(c, d, 2000)
+
+			g.Assert(newSnapshotC64().LoadSnapshot(bytes.NewReader(data)) != nil).IsTrue()
+
+			restored := newSnapshotC64()
+			restoredDrive := attach(restored)
+			g.Assert(restored.LoadSnapshot(bytes.NewReader(data))).IsNil()
+			g.Assert(restoredDrive.Disk.Tracks).Equal(d.Disk.Tracks)
+			g.Assert(driveTrace(restored, restoredDrive, 2000)).Equal(expected)
+			g.Assert(restoredDrive.RAM).Equal(d.RAM)
+		})
+
+		g.It("rejects other versions", func() {
+			var buffer bytes.Buffer
+			g.Assert(newSnapshotC64().SaveSnapshot(&buffer)).IsNil()
+			data := buffer.Bytes()
+			data[8]++
+			g.Assert(newSnapshotC64().LoadSnapshot(bytes.NewReader(data)) != nil).IsTrue()
+		})
+	})
+}
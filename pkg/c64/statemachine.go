@@ -3,20 +3,45 @@ package c64
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
-	"github.com/gentoomaniac/go64/pkg/cyclelock"
+	"github.com/gentoomaniac/go64/pkg/cartridge"
+	"github.com/gentoomaniac/go64/pkg/cia"
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/disk"
+	"github.com/gentoomaniac/go64/pkg/drive"
+	"github.com/gentoomaniac/go64/pkg/host"
+	"github.com/gentoomaniac/go64/pkg/iec"
 	"github.com/gentoomaniac/go64/pkg/memory"
 	"github.com/gentoomaniac/go64/pkg/mpu"
+	"github.com/gentoomaniac/go64/pkg/reu"
+	"github.com/gentoomaniac/go64/pkg/scheduler"
+	"github.com/gentoomaniac/go64/pkg/speed"
+	"github.com/gentoomaniac/go64/pkg/tape"
+	"github.com/gentoomaniac/go64/pkg/trace"
 )
 
 const (
 	// MaxMemoryAddress is the highest adressable Memory position
 	MaxMemoryAddress uint16 = 0xffff
+
+	// ClockRate is the frequency of the PAL C64 in Hz
+	ClockRate = 985248
+	// CyclesPerFrame is the number of cycles the VIC-II needs to draw a frame
+	CyclesPerFrame = cyclesPerLine * linesPerFrame
+	// FrameDuration is the time of a frame, the PAL C64 draws 50.125 frames per second
+	FrameDuration = time.Second * CyclesPerFrame / ClockRate
+
+	// todRate is the frequency of the power line feeding the TOD clocks of the CIAs
+	todRate = 50
+	// todPeriod is the number of cycles between two ticks of the TOD clocks
+	todPeriod = ClockRate / todRate
 )
 
 const (
@@ -33,14 +58,74 @@ type C64 struct {
 
 	// Memory represents the 64kB memory of the C64
 	Memory memory.Memory
+	// ColorRAM holds the 4 bit color of every character on the screen
+	ColorRAM [ColorRAMSize]byte
 
 	// Mpu represents the MOS6502 of the C64
 	Mpu     mpu.MOS6502
-	mpuLock cyclelock.CycleLock
+	mpuLock cycleLock
+	port    processorPort
+	// scheduler counts the cycles since power on and calls the events like the TOD ticks
+	scheduler scheduler.Scheduler
+	// speed paces the frames of Run to the wall clock
+	speed *speed.Controller
+
+	// CIA1 scans the keyboard and reads the datasette, CIA2 drives the serial bus
+	CIA1 cia.CIA
+	CIA2 cia.CIA
+	// Keyboard is the matrix scanned by CIA1
+	Keyboard Keyboard
+	// todEvent is the next tick of the TOD clocks
+	todEvent *scheduler.Event
+
+	// vicRegisters and sidRegisters hold the values written to the not yet emulated chips
+	vicRegisters [0x40]byte
+	sidRegisters [0x20]byte
+	rasterCycle  int
+	rasterLine   uint16
+	// dma decides which cycles the VIC-II steals from the MPU
+	dma dma
+
+	// Cartridge is the cartridge in the expansion port or nil
+	Cartridge cartridge.Cartridge
+	// REU is the RAM expansion unit or nil
+	REU *reu.REU
+	// freezeRequested is set when the freeze button was pressed outside of the emulation goroutine
+	freezeRequested atomic.Bool
+
+	// Datasette is the tape drive connected to the cassette port
+	Datasette tape.Datasette
+	// tapeArchive is served by the KERNAL LOAD trap instead of the datasette
+	tapeArchive *tape.T64
+
+	// IEC is the serial bus connecting the C64 with its peripherals
+	IEC iec.Bus
+	// Drives are the 1541 disk drives attached to the serial bus
+	Drives []*drive.Drive1541
+	// driveClock accumulates the difference between the C64 and the drive clock rate
+	driveClock int
+
+	// control stops and resumes the emulation for the monitor
+	control control
+	// debugger holds the breakpoints stopping the emulation
+	debugger debugger.Debugger
+	// Host presents the frames of Run and feeds the input
+	Host  host.Host
+	frame host.Frame
+	audio audio
+	// tracer logs every executed instruction if set
+	tracer *trace.Tracer
+
+	// restored and drivesRestored are set if the state was loaded from a snapshot, the MPUs then continue
+	// without a reset
+	restored       bool
+	drivesRestored bool
+	// poweredOn is set once the first frame started
+	poweredOn bool
 }
 
 // DumpMemory debug prints the memory in the given address range
-func (c C64) DumpMemory(start uint16, end uint16) string {
+func (c *C64) DumpMemory(start uint16, end uint16) string {
 	dump := ""
 	bytesPerRow := 16
 
@@ -62,22 +147,6 @@ func (c C64) DumpMemory(start uint16, end uint16) string {
 	return dump
 }
 
-func (c *C64) updateMemoryBanks() {
-	// http://www.zimmers.net/anonftp/pub/cbm/maps/C64.MemoryMap
-	if c.Memory[0x01]&LORAM == 1 {
-		copy(c.Memory[0xa000:0xa000+len(c.BasicRom)], c.BasicRom)
-	}
-
-	if c.Memory[0x01]&HIRAM == 1 {
-		copy(c.Memory[0xe000:0xe000+len(c.KernalRom)], c.KernalRom)
-	}
-	if c.Memory[0x01]&CHAREN == 1 {
-		log.Warn().Msg("ToDo: CHAREN is set, I/O should be mapped")
-	} else {
-		copy(c.Memory[0xd000:0xd000+len(c.CharacterRom)], c.CharacterRom)
-	}
-}
-
 // Init initialises all components (loading roms, setting specific memory values etc)
 func (c *C64) Init(basicRom string, kernalRom string, characterRom string) {
 	var err error
@@ -96,32 +165,287 @@ func (c *C64) Init(basicRom string, kernalRom string, characterRom string) {
 		log.Panic().Err(err)
 	}
 
-	c.Memory[0x00] = 0xff
-	c.Memory[0x01] = 0x07
+	c.initChips()
+
+	fmt.Println(c.Mpu.DumpRegisters())
+}
 
-	c.updateMemoryBanks()
+// initChips connects the chips with each other and puts them into their power on state
+func (c *C64) initChips() {
+	c.CIA1.IRQ = func(active bool) { c.Mpu.SetIRQ(ciaIRQ, active) }
+	c.CIA2.IRQ = func(active bool) { c.Mpu.SetNMI(ciaNMI, active) }
+	c.CIA1.PortAIn = func() byte { return ^c.Keyboard.columns(^c.CIA1.OutputB()) }
+	c.CIA1.PortBIn = func() byte { return ^c.Keyboard.rows(^c.CIA1.OutputA()) }
+	c.CIA2.PortAIn = c.serialPortIn
+	c.CIA2.PortAOut = c.serialPortOut
+	c.CIA1.Reset()
+	c.CIA2.Reset()
+	c.Datasette.Pulse = c.CIA1.TriggerFLAG
 
 	c.Mpu.Memory = &c.Memory
+	c.Mpu.Bus = c
+	c.Mpu.SetTrap(kernalLoad, c.trapTapeLoad)
 
-	channelLock := &cyclelock.ChannelLock{}
-	channelLock.Init()
-	c.mpuLock = channelLock
-	c.Mpu.Init(c.mpuLock)
+	c.scheduleTOD(todPeriod)
+	c.speed = speed.New(FrameDuration)
 
-	fmt.Println(c.Mpu.DumpRegisters())
+	c.mpuLock.c64 = c
+	c.control.init()
+	c.Mpu.Init(&c.mpuLock)
 }
 
-// Run starts the simulation
-func (c *C64) Run() {
-	go c.Mpu.Run()
+// AttachDrive connects a 1541 with the given device number to the serial bus
+func (c *C64) AttachDrive(device int, romFile string) (*drive.Drive1541, error) {
+	rom, err := drive.LoadROM(romFile)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &drive.Drive1541{}
+	d.Init(device, rom, &c.IEC)
+	c.Drives = append(c.Drives, d)
+
+	return d, nil
+}
+
+// InsertDisk loads a D64 or G64 image and inserts it into the drive with the given device number
+func (c *C64) InsertDisk(device int, path string) error {
+	image, err := disk.Load(path)
+	if err != nil {
+		return err
+	}
 
-	time.Sleep(100 * time.Millisecond)
-	cycle := 0
-	for true {
-		log.Debug().Int("cycle", cycle).Msg("")
-		c.mpuLock.Unlock()
-		c.mpuLock.WaitForLock()
-		cycle++
-		time.Sleep(977 * time.Nanosecond)
+	d := c.drive(device)
+	if d == nil {
+		return fmt.Errorf("no drive with device number %d attached", device)
 	}
+	d.InsertDisk(image)
+	return nil
+}
+
+// drive returns the drive with the given device number or nil
+func (c *C64) drive(device int) *drive.Drive1541 {
+	for _, d := range c.Drives {
+		if d.Device == device {
+			return d
+		}
+	}
+	return nil
+}
+
+// Shutdown writes all modified media back to their image files and flushes the trace. The emulation must not run
+// meanwhile, so it may only be called while it is stopped or after Run returned, e.g. after Quit.
+func (c *C64) Shutdown() {
+	if cart, ok := c.Cartridge.(cartridge.Persistent); ok && cart.Modified() {
+		if err := cart.Save(); err != nil {
+			log.Error().Err(err).Msg("could not save cartridge image")
+		}
+	}
+	for _, d := range c.Drives {
+		if d.Disk == nil || !d.Disk.Modified {
+			continue
+		}
+		if err := d.Disk.Save(); err != nil {
+			log.Error().Err(err).Str("path", d.Disk.Path).Msg("could not save disk image")
+		}
+	}
+	if c.tracer != nil {
+		if err := c.tracer.Flush(); err != nil {
+			log.Error().Err(err).Msg("could not write trace")
+		}
+	}
+}
+
+// AttachCartridge plugs the cartridge of a CRT image into the expansion port. The cartridge is active after
+// the next reset.
+func (c *C64) AttachCartridge(path string) error {
+	cart, err := cartridge.Load(path)
+	if err != nil {
+		return err
+	}
+
+	c.Cartridge = cart
+	return nil
+}
+
+// AttachREU connects a RAM expansion unit with the given size in bytes
+func (c *C64) AttachREU(size int) error {
+	r, err := reu.New(size)
+	if err != nil {
+		return err
+	}
+
+	r.Memory = c
+	r.IRQ = func(active bool) { c.Mpu.SetIRQ(reuIRQ, active) }
+	c.REU = r
+	return nil
+}
+
+// DetachCartridge removes the cartridge from the expansion port
+func (c *C64) DetachCartridge() {
+	c.Cartridge = nil
+}
+
+// Freeze presses the freeze button of the cartridge, if it has one
+func (c *C64) Freeze() {
+	c.freezeRequested.Store(true)
+}
+
+// freeze switches the cartridge into freeze mode and pulses its NMI
+func (c *C64) freeze() {
+	freezer, ok := c.Cartridge.(cartridge.Freezer)
+	if !ok {
+		return
+	}
+	freezer.Freeze()
+	c.Mpu.SetNMI(cartridgeNMI, true)
+	c.Mpu.SetNMI(cartridgeNMI, false)
+}
+
+// InsertTape loads a TAP image into the datasette. T64 images contain no pulses, their files are loaded by
+// a trap replacing the KERNAL LOAD routine for device 1.
+func (c *C64) InsertTape(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if image, err := tape.ParseTAP(data); err == nil {
+		image.Path = path
+		c.Datasette.Insert(image)
+		c.tapeArchive = nil
+		return nil
+	}
+
+	archive, err := tape.ParseT64(data)
+	if err != nil {
+		return fmt.Errorf("%s: not a TAP or T64 image", path)
+	}
+	archive.Path = path
+	c.Datasette.Eject()
+	c.tapeArchive = archive
+	return nil
+}
+
+// PlayTape presses PLAY on the datasette
+func (c *C64) PlayTape() {
+	c.Datasette.Play()
+}
+
+// StopTape presses STOP on the datasette
+func (c *C64) StopTape() {
+	c.Datasette.Stop()
+}
+
+// RewindTape winds the tape in the datasette back to the start
+func (c *C64) RewindTape() {
+	c.Datasette.Rewind()
+}
+
+// Cycles returns the number of cycles since power on
+func (c *C64) Cycles() uint64 {
+	return c.scheduler.Cycle()
+}
+
+// scheduleTOD schedules the next tick of the TOD clocks after the given number of cycles
+func (c *C64) scheduleTOD(cycles int) {
+	c.scheduler.Cancel(c.todEvent)
+	c.todEvent = c.scheduler.After(uint64(cycles), c.tickTOD)
+}
+
+// tickTOD advances the TOD clocks of both CIAs
+func (c *C64) tickTOD() {
+	c.CIA1.TickTOD()
+	c.CIA2.TickTOD()
+	c.scheduleTOD(todPeriod)
+}
+
+// tick advances the system by one cycle. The VIC-II uses the first half of the cycle, the MPU does its bus
+// access after the chips were ticked. The SID isn't emulated yet, its registers are only stored.
+func (c *C64) tick() {
+	c.advanceRaster()
+	c.CIA1.Tick()
+	c.CIA2.Tick()
+	c.Datasette.Tick()
+	c.clockDrives()
+	c.scheduler.Tick()
+}
+
+// clockDrives advances the drives by the number of cycles they run during one C64 cycle
+func (c *C64) clockDrives() {
+	if c.Drives == nil {
+		return
+	}
+	c.driveClock += drive.ClockRate
+	for c.driveClock >= ClockRate {
+		c.driveClock -= ClockRate
+		for _, d := range c.Drives {
+			d.Clock()
+		}
+	}
+}
+
+// powerOn resets the MPUs unless their state was restored from a snapshot
+func (c *C64) powerOn() {
+	c.poweredOn = true
+	if !c.restored {
+		c.Mpu.Reset()
+	}
+	if !c.drivesRestored {
+		for _, d := range c.Drives {
+			d.Reset()
+		}
+	}
+}
+
+// RunFrame runs the emulation on the goroutine of the caller until the raster beam reaches the end of the
+// current frame. While the emulation is stopped RunFrame serves Step and Reset and only returns once it was
+// resumed and the frame is complete.
+func (c *C64) RunFrame() {
+	c.RunUntil(c.Cycles() + uint64(CyclesPerFrame-int(c.rasterLine)*cyclesPerLine-c.rasterCycle))
+}
+
+// RunUntil runs the emulation on the goroutine of the caller until the cycle counter reaches the given cycle.
+// Instructions aren't interrupted, so the last one may end a few cycles after it.
+func (c *C64) RunUntil(cycle uint64) {
+	if !c.poweredOn {
+		c.powerOn()
+	}
+
+	for c.Cycles() < cycle {
+		if c.freezeRequested.Load() && c.freezeRequested.CompareAndSwap(true, false) {
+			c.freeze()
+		}
+		if c.control.stopRequested.Load() {
+			c.halt()
+		} else if c.debugger.Active(debugger.Exec) && c.debugger.Check(debugger.Exec, c.Mpu.PC(), c.debugState) {
+			c.halt()
+		}
+		if c.control.quitting {
+			return
+		}
+		c.step()
+	}
+}
+
+// Run runs the emulation frame by frame, the speed controller waits after each frame until the next one is due.
+// It returns once the host ends the emulation or Quit is called, without a host it runs until Quit. Run may only
+// be called once.
+func (c *C64) Run() {
+	defer close(c.control.done)
+	for {
+		if c.Host != nil {
+			c.handleInput()
+		}
+		c.RunFrame()
+		if c.control.quitting || c.Host != nil && !c.present() {
+			return
+		}
+		c.speed.Frame()
+	}
+}
+
+// Speed returns the controller pacing the emulation to the wall clock
+func (c *C64) Speed() *speed.Controller {
+	return c.speed
 }
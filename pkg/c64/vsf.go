@@ -0,0 +1,224 @@
+package c64
+
+import (
+	"fmt"
+
+	"github.com/gentoomaniac/go64/pkg/cia"
+	"github.com/gentoomaniac/go64/pkg/vsf"
+)
+
+// names of the VICE snapshot modules that can be imported
+const (
+	vsfMainCPU     = "MAINCPU"
+	vsfMemory      = "C64MEM"
+	vsfCIA1        = "CIA1"
+	vsfCIA2        = "CIA2"
+	vsfSID         = "SID"
+	vsfSIDExtended = "SIDEXTENDED"
+	vsfVIC         = "VIC-II"
+)
+
+// vsfVersion is the version of a VICE snapshot module
+type vsfVersion struct {
+	major, minor byte
+}
+
+// vsfVersions are the module versions the importers read. VICE only appends data in minor versions, so newer
+// minor versions can be imported as well.
+var vsfVersions = map[string]vsfVersion{
+	vsfMainCPU:     {1, 1},
+	vsfMemory:      {0, 0},
+	vsfCIA1:        {2, 0},
+	vsfCIA2:        {2, 0},
+	vsfSID:         {1, 0},
+	vsfSIDExtended: {1, 0},
+	vsfVIC:         {1, 0},
+}
+
+// checkVSFVersion returns an error if the module has a version the importer can't read
+func checkVSFVersion(m *vsf.Module) error {
+	supported := vsfVersions[m.Name]
+	if m.Major != supported.major || m.Minor < supported.minor {
+		return fmt.Errorf("unsupported version %d.%d", m.Major, m.Minor)
+	}
+	return nil
+}
+
+// SkippedModule is a module of a VICE snapshot that was not imported
+type SkippedModule struct {
+	Name   string
+	Reason string
+}
+
+func (s SkippedModule) String() string {
+	return s.Name + ": " + s.Reason
+}
+
+// ImportVSF restores the state of a VICE snapshot of a C64. MAINCPU and C64MEM are required, the CIAs, the SID
+// registers and the VIC-II are imported if present. All other modules and the ones with unsupported versions are
+// returned as skipped, the components they belong to keep their current state.
+func (c *C64) ImportVSF(f *vsf.File) ([]SkippedModule, error) {
+	if f.Machine != "C64" && f.Machine != "C64SC" {
+		return nil, fmt.Errorf("snapshot of a %s, not a C64", f.Machine)
+	}
+
+	importers := map[string]func(m *vsf.Module) error{
+		vsfMainCPU: c.importMainCPU,
+		vsfMemory:  c.importMemory,
+		vsfCIA1:    importCIA(&c.CIA1),
+		vsfCIA2:    importCIA(&c.CIA2),
+		vsfSID: func(m *vsf.Module) error {
+			// the SID module only holds the sound settings
+			if f.Module(vsfSIDExtended) == nil {
+				return fmt.Errorf("the registers are missing, they are stored in %s", vsfSIDExtended)
+			}
+			return nil
+		},
+		vsfSIDExtended: c.importSID,
+		vsfVIC: func(m *vsf.Module) error {
+			if f.Machine != "C64" {
+				return fmt.Errorf("the VIC-II module of %s isn't supported", f.Machine)
+			}
+			return c.importVIC(m)
+		},
+	}
+
+	// nothing is imported if one of the required modules is missing or can't be read
+	required := []string{vsfMainCPU, vsfMemory}
+	for _, name := range required {
+		m := f.Module(name)
+		if m == nil {
+			return nil, fmt.Errorf("module %s missing", name)
+		}
+		if err := checkVSFVersion(m); err != nil {
+			return nil, fmt.Errorf("module %s: %w", name, err)
+		}
+	}
+	for _, name := range required {
+		if err := importers[name](f.Module(name)); err != nil {
+			return nil, fmt.Errorf("module %s: %w", name, err)
+		}
+	}
+
+	var skipped []SkippedModule
+	for i := range f.Modules {
+		m := &f.Modules[i]
+		importer, ok := importers[m.Name]
+		switch {
+		case m.Name == vsfMainCPU || m.Name == vsfMemory:
+		case !ok:
+			skipped = append(skipped, SkippedModule{m.Name, "not supported"})
+		default:
+			err := checkVSFVersion(m)
+			if err == nil {
+				err = importer(m)
+			}
+			if err != nil {
+				skipped = append(skipped, SkippedModule{m.Name, err.Error()})
+			}
+		}
+	}
+
+	c.restored = true
+	return skipped, nil
+}
+
+func (c *C64) importMainCPU(m *vsf.Module) error {
+	r := m.Reader()
+	clock := r.DWord()
+	a, x, y, s := r.Byte(), r.Byte(), r.Byte(), r.Byte()
+	pc := r.Word()
+	p := r.Byte()
+	if r.Err() != nil {
+		return r.Err()
+	}
+
+	c.Mpu.SetA(a)
+	c.Mpu.SetX(x)
+	c.Mpu.SetY(y)
+	c.Mpu.SetS(s)
+	c.Mpu.SetPC(pc)
+	c.Mpu.SetP(p)
+	c.scheduler.SetCycle(uint64(clock))
+	return nil
+}
+
+func (c *C64) importMemory(m *vsf.Module) error {
+	r := m.Reader()
+	data, ddr := r.Byte(), r.Byte()
+	// EXROM and GAME belong to the cartridge, which isn't imported
+	r.Bytes(2)
+	ram := r.Bytes(len(c.Memory))
+	if r.Err() != nil {
+		return r.Err()
+	}
+
+	copy(c.Memory[:], ram)
+	c.writePort(0x0000, ddr)
+	c.writePort(0x0001, data)
+	return nil
+}
+
+func importCIA(target *cia.CIA) func(m *vsf.Module) error {
+	return func(m *vsf.Module) error {
+		r := m.Reader()
+		var registers cia.Registers
+		registers.PRA, registers.PRB, registers.DDRA, registers.DDRB = r.Byte(), r.Byte(), r.Byte(), r.Byte()
+		registers.TimerA, registers.TimerB = r.Word(), r.Word()
+		copy(registers.TOD[:], r.Bytes(4))
+		registers.SDR, registers.Mask = r.Byte(), r.Byte()
+		registers.CRA, registers.CRB = r.Byte(), r.Byte()
+		registers.LatchA, registers.LatchB = r.Word(), r.Word()
+		registers.ICR = r.Byte()
+		// the timer outputs and the shift register state are derived from the registers
+		r.Bytes(2)
+		copy(registers.Alarm[:], r.Bytes(4))
+		if r.Err() != nil {
+			return r.Err()
+		}
+
+		target.SetRegisters(registers)
+		return nil
+	}
+}
+
+func (c *C64) importSID(m *vsf.Module) error {
+	r := m.Reader()
+	registers := r.Bytes(len(c.sidRegisters))
+	if r.Err() != nil {
+		return r.Err()
+	}
+
+	copy(c.sidRegisters[:], registers)
+	return nil
+}
+
+// importVIC reads the VIC-II module of x64, only the registers, the color RAM, the raster position and whether
+// badlines are allowed are used
+func (c *C64) importVIC(m *vsf.Module) error {
+	r := m.Reader()
+	badlines := r.Byte() != 0
+	// bad line and blanking flags, color buffer
+	r.Bytes(2 + 40)
+	colorRAM := r.Bytes(ColorRAMSize)
+	// idle state, light pen, matrix buffer, sprite DMA and RAM base
+	r.Bytes(4 + 40 + 1 + 4)
+	rasterCycle := int(r.Byte())
+	rasterLine := r.Word()
+	registers := r.Bytes(len(c.vicRegisters))
+	if r.Err() != nil {
+		return r.Err()
+	}
+	if rasterCycle >= cyclesPerLine || rasterLine >= linesPerFrame {
+		return fmt.Errorf("raster position %d/%d outside of a PAL frame", rasterLine, rasterCycle)
+	}
+
+	for i, value := range colorRAM {
+		c.ColorRAM[i] = value & 0x0f
+	}
+	copy(c.vicRegisters[:], registers)
+	c.rasterCycle, c.rasterLine = rasterCycle, rasterLine
+	c.dma = dma{badlines: badlines}
+	c.dma.badline = c.badline()
+	return nil
+}
@@ -0,0 +1,122 @@
+package c64
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/cia"
+	"github.com/gentoomaniac/go64/pkg/vsf"
+)
+
+// newTestVSF returns a VICE snapshot with the modules in the layout written by x64
+func newTestVSF() *vsf.File {
+	cpu := binary.LittleEndian.AppendUint32(nil, 123456)
+	cpu = append(cpu, 0x11, 0x22, 0x33, 0xf0)
+	cpu = binary.LittleEndian.AppendUint16(cpu, 0x1234)
+	cpu = append(cpu, 0x24)
+	// last opcode and interrupt state
+	cpu = append(cpu, make([]byte, 16)...)
+
+	memory := append([]byte{0x37, 0x2f, 0x01, 0x01}, make([]byte, 0x10000)...)
+	memory[4+0x0801] = 0x42
+
+	cia1 := []byte{0xff, 0xff, 0xff, 0x00, 0x25, 0x40, 0xff, 0xff, 0x00, 0x00, 0x00, 0x01, 0x00, 0x81, 0x11, 0x08,
+		0x25, 0x40, 0xff, 0xff, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	vic := make([]byte, 3+40)
+	colorRAM := make([]byte, ColorRAMSize)
+	colorRAM[0] = 0xfe
+	vic = append(vic, colorRAM...)
+	vic = append(vic, make([]byte, 4+40+1+4)...)
+	vic = append(vic, 12)
+	vic = binary.LittleEndian.AppendUint16(vic, 0x0123)
+	registers := make([]byte, 0x40)
+	registers[0x20] = 0x0e
+	vic = append(vic, registers...)
+
+	sid := make([]byte, 0x40)
+	sid[0x18] = 0x0f
+
+	return &vsf.File{Major: 1, Machine: "C64", Modules: []vsf.Module{
+		{Name: "MAINCPU", Major: 1, Minor: 1, Data: cpu},
+		{Name: "C64MEM", Data: memory},
+		{Name: "CIA1", Major: 2, Data: cia1},
+		{Name: "VIC-II", Major: 1, Data: vic},
+		{Name: "SID", Major: 1, Data: []byte{0x01, 0x00}},
+		{Name: "SIDEXTENDED", Major: 1, Data: sid},
+		{Name: "DRIVE8", Data: []byte{}},
+	}}
+}
+
+func TestVSFImport(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("VICE snapshot import", func() {
+		g.It("imports the supported modules", func() {
+			c := newTestC64()
+			skipped, err := c.ImportVSF(newTestVSF())
+			g.Assert(err).IsNil()
+			g.Assert(skipped).Equal([]SkippedModule{{"DRIVE8", "not supported"}})
+
+			g.Assert(c.Mpu.PC()).Equal(uint16(0x1234))
+			g.Assert(c.Mpu.A()).Equal(uint8(0x11))
+			g.Assert(c.Mpu.S()).Equal(uint8(0xf0))
+			g.Assert(c.Cycles()).Equal(uint64(123456))
+			g.Assert(c.Memory[0x0801]).Equal(uint8(0x42))
+			g.Assert(c.Get(0xa000)).Equal(uint8(0xba))
+
+			g.Assert(c.CIA1.Peek(cia.TALO)).Equal(uint8(0x25))
+			g.Assert(c.CIA1.Peek(cia.CRA)).Equal(uint8(0x01))
+			g.Assert(c.CIA1.IRQActive()).IsTrue()
+			g.Assert(c.Mpu.IRQ()).IsTrue()
+
+			g.Assert(c.Get(0xd020)).Equal(uint8(0x0e))
+			g.Assert(c.rasterLine).Equal(uint16(0x0123))
+			g.Assert(c.ColorRAM[0]).Equal(uint8(0x0e))
+			g.Assert(c.Get(0xd418)).Equal(uint8(0x0f))
+		})
+
+		g.It("reports modules that could not be imported", func() {
+			f := newTestVSF()
+			f.Machine = "C64SC"
+			f.Modules = f.Modules[:5]
+			f.Modules[2].Data = f.Modules[2].Data[:10]
+
+			skipped, err := newTestC64().ImportVSF(f)
+			g.Assert(err).IsNil()
+			g.Assert(len(skipped)).Equal(3)
+			g.Assert(skipped[0].Name).Equal("CIA1")
+			g.Assert(skipped[1].String()).Equal("VIC-II: the VIC-II module of C64SC isn't supported")
+			g.Assert(skipped[2].Name).Equal("SID")
+		})
+
+		g.It("skips modules with unsupported versions", func() {
+			f := newTestVSF()
+			f.Modules[2].Major = 1
+			f.Modules[3].Minor = 2
+
+			skipped, err := newTestC64().ImportVSF(f)
+			g.Assert(err).IsNil()
+			g.Assert(skipped).Equal([]SkippedModule{{"CIA1", "unsupported version 1.0"}, {"DRIVE8", "not supported"}})
+
+			f.Modules[0].Minor = 0
+			_, err = newTestC64().ImportVSF(f)
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("rejects snapshots without CPU or memory", func() {
+			f := newTestVSF()
+			f.Modules = f.Modules[1:]
+			c := newTestC64()
+			_, err := c.ImportVSF(f)
+			g.Assert(err != nil).IsTrue()
+			g.Assert(c.Memory[0x0801]).Equal(uint8(0x00))
+
+			f = newTestVSF()
+			f.Machine = "VIC20"
+			_, err = c.ImportVSF(f)
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+}
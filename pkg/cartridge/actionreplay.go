@@ -0,0 +1,117 @@
+package cartridge
+
+import "github.com/gentoomaniac/go64/pkg/snapshot"
+
+// actionReplay is a freezer cartridge with 32kB ROM in 4 banks and 8kB RAM. The control register at $de00
+// selects the lines, the bank and the RAM, IO2 mirrors the last page of the selected bank.
+// http://rr.pokefinder.org/wiki/Action_Replay
+type actionReplay struct {
+	crt     *CRT
+	rom     banks
+	ram     [BankSize]byte
+	control byte
+	// frozen forces Ultimax mode after the freeze button was pressed, disabled hides the cartridge until reset
+	frozen   bool
+	disabled bool
+}
+
+// bits of the control register
+const (
+	actionReplayGAME     byte = 0x01
+	actionReplayEXROM    byte = 0x02
+	actionReplayDisable  byte = 0x04
+	actionReplayRAM      byte = 0x20
+	actionReplayUnfreeze byte = 0x40
+)
+
+func newActionReplay(crt *CRT) (Cartridge, error) {
+	return &actionReplay{crt: crt, rom: chipBanks(crt)}, nil
+}
+
+func (a *actionReplay) GAME() bool {
+	if a.disabled {
+		return true
+	}
+	return !a.frozen && a.control&actionReplayGAME == 0
+}
+
+func (a *actionReplay) EXROM() bool {
+	if a.disabled {
+		return true
+	}
+	return a.frozen || a.control&actionReplayEXROM != 0
+}
+
+func (a *actionReplay) Reset() {
+	a.control = 0
+	a.frozen = false
+	a.disabled = false
+}
+
+// Freeze switches to Ultimax mode so that the NMI vector is read from the cartridge ROM
+func (a *actionReplay) Freeze() {
+	a.control = 0
+	a.frozen = true
+	a.disabled = false
+}
+
+func (a *actionReplay) image() *CRT { return a.crt }
+
+func (a *actionReplay) state(s *snapshot.State) {
+	s.Bytes(a.ram[:])
+	s.Byte(&a.control)
+	s.Bool(&a.frozen)
+	s.Bool(&a.disabled)
+}
+
+func (a *actionReplay) bank() int {
+	return int(a.control>>3) & 0x03
+}
+
+func (a *actionReplay) ramEnabled() bool {
+	return a.control&actionReplayRAM != 0
+}
+
+func (a *actionReplay) ReadROML(offset uint16) byte {
+	if a.ramEnabled() {
+		return a.ram[offset&(BankSize-1)]
+	}
+	return a.rom.read(a.bank(), offset)
+}
+
+func (a *actionReplay) ReadROMH(offset uint16) byte {
+	return a.rom.read(a.bank(), offset)
+}
+
+func (a *actionReplay) WriteROML(offset uint16, value byte) {
+	if a.ramEnabled() {
+		a.ram[offset&(BankSize-1)] = value
+	}
+}
+
+func (a *actionReplay) WriteROMH(offset uint16, value byte) {}
+
+func (a *actionReplay) ReadIO(addr uint16) (byte, bool) {
+	if a.disabled || addr < 0xdf00 {
+		return 0, false
+	}
+	return a.ReadROML(0x1f00 | addr&0xff), true
+}
+
+func (a *actionReplay) WriteIO(addr uint16, value byte) {
+	if a.disabled {
+		return
+	}
+	if addr >= 0xdf00 {
+		a.WriteROML(0x1f00|addr&0xff, value)
+		return
+	}
+
+	a.control = value
+	if value&actionReplayUnfreeze != 0 {
+		a.frozen = false
+	}
+	if value&actionReplayDisable != 0 {
+		a.disabled = true
+	}
+}
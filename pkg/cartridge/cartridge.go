@@ -0,0 +1,153 @@
+package cartridge
+
+import "fmt"
+
+// Cartridge is the hardware plugged into the expansion port. The mapper controls the GAME and EXROM lines
+// which select the memory configuration of the PLA, provides the ROML ($8000) and ROMH ($a000 or $e000)
+// windows and can use the IO1 ($de00) and IO2 ($df00) areas.
+type Cartridge interface {
+	// GAME and EXROM return the levels of the lines, both are active low
+	GAME() bool
+	EXROM() bool
+
+	// ReadROML and ReadROMH read from the 8kB windows, offset is relative to the start of the window
+	ReadROML(offset uint16) byte
+	ReadROMH(offset uint16) byte
+	// WriteROML and WriteROMH are called for writes to the visible windows
+	WriteROML(offset uint16, value byte)
+	WriteROMH(offset uint16, value byte)
+
+	// ReadIO reads from $de00-$dfff and returns false if the cartridge doesn't drive the data bus
+	ReadIO(addr uint16) (byte, bool)
+	WriteIO(addr uint16, value byte)
+
+	// Reset is called on power on and when the reset line is pulled
+	Reset()
+}
+
+// Freezer is implemented by cartridges with a freeze button. Freeze is called before the NMI is triggered.
+type Freezer interface {
+	Freeze()
+}
+
+// Persistent is implemented by cartridges that can write changes of their content back to the image file
+type Persistent interface {
+	Modified() bool
+	Save() error
+}
+
+// Hardware types of the CRT header, only the supported ones are listed
+const (
+	TypeNormal       uint16 = 0
+	TypeActionReplay uint16 = 1
+	TypeOcean        uint16 = 5
+	TypeMagicDesk    uint16 = 19
+	TypeEasyFlash    uint16 = 32
+)
+
+// Constructor creates the mapper for a CRT image
+type Constructor func(crt *CRT) (Cartridge, error)
+
+var mappers = map[uint16]Constructor{
+	TypeNormal:       newNormal,
+	TypeActionReplay: newActionReplay,
+	TypeOcean:        newOcean,
+	TypeMagicDesk:    newMagicDesk,
+	TypeEasyFlash:    newEasyFlash,
+}
+
+// Register adds or replaces the mapper for a hardware type
+func Register(hardwareType uint16, constructor Constructor) {
+	mappers[hardwareType] = constructor
+}
+
+// New creates the mapper selected by the hardware type of the image
+func New(crt *CRT) (Cartridge, error) {
+	constructor, ok := mappers[crt.HardwareType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cartridge hardware type %d", crt.HardwareType)
+	}
+
+	cart, err := constructor(crt)
+	if err != nil {
+		return nil, err
+	}
+	cart.Reset()
+	return cart, nil
+}
+
+// Load reads a CRT image and creates its mapper
+func Load(path string) (Cartridge, error) {
+	crt, err := LoadCRT(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := New(crt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cart, nil
+}
+
+// BankSize is the size of the ROML and ROMH windows
+const BankSize = 0x2000
+
+// banks holds the 8kB banks of a window, missing banks read as $ff
+type banks [][]byte
+
+func (b *banks) set(bank int, data []byte) {
+	for len(*b) <= bank {
+		*b = append(*b, nil)
+	}
+	if (*b)[bank] == nil {
+		(*b)[bank] = make([]byte, BankSize)
+		for i := range (*b)[bank] {
+			(*b)[bank][i] = 0xff
+		}
+	}
+	copy((*b)[bank], data)
+}
+
+func (b banks) read(bank int, offset uint16) byte {
+	if bank >= len(b) || b[bank] == nil {
+		return 0xff
+	}
+	return b[bank][offset&(BankSize-1)]
+}
+
+// splitChips sorts the chips into the ROML and ROMH banks by their load address, 16kB chips at $8000 fill both
+func splitChips(crt *CRT) (roml banks, romh banks) {
+	for _, chip := range crt.Chips {
+		data, addr := chip.Data, chip.LoadAddress
+		for len(data) > 0 {
+			size := len(data)
+			if size > BankSize {
+				size = BankSize
+			}
+			if addr == 0x8000 {
+				roml.set(int(chip.Bank), data[:size])
+			} else {
+				romh.set(int(chip.Bank), data[:size])
+			}
+			data, addr = data[size:], addr+BankSize
+		}
+	}
+	return roml, romh
+}
+
+// chipBanks stores the chips by their bank number only, for mappers switching one bank into both windows
+func chipBanks(crt *CRT) (b banks) {
+	for _, chip := range crt.Chips {
+		b.set(int(chip.Bank), chip.Data)
+	}
+	return b
+}
+
+// noIO can be embedded by mappers without registers and RAM-less windows
+type noIO struct{}
+
+func (noIO) ReadIO(addr uint16) (byte, bool)     { return 0, false }
+func (noIO) WriteIO(addr uint16, value byte)     {}
+func (noIO) WriteROML(offset uint16, value byte) {}
+func (noIO) WriteROMH(offset uint16, value byte) {}
@@ -0,0 +1,206 @@
+package cartridge
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+type testChip struct {
+	bank, address uint16
+	size          int
+	fill          byte
+}
+
+// newTestCRT returns a CRT image, every chip is filled with its fill byte followed by its bank number
+func newTestCRT(hardwareType uint16, exrom byte, game byte, chips ...testChip) []byte {
+	image := make([]byte, crtHeaderLen)
+	copy(image, crtSignature)
+	binary.BigEndian.PutUint32(image[0x10:], crtHeaderLen)
+	binary.BigEndian.PutUint16(image[0x14:], 0x0100)
+	binary.BigEndian.PutUint16(image[0x16:], hardwareType)
+	image[0x18], image[0x19] = exrom, game
+	copy(image[0x20:], "TEST")
+
+	for _, chip := range chips {
+		packet := make([]byte, chipHeaderLen+chip.size)
+		copy(packet, chipSignature)
+		binary.BigEndian.PutUint32(packet[4:], uint32(len(packet)))
+		binary.BigEndian.PutUint16(packet[0x0a:], chip.bank)
+		binary.BigEndian.PutUint16(packet[0x0c:], chip.address)
+		binary.BigEndian.PutUint16(packet[0x0e:], uint16(chip.size))
+		for i := chipHeaderLen; i < len(packet); i++ {
+			packet[i] = chip.fill
+		}
+		packet[chipHeaderLen+1] = byte(chip.bank)
+		image = append(image, packet...)
+	}
+	return image
+}
+
+func newTestCartridge(image []byte) Cartridge {
+	crt, err := ParseCRT(image)
+	if err != nil {
+		panic(err)
+	}
+	cart, err := New(crt)
+	if err != nil {
+		panic(err)
+	}
+	return cart
+}
+
+func TestCRT(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("CRT parser", func() {
+		g.It("reads the header and the CHIP packets", func() {
+			crt, err := ParseCRT(newTestCRT(TypeOcean, 0, 0,
+				testChip{0, 0x8000, 0x2000, 0x11}, testChip{1, 0x8000, 0x2000, 0x22}))
+			g.Assert(err).IsNil()
+			g.Assert(crt.Name).Equal("TEST")
+			g.Assert(crt.HardwareType).Equal(TypeOcean)
+			g.Assert(len(crt.Chips)).Equal(2)
+			g.Assert(crt.Chips[1].Bank).Equal(uint16(1))
+			g.Assert(crt.Chips[1].Data[0]).Equal(uint8(0x22))
+		})
+
+		g.It("rejects broken images", func() {
+			_, err := ParseCRT([]byte("C64 CARTRIDGE"))
+			g.Assert(err != nil).IsTrue()
+
+			image := newTestCRT(TypeNormal, 0, 1, testChip{0, 0x8000, 0x2000, 0x11})
+			_, err = ParseCRT(image[:len(image)-1])
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("selects the mapper by the hardware type", func() {
+			crt, _ := ParseCRT(newTestCRT(TypeMagicDesk, 0, 1, testChip{0, 0x8000, 0x2000, 0x11}))
+			cart, err := New(crt)
+			g.Assert(err).IsNil()
+			_, ok := cart.(*magicDesk)
+			g.Assert(ok).IsTrue()
+
+			crt.HardwareType = 1000
+			_, err = New(crt)
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+}
+
+func TestMappers(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Normal cartridge", func() {
+		g.It("splits 16kB chips into ROML and ROMH", func() {
+			cart := newTestCartridge(newTestCRT(TypeNormal, 0, 0, testChip{0, 0x8000, 0x4000, 0x11}))
+			g.Assert(cart.GAME()).IsFalse()
+			g.Assert(cart.EXROM()).IsFalse()
+			g.Assert(cart.ReadROML(0x0000)).Equal(uint8(0x11))
+			g.Assert(cart.ReadROMH(0x0000)).Equal(uint8(0x11))
+			g.Assert(cart.ReadROMH(0x0001)).Equal(uint8(0x11))
+		})
+
+		g.It("maps Ultimax ROMs at $e000 to ROMH", func() {
+			cart := newTestCartridge(newTestCRT(TypeNormal, 1, 0, testChip{0, 0xe000, 0x2000, 0x33}))
+			g.Assert(cart.GAME()).IsFalse()
+			g.Assert(cart.EXROM()).IsTrue()
+			g.Assert(cart.ReadROMH(0x1ffc)).Equal(uint8(0x33))
+			g.Assert(cart.ReadROML(0x0000)).Equal(uint8(0xff))
+		})
+	})
+
+	g.Describe("Ocean", func() {
+		g.It("switches banks with $de00", func() {
+			cart := newTestCartridge(newTestCRT(TypeOcean, 0, 0,
+				testChip{0, 0x8000, 0x2000, 0x10}, testChip{1, 0x8000, 0x2000, 0x11}, testChip{16, 0xa000, 0x2000, 0x20}))
+			g.Assert(cart.ReadROML(0)).Equal(uint8(0x10))
+			cart.WriteIO(0xde00, 0x01)
+			g.Assert(cart.ReadROML(0)).Equal(uint8(0x11))
+			cart.WriteIO(0xde00, 0x10)
+			g.Assert(cart.ReadROMH(0)).Equal(uint8(0x20))
+			cart.Reset()
+			g.Assert(cart.ReadROML(0)).Equal(uint8(0x10))
+		})
+	})
+
+	g.Describe("Magic Desk", func() {
+		g.It("switches banks and disables itself", func() {
+			cart := newTestCartridge(newTestCRT(TypeMagicDesk, 0, 1,
+				testChip{0, 0x8000, 0x2000, 0x10}, testChip{1, 0x8000, 0x2000, 0x11}))
+			g.Assert(cart.EXROM()).IsFalse()
+			cart.WriteIO(0xde00, 0x01)
+			g.Assert(cart.ReadROML(0)).Equal(uint8(0x11))
+			cart.WriteIO(0xde00, 0x80)
+			g.Assert(cart.EXROM()).IsTrue()
+			g.Assert(cart.GAME()).IsTrue()
+		})
+	})
+
+	g.Describe("EasyFlash", func() {
+		g.It("boots in Ultimax mode and switches the lines with $de02", func() {
+			cart := newTestCartridge(newTestCRT(TypeEasyFlash, 1, 0,
+				testChip{0, 0x8000, 0x2000, 0x10}, testChip{0, 0xa000, 0x2000, 0x20}, testChip{1, 0xa000, 0x2000, 0x21}))
+			g.Assert(cart.GAME()).IsFalse()
+			g.Assert(cart.EXROM()).IsTrue()
+			g.Assert(cart.ReadROMH(0)).Equal(uint8(0x20))
+
+			cart.WriteIO(0xde02, 0x07)
+			g.Assert(cart.GAME()).IsFalse()
+			g.Assert(cart.EXROM()).IsFalse()
+			cart.WriteIO(0xde02, 0x04)
+			g.Assert(cart.GAME()).IsTrue()
+			g.Assert(cart.EXROM()).IsTrue()
+
+			cart.WriteIO(0xde00, 0x01)
+			g.Assert(cart.ReadROMH(0)).Equal(uint8(0x21))
+			g.Assert(cart.ReadROML(0)).Equal(uint8(0xff))
+		})
+	})
+
+	g.Describe("Action Replay", func() {
+		newActionReplayCartridge := func() Cartridge {
+			return newTestCartridge(newTestCRT(TypeActionReplay, 0, 1,
+				testChip{0, 0x8000, 0x2000, 0x10}, testChip{1, 0x8000, 0x2000, 0x11},
+				testChip{2, 0x8000, 0x2000, 0x12}, testChip{3, 0x8000, 0x2000, 0x13}))
+		}
+
+		g.It("starts in 8kB mode and selects banks", func() {
+			cart := newActionReplayCartridge()
+			g.Assert(cart.GAME()).IsTrue()
+			g.Assert(cart.EXROM()).IsFalse()
+			g.Assert(cart.ReadROML(0)).Equal(uint8(0x10))
+			cart.WriteIO(0xde00, 0x18)
+			g.Assert(cart.ReadROML(0)).Equal(uint8(0x13))
+			v, ok := cart.ReadIO(0xdf00)
+			g.Assert(ok).IsTrue()
+			g.Assert(v).Equal(uint8(0x13))
+		})
+
+		g.It("maps its RAM into ROML and IO2", func() {
+			cart := newActionReplayCartridge()
+			cart.WriteIO(0xde00, 0x20)
+			cart.WriteROML(0x1f42, 0x55)
+			v, _ := cart.ReadIO(0xdf42)
+			g.Assert(v).Equal(uint8(0x55))
+			cart.WriteIO(0xdf43, 0x66)
+			g.Assert(cart.ReadROML(0x1f43)).Equal(uint8(0x66))
+		})
+
+		g.It("switches to Ultimax mode when frozen", func() {
+			cart := newActionReplayCartridge()
+			cart.WriteIO(0xde00, 0x04)
+			g.Assert(cart.EXROM()).IsTrue()
+			_, ok := cart.ReadIO(0xdf00)
+			g.Assert(ok).IsFalse()
+
+			cart.(Freezer).Freeze()
+			g.Assert(cart.GAME()).IsFalse()
+			g.Assert(cart.EXROM()).IsTrue()
+			cart.WriteIO(0xde00, 0x40)
+			g.Assert(cart.GAME()).IsTrue()
+			g.Assert(cart.EXROM()).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,131 @@
+package cartridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// CRT is the cartridge image format of CCS64 and VICE, a header followed by CHIP packets with the ROM banks
+// http://unusedino.de/ec64/technical/formats/crt.html
+
+const (
+	crtSignature  = "C64 CARTRIDGE   "
+	chipSignature = "CHIP"
+	// crtHeaderLen is the minimal header length, some images use 0x20 even though the header is 0x40 bytes
+	crtHeaderLen  = 0x40
+	chipHeaderLen = 0x10
+)
+
+// Types of CHIP packets
+const (
+	ChipROM   uint16 = 0
+	ChipRAM   uint16 = 1
+	ChipFlash uint16 = 2
+)
+
+// CRT is a parsed CRT image
+type CRT struct {
+	Name         string
+	Version      uint16
+	HardwareType uint16
+	// EXROM and GAME are the line levels after power on, 0 is active
+	EXROM byte
+	GAME  byte
+	Chips []Chip
+	Path  string
+}
+
+// Chip is a ROM, RAM or flash bank of a CRT image
+type Chip struct {
+	Type        uint16
+	Bank        uint16
+	LoadAddress uint16
+	Data        []byte
+}
+
+// LoadCRT reads a CRT image from a file
+func LoadCRT(path string) (*CRT, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	crt, err := ParseCRT(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	crt.Path = path
+	return crt, nil
+}
+
+// ParseCRT parses a CRT image, all numbers in the image are big endian
+func ParseCRT(data []byte) (*CRT, error) {
+	if len(data) < crtHeaderLen || string(data[:16]) != crtSignature {
+		return nil, fmt.Errorf("not a CRT image")
+	}
+
+	headerLen := int(binary.BigEndian.Uint32(data[0x10:]))
+	if headerLen < crtHeaderLen {
+		headerLen = crtHeaderLen
+	}
+	crt := &CRT{
+		Version:      binary.BigEndian.Uint16(data[0x14:]),
+		HardwareType: binary.BigEndian.Uint16(data[0x16:]),
+		EXROM:        data[0x18],
+		GAME:         data[0x19],
+		Name:         string(bytes.TrimRight(data[0x20:0x40], "\x00")),
+	}
+
+	for offset := headerLen; offset+chipHeaderLen <= len(data); {
+		packet := data[offset:]
+		if string(packet[:4]) != chipSignature {
+			return nil, fmt.Errorf("invalid CHIP packet at offset 0x%x", offset)
+		}
+
+		length := int(binary.BigEndian.Uint32(packet[4:]))
+		size := int(binary.BigEndian.Uint16(packet[0x0e:]))
+		if length < chipHeaderLen+size {
+			length = chipHeaderLen + size
+		}
+		if offset+chipHeaderLen+size > len(data) {
+			return nil, fmt.Errorf("CHIP packet at offset 0x%x truncated", offset)
+		}
+
+		crt.Chips = append(crt.Chips, Chip{
+			Type:        binary.BigEndian.Uint16(packet[8:]),
+			Bank:        binary.BigEndian.Uint16(packet[0x0a:]),
+			LoadAddress: binary.BigEndian.Uint16(packet[0x0c:]),
+			Data:        append([]byte{}, packet[chipHeaderLen:chipHeaderLen+size]...),
+		})
+		offset += length
+	}
+
+	return crt, nil
+}
+
+// Bytes returns the image in CRT format
+func (c *CRT) Bytes() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(crtSignature)
+	binary.Write(&buffer, binary.BigEndian, uint32(crtHeaderLen))
+	binary.Write(&buffer, binary.BigEndian, c.Version)
+	binary.Write(&buffer, binary.BigEndian, c.HardwareType)
+	buffer.Write([]byte{c.EXROM, c.GAME, 0, 0, 0, 0, 0, 0})
+	name := make([]byte, 0x20)
+	copy(name, c.Name)
+	buffer.Write(name)
+
+	for _, chip := range c.Chips {
+		buffer.WriteString(chipSignature)
+		binary.Write(&buffer, binary.BigEndian, uint32(chipHeaderLen+len(chip.Data)))
+		binary.Write(&buffer, binary.BigEndian, chip.Type)
+		binary.Write(&buffer, binary.BigEndian, chip.Bank)
+		binary.Write(&buffer, binary.BigEndian, chip.LoadAddress)
+		binary.Write(&buffer, binary.BigEndian, uint16(len(chip.Data)))
+		buffer.Write(chip.Data)
+	}
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,155 @@
+package cartridge
+
+import (
+	"os"
+
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+// easyFlash has two Am29F040 flash chips with 64 banks of 8kB for ROML and ROMH and 256 bytes of RAM in IO2.
+// $de00 selects the bank, $de02 controls the lines. With the boot jumper set the cartridge starts in Ultimax
+// mode. The flash is written through the ROML and ROMH windows.
+// http://skoe.de/easyflash/files/devdocs/EasyFlash-ProgRef.pdf
+type easyFlash struct {
+	crt        *CRT
+	roml, romh *am29f040
+	ram        [0x100]byte
+	bank       int
+	control    byte
+	boot       bool
+}
+
+// bits of the control register, set bits pull the lines low
+const (
+	easyFlashGAME     byte = 0x01
+	easyFlashEXROM    byte = 0x02
+	easyFlashGAMEMode byte = 0x04
+)
+
+func newEasyFlash(crt *CRT) (Cartridge, error) {
+	e := &easyFlash{
+		crt:  crt,
+		roml: newFlash(),
+		romh: newFlash(),
+		boot: true,
+	}
+
+	roml, romh := splitChips(crt)
+	for bank, data := range roml {
+		copy(e.roml.data[bank*BankSize:], data)
+	}
+	for bank, data := range romh {
+		copy(e.romh.data[bank*BankSize:], data)
+	}
+	return e, nil
+}
+
+// GAME is controlled by the boot jumper until GAME mode is set in the control register
+func (e *easyFlash) GAME() bool {
+	if e.control&easyFlashGAMEMode == 0 {
+		return !e.boot
+	}
+	return e.control&easyFlashGAME == 0
+}
+
+func (e *easyFlash) EXROM() bool { return e.control&easyFlashEXROM == 0 }
+
+// Reset doesn't clear the RAM, it keeps its content like the real one
+func (e *easyFlash) Reset() {
+	e.bank = 0
+	e.control = 0
+	e.roml.state = flashRead
+	e.romh.state = flashRead
+}
+
+func (e *easyFlash) image() *CRT { return e.crt }
+
+// state only stores the flash chips if they differ from the image
+func (e *easyFlash) state(s *snapshot.State) {
+	e.roml.snapshot(s)
+	e.romh.snapshot(s)
+	s.Bytes(e.ram[:])
+	s.Int(&e.bank)
+	s.Byte(&e.control)
+	s.Bool(&e.boot)
+}
+
+func (e *easyFlash) flashAddress(offset uint16) uint32 {
+	return uint32(e.bank)*BankSize + uint32(offset&(BankSize-1))
+}
+
+func (e *easyFlash) ReadROML(offset uint16) byte { return e.roml.read(e.flashAddress(offset)) }
+func (e *easyFlash) ReadROMH(offset uint16) byte { return e.romh.read(e.flashAddress(offset)) }
+
+func (e *easyFlash) WriteROML(offset uint16, value byte) { e.roml.write(e.flashAddress(offset), value) }
+func (e *easyFlash) WriteROMH(offset uint16, value byte) { e.romh.write(e.flashAddress(offset), value) }
+
+func (e *easyFlash) ReadIO(addr uint16) (byte, bool) {
+	if addr < 0xdf00 {
+		return 0, false
+	}
+	return e.ram[addr&0xff], true
+}
+
+func (e *easyFlash) WriteIO(addr uint16, value byte) {
+	if addr >= 0xdf00 {
+		e.ram[addr&0xff] = value
+		return
+	}
+	if addr&0x02 == 0 {
+		e.bank = int(value & 0x3f)
+	} else {
+		e.control = value & 0x87
+	}
+}
+
+// Modified returns true if one of the flash chips was programmed or erased
+func (e *easyFlash) Modified() bool {
+	return e.roml.modified || e.romh.modified
+}
+
+// Save writes the flash content back to the CRT file, erased banks are left out
+func (e *easyFlash) Save() error {
+	crt := &CRT{
+		Name:         e.crt.Name,
+		Version:      e.crt.Version,
+		HardwareType: TypeEasyFlash,
+		EXROM:        e.crt.EXROM,
+		GAME:         e.crt.GAME,
+		Path:         e.crt.Path,
+	}
+	for bank := 0; bank < flashSize/BankSize; bank++ {
+		for _, chip := range []struct {
+			flash   *am29f040
+			address uint16
+		}{{e.roml, 0x8000}, {e.romh, 0xa000}} {
+			data := chip.flash.data[bank*BankSize : (bank+1)*BankSize]
+			if erased(data) {
+				continue
+			}
+			crt.Chips = append(crt.Chips, Chip{
+				Type:        ChipFlash,
+				Bank:        uint16(bank),
+				LoadAddress: chip.address,
+				Data:        append([]byte{}, data...),
+			})
+		}
+	}
+
+	if err := os.WriteFile(crt.Path, crt.Bytes(), 0644); err != nil {
+		return err
+	}
+	e.crt = crt
+	e.roml.modified = false
+	e.romh.modified = false
+	return nil
+}
+
+func erased(data []byte) bool {
+	for _, value := range data {
+		if value != 0xff {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package cartridge
+
+import "github.com/gentoomaniac/go64/pkg/snapshot"
+
+// am29f040 emulates the command state machine of the 512kB AMD Am29F040 flash. Commands are unlocked by
+// writing $aa to $555 and $55 to $2aa, only the lower 11 address bits are decoded for the command cycles.
+// Programming and erasing finish immediately, so data polling succeeds on the first read.
+// http://www.datasheetarchive.com/Am29F040-datasheet.html
+type am29f040 struct {
+	data     [flashSize]byte
+	state    flashState
+	modified bool
+}
+
+const (
+	flashSize       = 0x80000
+	flashSectorSize = 0x10000
+
+	flashManufacturer byte = 0x01
+	flashDevice       byte = 0xa4
+)
+
+type flashState int
+
+const (
+	flashRead flashState = iota
+	flashUnlocked1
+	flashUnlocked2
+	flashAutoselect
+	flashProgram
+	flashEraseSetup
+	flashEraseUnlocked1
+	flashEraseUnlocked2
+)
+
+func newFlash() *am29f040 {
+	f := &am29f040{}
+	for i := range f.data {
+		f.data[i] = 0xff
+	}
+	return f
+}
+
+func (f *am29f040) read(addr uint32) byte {
+	addr &= flashSize - 1
+	if f.state == flashAutoselect {
+		switch addr & 0x03 {
+		case 0x00:
+			return flashManufacturer
+		case 0x01:
+			return flashDevice
+		case 0x02:
+			// no sector is write protected
+			return 0x00
+		}
+	}
+	return f.data[addr]
+}
+
+func (f *am29f040) write(addr uint32, value byte) {
+	addr &= flashSize - 1
+	command := addr & 0x7ff
+
+	switch f.state {
+	case flashRead, flashAutoselect:
+		switch {
+		case value == 0xf0:
+			f.state = flashRead
+		case command == 0x555 && value == 0xaa:
+			f.state = flashUnlocked1
+		}
+
+	case flashUnlocked1:
+		f.state = flashRead
+		if command == 0x2aa && value == 0x55 {
+			f.state = flashUnlocked2
+		}
+
+	case flashUnlocked2:
+		f.state = flashRead
+		if command != 0x555 {
+			return
+		}
+		switch value {
+		case 0x90:
+			f.state = flashAutoselect
+		case 0xa0:
+			f.state = flashProgram
+		case 0x80:
+			f.state = flashEraseSetup
+		}
+
+	case flashProgram:
+		// programming can only clear bits
+		f.data[addr] &= value
+		f.modified = true
+		f.state = flashRead
+
+	case flashEraseSetup:
+		f.state = flashRead
+		if command == 0x555 && value == 0xaa {
+			f.state = flashEraseUnlocked1
+		}
+
+	case flashEraseUnlocked1:
+		f.state = flashRead
+		if command == 0x2aa && value == 0x55 {
+			f.state = flashEraseUnlocked2
+		}
+
+	case flashEraseUnlocked2:
+		f.state = flashRead
+		switch {
+		case value == 0x30:
+			f.erase(addr&^(flashSectorSize-1), flashSectorSize)
+		case command == 0x555 && value == 0x10:
+			f.erase(0, flashSize)
+		}
+	}
+}
+
+func (f *am29f040) erase(start uint32, size uint32) {
+	for i := start; i < start+size; i++ {
+		f.data[i] = 0xff
+	}
+	f.modified = true
+}
+
+func (f *am29f040) snapshot(s *snapshot.State) {
+	state := byte(f.state)
+	s.Byte(&state)
+	f.state = flashState(state)
+	s.Bool(&f.modified)
+	if f.modified {
+		s.Bytes(f.data[:])
+	}
+}
@@ -0,0 +1,133 @@
+package cartridge
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+// flashCommand writes the unlock cycles followed by the command
+func flashCommand(write func(addr uint32, value byte), command byte) {
+	write(0x555, 0xaa)
+	write(0x2aa, 0x55)
+	write(0x555, command)
+}
+
+func TestFlash(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Am29F040", func() {
+		g.It("programs bytes", func() {
+			f := newFlash()
+			f.write(0x1234, 0x00)
+			g.Assert(f.read(0x1234)).Equal(uint8(0xff))
+
+			flashCommand(f.write, 0xa0)
+			f.write(0x1234, 0x5a)
+			g.Assert(f.read(0x1234)).Equal(uint8(0x5a))
+			g.Assert(f.modified).IsTrue()
+
+			// bits can't be set by programming
+			flashCommand(f.write, 0xa0)
+			f.write(0x1234, 0xa5)
+			g.Assert(f.read(0x1234)).Equal(uint8(0x00))
+		})
+
+		g.It("decodes only 11 address bits for commands", func() {
+			f := newFlash()
+			f.write(0x12555, 0xaa)
+			f.write(0x4aaa, 0x55)
+			f.write(0x7d55, 0xa0)
+			f.write(0x0010, 0x42)
+			g.Assert(f.read(0x0010)).Equal(uint8(0x42))
+		})
+
+		g.It("ignores broken command sequences", func() {
+			f := newFlash()
+			f.write(0x555, 0xaa)
+			f.write(0x2aa, 0x56)
+			f.write(0x555, 0xa0)
+			f.write(0x0010, 0x42)
+			g.Assert(f.read(0x0010)).Equal(uint8(0xff))
+		})
+
+		g.It("identifies itself in autoselect mode", func() {
+			f := newFlash()
+			flashCommand(f.write, 0x90)
+			g.Assert(f.read(0x0000)).Equal(flashManufacturer)
+			g.Assert(f.read(0x0001)).Equal(flashDevice)
+			g.Assert(f.read(0x10002)).Equal(uint8(0x00))
+			f.write(0x0000, 0xf0)
+			g.Assert(f.read(0x0000)).Equal(uint8(0xff))
+		})
+
+		g.It("erases sectors and the whole chip", func() {
+			f := newFlash()
+			for _, addr := range []uint32{0x00000, 0x10000, 0x1ffff, 0x20000} {
+				flashCommand(f.write, 0xa0)
+				f.write(addr, 0x00)
+			}
+
+			flashCommand(f.write, 0x80)
+			f.write(0x555, 0xaa)
+			f.write(0x2aa, 0x55)
+			f.write(0x18000, 0x30)
+			g.Assert(f.read(0x00000)).Equal(uint8(0x00))
+			g.Assert(f.read(0x10000)).Equal(uint8(0xff))
+			g.Assert(f.read(0x1ffff)).Equal(uint8(0xff))
+			g.Assert(f.read(0x20000)).Equal(uint8(0x00))
+
+			flashCommand(f.write, 0x80)
+			flashCommand(f.write, 0x10)
+			g.Assert(f.read(0x00000)).Equal(uint8(0xff))
+			g.Assert(f.read(0x20000)).Equal(uint8(0xff))
+		})
+	})
+
+	g.Describe("EasyFlash", func() {
+		newEasyFlashCartridge := func() *easyFlash {
+			return newTestCartridge(newTestCRT(TypeEasyFlash, 1, 0,
+				testChip{0, 0x8000, 0x2000, 0x10}, testChip{0, 0xa000, 0x2000, 0x20})).(*easyFlash)
+		}
+
+		g.It("has 256 bytes of RAM in IO2", func() {
+			e := newEasyFlashCartridge()
+			e.WriteIO(0xdf80, 0x42)
+			v, ok := e.ReadIO(0xdf80)
+			g.Assert(ok).IsTrue()
+			g.Assert(v).Equal(uint8(0x42))
+			_, ok = e.ReadIO(0xde00)
+			g.Assert(ok).IsFalse()
+		})
+
+		g.It("programs the flash of the selected bank", func() {
+			e := newEasyFlashCartridge()
+			e.WriteIO(0xde00, 0x05)
+			flashCommand(func(addr uint32, value byte) { e.WriteROMH(uint16(addr), value) }, 0xa0)
+			e.WriteROMH(0x0100, 0x33)
+			g.Assert(e.ReadROMH(0x0100)).Equal(uint8(0x33))
+			g.Assert(e.romh.data[5*BankSize+0x100]).Equal(uint8(0x33))
+			g.Assert(e.Modified()).IsTrue()
+		})
+
+		g.It("writes the flash back to the CRT file", func() {
+			e := newEasyFlashCartridge()
+			e.crt.Path = filepath.Join(t.TempDir(), "test.crt")
+			e.WriteIO(0xde00, 0x02)
+			flashCommand(func(addr uint32, value byte) { e.WriteROML(uint16(addr), value) }, 0xa0)
+			e.WriteROML(0x0000, 0x44)
+
+			g.Assert(e.Save()).IsNil()
+			g.Assert(e.Modified()).IsFalse()
+
+			cart, err := Load(e.crt.Path)
+			g.Assert(err).IsNil()
+			g.Assert(len(cart.(*easyFlash).crt.Chips)).Equal(3)
+			g.Assert(cart.ReadROML(0x0000)).Equal(uint8(0x10))
+			g.Assert(cart.ReadROMH(0x0000)).Equal(uint8(0x20))
+			cart.WriteIO(0xde00, 0x02)
+			g.Assert(cart.ReadROML(0x0000)).Equal(uint8(0x44))
+		})
+	})
+}
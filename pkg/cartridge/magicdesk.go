@@ -0,0 +1,42 @@
+package cartridge
+
+import "github.com/gentoomaniac/go64/pkg/snapshot"
+
+// magicDesk is an 8kB cartridge with up to 128 banks selected by writing to $de00. Setting bit 7 disables
+// the cartridge until the next write.
+type magicDesk struct {
+	noIO
+	crt      *CRT
+	banks    banks
+	bank     int
+	disabled bool
+}
+
+func newMagicDesk(crt *CRT) (Cartridge, error) {
+	return &magicDesk{crt: crt, banks: chipBanks(crt)}, nil
+}
+
+func (m *magicDesk) GAME() bool  { return true }
+func (m *magicDesk) EXROM() bool { return m.disabled }
+
+func (m *magicDesk) Reset() {
+	m.bank = 0
+	m.disabled = false
+}
+
+func (m *magicDesk) image() *CRT { return m.crt }
+
+func (m *magicDesk) state(s *snapshot.State) {
+	s.Int(&m.bank)
+	s.Bool(&m.disabled)
+}
+
+func (m *magicDesk) ReadROML(offset uint16) byte { return m.banks.read(m.bank, offset) }
+func (m *magicDesk) ReadROMH(offset uint16) byte { return 0xff }
+
+func (m *magicDesk) WriteIO(addr uint16, value byte) {
+	if addr < 0xdf00 {
+		m.bank = int(value & 0x7f)
+		m.disabled = value&0x80 != 0
+	}
+}
@@ -0,0 +1,32 @@
+package cartridge
+
+import "github.com/gentoomaniac/go64/pkg/snapshot"
+
+// normal is the generic cartridge with 8kB or 16kB of ROM, or an Ultimax cartridge with ROMH at $e000.
+// The lines never change and are taken from the CRT header.
+type normal struct {
+	noIO
+	crt         *CRT
+	roml, romh  banks
+	game, exrom bool
+}
+
+func newNormal(crt *CRT) (Cartridge, error) {
+	n := &normal{
+		crt:   crt,
+		game:  crt.GAME != 0,
+		exrom: crt.EXROM != 0,
+	}
+	n.roml, n.romh = splitChips(crt)
+	return n, nil
+}
+
+func (n *normal) GAME() bool  { return n.game }
+func (n *normal) EXROM() bool { return n.exrom }
+func (n *normal) Reset()      {}
+
+func (n *normal) image() *CRT             { return n.crt }
+func (n *normal) state(s *snapshot.State) {}
+
+func (n *normal) ReadROML(offset uint16) byte { return n.roml.read(0, offset) }
+func (n *normal) ReadROMH(offset uint16) byte { return n.romh.read(0, offset) }
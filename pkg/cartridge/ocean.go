@@ -0,0 +1,38 @@
+package cartridge
+
+import "github.com/gentoomaniac/go64/pkg/snapshot"
+
+// ocean switches one of up to 64 banks into ROML and ROMH by writing to $de00. 128kB and 256kB cartridges
+// run in 16kB mode, the 512kB ones in 8kB mode, which is stored in the CRT header.
+type ocean struct {
+	noIO
+	crt         *CRT
+	banks       banks
+	bank        int
+	game, exrom bool
+}
+
+func newOcean(crt *CRT) (Cartridge, error) {
+	return &ocean{
+		crt:   crt,
+		banks: chipBanks(crt),
+		game:  crt.GAME != 0,
+		exrom: crt.EXROM != 0,
+	}, nil
+}
+
+func (o *ocean) GAME() bool  { return o.game }
+func (o *ocean) EXROM() bool { return o.exrom }
+func (o *ocean) Reset()      { o.bank = 0 }
+
+func (o *ocean) image() *CRT             { return o.crt }
+func (o *ocean) state(s *snapshot.State) { s.Int(&o.bank) }
+
+func (o *ocean) ReadROML(offset uint16) byte { return o.banks.read(o.bank, offset) }
+func (o *ocean) ReadROMH(offset uint16) byte { return o.banks.read(o.bank, offset) }
+
+func (o *ocean) WriteIO(addr uint16, value byte) {
+	if addr < 0xdf00 {
+		o.bank = int(value & 0x3f)
+	}
+}
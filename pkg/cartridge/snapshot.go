@@ -0,0 +1,57 @@
+package cartridge
+
+import (
+	"fmt"
+
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+// mapper is implemented by the mappers of this package so that cartridges can be stored in snapshots
+type mapper interface {
+	Cartridge
+	image() *CRT
+	state(s *snapshot.State)
+}
+
+// SaveState stores the CRT image and the state of the mapper in a snapshot
+func SaveState(cart Cartridge, s *snapshot.State) error {
+	m, ok := cart.(mapper)
+	if !ok {
+		return fmt.Errorf("cartridge %T doesn't support snapshots", cart)
+	}
+
+	crt := m.image()
+	image, path := crt.Bytes(), crt.Path
+	s.Slice(&image)
+	s.String(&path)
+	m.state(s)
+	return s.Err()
+}
+
+// LoadState creates the cartridge from the CRT image stored in a snapshot and restores the state of the mapper
+func LoadState(s *snapshot.State) (Cartridge, error) {
+	var image []byte
+	var path string
+	s.Slice(&image)
+	s.String(&path)
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+
+	crt, err := ParseCRT(image)
+	if err != nil {
+		return nil, err
+	}
+	crt.Path = path
+	cart, err := New(crt)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := cart.(mapper)
+	if !ok {
+		return nil, fmt.Errorf("cartridge %T doesn't support snapshots", cart)
+	}
+	m.state(s)
+	return cart, s.Err()
+}
@@ -0,0 +1,516 @@
+package cia
+
+import "github.com/gentoomaniac/go64/pkg/snapshot"
+
+// CIA emulates the MOS 6526 Complex Interface Adapter
+// http://archive.6502.org/datasheets/mos_6526_cia_recreated.pdf
+type CIA struct {
+	pra, prb   byte
+	ddra, ddrb byte
+
+	timerA timer
+	timerB timer
+	// pb6 and pb7 are the timer outputs on port B
+	pb6, pb7 bool
+
+	tod tod
+
+	sdr byte
+	// srBits counts the bits left to shift, srShift holds the bits being shifted
+	srBits  int
+	srShift byte
+	srClock bool
+	// sp and cnt are the levels of the serial port lines
+	sp, cnt bool
+
+	icr  byte
+	mask byte
+	irq  bool
+
+	// PortAIn and PortBIn return the levels of the port pins as driven by the peripherals
+	PortAIn func() byte
+	PortBIn func() byte
+	// PortAOut and PortBOut are called whenever the output of a port changes
+	PortAOut func(value byte)
+	PortBOut func(value byte)
+	// SPOut is called for every bit shifted out of the serial port, CNTOut when CIA drives CNT
+	SPOut  func(level bool)
+	CNTOut func(level bool)
+	// IRQ is called whenever the state of the IRQ output changes
+	IRQ func(active bool)
+}
+
+type timer struct {
+	counter uint16
+	latch   uint16
+	control byte
+}
+
+// Registers
+const (
+	PRA uint16 = iota
+	PRB
+	DDRA
+	DDRB
+	TALO
+	TAHI
+	TBLO
+	TBHI
+	TOD10TH
+	TODSEC
+	TODMIN
+	TODHR
+	SDR
+	ICR
+	CRA
+	CRB
+)
+
+// Interrupt sources of the ICR
+const (
+	InterruptTA    byte = 0x01
+	InterruptTB    byte = 0x02
+	InterruptAlarm byte = 0x04
+	InterruptSP    byte = 0x08
+	InterruptFLAG  byte = 0x10
+	InterruptIR    byte = 0x80
+)
+
+// control register bits
+const (
+	controlStart    byte = 0x01
+	controlPBOn     byte = 0x02
+	controlToggle   byte = 0x04
+	controlOneShot  byte = 0x08
+	controlLoad     byte = 0x10
+	controlInMode   byte = 0x20
+	controlSPOutput byte = 0x40
+	controlTOD50Hz  byte = 0x80
+	controlAlarm    byte = 0x80
+)
+
+// Reset puts the CIA into the power on state
+func (c *CIA) Reset() {
+	c.pra, c.prb, c.ddra, c.ddrb = 0, 0, 0, 0
+	c.timerA = timer{counter: 0xffff, latch: 0xffff}
+	c.timerB = timer{counter: 0xffff, latch: 0xffff}
+	c.pb6, c.pb7 = false, false
+	c.tod.reset()
+	c.sdr, c.srBits = 0, 0
+	c.sp, c.cnt = true, true
+	c.icr, c.mask = 0, 0
+	c.updateIRQ()
+	c.portAChanged()
+	c.portBChanged()
+}
+
+/* Interrupts */
+
+func (c *CIA) updateIRQ() {
+	irq := c.icr&c.mask&0x1f != 0
+	if irq != c.irq {
+		c.irq = irq
+		if c.IRQ != nil {
+			c.IRQ(irq)
+		}
+	}
+}
+
+func (c *CIA) interrupt(source byte) {
+	c.icr |= source
+	c.updateIRQ()
+}
+
+// IRQActive returns true if the CIA is pulling its IRQ line
+func (c *CIA) IRQActive() bool {
+	return c.irq
+}
+
+// TriggerFLAG signals a negative edge on the FLAG input
+func (c *CIA) TriggerFLAG() {
+	c.interrupt(InterruptFLAG)
+}
+
+/* Ports */
+
+// OutputA returns the levels of the port A pins driven by the CIA, input pins read as 1 because of the pull ups
+func (c *CIA) OutputA() byte {
+	return c.pra | ^c.ddra
+}
+
+// OutputB returns the levels of the port B pins driven by the CIA including the timer outputs on PB6 and PB7,
+// input pins read as 1 because of the pull ups
+func (c *CIA) OutputB() byte {
+	value := c.prb | ^c.ddrb
+	if c.timerA.control&controlPBOn != 0 {
+		value &^= 0x40
+		if c.pb6 {
+			value |= 0x40
+		}
+	}
+	if c.timerB.control&controlPBOn != 0 {
+		value &^= 0x80
+		if c.pb7 {
+			value |= 0x80
+		}
+	}
+	return value
+}
+
+func (c *CIA) portAChanged() {
+	if c.PortAOut != nil {
+		c.PortAOut(c.OutputA())
+	}
+}
+
+func (c *CIA) portBChanged() {
+	if c.PortBOut != nil {
+		c.PortBOut(c.OutputB())
+	}
+}
+
+// readA returns the level of the port A pins. Outputs can be pulled low from outside, e.g. by the keyboard.
+func (c *CIA) readA() byte {
+	value := c.OutputA()
+	if c.PortAIn != nil {
+		value &= c.PortAIn()
+	}
+	return value
+}
+
+func (c *CIA) readB() byte {
+	value := c.OutputB()
+	if c.PortBIn != nil {
+		value &= c.PortBIn()
+	}
+	return value
+}
+
+/* Timers */
+
+// Tick advances the CIA by one phi2 cycle
+func (c *CIA) Tick() {
+	if c.timerA.running() && c.timerA.control&controlInMode == 0 {
+		c.countA()
+	}
+	if c.timerB.running() && c.timerB.control&0x60 == 0x00 {
+		c.countB()
+	}
+}
+
+func (t *timer) running() bool {
+	return t.control&controlStart != 0
+}
+
+// count decrements the timer and returns true on underflow, the underflow happens one cycle after reaching 0
+func (t *timer) count() bool {
+	if t.counter != 0 {
+		t.counter--
+		return false
+	}
+
+	t.counter = t.latch
+	if t.control&controlOneShot != 0 {
+		t.control &^= controlStart
+	}
+	return true
+}
+
+func (c *CIA) countA() {
+	if !c.timerA.count() {
+		return
+	}
+
+	c.interrupt(InterruptTA)
+	c.pb6 = timerOutput(&c.timerA, c.pb6)
+	if c.timerA.control&controlPBOn != 0 {
+		c.portBChanged()
+	}
+
+	if c.timerA.control&controlSPOutput != 0 {
+		c.shiftOut()
+	}
+
+	switch c.timerB.control & 0x60 {
+	case 0x40:
+		if c.timerB.running() {
+			c.countB()
+		}
+	case 0x60:
+		if c.timerB.running() && c.cnt {
+			c.countB()
+		}
+	}
+}
+
+func (c *CIA) countB() {
+	if !c.timerB.count() {
+		return
+	}
+
+	c.interrupt(InterruptTB)
+	c.pb7 = timerOutput(&c.timerB, c.pb7)
+	if c.timerB.control&controlPBOn != 0 {
+		c.portBChanged()
+	}
+}
+
+// timerOutput returns the new level of the timer output on port B after an underflow
+func timerOutput(t *timer, level bool) bool {
+	if t.control&controlToggle != 0 {
+		return !level
+	}
+	// in pulse mode the output is high for one cycle, which is not visible between two Ticks
+	return false
+}
+
+// SetCNT sets the level of the CNT input. Positive edges are counted by the timers and clock the serial port.
+func (c *CIA) SetCNT(level bool) {
+	rising := level && !c.cnt
+	c.cnt = level
+	if !rising {
+		return
+	}
+
+	if c.timerA.running() && c.timerA.control&controlInMode != 0 {
+		c.countA()
+	}
+	if c.timerB.running() && c.timerB.control&0x60 == 0x20 {
+		c.countB()
+	}
+	if c.timerA.control&controlSPOutput == 0 {
+		c.shiftIn()
+	}
+}
+
+// SetSP sets the level of the SP input
+func (c *CIA) SetSP(level bool) {
+	c.sp = level
+}
+
+/* Serial port */
+
+func (c *CIA) shiftIn() {
+	c.srShift = c.srShift << 1
+	if c.sp {
+		c.srShift |= 0x01
+	}
+	c.srBits++
+	if c.srBits == 8 {
+		c.srBits = 0
+		c.sdr = c.srShift
+		c.interrupt(InterruptSP)
+	}
+}
+
+// shiftOut is called on every timer A underflow in output mode, two underflows shift one bit
+func (c *CIA) shiftOut() {
+	if c.srBits == 0 {
+		return
+	}
+
+	c.srClock = !c.srClock
+	if c.CNTOut != nil {
+		c.CNTOut(c.srClock)
+	}
+	if c.srClock {
+		return
+	}
+
+	c.sp = c.srShift&0x80 != 0
+	if c.SPOut != nil {
+		c.SPOut(c.sp)
+	}
+	c.srShift <<= 1
+	c.srBits--
+	if c.srBits == 0 {
+		c.interrupt(InterruptSP)
+	}
+}
+
+/* Register access */
+
+// TickTOD has to be called with the frequency of the power line (50 or 60 Hz)
+func (c *CIA) TickTOD() {
+	if c.tod.tick(c.timerA.control&controlTOD50Hz != 0) {
+		c.interrupt(InterruptAlarm)
+	}
+}
+
+// Read reads one of the 16 registers, only the lower 4 bits of the address are decoded
+func (c *CIA) Read(register uint16) byte {
+	switch register & 0x0f {
+	case TOD10TH:
+		return c.tod.read10th()
+	case TODHR:
+		return c.tod.readHours()
+	case ICR:
+		value := c.Peek(register)
+		c.icr = 0
+		c.updateIRQ()
+		return value
+	}
+	return c.Peek(register)
+}
+
+// Peek returns the value of a register without any side effects
+func (c *CIA) Peek(register uint16) byte {
+	switch register & 0x0f {
+	case PRA:
+		return c.readA()
+	case PRB:
+		return c.readB()
+	case DDRA:
+		return c.ddra
+	case DDRB:
+		return c.ddrb
+	case TALO:
+		return byte(c.timerA.counter)
+	case TAHI:
+		return byte(c.timerA.counter >> 8)
+	case TBLO:
+		return byte(c.timerB.counter)
+	case TBHI:
+		return byte(c.timerB.counter >> 8)
+	case TOD10TH:
+		return c.tod.value(0)
+	case TODSEC:
+		return c.tod.value(1)
+	case TODMIN:
+		return c.tod.value(2)
+	case TODHR:
+		return c.tod.value(3)
+	case SDR:
+		return c.sdr
+	case ICR:
+		if c.irq {
+			return c.icr | InterruptIR
+		}
+		return c.icr
+	case CRA:
+		return c.timerA.control &^ controlLoad
+	default:
+		return c.timerB.control &^ controlLoad
+	}
+}
+
+// Write writes one of the 16 registers, only the lower 4 bits of the address are decoded
+func (c *CIA) Write(register uint16, value byte) {
+	switch register & 0x0f {
+	case PRA:
+		c.pra = value
+		c.portAChanged()
+	case PRB:
+		c.prb = value
+		c.portBChanged()
+	case DDRA:
+		c.ddra = value
+		c.portAChanged()
+	case DDRB:
+		c.ddrb = value
+		c.portBChanged()
+	case TALO:
+		c.timerA.latch = (c.timerA.latch & 0xff00) | uint16(value)
+	case TAHI:
+		c.timerA.writeHigh(value)
+	case TBLO:
+		c.timerB.latch = (c.timerB.latch & 0xff00) | uint16(value)
+	case TBHI:
+		c.timerB.writeHigh(value)
+	case TOD10TH, TODSEC, TODMIN, TODHR:
+		c.tod.write(int(register&0x0f)-int(TOD10TH), value, c.timerB.control&controlAlarm != 0)
+	case SDR:
+		c.sdr = value
+		if c.timerA.control&controlSPOutput != 0 {
+			c.srShift = value
+			c.srBits = 8
+		}
+	case ICR:
+		if value&0x80 != 0 {
+			c.mask |= value & 0x1f
+		} else {
+			c.mask &^= value & 0x1f
+		}
+		c.updateIRQ()
+	case CRA:
+		if (value^c.timerA.control)&controlSPOutput != 0 {
+			c.srBits = 0
+		}
+		c.timerA.writeControl(value)
+		c.portBChanged()
+	case CRB:
+		c.timerB.writeControl(value)
+		c.portBChanged()
+	}
+}
+
+func (t *timer) writeHigh(value byte) {
+	t.latch = (t.latch & 0x00ff) | uint16(value)<<8
+	if !t.running() {
+		t.counter = t.latch
+	}
+}
+
+func (t *timer) writeControl(value byte) {
+	if value&controlLoad != 0 {
+		t.counter = t.latch
+	}
+	t.control = value &^ controlLoad
+}
+
+// Registers is the externally visible state of a CIA as stored in the snapshots of other emulators
+type Registers struct {
+	PRA, PRB, DDRA, DDRB byte
+	// TimerA and TimerB are the counters, LatchA and LatchB the values they are reloaded with
+	TimerA, TimerB uint16
+	LatchA, LatchB uint16
+	CRA, CRB       byte
+	SDR            byte
+	// ICR holds the pending interrupts, Mask the enabled ones
+	ICR, Mask byte
+	// TOD and Alarm are the 10ths, seconds, minutes and hours in BCD
+	TOD, Alarm [4]byte
+	TODHalted  bool
+}
+
+// SetRegisters puts the CIA into the given state, the outputs and the IRQ line are updated
+func (c *CIA) SetRegisters(r Registers) {
+	c.pra, c.prb, c.ddra, c.ddrb = r.PRA, r.PRB, r.DDRA, r.DDRB
+	c.timerA = timer{counter: r.TimerA, latch: r.LatchA, control: r.CRA &^ controlLoad}
+	c.timerB = timer{counter: r.TimerB, latch: r.LatchB, control: r.CRB &^ controlLoad}
+	c.sdr, c.srBits = r.SDR, 0
+	c.icr, c.mask = r.ICR&0x1f, r.Mask&0x1f
+
+	c.tod.reset()
+	c.tod.time, c.tod.alarm = r.TOD, r.Alarm
+	c.tod.halted = r.TODHalted
+
+	c.updateIRQ()
+	c.portAChanged()
+	c.portBChanged()
+}
+
+// State saves or restores the registers and the internal state of the CIA
+func (c *CIA) State(s *snapshot.State) {
+	s.Byte(&c.pra)
+	s.Byte(&c.prb)
+	s.Byte(&c.ddra)
+	s.Byte(&c.ddrb)
+	for _, t := range []*timer{&c.timerA, &c.timerB} {
+		s.Uint16(&t.counter)
+		s.Uint16(&t.latch)
+		s.Byte(&t.control)
+	}
+	s.Bool(&c.pb6)
+	s.Bool(&c.pb7)
+	c.tod.state(s)
+	s.Byte(&c.sdr)
+	s.Int(&c.srBits)
+	s.Byte(&c.srShift)
+	s.Bool(&c.srClock)
+	s.Bool(&c.sp)
+	s.Bool(&c.cnt)
+	s.Byte(&c.icr)
+	s.Byte(&c.mask)
+	s.Bool(&c.irq)
+}
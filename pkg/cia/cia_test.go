@@ -0,0 +1,229 @@
+package cia
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func newTestCIA() *CIA {
+	c := &CIA{}
+	c.Reset()
+	return c
+}
+
+func TestTimers(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Timer A", func() {
+		g.It("underflows every N+1 cycles in continuous mode", func() {
+			c := newTestCIA()
+			c.Write(TALO, 0x02)
+			c.Write(TAHI, 0x00)
+			c.Write(CRA, 0x11)
+
+			underflows := []int{}
+			for cycle := 1; cycle <= 9; cycle++ {
+				c.Tick()
+				if c.Read(ICR)&InterruptTA != 0 {
+					underflows = append(underflows, cycle)
+				}
+			}
+			g.Assert(underflows).Equal([]int{3, 6, 9})
+		})
+
+		g.It("stops after one underflow in one shot mode", func() {
+			c := newTestCIA()
+			c.Write(TALO, 0x01)
+			c.Write(TAHI, 0x00)
+			c.Write(CRA, 0x19)
+			c.Tick()
+			c.Tick()
+			g.Assert(c.Peek(CRA) & controlStart).Equal(uint8(0))
+			g.Assert(c.Peek(TALO)).Equal(uint8(0x01))
+			g.Assert(c.Read(ICR)).Equal(InterruptTA)
+			c.Tick()
+			c.Tick()
+			g.Assert(c.Read(ICR)).Equal(uint8(0))
+		})
+
+		g.It("toggles PB6", func() {
+			c := newTestCIA()
+			c.Write(TALO, 0x00)
+			c.Write(TAHI, 0x00)
+			c.Write(CRA, 0x07)
+			g.Assert(c.OutputB() & 0x40).Equal(uint8(0x00))
+			c.Tick()
+			g.Assert(c.OutputB() & 0x40).Equal(uint8(0x40))
+			c.Tick()
+			g.Assert(c.OutputB() & 0x40).Equal(uint8(0x00))
+		})
+	})
+
+	g.Describe("Timer B", func() {
+		g.It("counts timer A underflows", func() {
+			c := newTestCIA()
+			c.Write(TALO, 0x01)
+			c.Write(TAHI, 0x00)
+			c.Write(TBLO, 0x02)
+			c.Write(TBHI, 0x00)
+			c.Write(CRB, 0x41)
+			c.Write(CRA, 0x01)
+			for i := 0; i < 5; i++ {
+				c.Tick()
+			}
+			g.Assert(c.Peek(ICR) & InterruptTB).Equal(uint8(0))
+			c.Tick()
+			g.Assert(c.Peek(ICR) & InterruptTB).Equal(InterruptTB)
+		})
+
+		g.It("counts positive CNT edges", func() {
+			c := newTestCIA()
+			c.Write(TBLO, 0x05)
+			c.Write(TBHI, 0x00)
+			c.Write(CRB, 0x21)
+			c.Tick()
+			g.Assert(c.Peek(TBLO)).Equal(uint8(0x05))
+			c.SetCNT(false)
+			c.SetCNT(true)
+			g.Assert(c.Peek(TBLO)).Equal(uint8(0x04))
+		})
+	})
+}
+
+func TestInterrupts(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Interrupt control", func() {
+		g.It("only asserts IRQ for enabled sources", func() {
+			c := newTestCIA()
+			irq := false
+			c.IRQ = func(active bool) { irq = active }
+
+			c.TriggerFLAG()
+			g.Assert(irq).IsFalse()
+			g.Assert(c.Peek(ICR)).Equal(InterruptFLAG)
+
+			c.Write(ICR, 0x80|InterruptFLAG)
+			g.Assert(irq).IsTrue()
+			g.Assert(c.Read(ICR)).Equal(InterruptIR | InterruptFLAG)
+			g.Assert(irq).IsFalse()
+			g.Assert(c.Read(ICR)).Equal(uint8(0))
+
+			c.Write(ICR, InterruptFLAG)
+			c.TriggerFLAG()
+			g.Assert(irq).IsFalse()
+		})
+	})
+}
+
+func TestPorts(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Ports", func() {
+		g.It("mixes output register and pins according to the data direction", func() {
+			c := newTestCIA()
+			c.PortAIn = func() byte { return 0xfd }
+			c.Write(DDRA, 0xf0)
+			c.Write(PRA, 0x50)
+			g.Assert(c.Read(PRA)).Equal(uint8(0x5d))
+			g.Assert(c.OutputA()).Equal(uint8(0x5f))
+		})
+
+		g.It("notifies about output changes", func() {
+			c := newTestCIA()
+			out := byte(0)
+			c.PortBOut = func(value byte) { out = value }
+			c.Write(DDRB, 0xff)
+			c.Write(PRB, 0x3c)
+			g.Assert(out).Equal(uint8(0x3c))
+		})
+	})
+
+	g.Describe("Serial port", func() {
+		g.It("shifts out at half the timer A rate", func() {
+			c := newTestCIA()
+			bits := byte(0)
+			c.SPOut = func(level bool) {
+				bits <<= 1
+				if level {
+					bits |= 1
+				}
+			}
+			c.Write(TALO, 0x00)
+			c.Write(TAHI, 0x00)
+			c.Write(CRA, 0x41)
+			c.Write(SDR, 0xa5)
+			for i := 0; i < 15; i++ {
+				c.Tick()
+			}
+			g.Assert(c.Peek(ICR) & InterruptSP).Equal(uint8(0))
+			c.Tick()
+			g.Assert(bits).Equal(uint8(0xa5))
+			g.Assert(c.Peek(ICR) & InterruptSP).Equal(InterruptSP)
+		})
+
+		g.It("shifts in on CNT", func() {
+			c := newTestCIA()
+			for _, bit := range []bool{false, true, true, false, false, true, false, true} {
+				c.SetSP(bit)
+				c.SetCNT(false)
+				c.SetCNT(true)
+			}
+			g.Assert(c.Peek(SDR)).Equal(uint8(0x65))
+			g.Assert(c.Peek(ICR) & InterruptSP).Equal(InterruptSP)
+		})
+	})
+}
+
+func TestTOD(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Time of day clock", func() {
+		g.It("counts in BCD and switches to PM", func() {
+			c := newTestCIA()
+			c.Write(CRA, 0x80)
+			c.Write(TODHR, 0x11)
+			c.Write(TODMIN, 0x59)
+			c.Write(TODSEC, 0x59)
+			c.Write(TOD10TH, 0x09)
+			for i := 0; i < 5; i++ {
+				c.TickTOD()
+			}
+			g.Assert(c.Read(TODHR)).Equal(uint8(0x92))
+			g.Assert(c.Read(TODMIN)).Equal(uint8(0x00))
+			g.Assert(c.Read(TODSEC)).Equal(uint8(0x00))
+			g.Assert(c.Read(TOD10TH)).Equal(uint8(0x00))
+		})
+
+		g.It("latches the time while reading", func() {
+			c := newTestCIA()
+			c.Write(CRA, 0x80)
+			c.Write(TODHR, 0x01)
+			c.Write(TOD10TH, 0x00)
+			c.Read(TODHR)
+			for i := 0; i < 5; i++ {
+				c.TickTOD()
+			}
+			g.Assert(c.Read(TOD10TH)).Equal(uint8(0x00))
+			g.Assert(c.Read(TOD10TH)).Equal(uint8(0x01))
+		})
+
+		g.It("triggers the alarm", func() {
+			c := newTestCIA()
+			c.Write(CRB, 0x80)
+			c.Write(TODHR, 0x01)
+			c.Write(TOD10TH, 0x02)
+			c.Write(CRB, 0x00)
+			c.Write(TODHR, 0x01)
+			c.Write(TOD10TH, 0x00)
+			for i := 0; i < 10; i++ {
+				c.TickTOD()
+			}
+			g.Assert(c.Peek(ICR) & InterruptAlarm).Equal(uint8(0))
+			c.TickTOD()
+			c.TickTOD()
+			g.Assert(c.Peek(ICR) & InterruptAlarm).Equal(InterruptAlarm)
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package cia
+
+import "github.com/gentoomaniac/go64/pkg/snapshot"
+
+// tod is the time of day clock with its 10ths of seconds, seconds, minutes and hours registers in BCD
+type tod struct {
+	time  [4]byte
+	alarm [4]byte
+	// reading the hours latches the time until the 10ths are read
+	latch   [4]byte
+	latched bool
+	// writing the hours stops the clock until the 10ths are written
+	halted    bool
+	prescaler int
+}
+
+var todMasks = [4]byte{0x0f, 0x7f, 0x7f, 0x9f}
+
+func (t *tod) reset() {
+	*t = tod{time: [4]byte{0, 0, 0, 1}, halted: true}
+}
+
+// tick is called with the power line frequency and returns true if the alarm time is reached
+func (t *tod) tick(is50Hz bool) bool {
+	if t.halted {
+		return false
+	}
+
+	limit := 6
+	if is50Hz {
+		limit = 5
+	}
+	t.prescaler++
+	if t.prescaler < limit {
+		return false
+	}
+	t.prescaler = 0
+
+	t.advance()
+	return t.time == t.alarm
+}
+
+func (t *tod) advance() {
+	if t.time[0] = (t.time[0] + 1) & 0x0f; t.time[0] < 10 {
+		return
+	}
+	t.time[0] = 0
+
+	if t.time[1] = incrementBCD(t.time[1]); t.time[1] < 0x60 {
+		return
+	}
+	t.time[1] = 0
+
+	if t.time[2] = incrementBCD(t.time[2]); t.time[2] < 0x60 {
+		return
+	}
+	t.time[2] = 0
+
+	pm, hours := t.time[3]&0x80, incrementBCD(t.time[3]&0x1f)
+	switch hours {
+	case 0x12:
+		pm ^= 0x80
+	case 0x13:
+		hours = 0x01
+	}
+	t.time[3] = pm | hours
+}
+
+func incrementBCD(value byte) byte {
+	value++
+	if value&0x0f == 0x0a {
+		value += 0x06
+	}
+	return value
+}
+
+func (t *tod) value(index int) byte {
+	if t.latched {
+		return t.latch[index]
+	}
+	return t.time[index]
+}
+
+func (t *tod) read10th() byte {
+	value := t.value(0)
+	t.latched = false
+	return value
+}
+
+func (t *tod) readHours() byte {
+	if !t.latched {
+		t.latch = t.time
+		t.latched = true
+	}
+	return t.latch[3]
+}
+
+func (t *tod) write(index int, value byte, alarm bool) {
+	value &= todMasks[index]
+	if alarm {
+		t.alarm[index] = value
+		return
+	}
+
+	t.time[index] = value
+	switch index {
+	case 0:
+		t.halted = false
+	case 3:
+		t.halted = true
+	}
+}
+
+func (t *tod) state(s *snapshot.State) {
+	s.Bytes(t.time[:])
+	s.Bytes(t.alarm[:])
+	s.Bytes(t.latch[:])
+	s.Bool(&t.latched)
+	s.Bool(&t.halted)
+	s.Int(&t.prescaler)
+}
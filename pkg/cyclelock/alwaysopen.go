@@ -1,6 +1,7 @@
 package cyclelock
 
-// AlwaysOpenLock is a CycleLock for testing that doesn't lock at all so that tests can run with full speed
+// AlwaysOpenLock is a CycleLock that doesn't lock at all, it is used by tests and by systems advancing their other
+// chips on the goroutine of the MPU
 type AlwaysOpenLock struct {
 	cycleCount int
 }
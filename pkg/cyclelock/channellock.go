@@ -1,6 +1,8 @@
 package cyclelock
 
-// ChannelLock uses a sync.mutex to lock the ressource
+// ChannelLock passes a token through a channel on every cycle, so that another goroutine can run in lockstep with
+// the MPU. The handover costs far more than the cycle itself, the emulation advances its chips on the goroutine of
+// the MPU instead.
 type ChannelLock struct {
 	cycleCount int
 	lock       chan bool
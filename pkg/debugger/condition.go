@@ -0,0 +1,146 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// State holds the values conditions can refer to
+type State struct {
+	A, X, Y, S, P byte
+	PC            uint16
+	RasterLine    uint16
+}
+
+// variables are the names usable in conditions
+var variables = map[string]func(s *State) int{
+	"A":  func(s *State) int { return int(s.A) },
+	"X":  func(s *State) int { return int(s.X) },
+	"Y":  func(s *State) int { return int(s.Y) },
+	"S":  func(s *State) int { return int(s.S) },
+	"SP": func(s *State) int { return int(s.S) },
+	"P":  func(s *State) int { return int(s.P) },
+	"PC": func(s *State) int { return int(s.PC) },
+	"RL": func(s *State) int { return int(s.RasterLine) },
+}
+
+// Condition is a parsed expression like "A == $20 && X > 3". Comparisons of registers and numbers are
+// combined with && and ||, && binds stronger.
+type Condition struct {
+	source string
+	// any of the terms has to be true, all comparisons of a term have to be true
+	terms [][]comparison
+}
+
+type comparison struct {
+	left, right operand
+	operator    string
+}
+
+// operand is a variable or a constant
+type operand struct {
+	variable func(s *State) int
+	value    int
+}
+
+func (o operand) get(s *State) int {
+	if o.variable != nil {
+		return o.variable(s)
+	}
+	return o.value
+}
+
+// ParseCondition parses a condition, numbers are decimal, hexadecimal with $ or binary with %
+func ParseCondition(source string) (*Condition, error) {
+	c := &Condition{source: strings.TrimSpace(source)}
+	for _, term := range strings.Split(source, "||") {
+		var comparisons []comparison
+		for _, text := range strings.Split(term, "&&") {
+			cmp, err := parseComparison(text)
+			if err != nil {
+				return nil, err
+			}
+			comparisons = append(comparisons, cmp)
+		}
+		c.terms = append(c.terms, comparisons)
+	}
+	return c, nil
+}
+
+func parseComparison(text string) (comparison, error) {
+	// two character operators have to be found first
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if i := strings.Index(text, operator); i >= 0 {
+			left, err := parseOperand(text[:i])
+			if err != nil {
+				return comparison{}, err
+			}
+			right, err := parseOperand(text[i+len(operator):])
+			if err != nil {
+				return comparison{}, err
+			}
+			return comparison{left, right, operator}, nil
+		}
+	}
+	return comparison{}, fmt.Errorf("missing comparison in %q", strings.TrimSpace(text))
+}
+
+func parseOperand(text string) (operand, error) {
+	text = strings.TrimSpace(text)
+	if variable, ok := variables[strings.ToUpper(text)]; ok {
+		return operand{variable: variable}, nil
+	}
+
+	base, digits := 10, text
+	switch {
+	case strings.HasPrefix(text, "$"):
+		base, digits = 16, text[1:]
+	case strings.HasPrefix(text, "%"):
+		base, digits = 2, text[1:]
+	}
+	value, err := strconv.ParseUint(digits, base, 16)
+	if err != nil {
+		return operand{}, fmt.Errorf("invalid operand %q", text)
+	}
+	return operand{value: int(value)}, nil
+}
+
+// Evaluate returns the result of the condition
+func (c *Condition) Evaluate(s *State) bool {
+	for _, term := range c.terms {
+		if all(term, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func all(comparisons []comparison, s *State) bool {
+	for _, cmp := range comparisons {
+		left, right := cmp.left.get(s), cmp.right.get(s)
+		var result bool
+		switch cmp.operator {
+		case "==":
+			result = left == right
+		case "!=":
+			result = left != right
+		case "<":
+			result = left < right
+		case ">":
+			result = left > right
+		case "<=":
+			result = left <= right
+		case ">=":
+			result = left >= right
+		}
+		if !result {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
@@ -0,0 +1,171 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the event a breakpoint triggers on
+type Kind uint8
+
+const (
+	// Exec triggers before the instruction at the address is executed
+	Exec Kind = 1 << iota
+	// Read and Write trigger on bus accesses to the address, the emulation stops after the instruction
+	Read
+	Write
+	// Raster triggers at the start of a raster line
+	Raster
+
+	Access = Read | Write
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Exec:
+		return "exec"
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	case Access:
+		return "access"
+	case Raster:
+		return "raster"
+	}
+	return fmt.Sprintf("kind %d", k)
+}
+
+// Breakpoint stops the emulation on an event in an address or raster line range
+type Breakpoint struct {
+	ID   int
+	Kind Kind
+	// Start and End are the inclusive range of addresses or raster lines
+	Start, End uint16
+	// Condition has to be true for the breakpoint to trigger, nil triggers always
+	Condition *Condition
+	Disabled  bool
+	// Trace starts the trace log instead of stopping the emulation
+	Trace bool
+	// Hits counts how often the breakpoint triggered
+	Hits int
+}
+
+func (b *Breakpoint) String() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "%d: ", b.ID)
+	if b.Trace {
+		s.WriteString("trace ")
+	}
+	fmt.Fprintf(&s, "%s $%04x", b.Kind, b.Start)
+	if b.End != b.Start {
+		fmt.Fprintf(&s, "-$%04x", b.End)
+	}
+	if b.Condition != nil {
+		fmt.Fprintf(&s, " if %s", b.Condition)
+	}
+	if b.Disabled {
+		s.WriteString(" (disabled)")
+	}
+	fmt.Fprintf(&s, ", %d hits", b.Hits)
+	return s.String()
+}
+
+// Debugger holds the breakpoints of a machine. They are only changed while the emulation is stopped. The
+// emulation asks Active before checking so that there is no cost if no breakpoints of a kind are enabled.
+type Debugger struct {
+	breakpoints []*Breakpoint
+	lastID      int
+	// active holds the kinds of all enabled breakpoints
+	active Kind
+
+	// Hit is the ID of the breakpoint which triggered last, 0 if none did since it was reset
+	Hit int
+	// Tracing is set once a trace breakpoint triggered
+	Tracing bool
+}
+
+// Add adds a breakpoint and returns it
+func (d *Debugger) Add(kind Kind, start uint16, end uint16, condition *Condition) (*Breakpoint, error) {
+	switch kind {
+	case Exec, Read, Write, Access, Raster:
+	default:
+		return nil, fmt.Errorf("invalid breakpoint kind %d", kind)
+	}
+	if end < start {
+		return nil, fmt.Errorf("end %d before start %d", end, start)
+	}
+
+	d.lastID++
+	b := &Breakpoint{ID: d.lastID, Kind: kind, Start: start, End: end, Condition: condition}
+	d.breakpoints = append(d.breakpoints, b)
+	d.update()
+	return b, nil
+}
+
+// Delete removes the breakpoint with the given ID
+func (d *Debugger) Delete(id int) error {
+	for i, b := range d.breakpoints {
+		if b.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			d.update()
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %d", id)
+}
+
+// Enable enables or disables the breakpoint with the given ID
+func (d *Debugger) Enable(id int, enabled bool) error {
+	for _, b := range d.breakpoints {
+		if b.ID == id {
+			b.Disabled = !enabled
+			d.update()
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %d", id)
+}
+
+// Breakpoints returns all breakpoints ordered by their ID
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return d.breakpoints
+}
+
+func (d *Debugger) update() {
+	d.active = 0
+	for _, b := range d.breakpoints {
+		if !b.Disabled {
+			d.active |= b.Kind
+		}
+	}
+}
+
+// Active returns true if any enabled breakpoint triggers on one of the given kinds
+func (d *Debugger) Active(kind Kind) bool {
+	return d.active&kind != 0
+}
+
+// Check returns true if an enabled breakpoint of the given kind covers addr and its condition is true. The
+// state is only requested for conditions. Trace breakpoints set Tracing but don't stop the emulation.
+func (d *Debugger) Check(kind Kind, addr uint16, state func() State) bool {
+	for _, b := range d.breakpoints {
+		if b.Disabled || b.Kind&kind == 0 || addr < b.Start || addr > b.End {
+			continue
+		}
+		if b.Condition != nil {
+			s := state()
+			if !b.Condition.Evaluate(&s) {
+				continue
+			}
+		}
+		b.Hits++
+		if b.Trace {
+			d.Tracing = true
+			continue
+		}
+		d.Hit = b.ID
+		return true
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestDebugger(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Condition", func() {
+		g.It("evaluates comparisons of registers", func() {
+			state := &State{A: 0x20, X: 4, S: 0xf0, PC: 0x1000, RasterLine: 100}
+			for source, expected := range map[string]bool{
+				"A == $20 && X > 3":     true,
+				"a == 32 && x > 4":      false,
+				"A != $20 || PC>=$1000": true,
+				"SP < %11110001":        true,
+				"RL <= 99 || Y == 1":    false,
+				"4 == X":                true,
+			} {
+				c, err := ParseCondition(source)
+				g.Assert(err).IsNil()
+				g.Assert(c.Evaluate(state)).Equal(expected, source)
+			}
+		})
+
+		g.It("reports invalid conditions", func() {
+			for source, message := range map[string]string{
+				"":            `missing comparison in ""`,
+				"A = 1":       `missing comparison in "A = 1"`,
+				"Q == 1":      `invalid operand "Q"`,
+				"A == $10000": `invalid operand "$10000"`,
+			} {
+				_, err := ParseCondition(source)
+				g.Assert(err == nil).IsFalse()
+				g.Assert(err.Error()).Equal(message)
+			}
+		})
+	})
+
+	g.Describe("Debugger", func() {
+		noState := func() State { panic("state requested without condition") }
+
+		g.It("is only active for kinds of enabled breakpoints", func() {
+			d := &Debugger{}
+			g.Assert(d.Active(Exec | Access | Raster)).IsFalse()
+
+			b, err := d.Add(Write, 0xd020, 0xd021, nil)
+			g.Assert(err).IsNil()
+			g.Assert(d.Active(Write)).IsTrue()
+			g.Assert(d.Active(Access)).IsTrue()
+			g.Assert(d.Active(Exec | Read)).IsFalse()
+
+			g.Assert(d.Enable(b.ID, false)).IsNil()
+			g.Assert(d.Active(Write)).IsFalse()
+			g.Assert(d.Enable(b.ID, true)).IsNil()
+			g.Assert(d.Delete(b.ID)).IsNil()
+			g.Assert(d.Active(Write)).IsFalse()
+			g.Assert(d.Delete(b.ID).Error()).Equal("no breakpoint 1")
+		})
+
+		g.It("triggers on addresses in the range", func() {
+			d := &Debugger{}
+			d.Add(Exec, 0x1000, 0x1000, nil)
+			b, _ := d.Add(Access, 0x0400, 0x07e7, nil)
+
+			g.Assert(d.Check(Exec, 0x1001, noState)).IsFalse()
+			g.Assert(d.Check(Read, 0x03ff, noState)).IsFalse()
+			g.Assert(d.Check(Exec, 0x0400, noState)).IsFalse()
+			g.Assert(d.Check(Write, 0x07e7, noState)).IsTrue()
+			g.Assert(d.Check(Read, 0x0400, noState)).IsTrue()
+			g.Assert(d.Hit).Equal(b.ID)
+			g.Assert(b.Hits).Equal(2)
+			g.Assert(b.String()).Equal("2: access $0400-$07e7, 2 hits")
+		})
+
+		g.It("triggers only if the condition is true", func() {
+			d := &Debugger{}
+			c, _ := ParseCondition("A == $20")
+			b, _ := d.Add(Raster, 50, 50, c)
+
+			g.Assert(d.Check(Raster, 50, func() State { return State{A: 0x1f} })).IsFalse()
+			g.Assert(d.Check(Raster, 50, func() State { return State{A: 0x20} })).IsTrue()
+			g.Assert(b.String()).Equal("1: raster $0032 if A == $20, 1 hits")
+		})
+
+		g.It("ignores disabled breakpoints", func() {
+			d := &Debugger{}
+			b, _ := d.Add(Exec, 0xe000, 0xffff, nil)
+			d.Enable(b.ID, false)
+			g.Assert(d.Check(Exec, 0xfce2, noState)).IsFalse()
+			g.Assert(b.String()).Equal("1: exec $e000-$ffff (disabled), 0 hits")
+		})
+
+		g.It("starts tracing on trace breakpoints", func() {
+			d := &Debugger{}
+			b, _ := d.Add(Exec, 0x1000, 0x1000, nil)
+			b.Trace = true
+			g.Assert(d.Check(Exec, 0x1000, noState)).IsFalse()
+			g.Assert(d.Tracing).IsTrue()
+			g.Assert(d.Hit).Equal(0)
+			g.Assert(b.String()).Equal("1: trace exec $1000, 1 hits")
+		})
+
+		g.It("rejects invalid breakpoints", func() {
+			d := &Debugger{}
+			_, err := d.Add(Exec|Raster, 0, 0, nil)
+			g.Assert(err.Error()).Equal("invalid breakpoint kind 9")
+			_, err = d.Add(Exec, 2, 1, nil)
+			g.Assert(err.Error()).Equal("end 1 before start 2")
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// The instructions are decoded with the opcode table of the MPU, so the disassembly always matches what the
+// MPU executes, including the undocumented opcodes.
+
+// Instruction is a decoded instruction
+type Instruction struct {
+	Address uint16
+	// Bytes holds the opcode followed by the operand bytes
+	Bytes []byte
+	mpu.Opcode
+	// Value is the operand, for branches the target address
+	Value uint16
+}
+
+// Decode decodes the instruction at addr, read returns the bytes of the address space
+func Decode(read func(addr uint16) byte, addr uint16) Instruction {
+	opcode := mpu.Opcodes[read(addr)]
+	i := Instruction{Address: addr, Opcode: opcode}
+	for n := 0; n < opcode.Length(); n++ {
+		i.Bytes = append(i.Bytes, read(addr+uint16(n)))
+	}
+
+	switch opcode.Mode.Operands() {
+	case 1:
+		i.Value = uint16(i.Bytes[1])
+	case 2:
+		i.Value = uint16(i.Bytes[2])<<8 | uint16(i.Bytes[1])
+	}
+	if opcode.Mode == mpu.Relative {
+		i.Value = addr + 2 + uint16(int8(i.Bytes[1]))
+	}
+	return i
+}
+
+// Next returns the address of the following instruction
+func (i Instruction) Next() uint16 {
+	return i.Address + uint16(len(i.Bytes))
+}
+
+// Operand returns the operand in the usual assembler syntax, e.g. ($fb),Y
+func (i Instruction) Operand() string {
+	switch i.Mode {
+	case mpu.Immediate:
+		return fmt.Sprintf("#$%02x", i.Value)
+	case mpu.Zeropage:
+		return fmt.Sprintf("$%02x", i.Value)
+	case mpu.ZeropageX:
+		return fmt.Sprintf("$%02x,X", i.Value)
+	case mpu.ZeropageY:
+		return fmt.Sprintf("$%02x,Y", i.Value)
+	case mpu.Absolute, mpu.Relative:
+		return fmt.Sprintf("$%04x", i.Value)
+	case mpu.AbsoluteX:
+		return fmt.Sprintf("$%04x,X", i.Value)
+	case mpu.AbsoluteY:
+		return fmt.Sprintf("$%04x,Y", i.Value)
+	case mpu.Indirect:
+		return fmt.Sprintf("($%04x)", i.Value)
+	case mpu.IndexedIndirect:
+		return fmt.Sprintf("($%02x,X)", i.Value)
+	case mpu.IndirectIndexed:
+		return fmt.Sprintf("($%02x),Y", i.Value)
+	}
+	return ""
+}
+
+// String returns the mnemonic and the operand
+func (i Instruction) String() string {
+	return strings.TrimRight(i.Mnemonic+" "+i.Operand(), " ")
+}
+
+// Line returns the instruction as listed by a monitor: address, bytes, mnemonic and operand
+func (i Instruction) Line() string {
+	var hex []string
+	for _, value := range i.Bytes {
+		hex = append(hex, fmt.Sprintf("%02x", value))
+	}
+	return fmt.Sprintf("%04x  %-8s  %s", i.Address, strings.Join(hex, " "), i)
+}
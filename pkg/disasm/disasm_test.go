@@ -0,0 +1,78 @@
+package disasm
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/memory"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+func decode(addr uint16, code ...byte) Instruction {
+	var m memory.Memory
+	m.CopyTo(addr, code)
+	return Decode(m.Get, addr)
+}
+
+func TestDisasm(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Disassembler", func() {
+		g.It("decodes every addressing mode", func() {
+			tests := []struct {
+				code []byte
+				text string
+			}{
+				{[]byte{0xea}, "NOP"},
+				{[]byte{0x0a}, "ASL"},
+				{[]byte{0xa9, 0x01}, "LDA #$01"},
+				{[]byte{0xa5, 0xfb}, "LDA $fb"},
+				{[]byte{0xb5, 0xfb}, "LDA $fb,X"},
+				{[]byte{0xb6, 0xfb}, "LDX $fb,Y"},
+				{[]byte{0xad, 0x20, 0xd0}, "LDA $d020"},
+				{[]byte{0xbd, 0x00, 0x04}, "LDA $0400,X"},
+				{[]byte{0xb9, 0x00, 0x04}, "LDA $0400,Y"},
+				{[]byte{0x6c, 0xfc, 0xff}, "JMP ($fffc)"},
+				{[]byte{0xa1, 0xfb}, "LDA ($fb,X)"},
+				{[]byte{0xb1, 0xfb}, "LDA ($fb),Y"},
+				{[]byte{0xd0, 0xfe}, "BNE $c000"},
+				{[]byte{0x10, 0x7f}, "BPL $c081"},
+				{[]byte{0x30, 0x80}, "BMI $bf82"},
+			}
+			for _, test := range tests {
+				g.Assert(decode(0xc000, test.code...).String()).Equal(test.text)
+			}
+		})
+
+		g.It("decodes undocumented opcodes", func() {
+			i := decode(0x1000, 0xa7, 0x10)
+			g.Assert(i.String()).Equal("LAX $10")
+			g.Assert(i.Illegal).IsTrue()
+			g.Assert(decode(0x1000, 0x02).String()).Equal("JAM")
+		})
+
+		g.It("returns the length and cycles of the instruction", func() {
+			i := decode(0x1000, 0xbd, 0x00, 0x04)
+			g.Assert(i.Bytes).Equal([]byte{0xbd, 0x00, 0x04})
+			g.Assert(i.Next()).Equal(uint16(0x1003))
+			g.Assert(i.Cycles).Equal(4)
+			g.Assert(i.PageCrossPenalty).IsTrue()
+			g.Assert(i.Line()).Equal("1000  bd 00 04  LDA $0400,X")
+
+			for opcode := 0; opcode < 0x100; opcode++ {
+				i := decode(0x1000, byte(opcode))
+				g.Assert(len(i.Bytes)).Equal(mpu.Opcodes[opcode].Length())
+				g.Assert(i.Cycles).Equal(mpu.Opcodes[opcode].Cycles)
+			}
+		})
+
+		g.It("wraps around at the end of the address space", func() {
+			var m memory.Memory
+			m[0xffff] = 0x4c
+			m[0x0000], m[0x0001] = 0x34, 0x12
+			i := Decode(m.Get, 0xffff)
+			g.Assert(i.String()).Equal("JMP $1234")
+			g.Assert(i.Next()).Equal(uint16(0x0002))
+		})
+	})
+}
@@ -0,0 +1,137 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// SectorSize is the number of data bytes in a sector
+	SectorSize = 256
+
+	// DirectoryTrack holds the BAM and the directory
+	DirectoryTrack = 18
+
+	d64Tracks         = 35
+	d64ExtendedTracks = 40
+	d64Sectors        = 683
+	d64ExtendedSector = 768
+)
+
+// D64 is a sector level image of a 1541 disk. Only the data of the sectors is stored, everything else
+// (sync marks, headers, gaps) has to be recreated when converting it to GCR.
+type D64 struct {
+	// Tracks is the number of tracks of the image, either 35 or 40
+	Tracks int
+
+	data []byte
+	// errors holds one error code per sector if the image contains error information
+	errors []byte
+}
+
+// SectorsPerTrack returns the number of sectors on the given track (1 based)
+func SectorsPerTrack(track int) int {
+	switch {
+	case track <= 17:
+		return 21
+	case track <= 24:
+		return 19
+	case track <= 30:
+		return 18
+	default:
+		return 17
+	}
+}
+
+// sectorOffset returns the index of the first sector of the track in the image
+func sectorOffset(track int) int {
+	offset := 0
+	for t := 1; t < track; t++ {
+		offset += SectorsPerTrack(t)
+	}
+	return offset
+}
+
+// ParseD64 parses a D64 image with 35 or 40 tracks and optional error information
+func ParseD64(data []byte) (*D64, error) {
+	d := &D64{}
+
+	switch len(data) {
+	case d64Sectors * SectorSize:
+		d.Tracks = d64Tracks
+	case d64Sectors*SectorSize + d64Sectors:
+		d.Tracks = d64Tracks
+		d.errors = data[d64Sectors*SectorSize:]
+	case d64ExtendedSector * SectorSize:
+		d.Tracks = d64ExtendedTracks
+	case d64ExtendedSector*SectorSize + d64ExtendedSector:
+		d.Tracks = d64ExtendedTracks
+		d.errors = data[d64ExtendedSector*SectorSize:]
+	default:
+		return nil, fmt.Errorf("invalid D64 image size: %d bytes", len(data))
+	}
+
+	sectors := sectorOffset(d.Tracks + 1)
+	d.data = make([]byte, sectors*SectorSize)
+	copy(d.data, data)
+	if d.errors != nil {
+		d.errors = append([]byte{}, d.errors...)
+	}
+
+	return d, nil
+}
+
+// LoadD64 reads a D64 image from a file
+func LoadD64(path string) (*D64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseD64(data)
+}
+
+func (d *D64) checkSector(track int, sector int) error {
+	if track < 1 || track > d.Tracks || sector < 0 || sector >= SectorsPerTrack(track) {
+		return fmt.Errorf("illegal track or sector: %d/%d", track, sector)
+	}
+	return nil
+}
+
+// Sector returns the data of the given sector. The returned slice references the image.
+func (d *D64) Sector(track int, sector int) ([]byte, error) {
+	if err := d.checkSector(track, sector); err != nil {
+		return nil, err
+	}
+	offset := (sectorOffset(track) + sector) * SectorSize
+	return d.data[offset : offset+SectorSize], nil
+}
+
+// SetSector replaces the data of the given sector
+func (d *D64) SetSector(track int, sector int, data []byte) error {
+	s, err := d.Sector(track, sector)
+	if err != nil {
+		return err
+	}
+	copy(s, data)
+	return nil
+}
+
+// SectorError returns the error code stored for the sector in the image, 1 means no error
+func (d *D64) SectorError(track int, sector int) byte {
+	if d.errors == nil || d.checkSector(track, sector) != nil {
+		return 1
+	}
+	return d.errors[sectorOffset(track)+sector]
+}
+
+// ID returns the two disk ID characters stored in the BAM
+func (d *D64) ID() (byte, byte) {
+	bam, _ := d.Sector(DirectoryTrack, 0)
+	return bam[0xa2], bam[0xa3]
+}
+
+// Bytes returns the image in D64 format
+func (d *D64) Bytes() []byte {
+	image := append([]byte{}, d.data...)
+	return append(image, d.errors...)
+}
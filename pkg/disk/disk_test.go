@@ -0,0 +1,146 @@
+package disk
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+func randomD64(tracks int) []byte {
+	data := make([]byte, sectorOffset(tracks+1)*SectorSize)
+	rand.Read(data)
+	return data
+}
+
+func TestGCR(t *testing.T) {
+
+	rand.Seed(time.Now().UTC().UnixNano())
+
+	g := goblin.Goblin(t)
+	g.Describe("GCR", func() {
+		g.It("decodes what it encoded", func() {
+			for i := 0; i < 100; i++ {
+				in := [4]byte{byte(rand.Intn(0x100)), byte(rand.Intn(0x100)), byte(rand.Intn(0x100)), byte(rand.Intn(0x100))}
+				out, err := DecodeGCR(EncodeGCR(in))
+				g.Assert(err).IsNil()
+				g.Assert(out).Equal(in)
+			}
+		})
+
+		g.It("encodes the header block id", func() {
+			g.Assert(EncodeGCR([4]byte{0x08, 0x00, 0x00, 0x00})).Equal([5]byte{0x52, 0x54, 0xa5, 0x29, 0x4a})
+		})
+
+		g.It("rejects invalid codes", func() {
+			_, err := DecodeGCR([5]byte{0x00, 0x00, 0x00, 0x00, 0x00})
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+
+	g.Describe("D64", func() {
+		g.It("accepts only valid image sizes", func() {
+			_, err := ParseD64(make([]byte, 1000))
+			g.Assert(err == nil).IsFalse()
+
+			d, err := ParseD64(randomD64(35))
+			g.Assert(err).IsNil()
+			g.Assert(d.Tracks).Equal(35)
+
+			d, err = ParseD64(randomD64(40))
+			g.Assert(err).IsNil()
+			g.Assert(d.Tracks).Equal(40)
+		})
+
+		g.It("converts to GCR tracks that decode to the same sectors", func() {
+			image := randomD64(35)
+			d, _ := ParseD64(image)
+			gcr := FromD64(d)
+
+			for _, track := range []int{1, 17, 18, 24, 25, 30, 31, 35} {
+				g.Assert(len(gcr.Tracks[HalfTrack(track)])).Equal(TrackCapacity(SpeedZone(track)))
+				for sector := 0; sector < SectorsPerTrack(track); sector++ {
+					expected, _ := d.Sector(track, sector)
+					data, err := gcr.ReadSector(track, sector)
+					g.Assert(err).IsNil()
+					g.Assert(data).Equal(expected)
+				}
+			}
+			g.Assert(gcr.Tracks[HalfTrack(1)+1] == nil).IsTrue()
+		})
+
+		g.It("recreates read errors from the error information", func() {
+			image := append(randomD64(35), make([]byte, d64Sectors)...)
+			for i := range image[d64Sectors*SectorSize:] {
+				image[d64Sectors*SectorSize+i] = 0x01
+			}
+			// 23 READ ERROR on 1/3, 29 DISK ID MISMATCH on 1/5
+			image[d64Sectors*SectorSize+3] = 0x05
+			image[d64Sectors*SectorSize+5] = 0x0b
+			d, _ := ParseD64(image)
+			gcr := FromD64(d)
+
+			_, err := gcr.ReadSector(1, 3)
+			g.Assert(err == nil).IsFalse()
+			_, err = gcr.ReadSector(1, 4)
+			g.Assert(err).IsNil()
+			_, err = gcr.ReadSector(1, 5)
+			g.Assert(errorCode(err)).Equal(uint8(0x0b))
+		})
+	})
+
+	g.Describe("G64", func() {
+		g.It("rejects other files", func() {
+			_, err := ParseG64(randomD64(35))
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("keeps half tracks, track lengths and speed zones", func() {
+			d, _ := ParseD64(randomD64(35))
+			gcr := FromD64(d)
+			gcr.Tracks[HalfTrack(36)+1] = []byte{0xff, 0xff, 0x55, 0x52}
+			gcr.Speed[HalfTrack(36)+1] = 2
+			gcr.SpeedMaps[HalfTrack(2)] = make([]byte, (len(gcr.Tracks[HalfTrack(2)])+3)/4)
+			gcr.SpeedMaps[HalfTrack(2)][0] = 0xc0
+
+			parsed, err := ParseG64(gcr.G64())
+			g.Assert(err).IsNil()
+			g.Assert(parsed.Tracks).Equal(gcr.Tracks)
+			g.Assert(parsed.Speed).Equal(gcr.Speed)
+			g.Assert(parsed.SpeedMaps[HalfTrack(2)]).Equal(gcr.SpeedMaps[HalfTrack(2)])
+			g.Assert(parsed.Tracks[HalfTrack(5)+1] == nil).IsTrue()
+		})
+
+		g.It("rejects empty tracks with a speed zone map", func() {
+			image := append([]byte(g64Signature), g64Version, 1, 0x00, 0x00)
+			image = append(image, 20, 0, 0, 0, 22, 0, 0, 0)
+			image = append(image, 0x00, 0x00, 0xc0)
+			_, err := ParseG64(image)
+			g.Assert(err == nil).IsFalse()
+
+			image[16] = 3
+			parsed, err := ParseG64(image)
+			g.Assert(err).IsNil()
+			g.Assert(parsed.Speed[0]).Equal(uint8(3))
+		})
+
+		g.It("converts back to D64 including errors", func() {
+			image := randomD64(35)
+			d, _ := ParseD64(image)
+			gcr := FromD64(d)
+			g.Assert(gcr.D64(35).Bytes()).Equal(image)
+
+			// destroy the data block checksum of 18/1 and change the header ID of 18/3
+			d.errors = make([]byte, d64Sectors)
+			d.errors[sectorOffset(18)+1] = 0x05
+			d.errors[sectorOffset(18)+3] = 0x0b
+			gcr.Tracks[HalfTrack(18)] = EncodeTrack(d, 18)
+
+			converted := gcr.D64(35)
+			g.Assert(converted.SectorError(18, 1)).Equal(uint8(0x05))
+			g.Assert(converted.SectorError(18, 2)).Equal(uint8(0x01))
+			g.Assert(converted.SectorError(18, 3)).Equal(uint8(0x0b))
+		})
+	})
+}
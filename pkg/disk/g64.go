@@ -0,0 +1,161 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// G64 stores the raw GCR data of every half track including custom formats, sync marks and track lengths
+// http://www.unusedino.de/ec64/technical/formats/g64.html
+
+const (
+	g64Signature = "GCR-1541"
+	g64Version   = 0x00
+	// g64TrackSize is the maximum track size written by most tools
+	g64TrackSize = 7928
+	g64HeaderLen = 12
+)
+
+// ParseG64 parses a G64 image
+func ParseG64(data []byte) (*GCRDisk, error) {
+	if len(data) < g64HeaderLen || string(data[:8]) != g64Signature {
+		return nil, fmt.Errorf("not a G64 image")
+	}
+	if data[8] != g64Version {
+		return nil, fmt.Errorf("unsupported G64 version %d", data[8])
+	}
+
+	halfTracks := int(data[9])
+	if halfTracks > MaxHalfTracks {
+		return nil, fmt.Errorf("G64 image has too many tracks: %d", halfTracks)
+	}
+	tableEnd := g64HeaderLen + halfTracks*8
+	if len(data) < tableEnd {
+		return nil, fmt.Errorf("G64 track table truncated")
+	}
+
+	g := &GCRDisk{}
+	for i := 0; i < halfTracks; i++ {
+		offset := int(binary.LittleEndian.Uint32(data[g64HeaderLen+i*4:]))
+		speed := int(binary.LittleEndian.Uint32(data[g64HeaderLen+halfTracks*4+i*4:]))
+		if offset == 0 {
+			continue
+		}
+
+		if offset+2 > len(data) {
+			return nil, fmt.Errorf("G64 track %d out of range", i)
+		}
+		length := int(binary.LittleEndian.Uint16(data[offset:]))
+		if offset+2+length > len(data) {
+			return nil, fmt.Errorf("G64 track %d truncated", i)
+		}
+		g.Tracks[i] = append([]byte{}, data[offset+2:offset+2+length]...)
+
+		if speed <= 3 {
+			g.Speed[i] = byte(speed)
+			continue
+		}
+
+		// the speed zone of every byte is stored as 2 bits per byte
+		if length == 0 {
+			return nil, fmt.Errorf("G64 track %d is empty but has a speed zone map", i)
+		}
+		mapLength := (length + 3) / 4
+		if speed+mapLength > len(data) {
+			return nil, fmt.Errorf("G64 speed zone map of track %d truncated", i)
+		}
+		g.SpeedMaps[i] = append([]byte{}, data[speed:speed+mapLength]...)
+		g.Speed[i] = g.SpeedMaps[i][0] >> 6
+	}
+
+	return g, nil
+}
+
+// G64 returns the disk as G64 image
+func (g *GCRDisk) G64() []byte {
+	trackSize := g64TrackSize
+	for _, track := range g.Tracks {
+		if len(track) > trackSize {
+			trackSize = len(track)
+		}
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(g64Signature)
+	buffer.WriteByte(g64Version)
+	buffer.WriteByte(MaxHalfTracks)
+	binary.Write(&buffer, binary.LittleEndian, uint16(trackSize))
+
+	offsets := make([]uint32, MaxHalfTracks)
+	speeds := make([]uint32, MaxHalfTracks)
+	offset := g64HeaderLen + MaxHalfTracks*8
+	for i, track := range g.Tracks {
+		if track == nil {
+			continue
+		}
+		offsets[i] = uint32(offset)
+		offset += 2 + trackSize
+	}
+	for i, speedMap := range g.SpeedMaps {
+		speeds[i] = uint32(g.Speed[i])
+		if g.Tracks[i] != nil && speedMap != nil {
+			speeds[i] = uint32(offset)
+			offset += len(speedMap)
+		}
+	}
+	binary.Write(&buffer, binary.LittleEndian, offsets)
+	binary.Write(&buffer, binary.LittleEndian, speeds)
+
+	for _, track := range g.Tracks {
+		if track == nil {
+			continue
+		}
+		binary.Write(&buffer, binary.LittleEndian, uint16(len(track)))
+		buffer.Write(track)
+		buffer.Write(make([]byte, trackSize-len(track)))
+	}
+	for i, speedMap := range g.SpeedMaps {
+		if g.Tracks[i] != nil && speedMap != nil {
+			buffer.Write(speedMap)
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+// D64 decodes all sectors of the first tracks into a D64 image. Sectors that can't be read are stored
+// with the matching error code in the error information of the image.
+func (g *GCRDisk) D64(tracks int) *D64 {
+	if tracks != d64ExtendedTracks {
+		tracks = d64Tracks
+	}
+
+	sectors := sectorOffset(tracks + 1)
+	d := &D64{
+		Tracks: tracks,
+		data:   make([]byte, sectors*SectorSize),
+		errors: make([]byte, sectors),
+	}
+
+	id := g.diskID()
+	hasErrors := false
+	for track := 1; track <= tracks; track++ {
+		for sector := 0; sector < SectorsPerTrack(track); sector++ {
+			index := sectorOffset(track) + sector
+			data, _, err := g.readSector(track, sector, id)
+			if err != nil {
+				d.errors[index] = errorCode(err)
+				hasErrors = true
+				continue
+			}
+			d.errors[index] = 0x01
+			copy(d.data[index*SectorSize:], data)
+		}
+	}
+	if !hasErrors {
+		d.errors = nil
+	}
+
+	return d
+}
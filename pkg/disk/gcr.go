@@ -0,0 +1,79 @@
+package disk
+
+import "fmt"
+
+// GCR (group code recording) stores every nibble as 5 bits so that there are never more than two 0 bits in a row
+// and that only sync marks contain more than 8 consecutive 1 bits.
+// http://www.baltissen.org/newhtm/1541c.htm
+
+var gcrEncode = [16]byte{
+	0x0a, 0x0b, 0x12, 0x13, 0x0e, 0x0f, 0x16, 0x17,
+	0x09, 0x19, 0x1a, 0x1b, 0x0d, 0x1d, 0x1e, 0x15,
+}
+
+var gcrDecode [32]int
+
+func init() {
+	for i := range gcrDecode {
+		gcrDecode[i] = -1
+	}
+	for nibble, code := range gcrEncode {
+		gcrDecode[code] = nibble
+	}
+}
+
+// EncodeGCR encodes 4 bytes into 5 GCR bytes
+func EncodeGCR(in [4]byte) [5]byte {
+	var bits uint64
+	for _, b := range in {
+		bits = bits<<10 | uint64(gcrEncode[b>>4])<<5 | uint64(gcrEncode[b&0x0f])
+	}
+
+	var out [5]byte
+	for i := range out {
+		out[i] = byte(bits >> (32 - 8*i))
+	}
+	return out
+}
+
+// DecodeGCR decodes 5 GCR bytes into 4 bytes. An error is returned if the input contains invalid GCR codes.
+func DecodeGCR(in [5]byte) ([4]byte, error) {
+	var bits uint64
+	for _, b := range in {
+		bits = bits<<8 | uint64(b)
+	}
+
+	var out [4]byte
+	for i := range out {
+		hi := gcrDecode[(bits>>(35-10*i))&0x1f]
+		lo := gcrDecode[(bits>>(30-10*i))&0x1f]
+		if hi < 0 || lo < 0 {
+			return out, fmt.Errorf("invalid GCR code in %02x", in)
+		}
+		out[i] = byte(hi<<4 | lo)
+	}
+	return out, nil
+}
+
+// encodeBlock GCR encodes data, the length of data has to be a multiple of 4
+func encodeBlock(data []byte) []byte {
+	encoded := make([]byte, 0, len(data)/4*5)
+	for i := 0; i+4 <= len(data); i += 4 {
+		group := EncodeGCR([4]byte{data[i], data[i+1], data[i+2], data[i+3]})
+		encoded = append(encoded, group[:]...)
+	}
+	return encoded
+}
+
+// decodeBlock decodes GCR data, the length of data has to be a multiple of 5
+func decodeBlock(data []byte) ([]byte, error) {
+	decoded := make([]byte, 0, len(data)/5*4)
+	for i := 0; i+5 <= len(data); i += 5 {
+		group, err := DecodeGCR([5]byte{data[i], data[i+1], data[i+2], data[i+3], data[i+4]})
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, group[:]...)
+	}
+	return decoded, nil
+}
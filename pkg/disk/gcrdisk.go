@@ -0,0 +1,294 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+const (
+	// MaxHalfTracks is the number of head positions of the 1541 (tracks 1 to 42 including the half tracks)
+	MaxHalfTracks = 84
+
+	syncLength           = 5
+	headerGapLength      = 9
+	gapByte         byte = 0x55
+	syncByte        byte = 0xff
+
+	headerBlockID byte = 0x08
+	dataBlockID   byte = 0x07
+)
+
+// trackCapacity is the number of bytes that fit on a track at the nominal speed of the zone
+var trackCapacity = [4]int{6250, 6666, 7142, 7692}
+
+// sectorGap is the gap written by the 1541 format routine after each data block
+var sectorGap = [4]int{9, 12, 17, 8}
+
+// GCRDisk is the flux level representation of a disk as seen by the read/write head of the drive.
+// Half tracks are stored at odd indices, index 0 is track 1.
+type GCRDisk struct {
+	Tracks [MaxHalfTracks][]byte
+	// Speed is the speed zone (0-3) the track was written with
+	Speed [MaxHalfTracks]byte
+	// SpeedMaps optionally hold the speed zone of every byte of a track, 2 bits per byte as in G64 images
+	SpeedMaps [MaxHalfTracks][]byte
+
+	WriteProtected bool
+	// Modified is set as soon as the drive wrote to a track
+	Modified bool
+
+	// Path is the file the disk was loaded from
+	Path string
+	// d64Tracks is the number of tracks if the disk was loaded from a D64 image
+	d64Tracks int
+}
+
+// HalfTrack returns the index of the given track (1 based) in GCRDisk.Tracks
+func HalfTrack(track int) int {
+	return (track - 1) * 2
+}
+
+// SpeedZone returns the speed zone the 1541 uses for the given track (1 based)
+func SpeedZone(track int) byte {
+	switch {
+	case track <= 17:
+		return 3
+	case track <= 24:
+		return 2
+	case track <= 30:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// TrackCapacity returns the number of bytes a track written in the given speed zone holds
+func TrackCapacity(zone byte) int {
+	return trackCapacity[zone&0x03]
+}
+
+// FromD64 converts a D64 image into GCR tracks as written by the 1541 format routine
+func FromD64(d *D64) *GCRDisk {
+	g := &GCRDisk{}
+	for track := 1; track <= d.Tracks; track++ {
+		g.Tracks[HalfTrack(track)] = EncodeTrack(d, track)
+		g.Speed[HalfTrack(track)] = SpeedZone(track)
+	}
+	return g
+}
+
+func fill(value byte, count int) []byte {
+	data := make([]byte, count)
+	for i := range data {
+		data[i] = value
+	}
+	return data
+}
+
+// EncodeTrack creates the GCR data of a track of a D64 image, recreating the errors stored in the image
+func EncodeTrack(d *D64, track int) []byte {
+	zone := SpeedZone(track)
+	id1, id2 := d.ID()
+	data := make([]byte, 0, TrackCapacity(zone))
+
+	for sector := 0; sector < SectorsPerTrack(track); sector++ {
+		content, _ := d.Sector(track, sector)
+		errorCode := d.SectorError(track, sector)
+
+		sync := fill(syncByte, syncLength)
+		if errorCode == 0x03 {
+			// 21 READ ERROR: no sync mark
+			sync = fill(gapByte, syncLength)
+		}
+
+		header := []byte{headerBlockID, 0, byte(sector), byte(track), id2, id1, 0x0f, 0x0f}
+		if errorCode == 0x0b {
+			// 29 DISK ID MISMATCH
+			header[5] ^= 0xff
+		}
+		header[1] = header[2] ^ header[3] ^ header[4] ^ header[5]
+		switch errorCode {
+		case 0x02:
+			// 20 READ ERROR: header block not found
+			header[0] = 0x00
+		case 0x09:
+			// 27 READ ERROR: checksum error in header
+			header[1] ^= 0xff
+		}
+
+		block := make([]byte, 0, 260)
+		block = append(block, dataBlockID)
+		block = append(block, content...)
+		var checksum byte
+		for _, b := range content {
+			checksum ^= b
+		}
+		block = append(block, checksum, 0x00, 0x00)
+		switch errorCode {
+		case 0x04:
+			// 22 READ ERROR: data block not found
+			block[0] = 0x00
+		case 0x05:
+			// 23 READ ERROR: checksum error in data block
+			block[257] ^= 0xff
+		}
+
+		data = append(data, sync...)
+		data = append(data, encodeBlock(header)...)
+		data = append(data, fill(gapByte, headerGapLength)...)
+		data = append(data, sync...)
+		data = append(data, encodeBlock(block)...)
+		data = append(data, fill(gapByte, sectorGap[zone])...)
+	}
+
+	return append(data, fill(gapByte, TrackCapacity(zone)-len(data))...)
+}
+
+// SectorError describes why a sector could not be read
+type SectorError struct {
+	Track  int
+	Sector int
+	// Code is the error code as stored in the error information of D64 images
+	Code    byte
+	message string
+}
+
+func (e *SectorError) Error() string {
+	return fmt.Sprintf("%s in %d/%d", e.message, e.Track, e.Sector)
+}
+
+// errorCode returns the D64 error code for errors returned by ReadSector
+func errorCode(err error) byte {
+	var sectorError *SectorError
+	if errors.As(err, &sectorError) {
+		return sectorError.Code
+	}
+	return 0x02
+}
+
+// bitReader reads a track bit by bit, wrapping around at the end like the rotating disk
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) next() byte {
+	bit := (r.data[r.pos>>3] >> (7 - r.pos&7)) & 0x01
+	r.pos = (r.pos + 1) % (len(r.data) * 8)
+	return bit
+}
+
+// readBytes reads count bytes, first is the already read first bit of the first byte
+func (r *bitReader) readBytes(first byte, count int) []byte {
+	data := make([]byte, count)
+	bit := first
+	for i := range data {
+		for b := 0; b < 8; b++ {
+			if i != 0 || b != 0 {
+				bit = r.next()
+			}
+			data[i] = data[i]<<1 | bit
+		}
+	}
+	return data
+}
+
+// findSync searches for the next sync mark and returns the first bit after it
+func (r *bitReader) findSync(maxBits int) (byte, bool) {
+	ones := 0
+	for i := 0; i < maxBits; i++ {
+		bit := r.next()
+		if bit == 1 {
+			ones++
+			continue
+		}
+		if ones >= 10 {
+			return bit, true
+		}
+		ones = 0
+	}
+	return 0, false
+}
+
+// ReadSector decodes a sector from the GCR data like the 1541 DOS does it. It is mainly used to convert
+// GCR tracks back into a sector based image.
+func (g *GCRDisk) ReadSector(track int, sector int) ([]byte, error) {
+	data, _, err := g.readSector(track, sector, g.diskID())
+	return data, err
+}
+
+// diskID returns the ID in the header of the first sector of the directory track, the DOS reads it from there
+// when the disk is initialised. It is nil if the header can't be found.
+func (g *GCRDisk) diskID() []byte {
+	_, id, _ := g.readSector(DirectoryTrack, 0, nil)
+	return id
+}
+
+// readSector decodes a sector and returns the ID of its header as well, the ID is compared with the disk ID
+// unless that is nil
+func (g *GCRDisk) readSector(track int, sector int, diskID []byte) ([]byte, []byte, error) {
+	sectorError := func(code byte, message string) error {
+		return &SectorError{Track: track, Sector: sector, Code: code, message: message}
+	}
+
+	data := g.Tracks[HalfTrack(track)]
+	if len(data) == 0 {
+		return nil, nil, sectorError(0x03, "no sync mark")
+	}
+
+	r := &bitReader{data: data}
+	// every sector has two sync marks, look at each of them at least twice to find blocks that wrap around
+	for attempt := 0; attempt < 4*SectorsPerTrack(track); attempt++ {
+		first, found := r.findSync(len(data) * 8)
+		if !found {
+			return nil, nil, sectorError(0x03, "no sync mark")
+		}
+
+		header, err := decodeBlock(r.readBytes(first, 10))
+		if err != nil || header[0] != headerBlockID || int(header[2]) != sector || int(header[3]) != track {
+			continue
+		}
+		if header[1] != header[2]^header[3]^header[4]^header[5] {
+			return nil, nil, sectorError(0x09, "checksum error in header")
+		}
+		id := header[4:6]
+		if diskID != nil && !bytes.Equal(id, diskID) {
+			return nil, id, sectorError(0x0b, "disk ID mismatch")
+		}
+
+		first, found = r.findSync(len(data) * 8)
+		if !found {
+			return nil, id, sectorError(0x04, "data block not found")
+		}
+		block, err := decodeBlock(r.readBytes(first, 325))
+		if err != nil || block[0] != dataBlockID {
+			return nil, id, sectorError(0x04, "data block not found")
+		}
+		var checksum byte
+		for _, b := range block[1:257] {
+			checksum ^= b
+		}
+		if checksum != block[257] {
+			return nil, id, sectorError(0x05, "checksum error in data block")
+		}
+		return block[1:257], id, nil
+	}
+
+	return nil, nil, sectorError(0x02, "header block not found")
+}
+
+// State saves or restores the tracks of the disk and where it was loaded from
+func (g *GCRDisk) State(s *snapshot.State) {
+	for i := range g.Tracks {
+		s.Slice(&g.Tracks[i])
+		s.Byte(&g.Speed[i])
+		s.Slice(&g.SpeedMaps[i])
+	}
+	s.Bool(&g.WriteProtected)
+	s.Bool(&g.Modified)
+	s.String(&g.Path)
+	s.Int(&g.d64Tracks)
+}
@@ -0,0 +1,42 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Load reads a D64 or G64 image from a file and returns the GCR representation used by the drives
+func Load(path string) (*GCRDisk, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var g *GCRDisk
+	if strings.HasPrefix(string(data), g64Signature) {
+		g, err = ParseG64(data)
+	} else {
+		var d *D64
+		d, err = ParseD64(data)
+		if err == nil {
+			g = FromD64(d)
+			g.d64Tracks = d.Tracks
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g.Path = path
+	return g, nil
+}
+
+// Save writes the disk back into the file it was loaded from. Disks loaded from D64 images are decoded
+// sector by sector, so everything but the sector data is lost.
+func (g *GCRDisk) Save() error {
+	if strings.EqualFold(filepath.Ext(g.Path), ".g64") || g.d64Tracks == 0 {
+		return os.WriteFile(g.Path, g.G64(), 0644)
+	}
+	return os.WriteFile(g.Path, g.D64(g.d64Tracks).Bytes(), 0644)
+}
@@ -0,0 +1,210 @@
+package drive
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gentoomaniac/go64/pkg/cyclelock"
+	"github.com/gentoomaniac/go64/pkg/disk"
+	"github.com/gentoomaniac/go64/pkg/iec"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+	"github.com/gentoomaniac/go64/pkg/via"
+)
+
+const (
+	// RAMSize is the size of the drive RAM
+	RAMSize = 0x0800
+	// ROMSize is the size of the DOS ROM
+	ROMSize = 0x4000
+	// ClockRate is the frequency of the drive MPU in Hz
+	ClockRate = 1000000
+
+	busControllerIRQ  uint = 0
+	diskControllerIRQ uint = 1
+)
+
+// Drive1541 emulates a Commodore 1541 disk drive: its own 6502 running the DOS ROM, 2kB of RAM,
+// VIA1 connected to the serial bus, VIA2 controlling the motors and the GCR read/write head.
+// http://unusedino.de/ec64/technical/aay/c1541/
+type Drive1541 struct {
+	// Mpu is the 6502 of the drive
+	Mpu mpu.MOS6502
+	RAM [RAMSize]byte
+	ROM []byte
+
+	// Device is the device number on the serial bus (8-11)
+	Device int
+	// Disk is the inserted disk or nil
+	Disk *disk.GCRDisk
+
+	// busController is VIA1 at $1800
+	busController via.VIA
+	// diskController is VIA2 at $1c00
+	diskController via.VIA
+
+	bus  *iec.Bus
+	lock cyclelock.AlwaysOpenLock
+	head head
+}
+
+// LoadROM reads the 16kB DOS ROM from a file
+func LoadROM(path string) ([]byte, error) {
+	rom, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(rom) != ROMSize {
+		return nil, fmt.Errorf("invalid 1541 ROM size: %d bytes", len(rom))
+	}
+	return rom, nil
+}
+
+// Init initialises the drive and attaches it to the serial bus
+func (d *Drive1541) Init(device int, rom []byte, bus *iec.Bus) {
+	d.Device = device
+	d.ROM = rom
+	d.bus = bus
+
+	d.busController.PortBIn = d.serialPortIn
+	d.busController.IRQ = func(active bool) { d.Mpu.SetIRQ(busControllerIRQ, active) }
+	d.diskController.PortAIn = func() byte { return d.head.readLatch }
+	d.diskController.PortBIn = d.diskPortIn
+	d.diskController.IRQ = func(active bool) { d.Mpu.SetIRQ(diskControllerIRQ, active) }
+	d.busController.Reset()
+	d.diskController.Reset()
+
+	// start on the directory track, the DOS bumps the head on errors anyway
+	d.head.halfTrack = disk.HalfTrack(disk.DirectoryTrack)
+
+	d.Mpu.Bus = d
+	d.Mpu.Init(&d.lock)
+}
+
+// InsertDisk puts a disk into the drive
+func (d *Drive1541) InsertDisk(g *disk.GCRDisk) {
+	d.Disk = g
+}
+
+// EjectDisk removes the disk from the drive and returns it
+func (d *Drive1541) EjectDisk() *disk.GCRDisk {
+	g := d.Disk
+	d.Disk = nil
+	return g
+}
+
+// State saves or restores the MPU, the RAM, the VIAs, the head and the inserted disk. The ROM isn't part of the
+// state, the drive has to be initialised before.
+func (d *Drive1541) State(s *snapshot.State) {
+	d.Mpu.State(s)
+	s.Bytes(d.RAM[:])
+	d.busController.State(s)
+	d.diskController.State(s)
+	d.head.state(s)
+
+	inserted := d.Disk != nil
+	s.Bool(&inserted)
+	if !inserted {
+		d.Disk = nil
+		return
+	}
+	if s.Loading() {
+		d.Disk = &disk.GCRDisk{}
+	}
+	d.Disk.State(s)
+}
+
+// Reset runs the reset sequence of the drive MPU, afterwards it has to be clocked with Clock()
+func (d *Drive1541) Reset() {
+	d.Mpu.Reset()
+}
+
+// Clock advances the drive by a single cycle on the goroutine of the caller. The MPU does one bus access per
+// cycle, so changes of the serial bus are seen in the cycle they happen.
+func (d *Drive1541) Clock() {
+	d.tick()
+	d.Mpu.Tick()
+}
+
+// Get reads a byte from the drive address space
+func (d *Drive1541) Get(addr uint16) byte {
+	if addr&0x8000 != 0 {
+		return d.ROM[addr&(ROMSize-1)]
+	}
+
+	switch addr & 0x1c00 {
+	case 0x0000, 0x0400:
+		return d.RAM[addr&(RAMSize-1)]
+	case 0x1800:
+		return d.busController.Read(addr)
+	case 0x1c00:
+		return d.diskController.Read(addr)
+	}
+
+	// open bus
+	return byte(addr >> 8)
+}
+
+// Set writes a byte into the drive address space
+func (d *Drive1541) Set(addr uint16, value byte) {
+	if addr&0x8000 != 0 {
+		return
+	}
+
+	switch addr & 0x1c00 {
+	case 0x0000, 0x0400:
+		d.RAM[addr&(RAMSize-1)] = value
+	case 0x1800:
+		d.busController.Write(addr, value)
+		d.updateSerialBus()
+	case 0x1c00:
+		d.diskController.Write(addr, value)
+	}
+}
+
+// tick advances all parts of the drive besides the MPU by one cycle before the bus access of the MPU
+func (d *Drive1541) tick() {
+	d.busController.Tick()
+	d.diskController.Tick()
+	d.updateSerialBus()
+	d.updateHead()
+}
+
+/* Serial bus */
+
+// serialPortIn returns the port B pins of VIA1. The bus lines are inverted, a low line reads as 1.
+func (d *Drive1541) serialPortIn() byte {
+	low := d.bus.Low()
+	// PB5 and PB6 are the device number jumpers
+	value := byte((d.Device-8)&0x03) << 5
+	if low&iec.DATA != 0 {
+		value |= 0x01
+	}
+	if low&iec.CLK != 0 {
+		value |= 0x04
+	}
+	if low&iec.ATN != 0 {
+		value |= 0x80
+	}
+	return value
+}
+
+func (d *Drive1541) updateSerialBus() {
+	out := d.busController.OutputB()
+	atn := d.bus.IsLow(iec.ATN)
+
+	var lines iec.Line
+	if out&0x02 != 0 {
+		lines |= iec.DATA
+	}
+	if out&0x08 != 0 {
+		lines |= iec.CLK
+	}
+	// the ATN acknowledge logic pulls DATA in hardware until the DOS sets ATNA
+	if atn != (out&0x10 != 0) {
+		lines |= iec.DATA
+	}
+	d.bus.Pull(d.Device, lines)
+
+	d.busController.SetCA1(atn)
+}
@@ -0,0 +1,143 @@
+package drive
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/disk"
+	"github.com/gentoomaniac/go64/pkg/iec"
+	"github.com/gentoomaniac/go64/pkg/via"
+)
+
+func newTestDrive() (*Drive1541, *iec.Bus) {
+	bus := &iec.Bus{}
+	d := &Drive1541{}
+	d.Init(8, make([]byte, ROMSize), bus)
+
+	image, _ := disk.ParseD64(make([]byte, 683*disk.SectorSize))
+	d.InsertDisk(disk.FromD64(image))
+
+	return d, bus
+}
+
+func TestDrive1541(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("1541 address decoding", func() {
+		g.It("mirrors the RAM and the ROM", func() {
+			d, _ := newTestDrive()
+			d.ROM[0x1234] = 0x42
+
+			d.Set(0x0010, 0x23)
+			g.Assert(d.Get(0x0010)).Equal(uint8(0x23))
+			g.Assert(d.Get(0x0410)).Equal(uint8(0x00))
+			g.Assert(d.Get(0x9234)).Equal(uint8(0x42))
+			g.Assert(d.Get(0xd234)).Equal(uint8(0x42))
+		})
+
+		g.It("maps the VIAs", func() {
+			d, _ := newTestDrive()
+			d.Set(0x1803, 0xaa)
+			d.Set(0x1c03, 0x55)
+			g.Assert(d.busController.Peek(via.DDRA)).Equal(uint8(0xaa))
+			g.Assert(d.diskController.Peek(via.DDRA)).Equal(uint8(0x55))
+			g.Assert(d.Get(0x1813)).Equal(uint8(0xaa))
+		})
+	})
+
+	g.Describe("1541 clock", func() {
+		g.It("executes the instructions cycle by cycle", func() {
+			d, _ := newTestDrive()
+			copy(d.RAM[0x0300:], []byte{0xea, 0xe8}) // NOP INX
+			d.Mpu.SetPC(0x0300)
+
+			d.Clock()
+			g.Assert(d.Mpu.PC()).Equal(uint16(0x0301))
+			d.Clock()
+			g.Assert(d.Mpu.PC()).Equal(uint16(0x0301))
+			d.Clock()
+			g.Assert(d.Mpu.PC()).Equal(uint16(0x0302))
+			g.Assert(d.Mpu.X()).Equal(uint8(0))
+			d.Clock()
+			g.Assert(d.Mpu.X()).Equal(uint8(1))
+		})
+
+		g.It("sees the serial bus in the cycle of the read", func() {
+			d, bus := newTestDrive()
+			copy(d.RAM[0x0300:], []byte{0xad, 0x00, 0x18}) // LDA $1800
+			d.Mpu.SetPC(0x0300)
+
+			d.Clock()
+			d.Clock()
+			d.Clock()
+			bus.Pull(0, iec.ATN)
+			d.Clock()
+			g.Assert(d.Mpu.A() & 0x80).Equal(uint8(0x80))
+		})
+	})
+
+	g.Describe("1541 serial bus", func() {
+		g.It("acknowledges ATN in hardware", func() {
+			d, bus := newTestDrive()
+			d.Set(0x1802, 0x1a)
+			d.tick()
+			g.Assert(bus.IsLow(iec.DATA)).IsFalse()
+
+			bus.Pull(0, iec.ATN)
+			d.tick()
+			g.Assert(bus.IsLow(iec.DATA)).IsTrue()
+			g.Assert(d.Get(0x1800) & 0x80).Equal(uint8(0x80))
+
+			// ATNA
+			d.Set(0x1800, 0x10)
+			g.Assert(bus.IsLow(iec.DATA)).IsFalse()
+		})
+
+		g.It("reports the device number", func() {
+			d, _ := newTestDrive()
+			d.Device = 9
+			g.Assert(d.Get(0x1800) & 0x60).Equal(uint8(0x20))
+		})
+	})
+
+	g.Describe("1541 disk controller", func() {
+		g.It("moves the head with the stepper motor", func() {
+			d, _ := newTestDrive()
+			start := d.head.halfTrack
+			d.Set(0x1c02, 0x6f)
+			for _, phase := range []byte{1, 2, 3} {
+				d.Set(0x1c00, phase)
+				d.tick()
+			}
+			g.Assert(d.head.halfTrack).Equal(start + 3)
+			d.Set(0x1c00, 2)
+			d.tick()
+			g.Assert(d.head.halfTrack).Equal(start + 2)
+		})
+
+		g.It("finds sync marks and reads bytes", func() {
+			d, _ := newTestDrive()
+			// motor on, density 3, read mode, byte ready enabled
+			d.Set(0x1c02, 0x6f)
+			d.Set(0x1c00, 0x64)
+			d.Set(0x1c0c, 0xee)
+			d.head.halfTrack = disk.HalfTrack(1)
+
+			for !d.head.sync {
+				d.tick()
+			}
+			for d.head.sync {
+				d.tick()
+			}
+			g.Assert(d.Get(0x1c00) & 0x80).Equal(uint8(0x80))
+
+			d.Mpu.SetP(0)
+			d.Get(0x1c01)
+			for d.diskController.Peek(via.IFR)&via.FlagCA1 == 0 {
+				d.tick()
+			}
+			g.Assert(d.Get(0x1c01)).Equal(uint8(0x52))
+			g.Assert(d.Mpu.P() & 0x40).Equal(uint8(0x40))
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package drive
+
+import (
+	"fmt"
+
+	"github.com/gentoomaniac/go64/pkg/disk"
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+// revolutionTime is the time in µs for one revolution of the disk at 300 rpm
+const revolutionTime = 200000
+
+// head represents the read/write head, the stepper motor and the GCR logic of the disk controller
+type head struct {
+	halfTrack    int
+	stepperPhase byte
+
+	// bitPos is the position of the head on the current track in bits
+	bitPos int
+	// clock accumulates the time until the next bit passes the head
+	clock int
+
+	// shift holds the last 10 bits read to detect sync marks
+	shift      uint16
+	bitCounter int
+	readLatch  byte
+	writeShift byte
+	sync       bool
+}
+
+func (h *head) state(s *snapshot.State) {
+	s.Int(&h.halfTrack)
+	s.Byte(&h.stepperPhase)
+	s.Int(&h.bitPos)
+	s.Int(&h.clock)
+	s.Uint16(&h.shift)
+	s.Int(&h.bitCounter)
+	s.Byte(&h.readLatch)
+	s.Byte(&h.writeShift)
+	s.Bool(&h.sync)
+
+	if s.Loading() && (h.halfTrack < 0 || h.halfTrack >= disk.MaxHalfTracks) {
+		s.Fail(fmt.Errorf("invalid half track %d", h.halfTrack))
+	}
+}
+
+// diskPortIn returns the port B pins of VIA2
+func (d *Drive1541) diskPortIn() byte {
+	value := byte(0xff)
+	if d.Disk != nil && d.Disk.WriteProtected {
+		value &^= 0x10
+	}
+	if d.head.sync {
+		value &^= 0x80
+	}
+	return value
+}
+
+func (d *Drive1541) motorOn() bool {
+	return d.diskController.OutputB()&0x04 != 0
+}
+
+// density returns the bit rate selected by PB5 and PB6 of VIA2
+func (d *Drive1541) density() byte {
+	return (d.diskController.OutputB() >> 5) & 0x03
+}
+
+// writing returns true if the disk controller is in write mode (CB2 low)
+func (d *Drive1541) writing() bool {
+	return !d.diskController.CB2()
+}
+
+func (d *Drive1541) track() []byte {
+	if d.Disk == nil {
+		return nil
+	}
+	return d.Disk.Tracks[d.head.halfTrack]
+}
+
+// trackBits returns the number of bits on the current track, unformatted tracks are assumed to be written
+// at the current density
+func (d *Drive1541) trackBits() int {
+	if track := d.track(); len(track) > 0 {
+		return len(track) * 8
+	}
+	return disk.TrackCapacity(d.density()) * 8
+}
+
+func (d *Drive1541) updateHead() {
+	d.stepHead()
+
+	if !d.motorOn() {
+		return
+	}
+
+	// the disk rotates at constant speed, so the time per bit depends on the number of bits on the track
+	d.head.clock += d.trackBits()
+	for d.head.clock >= revolutionTime {
+		d.head.clock -= revolutionTime
+		d.rotateBit()
+	}
+}
+
+// stepHead moves the head by a half track whenever the stepper motor phase changes to a neighbouring phase
+func (d *Drive1541) stepHead() {
+	phase := d.diskController.OutputB() & 0x03
+	if phase == d.head.stepperPhase {
+		return
+	}
+
+	bits := d.trackBits()
+	switch phase {
+	case (d.head.stepperPhase + 1) & 0x03:
+		if d.head.halfTrack < disk.MaxHalfTracks-1 {
+			d.head.halfTrack++
+		}
+	case (d.head.stepperPhase - 1) & 0x03:
+		if d.head.halfTrack > 0 {
+			d.head.halfTrack--
+		}
+	}
+	d.head.stepperPhase = phase
+
+	// keep the angular position of the head
+	d.head.bitPos = d.head.bitPos * d.trackBits() / bits
+}
+
+func (d *Drive1541) rotateBit() {
+	h := &d.head
+	track := d.track()
+	writing := d.writing()
+
+	var bit byte
+	if len(track) > 0 {
+		index, mask := h.bitPos>>3, byte(0x80)>>(h.bitPos&7)
+		if writing && !d.Disk.WriteProtected {
+			if h.writeShift&0x80 != 0 {
+				track[index] |= mask
+			} else {
+				track[index] &^= mask
+			}
+			d.Disk.Modified = true
+		}
+		if track[index]&mask != 0 {
+			bit = 1
+		}
+	}
+	h.bitPos = (h.bitPos + 1) % d.trackBits()
+	h.writeShift <<= 1
+	h.shift = (h.shift<<1 | uint16(bit)) & 0x03ff
+
+	// 10 consecutive 1 bits are a sync mark, the byte counter restarts with the first 0 bit after it
+	if !writing && h.shift == 0x03ff {
+		h.sync = true
+		h.bitCounter = 0
+		return
+	}
+	h.sync = false
+
+	h.bitCounter++
+	if h.bitCounter == 8 {
+		h.bitCounter = 0
+		h.readLatch = byte(h.shift)
+		h.writeShift = d.diskController.OutputA()
+		d.byteReady()
+	}
+}
+
+// byteReady signals a complete byte to VIA2 CA1 and, if enabled by CA2, to the SO pin of the MPU
+func (d *Drive1541) byteReady() {
+	if d.diskController.CA2() {
+		d.Mpu.SetOverflow()
+	}
+	d.diskController.SetCA1(false)
+	d.diskController.SetCA1(true)
+}
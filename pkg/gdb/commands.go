@@ -0,0 +1,372 @@
+package gdb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gentoomaniac/go64/pkg/debugger"
+)
+
+// targetDescription describes the registers in the order of the g packet
+const targetDescription = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gentoomaniac.go64.mos6502">
+    <reg name="a" bitsize="8" regnum="0" type="uint8"/>
+    <reg name="x" bitsize="8" type="uint8"/>
+    <reg name="y" bitsize="8" type="uint8"/>
+    <reg name="s" bitsize="8" type="uint8"/>
+    <reg name="p" bitsize="8" type="uint8"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+  </feature>
+</target>
+`
+
+// the number of bytes of all registers
+const registersSize = 7
+
+// stop replies, the emulation stops with a trap after steps and breakpoints and with an interrupt on request
+const (
+	stopTrap      = "S05"
+	stopInterrupt = "S02"
+)
+
+// errorReply is the reply to invalid requests
+const errorReply = "E01"
+
+// breakpoint is a breakpoint or watchpoint as set by the client with the Z packet
+type breakpoint struct {
+	kind   byte
+	addr   uint16
+	length int
+}
+
+// execute executes a command and returns the reply, unsupported commands get an empty reply
+func (c *session) execute(packet string) (string, error) {
+	if packet == "" {
+		return "", nil
+	}
+
+	command, args := packet[0], packet[1:]
+	switch command {
+	case '?':
+		return stopTrap, nil
+	case 'g':
+		return c.readRegisters(), nil
+	case 'G':
+		return c.writeRegisters(args), nil
+	case 'p':
+		return c.readRegister(args), nil
+	case 'P':
+		return c.writeRegister(args), nil
+	case 'm':
+		return c.readMemory(args), nil
+	case 'M':
+		return c.writeMemory(args), nil
+	case 's':
+		if !c.setPC(args) {
+			return errorReply, nil
+		}
+		c.machine.Step()
+		return stopTrap, nil
+	case 'c':
+		if !c.setPC(args) {
+			return errorReply, nil
+		}
+		return c.run()
+	case 'Z', 'z':
+		return c.changeBreakpoint(command == 'Z', args), nil
+	case 'H':
+		return "OK", nil
+	case 'D':
+		c.detached = true
+		return "OK", nil
+	case 'k':
+		c.detached = true
+		return "", nil
+	case 'q', 'Q':
+		return c.query(packet), nil
+	}
+	return "", nil
+}
+
+// query answers the general queries
+func (c *session) query(packet string) string {
+	name, args, _ := strings.Cut(packet, ":")
+	switch name {
+	case "qSupported":
+		return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+"
+	case "QStartNoAckMode":
+		c.noAck.Store(true)
+		return "OK"
+	case "qAttached":
+		return "1"
+	case "qC":
+		return "QC1"
+	case "qfThreadInfo":
+		return "m1"
+	case "qsThreadInfo":
+		return "l"
+	case "qXfer":
+		return c.readFeatures(args)
+	}
+	return ""
+}
+
+// readFeatures returns a part of the target description for qXfer:features:read:target.xml:offset,length
+func (c *session) readFeatures(args string) string {
+	fields := strings.Split(args, ":")
+	if len(fields) != 4 || fields[0] != "features" || fields[1] != "read" || fields[2] != "target.xml" {
+		return ""
+	}
+	offset, length, ok := parseRange(fields[3])
+	if !ok {
+		return errorReply
+	}
+	if offset >= len(targetDescription) {
+		return "l"
+	}
+	if offset+length >= len(targetDescription) {
+		return "l" + targetDescription[offset:]
+	}
+	return "m" + targetDescription[offset:offset+length]
+}
+
+// registers returns the registers in the order of the target description
+func (c *session) registers() []byte {
+	cpu := c.machine.CPU()
+	return []byte{cpu.A(), cpu.X(), cpu.Y(), cpu.S(), cpu.P(), byte(cpu.PC()), byte(cpu.PC() >> 8)}
+}
+
+func (c *session) setRegisters(values []byte) {
+	cpu := c.machine.CPU()
+	cpu.SetA(values[0])
+	cpu.SetX(values[1])
+	cpu.SetY(values[2])
+	cpu.SetS(values[3])
+	cpu.SetP(values[4])
+	cpu.SetPC(uint16(values[6])<<8 | uint16(values[5]))
+}
+
+func (c *session) readRegisters() string {
+	return hex.EncodeToString(c.registers())
+}
+
+func (c *session) writeRegisters(args string) string {
+	values, err := hex.DecodeString(args)
+	if err != nil || len(values) != registersSize {
+		return errorReply
+	}
+	c.setRegisters(values)
+	return "OK"
+}
+
+// registerBytes returns the offset and size of a register in the g packet
+func registerBytes(n uint64) (int, int, bool) {
+	switch {
+	case n < 5:
+		return int(n), 1, true
+	case n == 5:
+		return 5, 2, true
+	}
+	return 0, 0, false
+}
+
+func (c *session) readRegister(args string) string {
+	n, err := strconv.ParseUint(args, 16, 8)
+	if err != nil {
+		return errorReply
+	}
+	offset, size, ok := registerBytes(n)
+	if !ok {
+		return errorReply
+	}
+	return hex.EncodeToString(c.registers()[offset : offset+size])
+}
+
+func (c *session) writeRegister(args string) string {
+	number, value, ok := strings.Cut(args, "=")
+	if !ok {
+		return errorReply
+	}
+	n, err := strconv.ParseUint(number, 16, 8)
+	if err != nil {
+		return errorReply
+	}
+	offset, size, ok := registerBytes(n)
+	data, err := hex.DecodeString(value)
+	if !ok || err != nil || len(data) != size {
+		return errorReply
+	}
+
+	values := c.registers()
+	copy(values[offset:], data)
+	c.setRegisters(values)
+	return "OK"
+}
+
+// parseRange parses the hexadecimal address and length in "addr,length"
+func parseRange(args string) (int, int, bool) {
+	addrArg, lengthArg, ok := strings.Cut(args, ",")
+	if !ok {
+		return 0, 0, false
+	}
+	addr, err := strconv.ParseUint(addrArg, 16, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	length, err := strconv.ParseUint(lengthArg, 16, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return int(addr), int(length), true
+}
+
+func (c *session) readMemory(args string) string {
+	addr, length, ok := parseRange(args)
+	if !ok || addr+length > 0x10000 {
+		return errorReply
+	}
+
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = c.machine.Peek(uint16(addr + i))
+	}
+	return hex.EncodeToString(data)
+}
+
+func (c *session) writeMemory(args string) string {
+	location, values, found := strings.Cut(args, ":")
+	addr, length, ok := parseRange(location)
+	data, err := hex.DecodeString(values)
+	if !found || !ok || err != nil || len(data) != length || addr+length > 0x10000 {
+		return errorReply
+	}
+
+	for i, value := range data {
+		c.machine.Set(uint16(addr+i), value)
+	}
+	return "OK"
+}
+
+// setPC sets the PC to the optional address of the s and c packets
+func (c *session) setPC(args string) bool {
+	if args == "" {
+		return true
+	}
+	addr, err := strconv.ParseUint(args, 16, 16)
+	if err != nil {
+		return false
+	}
+	c.machine.CPU().SetPC(uint16(addr))
+	return true
+}
+
+// run continues the emulation until a breakpoint triggers or the client interrupts it
+func (c *session) run() (string, error) {
+	// interrupts received while the emulation was stopped are stale
+	select {
+	case <-c.interrupts:
+	default:
+	}
+
+	// the emulation is resumed before an interrupt can break it, a break while it is stopped would be ignored
+	c.machine.Resume()
+	done := make(chan struct{})
+	go func() {
+		c.machine.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return c.stopReason(), nil
+	case <-c.interrupts:
+		c.machine.Break()
+		<-done
+		return stopInterrupt, nil
+	case _, ok := <-c.packets:
+		// only interrupts are expected while running, anything else is a broken client
+		c.machine.Break()
+		<-done
+		if !ok {
+			return "", c.readErr
+		}
+		return "", fmt.Errorf("packet received while running")
+	}
+}
+
+// stopReason returns the stop reply for the breakpoint that stopped the emulation
+func (c *session) stopReason() string {
+	d := c.machine.Debugger()
+	for _, b := range d.Breakpoints() {
+		if b.ID != d.Hit {
+			continue
+		}
+		switch b.Kind {
+		case debugger.Write:
+			return fmt.Sprintf("T05watch:%04x;", b.Start)
+		case debugger.Read:
+			return fmt.Sprintf("T05rwatch:%04x;", b.Start)
+		case debugger.Access:
+			return fmt.Sprintf("T05awatch:%04x;", b.Start)
+		}
+	}
+	return stopTrap
+}
+
+// breakpointKinds maps the types of the Z packet to the kinds of the debugger
+var breakpointKinds = map[byte]debugger.Kind{
+	'0': debugger.Exec,
+	'1': debugger.Exec,
+	'2': debugger.Write,
+	'3': debugger.Read,
+	'4': debugger.Access,
+}
+
+// changeBreakpoint inserts or removes a breakpoint for Z type,addr,kind and z type,addr,kind
+func (c *session) changeBreakpoint(insert bool, args string) string {
+	fields := strings.Split(args, ",")
+	if len(fields) < 3 || len(fields[0]) != 1 {
+		return errorReply
+	}
+	kind, ok := breakpointKinds[fields[0][0]]
+	if !ok {
+		return ""
+	}
+	addr, length, ok := parseRange(fields[1] + "," + fields[2])
+	if !ok || addr > 0xffff {
+		return errorReply
+	}
+	// the length of execution breakpoints is the size of the breakpoint instruction
+	if kind == debugger.Exec || length == 0 {
+		length = 1
+	}
+	if addr+length > 0x10000 {
+		return errorReply
+	}
+
+	key := breakpoint{fields[0][0], uint16(addr), length}
+	d := c.machine.Debugger()
+	if !insert {
+		id, ok := c.breakpoints[key]
+		if !ok {
+			return errorReply
+		}
+		delete(c.breakpoints, key)
+		d.Delete(id)
+		return "OK"
+	}
+
+	if _, ok := c.breakpoints[key]; ok {
+		return "OK"
+	}
+	b, err := d.Add(kind, uint16(addr), uint16(addr+length-1), nil)
+	if err != nil {
+		return errorReply
+	}
+	c.breakpoints[key] = b.ID
+	return "OK"
+}
@@ -0,0 +1,201 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/internal/machinetest"
+)
+
+// client is a minimal RSP client
+type client struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	noAck bool
+}
+
+func (c *client) send(packet string) {
+	fmt.Fprintf(c.conn, "$%s#%02x", packet, sum([]byte(packet)))
+}
+
+// receive reads a packet, the acknowledgement of the request is skipped
+func (c *client) receive() string {
+	if !c.noAck {
+		if b, _ := c.r.ReadByte(); b != '+' {
+			return fmt.Sprintf("missing ack, got %q", b)
+		}
+	}
+	if b, _ := c.r.ReadByte(); b != '$' {
+		return fmt.Sprintf("missing packet start, got %q", b)
+	}
+	data, _ := c.r.ReadString('#')
+	checksum := make([]byte, 2)
+	c.r.Read(checksum)
+	if fmt.Sprintf("%02x", sum([]byte(data[:len(data)-1]))) != string(checksum) {
+		return "invalid checksum"
+	}
+	if !c.noAck {
+		c.conn.Write([]byte{'+'})
+	}
+	return data[:len(data)-1]
+}
+
+func (c *client) request(packet string) string {
+	c.send(packet)
+	return c.receive()
+}
+
+func newTestServer(program ...byte) (*client, *machinetest.Machine) {
+	machine := machinetest.New(program...)
+	machine.Resumed = make(chan struct{}, 1)
+	return serve(machine), machine
+}
+
+// serve connects a client to a server for the machine
+func serve(machine *machinetest.Machine) *client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go NewServer(machine).Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func TestServer(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("GDB server", func() {
+		g.It("stops the running emulation on attach", func() {
+			machine := machinetest.New(0xe8, 0x4c, 0x00, 0x10) // INX, JMP $1000
+			machine.Resume()
+			c := serve(machine)
+			defer c.conn.Close()
+
+			g.Assert(c.request("?")).Equal("S05")
+			g.Assert(machine.Running()).IsFalse()
+			x := machine.CPU().X()
+			c.request("g")
+			g.Assert(machine.CPU().X()).Equal(x)
+		})
+
+		g.It("negotiates features and describes the registers", func() {
+			c, _ := newTestServer()
+			defer c.conn.Close()
+
+			g.Assert(strings.Contains(c.request("qSupported:multiprocess+;xmlRegisters=i386"), "QStartNoAckMode+")).IsTrue()
+			g.Assert(c.request("QStartNoAckMode")).Equal("OK")
+			c.noAck = true
+			g.Assert(c.request("?")).Equal("S05")
+
+			description := c.request("qXfer:features:read:target.xml:0,40")
+			g.Assert(description).Equal("m" + targetDescription[:0x40])
+			description = c.request("qXfer:features:read:target.xml:40,1000")
+			g.Assert(description).Equal("l" + targetDescription[0x40:])
+			g.Assert(c.request("vMustReplyEmpty")).Equal("")
+		})
+
+		g.It("reads and writes registers", func() {
+			c, machine := newTestServer()
+			defer c.conn.Close()
+			machine.CPU().SetA(0x12)
+			machine.CPU().SetS(0xfd)
+
+			g.Assert(c.request("g")).Equal("120000fd" + fmt.Sprintf("%02x", machine.CPU().P()) + "0010")
+			g.Assert(c.request("G0102030405cdab")).Equal("OK")
+			g.Assert(machine.CPU().PC()).Equal(uint16(0xabcd))
+			g.Assert(machine.CPU().Y()).Equal(uint8(3))
+
+			g.Assert(c.request("P1=ff")).Equal("OK")
+			g.Assert(machine.CPU().X()).Equal(uint8(0xff))
+			g.Assert(c.request("P5=0020")).Equal("OK")
+			g.Assert(c.request("p5")).Equal("0020")
+			g.Assert(c.request("p6")).Equal("E01")
+			g.Assert(c.request("G01")).Equal("E01")
+		})
+
+		g.It("reads and writes memory", func() {
+			c, machine := newTestServer(0xa9, 0x01)
+			defer c.conn.Close()
+
+			g.Assert(c.request("m1000,3")).Equal("a90100")
+			g.Assert(c.request("M2000,2:cafe")).Equal("OK")
+			g.Assert(machine.Memory[0x2000:0x2002]).Equal([]byte{0xca, 0xfe})
+			g.Assert(c.request("mffff,2")).Equal("E01")
+			g.Assert(c.request("M2000,2:ca")).Equal("E01")
+		})
+
+		g.It("steps and continues to breakpoints", func() {
+			c, machine := newTestServer(0xe8, 0xe8, 0xe8, 0xe8, 0x00)
+			defer c.conn.Close()
+
+			g.Assert(c.request("s")).Equal("S05")
+			g.Assert(machine.CPU().X()).Equal(uint8(1))
+
+			g.Assert(c.request("Z0,1003,1")).Equal("OK")
+			g.Assert(c.request("c")).Equal("S05")
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1003))
+
+			g.Assert(c.request("z0,1003,1")).Equal("OK")
+			g.Assert(c.request("z0,1003,1")).Equal("E01")
+			g.Assert(c.request("c")).Equal("S05")
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1004))
+		})
+
+		g.It("reports watchpoints", func() {
+			c, machine := newTestServer()
+			defer c.conn.Close()
+
+			g.Assert(c.request("Z2,d020,2")).Equal("OK")
+			g.Assert(c.request("Z4,0400,1")).Equal("OK")
+			breakpoints := machine.Debugger().Breakpoints()
+			g.Assert(len(breakpoints)).Equal(2)
+			g.Assert(breakpoints[0].String()).Equal("1: write $d020-$d021, 0 hits")
+			g.Assert(breakpoints[1].String()).Equal("2: access $0400, 0 hits")
+
+			session := &session{machine: machine}
+			machine.Debugger().Hit = 1
+			g.Assert(session.stopReason()).Equal("T05watch:d020;")
+		})
+
+		g.It("stops the running emulation on an interrupt", func() {
+			c, machine := newTestServer(0x4c, 0x00, 0x10) // JMP $1000
+			defer c.conn.Close()
+
+			c.send("c")
+			ack, _ := c.r.ReadByte()
+			g.Assert(ack).Equal(byte('+'))
+			c.conn.Write([]byte{interrupt})
+			c.noAck = true
+			g.Assert(c.receive()).Equal("S02")
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1000))
+		})
+
+		g.It("rejects packets with invalid checksums", func() {
+			c, _ := newTestServer()
+			defer c.conn.Close()
+
+			c.conn.Write([]byte("$g#00"))
+			nak, _ := c.r.ReadByte()
+			g.Assert(nak).Equal(byte('-'))
+			g.Assert(c.request("?")).Equal("S05")
+		})
+
+		g.It("removes its breakpoints and resumes on detach", func() {
+			c, machine := newTestServer()
+			defer c.conn.Close()
+
+			g.Assert(c.request("Z0,1000,1")).Equal("OK")
+			g.Assert(c.request("D")).Equal("OK")
+			<-machine.Resumed
+			g.Assert(len(machine.Debugger().Breakpoints())).Equal(0)
+		})
+	})
+}
@@ -0,0 +1,221 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// The server speaks the GDB remote serial protocol (RSP) over TCP. The MPU registers are exposed in the order
+// A, X, Y, S, P and PC, which is described to the client with a target description.
+
+// Machine is the emulated system debugged by the client
+type Machine interface {
+	// Peek reads from the address space of the MPU without side effects
+	Peek(addr uint16) byte
+	// Set writes to the address space of the MPU
+	Set(addr uint16, value byte)
+	// CPU returns the MPU to read and change its registers
+	CPU() *mpu.MOS6502
+	// Step executes a single instruction of the stopped emulation
+	Step()
+	// Break requests the running emulation to stop
+	Break()
+	// Stop stops the emulation and returns once it is stopped
+	Stop()
+	// Resume resumes the stopped emulation, a break requested while it was stopped is ignored
+	Resume()
+	// Wait returns once the resumed emulation stopped again
+	Wait()
+	// Debugger returns the breakpoints stopping the emulation
+	Debugger() *debugger.Debugger
+}
+
+// interrupt is the byte sent by the client to stop the running emulation
+const interrupt = 0x03
+
+// Server serves one client at a time. The emulation is stopped while a client is attached and resumed when
+// it detaches.
+type Server struct {
+	machine Machine
+}
+
+// NewServer returns a server debugging the machine
+func NewServer(machine Machine) *Server {
+	return &Server{machine: machine}
+}
+
+// ListenAndServe serves clients on the TCP port of the loopback interface, it only returns on errors
+func (s *Server) ListenAndServe(port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return err
+	}
+	log.Info().Str("address", l.Addr().String()).Msg("GDB server listening")
+	return s.Serve(l)
+}
+
+// Serve serves the clients connecting to the listener, it only returns on errors
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		log.Info().Str("client", conn.RemoteAddr().String()).Msg("GDB client attached")
+		if err := s.handle(conn); err != nil && err != io.EOF {
+			log.Error().Err(err).Msg("GDB connection failed")
+		}
+		conn.Close()
+		log.Info().Str("client", conn.RemoteAddr().String()).Msg("GDB client detached")
+	}
+}
+
+// handle executes the commands of a client until it detaches or the connection is closed
+func (s *Server) handle(conn net.Conn) error {
+	c := &session{
+		machine:     s.machine,
+		conn:        conn,
+		packets:     make(chan string),
+		interrupts:  make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		breakpoints: make(map[breakpoint]int),
+	}
+	go c.read(bufio.NewReader(conn))
+
+	s.machine.Stop()
+	defer func() {
+		close(c.done)
+		for _, id := range c.breakpoints {
+			s.machine.Debugger().Delete(id)
+		}
+		s.machine.Resume()
+	}()
+
+	for packet := range c.packets {
+		reply, err := c.execute(packet)
+		if err != nil {
+			return err
+		}
+		// kill has no reply
+		if packet != "k" {
+			if err := c.send(reply); err != nil {
+				return err
+			}
+		}
+		if c.detached {
+			return nil
+		}
+	}
+	return c.readErr
+}
+
+// session is the state of a connection
+type session struct {
+	machine Machine
+	conn    net.Conn
+
+	// packets delivers the payload of received packets and is closed when reading fails with readErr
+	packets    chan string
+	interrupts chan struct{}
+	readErr    error
+	// done is closed when the session ends
+	done chan struct{}
+
+	// noAck is set once the client switched off acknowledgements
+	noAck    atomic.Bool
+	detached bool
+	// breakpoints maps the breakpoints of the client to the IDs of the debugger
+	breakpoints map[breakpoint]int
+}
+
+// read receives packets and interrupts, invalid packets are rejected so the client retransmits them
+func (c *session) read(r *bufio.Reader) {
+	defer close(c.packets)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		switch b {
+		case interrupt:
+			select {
+			case c.interrupts <- struct{}{}:
+			default:
+			}
+			continue
+		case '$':
+		default:
+			// acknowledgements of our packets, there is no retransmission over TCP
+			continue
+		}
+
+		data, err := r.ReadBytes('#')
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		data = data[:len(data)-1]
+		checksum := make([]byte, 2)
+		if _, err := io.ReadFull(r, checksum); err != nil {
+			c.readErr = err
+			return
+		}
+
+		expected, err := strconv.ParseUint(string(checksum), 16, 8)
+		if err != nil || byte(expected) != sum(data) {
+			if !c.noAck.Load() {
+				c.conn.Write([]byte{'-'})
+			}
+			continue
+		}
+		if !c.noAck.Load() {
+			if _, err := c.conn.Write([]byte{'+'}); err != nil {
+				c.readErr = err
+				return
+			}
+		}
+		select {
+		case c.packets <- string(unescape(data)):
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send sends a packet with the reply
+func (c *session) send(reply string) error {
+	_, err := fmt.Fprintf(c.conn, "$%s#%02x", reply, sum([]byte(reply)))
+	return err
+}
+
+func sum(data []byte) byte {
+	var s byte
+	for _, b := range data {
+		s += b
+	}
+	return s
+}
+
+// unescape restores the bytes escaped with } in binary data
+func unescape(data []byte) []byte {
+	result := data[:0]
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			result = append(result, data[i]^0x20)
+			continue
+		}
+		result = append(result, data[i])
+	}
+	return result
+}
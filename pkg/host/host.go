@@ -0,0 +1,98 @@
+// Package host is the contract between the emulation and the frontends presenting it, e.g. a window, a terminal
+// or a headless test runner. The emulation drives the host at the end of every frame on its own goroutine.
+package host
+
+// AudioRate is the sample rate of the audio passed to the host
+const AudioRate = 44100
+
+// Host presents the emulated machine and feeds it the input of the user
+type Host interface {
+	Video
+	Audio
+	Input
+	Timing
+}
+
+// Video receives the finished frames
+type Video interface {
+	// FrameReady is called with every finished frame, it is only valid during the call
+	FrameReady(frame *Frame)
+}
+
+// Audio receives the sound of the emulation
+type Audio interface {
+	// Samples receives the mono samples of a frame at AudioRate, they are only valid during the call
+	Samples(samples []int16)
+}
+
+// Input is the source of the input events
+type Input interface {
+	// Events returns the events since the last call, they are applied before the next frame
+	Events() []Event
+}
+
+// Timing lets the host take part in the pacing of the emulation
+type Timing interface {
+	// FrameDone is called once the frame was presented and before the emulation waits for the next one to be
+	// due, returning false ends the emulation
+	FrameDone() bool
+}
+
+// Frame is a frame of the emulated machine
+type Frame struct {
+	// Pixels holds Width*Height indexes into the palette of the machine
+	Pixels []byte
+	Width  int
+	Height int
+	// Text is the text screen shown in the frame, for hosts that can't show the pixels
+	Text *Text
+}
+
+const (
+	// TextColumns and TextRows are the size of the text screen in characters
+	TextColumns = 40
+	TextRows    = 25
+)
+
+// Text holds the text screen of the standard character mode
+type Text struct {
+	// Codes are the screen codes of the video matrix, Colors their colors from the color RAM
+	Codes      [TextColumns * TextRows]byte
+	Colors     [TextColumns * TextRows]byte
+	Border     byte
+	Background byte
+	// Lowercase is set if the lower case set of the character ROM is selected, custom character sets are
+	// treated like the upper case one
+	Lowercase bool
+	// Blank is set if the display is disabled, only the border is visible
+	Blank bool
+}
+
+// Key is a key of the keyboard of the emulated machine
+type Key byte
+
+// EventType tells what happened to the input
+type EventType int
+
+const (
+	// KeyDown and KeyUp press and release the key of the event
+	KeyDown EventType = iota
+	KeyUp
+	// AllKeysUp releases all keys, e.g. when the window of the host loses the focus
+	AllKeysUp
+)
+
+// Event is a change of the input
+type Event struct {
+	Type EventType
+	Key  Key
+}
+
+// Headless discards the output and has no input, it runs until the emulation is stopped. Hosts can embed it
+// to leave out the parts they can't present.
+type Headless struct{}
+
+func (Headless) FrameReady(frame *Frame) {}
+func (Headless) Samples(samples []int16) {}
+func (Headless) Events() []Event         { return nil }
+func (Headless) FrameDone() bool         { return true }
@@ -0,0 +1,76 @@
+package iec
+
+import (
+	"sync"
+
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+// Line is a bit mask of the open collector lines of the serial bus
+type Line uint8
+
+const (
+	ATN  Line = 0x01
+	CLK  Line = 0x02
+	DATA Line = 0x04
+	SRQ  Line = 0x08
+)
+
+// MaxDevices is the number of participants the bus can address. 0 is used by the computer, 4-30 by peripherals.
+const MaxDevices = 32
+
+// Bus represents the Commodore serial bus. All lines are open collector: a line is low as soon as a single
+// participant pulls it and only goes high if it is released by everybody.
+type Bus struct {
+	mutex sync.Mutex
+	pulls [MaxDevices]Line
+	low   Line
+}
+
+// Pull sets the lines the given participant is pulling low. Lines not in the mask are released by the participant.
+func (b *Bus) Pull(device int, lines Line) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.pulls[device] == lines {
+		return
+	}
+	b.pulls[device] = lines
+
+	b.low = 0
+	for _, pulled := range b.pulls {
+		b.low |= pulled
+	}
+}
+
+// Low returns all lines that are currently pulled low by at least one participant
+func (b *Bus) Low() Line {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.low
+}
+
+// IsLow returns true if the given line is pulled low
+func (b *Bus) IsLow(line Line) bool {
+	return b.Low()&line != 0
+}
+
+// Release releases all lines pulled by the given participant, e.g. when it is switched off
+func (b *Bus) Release(device int) {
+	b.Pull(device, 0)
+}
+
+// State saves or restores the lines pulled by every participant
+func (b *Bus) State(s *snapshot.State) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.low = 0
+	for i := range b.pulls {
+		lines := byte(b.pulls[i])
+		s.Byte(&lines)
+		b.pulls[i] = Line(lines)
+		b.low |= b.pulls[i]
+	}
+}
@@ -0,0 +1,139 @@
+// Package machinetest provides a fake machine for the tests of the monitor and the debugging servers
+package machinetest
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gentoomaniac/go64/pkg/c64"
+	"github.com/gentoomaniac/go64/pkg/cyclelock"
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/memory"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// Machine runs the program at $1000 on its own goroutine once it is resumed, until the next BRK, execution
+// breakpoint or Break. The MPU only accesses Memory, there are no I/O registers.
+type Machine struct {
+	Memory memory.Memory
+	// Resumed is signalled without blocking every time the emulation is resumed if it is set
+	Resumed chan struct{}
+	// Resets records the argument of every Reset, Autostarted the path of the last Autostart
+	Resets      []bool
+	Autostarted string
+
+	cpu      mpu.MOS6502
+	debugger debugger.Debugger
+	breaking atomic.Bool
+
+	mutex sync.Mutex
+	// stopped is closed once the run goroutine returned
+	stopped chan struct{}
+}
+
+// New returns a stopped machine with the program at $1000 and the PC pointing to it
+func New(program ...byte) *Machine {
+	m := &Machine{stopped: make(chan struct{})}
+	close(m.stopped)
+	m.Memory.CopyTo(0x1000, program)
+	m.cpu.Memory = &m.Memory
+	m.cpu.Init(&cyclelock.AlwaysOpenLock{})
+	m.cpu.SetPC(0x1000)
+	return m
+}
+
+func (m *Machine) Get(addr uint16) byte         { return m.Memory[addr] }
+func (m *Machine) Peek(addr uint16) byte        { return m.Memory[addr] }
+func (m *Machine) Set(addr uint16, value byte)  { m.Memory[addr] = value }
+func (m *Machine) CPU() *mpu.MOS6502            { return &m.cpu }
+func (m *Machine) Break()                       { m.breaking.Store(true) }
+func (m *Machine) Debugger() *debugger.Debugger { return &m.debugger }
+func (m *Machine) Reset(hard bool)              { m.Resets = append(m.Resets, hard) }
+func (m *Machine) Autostart(path string) error  { m.Autostarted = path; return nil }
+func (m *Machine) Screen() []byte               { return make([]byte, c64.ScreenWidth*c64.ScreenHeight) }
+
+// LoadPRG copies the program to its load address and returns that
+func (m *Machine) LoadPRG(prg []byte) (uint16, error) {
+	addr := binary.LittleEndian.Uint16(prg)
+	m.Memory.CopyTo(addr, prg[2:])
+	return addr, nil
+}
+
+// Step executes a single instruction. There are no watchpoints without I/O, so an execution breakpoint at the
+// next instruction stands in for them and stops the stepping commands.
+func (m *Machine) Step() {
+	m.cpu.Step()
+	m.debugger.Check(debugger.Exec, m.cpu.PC(), m.state)
+}
+
+// Stop stops the running emulation and returns once the run goroutine returned
+func (m *Machine) Stop() {
+	m.Break()
+	m.Wait()
+}
+
+// Resume starts the run goroutine
+func (m *Machine) Resume() {
+	m.debugger.Hit = 0
+	m.breaking.Store(false)
+	stopped := make(chan struct{})
+	m.mutex.Lock()
+	m.stopped = stopped
+	m.mutex.Unlock()
+	go m.run(stopped)
+
+	select {
+	case m.Resumed <- struct{}{}:
+	default:
+	}
+}
+
+// Wait returns once the run goroutine returned
+func (m *Machine) Wait() {
+	m.mutex.Lock()
+	stopped := m.stopped
+	m.mutex.Unlock()
+	<-stopped
+}
+
+// Continue resumes the emulation and returns once it stopped again
+func (m *Machine) Continue() {
+	m.Resume()
+	m.Wait()
+}
+
+// Running returns true until the run goroutine returned
+func (m *Machine) Running() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	select {
+	case <-m.stopped:
+		return false
+	default:
+		return true
+	}
+}
+
+// run executes the program until the next BRK, execution breakpoint or Break
+func (m *Machine) run(stopped chan struct{}) {
+	for m.Memory[m.cpu.PC()] != 0x00 && !m.breaking.Load() {
+		m.cpu.Step()
+		if m.debugger.Check(debugger.Exec, m.cpu.PC(), m.state) {
+			break
+		}
+	}
+	close(stopped)
+}
+
+// state returns the values used by the conditions of breakpoints
+func (m *Machine) state() debugger.State {
+	return debugger.State{
+		A:  m.cpu.A(),
+		X:  m.cpu.X(),
+		Y:  m.cpu.Y(),
+		S:  m.cpu.S(),
+		P:  m.cpu.P(),
+		PC: m.cpu.PC(),
+	}
+}
@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gentoomaniac/go64/pkg/debugger"
+)
+
+// addBreakpoint adds a breakpoint for a range given by the arguments, an optional condition follows "if".
+// Trace breakpoints start the trace log instead of stopping the emulation.
+func (m *Monitor) addBreakpoint(kind debugger.Kind, trace bool, args []string) error {
+	var condition *debugger.Condition
+	for i, arg := range args {
+		if strings.ToLower(arg) == "if" {
+			var err error
+			if condition, err = debugger.ParseCondition(strings.Join(args[i+1:], " ")); err != nil {
+				return err
+			}
+			args = args[:i]
+			break
+		}
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("expected a start and an optional end")
+	}
+
+	start, end, err := parseRange(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	b, err := m.machine.Debugger().Add(kind, start, end, condition)
+	if err != nil {
+		return err
+	}
+	b.Trace = trace
+	fmt.Fprintln(m.out, b)
+	return nil
+}
+
+// breakpoint lists the breakpoints without arguments or adds an execution breakpoint
+func (m *Monitor) breakpoint(args []string) error {
+	if len(args) == 0 {
+		for _, b := range m.machine.Debugger().Breakpoints() {
+			fmt.Fprintln(m.out, b)
+		}
+		return nil
+	}
+	return m.addBreakpoint(debugger.Exec, false, args)
+}
+
+// watch adds a watchpoint, it triggers on reads and writes unless r or w is given
+func (m *Monitor) watch(args []string) error {
+	kind := debugger.Access
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "r":
+			kind, args = debugger.Read, args[1:]
+		case "w":
+			kind, args = debugger.Write, args[1:]
+		case "rw":
+			args = args[1:]
+		}
+	}
+	return m.addBreakpoint(kind, false, args)
+}
+
+// changeBreakpoint deletes, enables or disables a breakpoint by its ID
+func (m *Monitor) changeBreakpoint(command string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s id", command)
+	}
+	id, err := parseValue(args[0])
+	if err != nil {
+		return err
+	}
+
+	d := m.machine.Debugger()
+	switch command {
+	case "delete":
+		return d.Delete(int(id))
+	case "enable":
+		return d.Enable(int(id), true)
+	}
+	return d.Enable(int(id), false)
+}
+
+// printHit prints the breakpoint which stopped the emulation
+func (m *Monitor) printHit() {
+	d := m.machine.Debugger()
+	for _, b := range d.Breakpoints() {
+		if b.ID == d.Hit {
+			fmt.Fprintf(m.out, "break %s\n", b)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+package monitor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gentoomaniac/go64/pkg/asm"
+	"github.com/gentoomaniac/go64/pkg/debugger"
+	"github.com/gentoomaniac/go64/pkg/disasm"
+	"github.com/gentoomaniac/go64/pkg/memory"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// Machine is the emulated system controlled by the monitor, it is only accessed while it is stopped
+type Machine interface {
+	// Peek reads from the address space of the MPU without side effects
+	Peek(addr uint16) byte
+	// Set writes to the address space of the MPU
+	Set(addr uint16, value byte)
+	// CPU returns the MPU to read and change its registers
+	CPU() *mpu.MOS6502
+	// Step executes a single instruction
+	Step()
+	// Continue runs the emulation until Break is called
+	Continue()
+	// Break stops the running emulation
+	Break()
+	// Debugger returns the breakpoints stopping the emulation
+	Debugger() *debugger.Debugger
+}
+
+// ErrQuit is returned by Run if the emulator should be quit
+var ErrQuit = errors.New("quit")
+
+// errLeave is returned by the command leaving the monitor
+var errLeave = errors.New("leave monitor")
+
+const (
+	defaultDumpLength   = 0x80
+	defaultDisasmLength = 16
+)
+
+// Monitor is a machine language monitor with the classic commands of the VICE and Action Replay monitors.
+// All numbers are hexadecimal, the $ prefix is optional.
+type Monitor struct {
+	machine Machine
+	in      *bufio.Scanner
+	out     io.Writer
+
+	// the addresses where memory dumps, disassembly and assembly continue if no address is given
+	nextDump, nextDisasm, nextAssemble uint16
+
+	// running is set while the emulation runs for g, interrupted aborts the commands stepping the MPU
+	running     atomic.Bool
+	interrupted atomic.Bool
+}
+
+// New returns a monitor reading its commands from in
+func New(machine Machine, in io.Reader, out io.Writer) *Monitor {
+	return &Monitor{machine: machine, in: bufio.NewScanner(in), out: out}
+}
+
+// Run reads and executes commands for the stopped machine until the monitor is left with x, nil is returned
+// then and the emulation should be resumed. ErrQuit is returned for q and at the end of the input.
+func (m *Monitor) Run() error {
+	m.printLocation()
+	for {
+		fmt.Fprintf(m.out, "(C:$%04x) ", m.machine.CPU().PC())
+		if !m.in.Scan() {
+			fmt.Fprintln(m.out)
+			return ErrQuit
+		}
+
+		err := m.Execute(m.in.Text())
+		switch {
+		case err == errLeave:
+			return nil
+		case err == ErrQuit:
+			return err
+		case err != nil:
+			fmt.Fprintf(m.out, "? %s\n", err)
+		}
+	}
+}
+
+// Interrupt stops the emulation while it runs for g and aborts stepping commands, e.g. on the break key
+func (m *Monitor) Interrupt() {
+	m.interrupted.Store(true)
+	if m.running.Load() {
+		m.machine.Break()
+	}
+}
+
+// Execute executes a single command line
+func (m *Monitor) Execute(line string) error {
+	args, err := split(line)
+	if err != nil || len(args) == 0 {
+		return err
+	}
+	m.interrupted.Store(false)
+
+	command, args := strings.ToLower(args[0]), args[1:]
+	switch command {
+	case "m":
+		return m.dump(args)
+	case "d":
+		return m.disassemble(args)
+	case "r":
+		return m.registers(args)
+	case "a":
+		return m.assemble(line, args)
+	case "g":
+		return m.goTo(args)
+	case "z":
+		return m.step(args, false)
+	case "n":
+		return m.step(args, true)
+	case "f":
+		return m.fill(args)
+	case "t":
+		return m.transfer(args)
+	case "h":
+		return m.hunt(args)
+	case "l":
+		return m.load(args)
+	case "s":
+		return m.save(args)
+	case "break":
+		return m.breakpoint(args)
+	case "watch":
+		return m.watch(args)
+	case "raster":
+		return m.addBreakpoint(debugger.Raster, false, args)
+	case "trace":
+		return m.addBreakpoint(debugger.Exec, true, args)
+	case "delete", "enable", "disable":
+		return m.changeBreakpoint(command, args)
+	case "x":
+		return errLeave
+	case "q":
+		return ErrQuit
+	case "?", "help":
+		fmt.Fprint(m.out, help)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+const help = `m [start [end]]          memory dump
+d [start [end]]          disassemble
+r [reg=value ...]        show or set the registers PC, A, X, Y, S and P
+a [addr] instruction     assemble a single instruction
+g [addr]                 run until the break key is pressed
+z [count]                step into
+n [count]                step over subroutine calls
+f start end byte ...     fill memory with a pattern
+t start end dest         copy memory
+h start end byte|"text"  hunt for bytes
+l "file" [addr]          load a PRG file, addr overrides the load address
+s "file" start end       save memory as a PRG file
+break [start [end]]      list breakpoints or break before executing an address
+watch [r|w|rw] start [end]
+                         break after an instruction reading or writing memory
+raster line [end]        break at the start of a raster line
+trace start [end]        start the trace log when executing an address
+delete id                delete a breakpoint
+enable id, disable id    enable or disable a breakpoint
+                         break, watch, raster and trace take a condition like: if A == $20 && X > 3
+x                        leave the monitor and resume the emulation
+q                        quit the emulator
+`
+
+// split splits a command line into its arguments, quoted arguments can contain spaces and keep their quotes
+func split(line string) ([]string, error) {
+	var args []string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("missing closing quote")
+			}
+			args = append(args, line[:end+2])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		args = append(args, line[:end])
+		line = line[end:]
+	}
+	return args, nil
+}
+
+// parseValue parses a hexadecimal number with an optional $ prefix
+func parseValue(s string) (uint16, error) {
+	value, err := strconv.ParseUint(strings.TrimPrefix(s, "$"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return uint16(value), nil
+}
+
+func parseByte(s string) (byte, error) {
+	value, err := parseValue(s)
+	if err == nil && value > 0xff {
+		err = fmt.Errorf("value %q doesn't fit into a byte", s)
+	}
+	return byte(value), err
+}
+
+// parseRange parses the optional start and end address, end defaults to start + length - 1
+func parseRange(args []string, start uint16, length int) (uint16, uint16, error) {
+	var err error
+	if len(args) > 0 {
+		if start, err = parseValue(args[0]); err != nil {
+			return 0, 0, err
+		}
+	}
+	end := start + uint16(length-1)
+	if end < start {
+		end = 0xffff
+	}
+	if len(args) > 1 {
+		if end, err = parseValue(args[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("end $%04x before start $%04x", end, start)
+	}
+	return start, end, nil
+}
+
+func parseFilename(arg string) string {
+	return strings.Trim(arg, `"`)
+}
+
+func (m *Monitor) dump(args []string) error {
+	start, end, err := parseRange(args, m.nextDump, defaultDumpLength)
+	if err != nil {
+		return err
+	}
+
+	var view memory.Memory
+	for addr := int(start) &^ 0x0f; addr <= int(end); addr++ {
+		view[addr] = m.machine.Peek(uint16(addr))
+	}
+	// DumpMemory excludes the end address but always prints the last row
+	fmt.Fprint(m.out, view.DumpMemory(start, uint16(min(int(end)+1, 0xffff))))
+	m.nextDump = end + 1
+	return nil
+}
+
+func (m *Monitor) disassemble(args []string) error {
+	start, end, err := parseRange(args, m.nextDisasm, 0x10000)
+	if err != nil {
+		return err
+	}
+
+	addr := start
+	for i := 0; len(args) > 1 || i < defaultDisasmLength; i++ {
+		instruction := disasm.Decode(m.machine.Peek, addr)
+		fmt.Fprintln(m.out, instruction.Line())
+		next := instruction.Next()
+		wrapped := next < addr
+		addr = next
+		if len(args) > 1 && (addr > end || wrapped) {
+			break
+		}
+	}
+	m.nextDisasm = addr
+	return nil
+}
+
+func (m *Monitor) registers(args []string) error {
+	cpu := m.machine.CPU()
+	for _, arg := range args {
+		name, valueArg, ok := strings.Cut(strings.ToLower(arg), "=")
+		if !ok {
+			return fmt.Errorf("expected register=value instead of %q", arg)
+		}
+		value, err := parseValue(valueArg)
+		if err != nil {
+			return err
+		}
+		if name != "pc" && value > 0xff {
+			return fmt.Errorf("value %q doesn't fit into %s", valueArg, name)
+		}
+
+		switch name {
+		case "pc":
+			cpu.SetPC(value)
+		case "a":
+			cpu.SetA(byte(value))
+		case "x":
+			cpu.SetX(byte(value))
+		case "y":
+			cpu.SetY(byte(value))
+		case "s", "sp":
+			cpu.SetS(byte(value))
+		case "p":
+			cpu.SetP(byte(value))
+		default:
+			return fmt.Errorf("unknown register %q", name)
+		}
+	}
+
+	fmt.Fprint(m.out, cpu.DumpRegisters())
+	return nil
+}
+
+func (m *Monitor) assemble(line string, args []string) error {
+	addr := m.nextAssemble
+	source := strings.TrimSpace(line)[1:]
+	// the address is optional, it is followed by the mnemonic as some mnemonics like ADC are hexadecimal numbers
+	if len(args) > 1 && asm.IsMnemonic(args[1]) {
+		value, err := parseValue(args[0])
+		if err != nil {
+			return err
+		}
+		addr = value
+		source = strings.TrimSpace(source)[len(args[0]):]
+	}
+
+	code, err := (&asm.Assembler{HexNumbers: true}).AssembleLine(addr, source)
+	if err != nil {
+		return err
+	}
+	for i, value := range code {
+		m.machine.Set(addr+uint16(i), value)
+	}
+
+	fmt.Fprintln(m.out, disasm.Decode(m.machine.Peek, addr).Line())
+	m.nextAssemble = addr + uint16(len(code))
+	return nil
+}
+
+func (m *Monitor) goTo(args []string) error {
+	if len(args) > 0 {
+		addr, err := parseValue(args[0])
+		if err != nil {
+			return err
+		}
+		m.machine.CPU().SetPC(addr)
+	}
+
+	m.running.Store(true)
+	m.machine.Continue()
+	m.running.Store(false)
+	m.printHit()
+	m.printLocation()
+	return nil
+}
+
+// step executes count instructions, subroutine calls are executed as a whole if over is set
+func (m *Monitor) step(args []string, over bool) error {
+	count := uint16(1)
+	if len(args) > 0 {
+		var err error
+		if count, err = parseValue(args[0]); err != nil {
+			return err
+		}
+	}
+
+	cpu, d := m.machine.CPU(), m.machine.Debugger()
+	d.Hit = 0
+	for i := uint16(0); i < count && !m.interrupted.Load() && d.Hit == 0; i++ {
+		if over && disasm.Decode(m.machine.Peek, cpu.PC()).Mnemonic == "JSR" {
+			// the subroutine returns when the stack is back at the level before the call, a watchpoint stops early
+			returnAddr, stack := cpu.PC()+3, cpu.S()
+			m.machine.Step()
+			for !(cpu.PC() == returnAddr && cpu.S() == stack) && !m.interrupted.Load() && d.Hit == 0 {
+				m.machine.Step()
+			}
+		} else {
+			m.machine.Step()
+		}
+		m.printHit()
+		m.printLocation()
+	}
+	return nil
+}
+
+// printLocation prints the next instruction and the registers
+func (m *Monitor) printLocation() {
+	cpu := m.machine.CPU()
+	line := disasm.Decode(m.machine.Peek, cpu.PC()).Line()
+	fmt.Fprintf(m.out, "%-32s a:%02x x:%02x y:%02x s:%02x p:%02x\n", line, cpu.A(), cpu.X(), cpu.Y(), cpu.S(), cpu.P())
+	m.nextDisasm, m.nextAssemble = cpu.PC(), cpu.PC()
+}
+
+func (m *Monitor) fill(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: f start end byte ...")
+	}
+	start, end, err := parseRange(args[:2], 0, 1)
+	if err != nil {
+		return err
+	}
+	pattern, err := parseBytes(args[2:])
+	if err != nil {
+		return err
+	}
+
+	for addr := int(start); addr <= int(end); addr++ {
+		m.machine.Set(uint16(addr), pattern[(addr-int(start))%len(pattern)])
+	}
+	return nil
+}
+
+func (m *Monitor) transfer(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: t start end dest")
+	}
+	start, end, err := parseRange(args[:2], 0, 1)
+	if err != nil {
+		return err
+	}
+	dest, err := parseValue(args[2])
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, int(end)-int(start)+1)
+	for i := range data {
+		data[i] = m.machine.Peek(start + uint16(i))
+	}
+	for i, value := range data {
+		m.machine.Set(dest+uint16(i), value)
+	}
+	return nil
+}
+
+func (m *Monitor) hunt(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf(`usage: h start end byte ... or h start end "text"`)
+	}
+	start, end, err := parseRange(args[:2], 0, 1)
+	if err != nil {
+		return err
+	}
+	pattern, err := parseBytes(args[2:])
+	if err != nil {
+		return err
+	}
+
+	var found []string
+	for addr := int(start); addr+len(pattern)-1 <= int(end); addr++ {
+		match := true
+		for i, value := range pattern {
+			if m.machine.Peek(uint16(addr+i)) != value {
+				match = false
+				break
+			}
+		}
+		if match {
+			found = append(found, fmt.Sprintf("%04x", addr))
+		}
+	}
+	for len(found) > 0 {
+		n := min(len(found), 8)
+		fmt.Fprintln(m.out, strings.Join(found[:n], " "))
+		found = found[n:]
+	}
+	return nil
+}
+
+// parseBytes parses hexadecimal bytes and quoted text
+func parseBytes(args []string) ([]byte, error) {
+	var data []byte
+	for _, arg := range args {
+		if strings.HasPrefix(arg, `"`) {
+			data = append(data, parseFilename(arg)...)
+			continue
+		}
+		value, err := parseByte(arg)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, value)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	return data, nil
+}
+
+func (m *Monitor) load(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf(`usage: l "file" [addr]`)
+	}
+	data, err := os.ReadFile(parseFilename(args[0]))
+	if err != nil {
+		return err
+	}
+	if len(data) < 2 {
+		return fmt.Errorf("%s: no load address", args[0])
+	}
+
+	addr := uint16(data[1])<<8 | uint16(data[0])
+	if len(args) > 1 {
+		if addr, err = parseValue(args[1]); err != nil {
+			return err
+		}
+	}
+	data = data[2:]
+	if int(addr)+len(data) > 0x10000 {
+		return fmt.Errorf("%s doesn't fit into memory at $%04x", args[0], addr)
+	}
+
+	for i, value := range data {
+		m.machine.Set(addr+uint16(i), value)
+	}
+	fmt.Fprintf(m.out, "loaded $%04x-$%04x\n", addr, int(addr)+len(data)-1)
+	return nil
+}
+
+func (m *Monitor) save(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf(`usage: s "file" start end`)
+	}
+	start, end, err := parseRange(args[1:], 0, 1)
+	if err != nil {
+		return err
+	}
+
+	data := []byte{byte(start), byte(start >> 8)}
+	for addr := int(start); addr <= int(end); addr++ {
+		data = append(data, m.machine.Peek(uint16(addr)))
+	}
+	return os.WriteFile(parseFilename(args[0]), data, 0o644)
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/internal/machinetest"
+)
+
+func newTestMonitor(program ...byte) (*Monitor, *machinetest.Machine, *bytes.Buffer) {
+	return newTestMonitorWithInput("", program...)
+}
+
+func newTestMonitorWithInput(input string, program ...byte) (*Monitor, *machinetest.Machine, *bytes.Buffer) {
+	machine := machinetest.New(program...)
+
+	out := &bytes.Buffer{}
+	return New(machine, strings.NewReader(input), out), machine, out
+}
+
+func TestMonitor(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Monitor", func() {
+		g.It("dumps memory", func() {
+			m, _, out := newTestMonitor(0x48, 0x49)
+			g.Assert(m.Execute("m 1000 100f")).IsNil()
+			g.Assert(out.String()).Equal("0x1000 48 49 00 00 00 00 00 00 00 00 00 00 00 00 00 00 HI..............\n")
+
+			out.Reset()
+			g.Assert(m.Execute("m")).IsNil()
+			g.Assert(strings.HasPrefix(out.String(), "0x1010 ")).IsTrue()
+		})
+
+		g.It("disassembles all addressing modes", func() {
+			m, _, out := newTestMonitor(
+				0xa9, 0x01, // LDA #$01
+				0xb1, 0xfb, // LDA ($fb),Y
+				0x9d, 0x00, 0x04, // STA $0400,X
+				0xd0, 0xf7, // BNE $1000
+				0x6c, 0xfc, 0xff, // JMP ($fffc)
+				0x0a,       // ASL
+				0xa7, 0x10, // LAX $10
+			)
+			g.Assert(m.Execute("d 1000 100d")).IsNil()
+			g.Assert(out.String()).Equal(strings.Join([]string{
+				"1000  a9 01     LDA #$01",
+				"1002  b1 fb     LDA ($fb),Y",
+				"1004  9d 00 04  STA $0400,X",
+				"1007  d0 f7     BNE $1000",
+				"1009  6c fc ff  JMP ($fffc)",
+				"100c  0a        ASL",
+				"100d  a7 10     LAX $10",
+			}, "\n") + "\n")
+		})
+
+		g.It("assembles instructions", func() {
+			m, machine, _ := newTestMonitor()
+			for _, line := range []string{
+				"a 2000 lda #$01",
+				"a sta $fb",
+				"a sta $0400,x",
+				"a adc ($fb),y",
+				"a asl",
+				"a bne 2000",
+				"a jmp ($0300)",
+				"a lax $10",
+			} {
+				g.Assert(m.Execute(line)).IsNil()
+			}
+			g.Assert(machine.Memory[0x2000:0x2012]).Equal([]byte{
+				0xa9, 0x01, 0x85, 0xfb, 0x9d, 0x00, 0x04, 0x71, 0xfb, 0x0a, 0xd0, 0xf4, 0x6c, 0x00, 0x03, 0xa7, 0x10, 0x00,
+			})
+
+			g.Assert(m.Execute("a 2000 lda #$100") == nil).IsFalse()
+			g.Assert(m.Execute("a 2000 bne 3000") == nil).IsFalse()
+			g.Assert(m.Execute("a 2000 foo") == nil).IsFalse()
+		})
+
+		g.It("shows and sets registers", func() {
+			m, machine, out := newTestMonitor()
+			g.Assert(m.Execute("r pc=c000 a=12 x=34 y=56 s=f0 p=a1")).IsNil()
+			g.Assert(machine.CPU().DumpRegisters()).Equal(out.String())
+			g.Assert(machine.CPU().PC()).Equal(uint16(0xc000))
+			g.Assert(machine.CPU().A()).Equal(uint8(0x12))
+			g.Assert(machine.CPU().S()).Equal(uint8(0xf0))
+
+			g.Assert(m.Execute("r a=100") == nil).IsFalse()
+			g.Assert(m.Execute("r q=1") == nil).IsFalse()
+		})
+
+		g.It("steps into and over subroutines", func() {
+			m, machine, out := newTestMonitor(
+				0x20, 0x10, 0x10, // JSR $1010
+				0xe8, // INX
+			)
+			copy(machine.Memory[0x1010:], []byte{0xc8, 0xc8, 0x60}) // INY INY RTS
+
+			g.Assert(m.Execute("z")).IsNil()
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1010))
+			g.Assert(strings.HasPrefix(out.String(), "1010  c8        INY")).IsTrue()
+
+			machine.CPU().SetPC(0x1000)
+			g.Assert(m.Execute("n")).IsNil()
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1003))
+			g.Assert(machine.CPU().Y()).Equal(uint8(2))
+
+			g.Assert(m.Execute("n 1")).IsNil()
+			g.Assert(machine.CPU().X()).Equal(uint8(1))
+		})
+
+		g.It("runs until the emulation is stopped", func() {
+			m, machine, _ := newTestMonitor(0xe8, 0xe8, 0x00)
+			g.Assert(m.Execute("g")).IsNil()
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1002))
+			g.Assert(machine.CPU().X()).Equal(uint8(2))
+
+			g.Assert(m.Execute("g 1001")).IsNil()
+			g.Assert(machine.CPU().X()).Equal(uint8(3))
+		})
+
+		g.It("manages breakpoints", func() {
+			m, machine, out := newTestMonitor(0xe8, 0xe8, 0xe8, 0xe8, 0x00)
+			g.Assert(m.Execute("break 1003")).IsNil()
+			g.Assert(m.Execute("break $1001 if X == 3")).IsNil()
+			g.Assert(m.Execute("watch w d020 d021")).IsNil()
+			g.Assert(m.Execute("raster 30 if rl>=$30")).IsNil()
+			g.Assert(m.Execute("disable 3")).IsNil()
+			g.Assert(m.Execute("delete 4")).IsNil()
+			g.Assert(m.Execute("trace 1002")).IsNil()
+
+			out.Reset()
+			g.Assert(m.Execute("break")).IsNil()
+			g.Assert(out.String()).Equal(strings.Join([]string{
+				"1: exec $1003, 0 hits",
+				"2: exec $1001 if X == 3, 0 hits",
+				"3: write $d020-$d021 (disabled), 0 hits",
+				"5: trace exec $1002, 0 hits",
+				"",
+			}, "\n"))
+
+			out.Reset()
+			g.Assert(m.Execute("g")).IsNil()
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1003))
+			g.Assert(strings.HasPrefix(out.String(), "break 1: exec $1003, 1 hits\n1003  e8")).IsTrue()
+
+			g.Assert(m.Execute("delete 1")).IsNil()
+			g.Assert(m.Execute("g")).IsNil()
+			g.Assert(machine.CPU().PC()).Equal(uint16(0x1004))
+
+			for command, message := range map[string]string{
+				"break 1000 if A": `missing comparison in "A"`,
+				"watch r":         "expected a start and an optional end",
+				"break 2000 1000": "end $1000 before start $2000",
+				"enable 9":        "no breakpoint 9",
+				"delete":          "usage: delete id",
+				"raster 1 2 3":    "expected a start and an optional end",
+			} {
+				g.Assert(m.Execute(command).Error()).Equal(message)
+			}
+		})
+
+		g.It("fills, transfers and hunts memory", func() {
+			m, machine, out := newTestMonitor()
+			g.Assert(m.Execute("f 2000 2004 01 02")).IsNil()
+			g.Assert(machine.Memory[0x2000:0x2006]).Equal([]byte{0x01, 0x02, 0x01, 0x02, 0x01, 0x00})
+
+			g.Assert(m.Execute("t 2000 2004 2001")).IsNil()
+			g.Assert(machine.Memory[0x2000:0x2006]).Equal([]byte{0x01, 0x01, 0x02, 0x01, 0x02, 0x01})
+
+			g.Assert(m.Execute("h 2000 2fff 01 02")).IsNil()
+			g.Assert(out.String()).Equal("2001 2003\n")
+
+			out.Reset()
+			copy(machine.Memory[0x3000:], "GO 64")
+			g.Assert(m.Execute(`h 0 ffff "GO 64"`)).IsNil()
+			g.Assert(out.String()).Equal("3000\n")
+		})
+
+		g.It("saves and loads PRG files", func() {
+			m, machine, _ := newTestMonitor(0x01, 0x02, 0x03)
+			path := filepath.Join(t.TempDir(), "test file.prg")
+
+			g.Assert(m.Execute(`s "` + path + `" 1000 1002`)).IsNil()
+			data, err := os.ReadFile(path)
+			g.Assert(err).IsNil()
+			g.Assert(data).Equal([]byte{0x00, 0x10, 0x01, 0x02, 0x03})
+
+			g.Assert(m.Execute(`l "` + path + `" 2000`)).IsNil()
+			g.Assert(machine.Memory[0x2000:0x2003]).Equal([]byte{0x01, 0x02, 0x03})
+		})
+
+		g.It("runs commands until it is left", func() {
+			m, machine, out := newTestMonitorWithInput("z\nfoo\nx\nz\nq\nz\n", 0xe8, 0xe8, 0xe8)
+			g.Assert(m.Run()).IsNil()
+			g.Assert(machine.CPU().X()).Equal(uint8(1))
+			g.Assert(strings.Contains(out.String(), `? unknown command "foo"`)).IsTrue()
+
+			g.Assert(m.Run()).Equal(ErrQuit)
+			g.Assert(machine.CPU().X()).Equal(uint8(2))
+			g.Assert(m.Run()).Equal(ErrQuit)
+			g.Assert(machine.CPU().X()).Equal(uint8(3))
+		})
+	})
+}
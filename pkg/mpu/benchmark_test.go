@@ -0,0 +1,98 @@
+package mpu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gentoomaniac/go64/pkg/asm"
+	"github.com/gentoomaniac/go64/pkg/cyclelock"
+	"github.com/gentoomaniac/go64/pkg/memory"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// benchmarkProgram copies a page and sums it up in an endless loop
+const benchmarkProgram = `
+		*= $1000
+start:	ldx #0
+copy:	lda $2000,x
+		sta $3000,x
+		inx
+		bne copy
+		clc
+sum:	adc $3000,x
+		dey
+		bne sum
+		jsr sub
+		jmp start
+sub:	pha
+		pla
+		rts
+`
+
+// newBenchmarkMPU returns a MPU running the benchmark program
+func newBenchmarkMPU(b *testing.B, lock cyclelock.CycleLock) *mpu.MOS6502 {
+	program, err := asm.Assemble(benchmarkProgram)
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := &memory.Memory{}
+	program.Store(m.Set)
+	cpu := &mpu.MOS6502{Memory: m}
+	cpu.Init(lock)
+	cpu.SetPC(program.Symbols["start"])
+	return cpu
+}
+
+// benchmarkMPU runs the program for b.N instructions and reports the clock rate achieved
+func benchmarkMPU(b *testing.B, lock cyclelock.CycleLock) {
+	cpu := newBenchmarkMPU(b, lock)
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		cpu.Step()
+	}
+	b.ReportMetric(float64(lock.CycleCount())/time.Since(start).Seconds()/1e6, "MHz")
+}
+
+func BenchmarkStep(b *testing.B) {
+	benchmarkMPU(b, &cyclelock.AlwaysOpenLock{})
+}
+
+// BenchmarkStepChannelLock passes the lock through a channel on every cycle, a second goroutine takes it back
+// after every cycle like the former emulation loop
+func BenchmarkStepChannelLock(b *testing.B) {
+	lock := &cyclelock.ChannelLock{}
+	lock.Init()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			lock.Unlock()
+			lock.WaitForLock()
+		}
+	}()
+
+	benchmarkMPU(b, lock)
+	close(done)
+	<-stopped
+}
+
+// BenchmarkTick runs the program cycle by cycle
+func BenchmarkTick(b *testing.B) {
+	cpu := newBenchmarkMPU(b, &cyclelock.AlwaysOpenLock{})
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		cpu.Tick()
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds()/1e6, "MHz")
+}
@@ -0,0 +1,557 @@
+package mpu
+
+/* Instruction execution */
+// Every bus access of an instruction takes exactly one cycle, including the dummy reads and writes of the real
+// hardware, so that the cycle count of the CycleLock matches the real MPU.
+// http://www.atarihq.com/danb/files/64doc.txt
+
+// Step executes a single instruction or enters a pending interrupt
+func (m *MOS6502) Step() {
+	m.tick.next, m.tick.count = 0, 0
+	if m.jammed {
+		m.getByteFromMemory(0xffff, true)
+		return
+	}
+
+	if m.nmiPending {
+		m.nmiPending = false
+		m.interrupt(NMIVector)
+		return
+	}
+	if m.irqSources != 0 && m.p&I == 0 {
+		m.interrupt(IRQVector)
+		return
+	}
+
+	if m.trapped != nil && m.trapped[m.pc/64]&(1<<(m.pc%64)) != 0 && m.traps[m.pc]() {
+		return
+	}
+
+	opcode := &Opcodes[m.getNextCodeByte()]
+
+	switch opcode.kind {
+	case kindImplied:
+		m.getByteFromMemory(m.pc, true)
+		opcode.operation(m, 0, 0)
+
+	case kindBranch:
+		offset := m.getNextCodeByte()
+		if opcode.operation(m, 0, 0) != 0 {
+			m.getByteFromMemory(m.pc, true)
+			target := m.relativeAdressing(m.pc, offset)
+			if offset&0x80 != 0 {
+				target -= 0x100
+			}
+			if target&0xff00 != m.pc&0xff00 {
+				m.getByteFromMemory((m.pc&0xff00)|(target&0x00ff), true)
+			}
+			m.pc = target
+		}
+
+	case kindControl:
+		opcode.operation(m, 0, 0)
+
+	default:
+		m.execute(opcode)
+	}
+}
+
+func (m *MOS6502) execute(opcode *Opcode) {
+	if opcode.Mode == Accumulator {
+		m.getByteFromMemory(m.pc, true)
+		m.a = opcode.operation(m, 0, m.a)
+		return
+	}
+	if opcode.Mode == Immediate {
+		opcode.operation(m, 0, m.getNextCodeByte())
+		return
+	}
+
+	addr := m.effectiveAddress(opcode)
+
+	switch opcode.kind {
+	case kindRead:
+		opcode.operation(m, addr, m.getByteFromMemory(addr, true))
+	case kindWrite:
+		m.storeByteInMemory(addr, opcode.operation(m, addr, 0), true)
+	case kindReadModifyWrite:
+		value := m.getByteFromMemory(addr, true)
+		m.storeByteInMemory(addr, value, true)
+		m.storeByteInMemory(addr, opcode.operation(m, addr, value), true)
+	}
+}
+
+// effectiveAddress fetches the operand and resolves the address including all dummy accesses
+func (m *MOS6502) effectiveAddress(opcode *Opcode) uint16 {
+	// read instructions only take the extra cycle when a page boundary is crossed
+	fixAlways := opcode.kind != kindRead
+
+	switch opcode.Mode {
+	case Zeropage:
+		return m.zeropageAdressing(m.getNextCodeByte())
+
+	case ZeropageX, ZeropageY:
+		base := m.getNextCodeByte()
+		m.getByteFromMemory(uint16(base), true)
+		if opcode.Mode == ZeropageX {
+			return m.zeropageIndexedAdressing(base, m.x)
+		}
+		return m.zeropageIndexedAdressing(base, m.y)
+
+	case Absolute:
+		return m.absoluteAdressing(m.getNextCodeWord())
+
+	case AbsoluteX, AbsoluteY:
+		base := m.getNextCodeWord()
+		index := m.x
+		if opcode.Mode == AbsoluteY {
+			index = m.y
+		}
+		return m.indexWithFixup(base, index, fixAlways)
+
+	case IndexedIndirect:
+		base := m.getNextCodeByte()
+		m.getByteFromMemory(uint16(base), true)
+		return m.indexedIndirectAdressing(base)
+
+	case IndirectIndexed:
+		pointer := m.getDWordFromZeropage(m.getNextCodeByte())
+		return m.indexWithFixup(pointer, m.y, fixAlways)
+	}
+
+	return 0
+}
+
+// indexWithFixup adds the index to base and performs the dummy read from the not yet fixed high byte
+func (m *MOS6502) indexWithFixup(base uint16, index uint8, fixAlways bool) uint16 {
+	addr := m.indexedAdressing(base, index)
+	m.baseHigh = uint8(base >> 8)
+	if fixAlways || addr&0xff00 != base&0xff00 {
+		m.getByteFromMemory((base&0xff00)|(addr&0x00ff), true)
+	}
+	return addr
+}
+
+func (m *MOS6502) getNextCodeWord() uint16 {
+	lo := m.getNextCodeByte()
+	hi := m.getNextCodeByte()
+	return uint16(hi)<<8 | uint16(lo)
+}
+
+// interrupt runs the 7 cycle interrupt sequence for IRQ and NMI
+func (m *MOS6502) interrupt(vector uint16) {
+	m.getByteFromMemory(m.pc, true)
+	m.getByteFromMemory(m.pc, true)
+	m.pushInterruptFrame(vector, false)
+}
+
+// pushInterruptFrame pushes PC and P and loads the PC from the vector. A NMI occuring during the sequence hijacks it.
+func (m *MOS6502) pushInterruptFrame(vector uint16, brk bool) {
+	m.push(m.PCH(), true)
+	m.push(m.PCL(), true)
+
+	status := m.p | uint8(X)
+	if brk {
+		status |= uint8(B)
+	} else {
+		status &^= uint8(B)
+	}
+	m.push(status, true)
+
+	if vector != NMIVector && m.nmiPending {
+		m.nmiPending = false
+		vector = NMIVector
+	}
+
+	m.setProcessorStatusBit(I, true)
+	lo := m.getByteFromMemory(vector, true)
+	hi := m.getByteFromMemory(vector+1, true)
+	m.pc = uint16(hi)<<8 | uint16(lo)
+}
+
+/* Flag helpers */
+
+func (m *MOS6502) setNZ(value byte) {
+	m.setProcessorStatusBit(Z, value == 0)
+	m.setProcessorStatusBit(N, value&0x80 != 0)
+}
+
+func (m *MOS6502) flag(s ProcessorStatus) bool {
+	return m.p&uint8(s) != 0
+}
+
+func (m *MOS6502) carry() byte {
+	return m.p & uint8(C)
+}
+
+func (m *MOS6502) compare(register byte, value byte) {
+	m.setProcessorStatusBit(C, register >= value)
+	m.setNZ(register - value)
+}
+
+func branchIf(condition bool) byte {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+/* Load, store and transfer */
+
+func (m *MOS6502) lda(addr uint16, value byte) byte { m.a = value; m.setNZ(m.a); return 0 }
+func (m *MOS6502) ldx(addr uint16, value byte) byte { m.x = value; m.setNZ(m.x); return 0 }
+func (m *MOS6502) ldy(addr uint16, value byte) byte { m.y = value; m.setNZ(m.y); return 0 }
+func (m *MOS6502) sta(addr uint16, value byte) byte { return m.a }
+func (m *MOS6502) stx(addr uint16, value byte) byte { return m.x }
+func (m *MOS6502) sty(addr uint16, value byte) byte { return m.y }
+func (m *MOS6502) tax(addr uint16, value byte) byte { m.x = m.a; m.setNZ(m.x); return 0 }
+func (m *MOS6502) txa(addr uint16, value byte) byte { m.a = m.x; m.setNZ(m.a); return 0 }
+func (m *MOS6502) tay(addr uint16, value byte) byte { m.y = m.a; m.setNZ(m.y); return 0 }
+func (m *MOS6502) tya(addr uint16, value byte) byte { m.a = m.y; m.setNZ(m.a); return 0 }
+func (m *MOS6502) tsx(addr uint16, value byte) byte { m.x = m.s; m.setNZ(m.x); return 0 }
+func (m *MOS6502) txs(addr uint16, value byte) byte { m.s = m.x; return 0 }
+
+/* Arithmetic and logic */
+
+func (m *MOS6502) ora(addr uint16, value byte) byte { m.a |= value; m.setNZ(m.a); return 0 }
+func (m *MOS6502) and(addr uint16, value byte) byte { m.a &= value; m.setNZ(m.a); return 0 }
+func (m *MOS6502) eor(addr uint16, value byte) byte { m.a ^= value; m.setNZ(m.a); return 0 }
+func (m *MOS6502) cmp(addr uint16, value byte) byte { m.compare(m.a, value); return 0 }
+func (m *MOS6502) cpx(addr uint16, value byte) byte { m.compare(m.x, value); return 0 }
+func (m *MOS6502) cpy(addr uint16, value byte) byte { m.compare(m.y, value); return 0 }
+
+func (m *MOS6502) bit(addr uint16, value byte) byte {
+	m.setProcessorStatusBit(Z, m.a&value == 0)
+	m.setProcessorStatusBit(N, value&0x80 != 0)
+	m.setProcessorStatusBit(V, value&0x40 != 0)
+	return 0
+}
+
+// adc implements the NMOS behaviour including the flags in decimal mode
+// http://www.6502.org/tutorials/decimal_mode.html
+func (m *MOS6502) adc(addr uint16, value byte) byte {
+	a := int(m.a)
+	v := int(value)
+	c := int(m.carry())
+
+	if !m.flag(D) {
+		result := a + v + c
+		m.setProcessorStatusBit(C, result > 0xff)
+		m.setProcessorStatusBit(V, (a^result)&(v^result)&0x80 != 0)
+		m.a = byte(result)
+		m.setNZ(m.a)
+		return 0
+	}
+
+	lo := (a & 0x0f) + (v & 0x0f) + c
+	if lo > 0x09 {
+		lo += 0x06
+	}
+	result := (a & 0xf0) + (v & 0xf0) + (lo & 0x0f)
+	if lo > 0x0f {
+		result += 0x10
+	}
+	m.setProcessorStatusBit(Z, (a+v+c)&0xff == 0)
+	m.setProcessorStatusBit(N, result&0x80 != 0)
+	m.setProcessorStatusBit(V, (a^result)&0x80 != 0 && (a^v)&0x80 == 0)
+	if result&0x1f0 > 0x90 {
+		result += 0x60
+	}
+	m.setProcessorStatusBit(C, result&0xff0 > 0xf0)
+	m.a = byte(result)
+	return 0
+}
+
+func (m *MOS6502) sbc(addr uint16, value byte) byte {
+	a := int(m.a)
+	v := int(value)
+	borrow := 1 - int(m.carry())
+
+	result := a - v - borrow
+	m.setProcessorStatusBit(C, result >= 0)
+	m.setProcessorStatusBit(V, (a^v)&(a^result)&0x80 != 0)
+	m.setNZ(byte(result))
+
+	if !m.flag(D) {
+		m.a = byte(result)
+		return 0
+	}
+
+	lo := (a & 0x0f) - (v & 0x0f) - borrow
+	var decimal int
+	if lo&0x10 != 0 {
+		decimal = ((lo - 0x06) & 0x0f) | ((a & 0xf0) - (v & 0xf0) - 0x10)
+	} else {
+		decimal = (lo & 0x0f) | ((a & 0xf0) - (v & 0xf0))
+	}
+	if decimal&0x100 != 0 {
+		decimal -= 0x60
+	}
+	m.a = byte(decimal)
+	return 0
+}
+
+func (m *MOS6502) asl(addr uint16, value byte) byte {
+	m.setProcessorStatusBit(C, value&0x80 != 0)
+	value <<= 1
+	m.setNZ(value)
+	return value
+}
+
+func (m *MOS6502) lsr(addr uint16, value byte) byte {
+	m.setProcessorStatusBit(C, value&0x01 != 0)
+	value >>= 1
+	m.setNZ(value)
+	return value
+}
+
+func (m *MOS6502) rol(addr uint16, value byte) byte {
+	carry := m.carry()
+	m.setProcessorStatusBit(C, value&0x80 != 0)
+	value = value<<1 | carry
+	m.setNZ(value)
+	return value
+}
+
+func (m *MOS6502) ror(addr uint16, value byte) byte {
+	carry := m.carry() << 7
+	m.setProcessorStatusBit(C, value&0x01 != 0)
+	value = value>>1 | carry
+	m.setNZ(value)
+	return value
+}
+
+func (m *MOS6502) inc(addr uint16, value byte) byte { value++; m.setNZ(value); return value }
+func (m *MOS6502) dec(addr uint16, value byte) byte { value--; m.setNZ(value); return value }
+func (m *MOS6502) inx(addr uint16, value byte) byte { m.x++; m.setNZ(m.x); return 0 }
+func (m *MOS6502) dex(addr uint16, value byte) byte { m.x--; m.setNZ(m.x); return 0 }
+func (m *MOS6502) iny(addr uint16, value byte) byte { m.y++; m.setNZ(m.y); return 0 }
+func (m *MOS6502) dey(addr uint16, value byte) byte { m.y--; m.setNZ(m.y); return 0 }
+
+/* Flags */
+
+func (m *MOS6502) clc(addr uint16, value byte) byte { m.setProcessorStatusBit(C, false); return 0 }
+func (m *MOS6502) sec(addr uint16, value byte) byte { m.setProcessorStatusBit(C, true); return 0 }
+func (m *MOS6502) cli(addr uint16, value byte) byte { m.setProcessorStatusBit(I, false); return 0 }
+func (m *MOS6502) sei(addr uint16, value byte) byte { m.setProcessorStatusBit(I, true); return 0 }
+func (m *MOS6502) clv(addr uint16, value byte) byte { m.setProcessorStatusBit(V, false); return 0 }
+func (m *MOS6502) cld(addr uint16, value byte) byte { m.setProcessorStatusBit(D, false); return 0 }
+func (m *MOS6502) sed(addr uint16, value byte) byte { m.setProcessorStatusBit(D, true); return 0 }
+func (m *MOS6502) nop(addr uint16, value byte) byte { return 0 }
+
+/* Branches */
+
+func (m *MOS6502) bpl(addr uint16, value byte) byte { return branchIf(!m.flag(N)) }
+func (m *MOS6502) bmi(addr uint16, value byte) byte { return branchIf(m.flag(N)) }
+func (m *MOS6502) bvc(addr uint16, value byte) byte { return branchIf(!m.flag(V)) }
+func (m *MOS6502) bvs(addr uint16, value byte) byte { return branchIf(m.flag(V)) }
+func (m *MOS6502) bcc(addr uint16, value byte) byte { return branchIf(!m.flag(C)) }
+func (m *MOS6502) bcs(addr uint16, value byte) byte { return branchIf(m.flag(C)) }
+func (m *MOS6502) bne(addr uint16, value byte) byte { return branchIf(!m.flag(Z)) }
+func (m *MOS6502) beq(addr uint16, value byte) byte { return branchIf(m.flag(Z)) }
+
+/* Control flow and stack */
+
+func (m *MOS6502) brk(addr uint16, value byte) byte {
+	m.getNextCodeByte()
+	m.pushInterruptFrame(IRQVector, true)
+	return 0
+}
+
+func (m *MOS6502) jsr(addr uint16, value byte) byte {
+	lo := m.getNextCodeByte()
+	m.getByteFromMemory(StackOffset+uint16(m.s), true)
+	m.push(m.PCH(), true)
+	m.push(m.PCL(), true)
+	hi := m.getByteFromMemory(m.pc, true)
+	m.pc = uint16(hi)<<8 | uint16(lo)
+	return 0
+}
+
+func (m *MOS6502) rts(addr uint16, value byte) byte {
+	m.getByteFromMemory(m.pc, true)
+	m.getByteFromMemory(StackOffset+uint16(m.s), true)
+	m.SetPCL(m.pop(true))
+	m.SetPCH(m.pop(true))
+	m.getNextCodeByte()
+	return 0
+}
+
+func (m *MOS6502) rti(addr uint16, value byte) byte {
+	m.getByteFromMemory(m.pc, true)
+	m.getByteFromMemory(StackOffset+uint16(m.s), true)
+	m.p = m.pop(true)&^uint8(B) | uint8(X)
+	m.SetPCL(m.pop(true))
+	m.SetPCH(m.pop(true))
+	return 0
+}
+
+func (m *MOS6502) jmp(addr uint16, value byte) byte {
+	m.pc = m.getNextCodeWord()
+	return 0
+}
+
+func (m *MOS6502) jmpIndirect(addr uint16, value byte) byte {
+	// the high byte of the pointer is not incremented (see "The 6502 bugs")
+	m.pc = m.getDWordFromMemoryByAddr(m.getNextCodeWord(), true)
+	return 0
+}
+
+func (m *MOS6502) pha(addr uint16, value byte) byte {
+	m.getByteFromMemory(m.pc, true)
+	m.push(m.a, true)
+	return 0
+}
+
+func (m *MOS6502) php(addr uint16, value byte) byte {
+	m.getByteFromMemory(m.pc, true)
+	m.push(m.p|uint8(B)|uint8(X), true)
+	return 0
+}
+
+func (m *MOS6502) pla(addr uint16, value byte) byte {
+	m.getByteFromMemory(m.pc, true)
+	m.getByteFromMemory(StackOffset+uint16(m.s), true)
+	m.a = m.pop(true)
+	m.setNZ(m.a)
+	return 0
+}
+
+func (m *MOS6502) plp(addr uint16, value byte) byte {
+	m.getByteFromMemory(m.pc, true)
+	m.getByteFromMemory(StackOffset+uint16(m.s), true)
+	m.p = m.pop(true)&^uint8(B) | uint8(X)
+	return 0
+}
+
+func (m *MOS6502) jam(addr uint16, value byte) byte {
+	m.jammed = true
+	return 0
+}
+
+/* Undocumented opcodes */
+// http://www.oxyron.de/html/opcodes02.html
+// https://csdb.dk/release/?id=198357 (No More Secrets)
+
+func (m *MOS6502) slo(addr uint16, value byte) byte {
+	value = m.asl(addr, value)
+	m.ora(addr, value)
+	return value
+}
+
+func (m *MOS6502) rla(addr uint16, value byte) byte {
+	value = m.rol(addr, value)
+	m.and(addr, value)
+	return value
+}
+
+func (m *MOS6502) sre(addr uint16, value byte) byte {
+	value = m.lsr(addr, value)
+	m.eor(addr, value)
+	return value
+}
+
+func (m *MOS6502) rra(addr uint16, value byte) byte {
+	value = m.ror(addr, value)
+	m.adc(addr, value)
+	return value
+}
+
+func (m *MOS6502) dcp(addr uint16, value byte) byte {
+	value--
+	m.compare(m.a, value)
+	return value
+}
+
+func (m *MOS6502) isc(addr uint16, value byte) byte {
+	value++
+	m.sbc(addr, value)
+	return value
+}
+
+func (m *MOS6502) sax(addr uint16, value byte) byte { return m.a & m.x }
+
+func (m *MOS6502) lax(addr uint16, value byte) byte {
+	m.a = value
+	m.x = value
+	m.setNZ(value)
+	return 0
+}
+
+func (m *MOS6502) anc(addr uint16, value byte) byte {
+	m.and(addr, value)
+	m.setProcessorStatusBit(C, m.a&0x80 != 0)
+	return 0
+}
+
+func (m *MOS6502) alr(addr uint16, value byte) byte {
+	m.a = m.lsr(addr, m.a&value)
+	return 0
+}
+
+func (m *MOS6502) arr(addr uint16, value byte) byte {
+	and := m.a & value
+	result := and>>1 | m.carry()<<7
+
+	if !m.flag(D) {
+		m.a = result
+		m.setNZ(m.a)
+		m.setProcessorStatusBit(C, m.a&0x40 != 0)
+		m.setProcessorStatusBit(V, (m.a&0x40)^((m.a&0x20)<<1) != 0)
+		return 0
+	}
+
+	m.setProcessorStatusBit(N, m.flag(C))
+	m.setProcessorStatusBit(Z, result == 0)
+	m.setProcessorStatusBit(V, (and^result)&0x40 != 0)
+	if (and&0x0f)+(and&0x01) > 0x05 {
+		result = (result & 0xf0) | ((result + 0x06) & 0x0f)
+	}
+	carry := uint16(and&0xf0)+uint16(and&0x10) > 0x50
+	if carry {
+		result += 0x60
+	}
+	m.setProcessorStatusBit(C, carry)
+	m.a = result
+	return 0
+}
+
+// ane and lxa are unstable, the magic constant depends on the chip. 0xee is what most C64s show.
+func (m *MOS6502) ane(addr uint16, value byte) byte {
+	m.a = (m.a | 0xee) & m.x & value
+	m.setNZ(m.a)
+	return 0
+}
+
+func (m *MOS6502) lxa(addr uint16, value byte) byte {
+	m.a = (m.a | 0xee) & value
+	m.x = m.a
+	m.setNZ(m.a)
+	return 0
+}
+
+func (m *MOS6502) sbx(addr uint16, value byte) byte {
+	ax := m.a & m.x
+	m.setProcessorStatusBit(C, ax >= value)
+	m.x = ax - value
+	m.setNZ(m.x)
+	return 0
+}
+
+func (m *MOS6502) las(addr uint16, value byte) byte {
+	m.a = value & m.s
+	m.x = m.a
+	m.s = m.a
+	m.setNZ(m.a)
+	return 0
+}
+
+// sha, shx, shy and tas store the register and'ed with the high byte of the base address + 1
+func (m *MOS6502) sha(addr uint16, value byte) byte { return m.a & m.x & (m.baseHigh + 1) }
+func (m *MOS6502) shx(addr uint16, value byte) byte { return m.x & (m.baseHigh + 1) }
+func (m *MOS6502) shy(addr uint16, value byte) byte { return m.y & (m.baseHigh + 1) }
+
+func (m *MOS6502) tas(addr uint16, value byte) byte {
+	m.s = m.a & m.x
+	return m.s & (m.baseHigh + 1)
+}
@@ -0,0 +1,202 @@
+package mpu
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/cyclelock"
+	"github.com/gentoomaniac/go64/pkg/memory"
+)
+
+func newTestMPU(program ...byte) (*MOS6502, *memory.Memory) {
+	var blankMemory memory.Memory
+	blankMemory.CopyTo(0x0200, program)
+
+	MOS6502 := &MOS6502{}
+	MOS6502.Memory = &blankMemory
+	MOS6502.Init(&cyclelock.AlwaysOpenLock{})
+	MOS6502.pc = 0x0200
+
+	return MOS6502, &blankMemory
+}
+
+func TestInstructions(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Instruction timing", func() {
+		g.It("every opcode takes its documented number of cycles", func() {
+			for opcode := 0; opcode < 0x100; opcode++ {
+				if Opcodes[opcode].Mnemonic == "JAM" {
+					continue
+				}
+
+				var MOS6502 *MOS6502
+				// try both flag states so that branches are not taken
+				for _, p := range []uint8{0x00, 0xff} {
+					MOS6502, _ = newTestMPU(byte(opcode), 0x10, 0x00)
+					MOS6502.p = p &^ uint8(I)
+					MOS6502.Step()
+					if Opcodes[opcode].kind != kindBranch || MOS6502.pc == 0x0202 {
+						break
+					}
+				}
+
+				g.Assert(fmt.Sprintf("%02x %d", opcode, MOS6502.CycleLock.CycleCount())).
+					Equal(fmt.Sprintf("%02x %d", opcode, Opcodes[opcode].Cycles))
+			}
+		})
+
+		g.It("read instructions take an extra cycle on page crossing", func() {
+			// LDA $10ff,X
+			MOS6502, _ := newTestMPU(0xbd, 0xff, 0x10)
+			MOS6502.x = 1
+			MOS6502.Step()
+			g.Assert(MOS6502.CycleLock.CycleCount()).Equal(5)
+		})
+
+		g.It("taken branches take one extra cycle and another one for page crossing", func() {
+			// BNE +2
+			MOS6502, _ := newTestMPU(0xd0, 0x02)
+			MOS6502.Step()
+			g.Assert(MOS6502.CycleLock.CycleCount()).Equal(3)
+			g.Assert(MOS6502.pc).Equal(uint16(0x0204))
+
+			// BNE -3
+			MOS6502, _ = newTestMPU(0xd0, 0xfd)
+			MOS6502.Step()
+			g.Assert(MOS6502.CycleLock.CycleCount()).Equal(4)
+			g.Assert(MOS6502.pc).Equal(uint16(0x01ff))
+		})
+	})
+
+	g.Describe("Instruction semantics", func() {
+		g.It("adds in binary and decimal mode", func() {
+			// CLC; LDA #$09; ADC #$01; SED; ADC #$01
+			MOS6502, _ := newTestMPU(0x18, 0xa9, 0x09, 0x69, 0x01, 0xf8, 0x69, 0x01)
+			for i := 0; i < 3; i++ {
+				MOS6502.Step()
+			}
+			g.Assert(MOS6502.a).Equal(uint8(0x0a))
+			MOS6502.Step()
+			MOS6502.a = 0x09
+			MOS6502.Step()
+			g.Assert(MOS6502.a).Equal(uint8(0x10))
+
+			MOS6502, _ = newTestMPU(0xf8, 0x38, 0xa9, 0x99, 0x69, 0x00)
+			for i := 0; i < 4; i++ {
+				MOS6502.Step()
+			}
+			g.Assert(MOS6502.a).Equal(uint8(0x00))
+			g.Assert(MOS6502.p&uint8(C) != 0).IsTrue()
+		})
+
+		g.It("subtracts in binary and decimal mode", func() {
+			// SEC; LDA #$10; SBC #$01
+			MOS6502, _ := newTestMPU(0x38, 0xa9, 0x10, 0xe9, 0x01)
+			for i := 0; i < 3; i++ {
+				MOS6502.Step()
+			}
+			g.Assert(MOS6502.a).Equal(uint8(0x0f))
+			g.Assert(MOS6502.p&uint8(C) != 0).IsTrue()
+
+			// SED; SEC; LDA #$10; SBC #$01
+			MOS6502, _ = newTestMPU(0xf8, 0x38, 0xa9, 0x10, 0xe9, 0x01)
+			for i := 0; i < 4; i++ {
+				MOS6502.Step()
+			}
+			g.Assert(MOS6502.a).Equal(uint8(0x09))
+		})
+
+		g.It("calls and returns from subroutines", func() {
+			// JSR $0210; ... $0210: LDX #$42; RTS
+			MOS6502, mem := newTestMPU(0x20, 0x10, 0x02)
+			mem.CopyTo(0x0210, []byte{0xa2, 0x42, 0x60})
+
+			MOS6502.Step()
+			g.Assert(MOS6502.pc).Equal(uint16(0x0210))
+			g.Assert(mem[0x01ff]).Equal(uint8(0x02))
+			g.Assert(mem[0x01fe]).Equal(uint8(0x02))
+			MOS6502.Step()
+			MOS6502.Step()
+			g.Assert(MOS6502.pc).Equal(uint16(0x0203))
+			g.Assert(MOS6502.x).Equal(uint8(0x42))
+			g.Assert(MOS6502.s).Equal(uint8(0xff))
+		})
+
+		g.It("runs a loop", func() {
+			// LDX #$05; LDA #$00; CLC; loop: ADC #$03; DEX; BNE loop; STA $10
+			MOS6502, mem := newTestMPU(0xa2, 0x05, 0xa9, 0x00, 0x18, 0x69, 0x03, 0xca, 0xd0, 0xfb, 0x85, 0x10)
+			for MOS6502.pc != 0x020c {
+				MOS6502.Step()
+			}
+			g.Assert(mem[0x10]).Equal(uint8(15))
+		})
+
+		g.It("executes read-modify-write illegal opcodes", func() {
+			// LDA #$01; DCP $10
+			MOS6502, mem := newTestMPU(0xa9, 0x01, 0xc7, 0x10)
+			mem[0x10] = 0x02
+			MOS6502.Step()
+			MOS6502.Step()
+			g.Assert(mem[0x10]).Equal(uint8(0x01))
+			g.Assert(MOS6502.p&uint8(Z) != 0).IsTrue()
+		})
+
+		g.It("enters the IRQ handler only when interrupts are enabled", func() {
+			MOS6502, mem := newTestMPU(0xea, 0xea)
+			mem[IRQVector] = 0x00
+			mem[IRQVector+1] = 0x30
+			MOS6502.p = uint8(I)
+
+			MOS6502.SetIRQ(0, true)
+			MOS6502.Step()
+			g.Assert(MOS6502.pc).Equal(uint16(0x0201))
+
+			MOS6502.p = 0
+			MOS6502.CycleLock.ResetCycleCount()
+			MOS6502.Step()
+			g.Assert(MOS6502.pc).Equal(uint16(0x3000))
+			g.Assert(MOS6502.CycleLock.CycleCount()).Equal(7)
+			g.Assert(mem[0x01fd] & uint8(B)).Equal(uint8(0))
+			g.Assert(MOS6502.p&uint8(I) != 0).IsTrue()
+		})
+
+		g.It("triggers the NMI on the active going edge only", func() {
+			MOS6502, mem := newTestMPU(0xea, 0xea, 0xea)
+			mem[NMIVector] = 0x00
+			mem[NMIVector+1] = 0x40
+
+			MOS6502.SetNMI(0, true)
+			MOS6502.Step()
+			g.Assert(MOS6502.pc).Equal(uint16(0x4000))
+
+			MOS6502.pc = 0x0200
+			MOS6502.SetNMI(0, true)
+			MOS6502.Step()
+			g.Assert(MOS6502.pc).Equal(uint16(0x0201))
+		})
+
+		g.It("calls traps before executing an instruction", func() {
+			// LDA #$01; LDX #$02
+			MOS6502, _ := newTestMPU(0xa9, 0x01, 0xa2, 0x02)
+			MOS6502.SetTrap(0x0200, func() bool { return false })
+			MOS6502.SetTrap(0x0202, func() bool {
+				MOS6502.pc = 0x0300
+				return true
+			})
+			MOS6502.Step()
+			g.Assert(MOS6502.a).Equal(uint8(0x01))
+			MOS6502.CycleLock.ResetCycleCount()
+			MOS6502.Step()
+			g.Assert(MOS6502.x).Equal(uint8(0x00))
+			g.Assert(MOS6502.pc).Equal(uint16(0x0300))
+			g.Assert(MOS6502.CycleLock.CycleCount()).Equal(0)
+
+			MOS6502.RemoveTrap(0x0200)
+			MOS6502.pc = 0x0200
+			MOS6502.Step()
+			g.Assert(MOS6502.pc).Equal(uint16(0x0202))
+		})
+	})
+}
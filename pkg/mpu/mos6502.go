@@ -5,6 +5,7 @@ import (
 
 	"github.com/gentoomaniac/go64/pkg/cyclelock"
 	"github.com/gentoomaniac/go64/pkg/memory"
+	"github.com/gentoomaniac/go64/pkg/snapshot"
 
 	"github.com/rs/zerolog/log"
 )
@@ -29,6 +30,12 @@ const (
 	IRQVector   uint16 = 0xfffe
 )
 
+// Bus is the interface through which the MPU reads and writes memory and memory mapped I/O
+type Bus interface {
+	Get(addr uint16) byte
+	Set(addr uint16, value byte)
+}
+
 // MOS6502 is a struct representing the internal state of the MOS 6510 MPU
 type MOS6502 struct {
 
@@ -96,9 +103,31 @@ type MOS6502 struct {
 	having to use self-modifying code. */
 	y uint8
 
+	// Memory is used for all bus accesses if no Bus is set
 	Memory *memory.Memory
+	// Bus allows to map I/O and banked memory into the address space of the MPU
+	Bus Bus
 
 	CycleLock cyclelock.CycleLock
+
+	// traps are called before the instruction at their address is executed, trapped has a bit for every
+	// address with a trap so that Step doesn't have to look up the map for every instruction
+	traps   map[uint16]func() bool
+	trapped []uint64
+
+	// irqSources holds one bit per device pulling the IRQ line
+	irqSources uint32
+	nmiSources uint32
+	nmiPending bool
+	jammed     bool
+
+	// high byte of the unindexed address of the current instruction, needed by SHA, SHX, SHY and TAS
+	baseHigh uint8
+	// notReady is set while the RDY line is pulled low, the MPU then halts in front of its next read cycle
+	notReady bool
+
+	// the instruction executed cycle by cycle by Tick
+	tick tickState
 }
 
 // PC returns the value of the PC register
@@ -207,11 +236,36 @@ func setBits(value byte, mask byte, set bool) byte {
 	return value & (0xff ^ mask)
 }
 
-func (m MOS6502) getByteFromMemory(addr uint16, lockToCycle bool) byte {
-	if lockToCycle {
+func (m *MOS6502) read(addr uint16) byte {
+	if m.Bus != nil {
+		return m.Bus.Get(addr)
+	}
+	return m.Memory[addr]
+}
+
+func (m *MOS6502) write(addr uint16, value byte) {
+	if m.Bus != nil {
+		m.Bus.Set(addr, value)
+		return
+	}
+	m.Memory[addr] = value
+}
+
+// enterReadCycle enters the cycle of a read access. While RDY is low the MPU doesn't read, the cycles pass until
+// it is released.
+func (m *MOS6502) enterReadCycle() {
+	m.CycleLock.EnterCycle()
+	for m.notReady {
+		m.CycleLock.ExitCycle()
 		m.CycleLock.EnterCycle()
 	}
-	b := m.Memory[addr]
+}
+
+func (m *MOS6502) getByteFromMemory(addr uint16, lockToCycle bool) byte {
+	if lockToCycle {
+		m.enterReadCycle()
+	}
+	b := m.read(addr)
 	if lockToCycle {
 		m.CycleLock.ExitCycle()
 	}
@@ -224,7 +278,7 @@ func (m *MOS6502) storeByteInMemory(addr uint16, value byte, lockToCycle bool) {
 	if lockToCycle {
 		m.CycleLock.EnterCycle()
 	}
-	m.Memory[addr] = value
+	m.write(addr, value)
 	if lockToCycle {
 		m.CycleLock.ExitCycle()
 	}
@@ -237,7 +291,7 @@ func (m *MOS6502) getNextCodeByte() byte {
 	return b
 }
 
-func (m MOS6502) getDWordFromMemory(hi uint16, lo uint16) uint16 {
+func (m *MOS6502) getDWordFromMemory(hi uint16, lo uint16) uint16 {
 	word := uint16(m.getByteFromMemory(hi, true)) << 8
 	result := word | uint16(m.getByteFromMemory(lo, true))
 
@@ -260,7 +314,7 @@ func (m *MOS6502) getDWordFromZeropage(addr uint8) uint16 {
 }
 
 func (m *MOS6502) getNextCodeDWord() uint16 {
-	word := m.getDWordFromMemory(m.pc, m.pc+1)
+	word := m.getDWordFromMemory(m.pc+1, m.pc)
 	m.pc += 2
 	return word
 }
@@ -329,7 +383,7 @@ func (m *MOS6502) push(value byte, lockToCycle bool) {
 
 func (m *MOS6502) pop(lockToCycle bool) byte {
 	if lockToCycle {
-		m.CycleLock.EnterCycle()
+		m.enterReadCycle()
 	}
 	m.s++
 	value := m.getByteFromMemory(StackOffset+uint16(m.s), false)
@@ -349,22 +403,128 @@ func checkForOverflow(vOld byte, vNew byte) bool {
 	return false
 }
 
+// SetTrap installs a trap which is called before the instruction at the address is executed, e.g. to replace
+// a ROM routine. A trap returns true if it handled the instruction, it then has to set the PC itself.
+func (m *MOS6502) SetTrap(addr uint16, trap func() bool) {
+	if m.traps == nil {
+		m.traps = make(map[uint16]func() bool)
+		m.trapped = make([]uint64, 0x10000/64)
+	}
+	m.traps[addr] = trap
+	m.trapped[addr/64] |= 1 << (addr % 64)
+}
+
+// RemoveTrap removes the trap at the address
+func (m *MOS6502) RemoveTrap(addr uint16) {
+	if m.traps == nil {
+		return
+	}
+	delete(m.traps, addr)
+	m.trapped[addr/64] &^= 1 << (addr % 64)
+}
+
 // Init initialises the MPU
 func (m *MOS6502) Init(cyclelock cyclelock.CycleLock) {
 	m.s = 0xff
 	m.CycleLock = cyclelock
 }
 
+// SetIRQ sets or releases the IRQ line for the given source. The line is active as long as any source holds it.
+func (m *MOS6502) SetIRQ(source uint, active bool) {
+	if active {
+		m.irqSources |= 1 << source
+	} else {
+		m.irqSources &^= 1 << source
+	}
+}
+
+// IRQ returns true if any source is holding the IRQ line
+func (m MOS6502) IRQ() bool {
+	return m.irqSources != 0
+}
+
+// SetNMI sets or releases the NMI line for the given source. The NMI is triggered on the falling edge
+// (active going) of the line, so it is only triggered by the first source pulling the line.
+func (m *MOS6502) SetNMI(source uint, active bool) {
+	sources := m.nmiSources
+	if active {
+		m.nmiSources |= 1 << source
+	} else {
+		m.nmiSources &^= 1 << source
+	}
+	if sources == 0 && m.nmiSources != 0 {
+		m.nmiPending = true
+	}
+}
+
+// SetRDY sets the RDY line, while it is low the MPU halts in front of its next read cycle. Write cycles aren't
+// halted, on the C64 the VIC-II pulls BA early enough for up to three writes to pass.
+func (m *MOS6502) SetRDY(ready bool) {
+	m.notReady = !ready
+}
+
+// RDY returns false while the RDY line is pulled low
+func (m MOS6502) RDY() bool {
+	return !m.notReady
+}
+
+// SetOverflow emulates the SO pin and sets the overflow flag
+func (m *MOS6502) SetOverflow() {
+	m.setProcessorStatusBit(V, true)
+}
+
+// Jammed returns true if the MPU executed one of the JAM opcodes and stopped
+func (m MOS6502) Jammed() bool {
+	return m.jammed
+}
+
+// Reset runs the reset sequence of the MPU and loads the PC from the reset vector
+func (m *MOS6502) Reset() {
+	// https://www.pagetable.com/?p=410
+	// the reset sequence is an interrupt sequence with the writes to the stack turned into reads
+	m.jammed = false
+	m.nmiPending = false
+	m.tick = tickState{}
+	m.getByteFromMemory(m.pc, true)
+	m.getByteFromMemory(m.pc, true)
+	for i := 0; i < 3; i++ {
+		m.getByteFromMemory(StackOffset+uint16(m.s), true)
+		m.s--
+	}
+	m.setProcessorStatusBit(I, true)
+	lo := m.getByteFromMemory(ResetVector, true)
+	hi := m.getByteFromMemory(ResetVector+1, true)
+	m.pc = uint16(hi)<<8 | uint16(lo)
+}
+
+// State saves or restores the registers and the interrupt state. Step has to be between two instructions, an
+// instruction executed by Tick may be in progress.
+func (m *MOS6502) State(s *snapshot.State) {
+	s.Uint16(&m.pc)
+	s.Byte(&m.s)
+	s.Byte(&m.p)
+	s.Byte(&m.a)
+	s.Byte(&m.x)
+	s.Byte(&m.y)
+	s.Uint32(&m.irqSources)
+	s.Uint32(&m.nmiSources)
+	s.Bool(&m.nmiPending)
+	s.Bool(&m.jammed)
+	s.Byte(&m.baseHigh)
+	m.tick.state(s)
+}
+
 // Run starts the execution of the MPU
 func (m *MOS6502) Run() {
-	// https://www.pagetable.com/?p=410
-	// load reset vector
-	//m.pc = getWordFromMemory(0xfffc);
-	//log.Debug(string.Format("loading reset vector took {0} cycles", cycleLock.getCycleCount()));
-
-	for i := 0; i <= 0xffff; i++ {
-		m.getNextCodeByte()
-		log.Debug().Int("cycleCount", m.CycleLock.CycleCount()).Msg("")
-		m.CycleLock.ResetCycleCount()
+	m.Reset()
+	log.Debug().Str("pc", fmt.Sprintf("0x%04x", m.pc)).Int("cycleCount", m.CycleLock.CycleCount()).Msg("reset")
+
+	m.Continue()
+}
+
+// Continue runs the MPU from its current state without a reset, e.g. after restoring a snapshot
+func (m *MOS6502) Continue() {
+	for {
+		m.Step()
 	}
 }
@@ -0,0 +1,331 @@
+package mpu
+
+// AddressingMode describes how an instruction resolves its operand
+type AddressingMode uint8
+
+// http://www.oxyron.de/html/opcodes02.html
+const (
+	Implied AddressingMode = iota
+	Accumulator
+	Immediate
+	Zeropage
+	ZeropageX
+	ZeropageY
+	Absolute
+	AbsoluteX
+	AbsoluteY
+	Indirect
+	IndexedIndirect
+	IndirectIndexed
+	Relative
+)
+
+// Operands returns the number of operand bytes following the opcode
+func (a AddressingMode) Operands() int {
+	switch a {
+	case Implied, Accumulator:
+		return 0
+	case Absolute, AbsoluteX, AbsoluteY, Indirect:
+		return 2
+	default:
+		return 1
+	}
+}
+
+type accessKind uint8
+
+const (
+	// reads the operand and passes it to the operation
+	kindRead accessKind = iota
+	// stores the result of the operation at the effective address
+	kindWrite
+	// reads the operand, writes it back unmodified and then writes the result of the operation
+	kindReadModifyWrite
+	// single byte instructions only working on registers
+	kindImplied
+	// conditional branches, the operation returns a non zero value if the branch is taken
+	kindBranch
+	// instructions with their own bus sequence (stack, jumps, interrupts)
+	kindControl
+)
+
+// Opcode describes a single entry of the instruction set
+type Opcode struct {
+	Mnemonic string
+	Mode     AddressingMode
+	// Cycles is the number of cycles the instruction takes without page crossing or taken branches
+	Cycles int
+	// PageCrossPenalty is true if crossing a page boundary (or taking a branch) adds cycles
+	PageCrossPenalty bool
+	// Illegal marks undocumented opcodes
+	Illegal bool
+
+	kind      accessKind
+	operation func(m *MOS6502, addr uint16, value byte) byte
+}
+
+// Length returns the number of bytes of the instruction including the opcode
+func (o Opcode) Length() int {
+	return 1 + o.Mode.Operands()
+}
+
+// Opcodes is the instruction set of the NMOS 6502 including the undocumented opcodes.
+// JAM opcodes never finish and have a cycle count of 0.
+var Opcodes = [256]Opcode{
+	0x00: {"BRK", Implied, 7, false, false, kindControl, (*MOS6502).brk},
+	0x01: {"ORA", IndexedIndirect, 6, false, false, kindRead, (*MOS6502).ora},
+	0x02: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x03: {"SLO", IndexedIndirect, 8, false, true, kindReadModifyWrite, (*MOS6502).slo},
+	0x04: {"NOP", Zeropage, 3, false, true, kindRead, (*MOS6502).nop},
+	0x05: {"ORA", Zeropage, 3, false, false, kindRead, (*MOS6502).ora},
+	0x06: {"ASL", Zeropage, 5, false, false, kindReadModifyWrite, (*MOS6502).asl},
+	0x07: {"SLO", Zeropage, 5, false, true, kindReadModifyWrite, (*MOS6502).slo},
+	0x08: {"PHP", Implied, 3, false, false, kindControl, (*MOS6502).php},
+	0x09: {"ORA", Immediate, 2, false, false, kindRead, (*MOS6502).ora},
+	0x0a: {"ASL", Accumulator, 2, false, false, kindReadModifyWrite, (*MOS6502).asl},
+	0x0b: {"ANC", Immediate, 2, false, true, kindRead, (*MOS6502).anc},
+	0x0c: {"NOP", Absolute, 4, false, true, kindRead, (*MOS6502).nop},
+	0x0d: {"ORA", Absolute, 4, false, false, kindRead, (*MOS6502).ora},
+	0x0e: {"ASL", Absolute, 6, false, false, kindReadModifyWrite, (*MOS6502).asl},
+	0x0f: {"SLO", Absolute, 6, false, true, kindReadModifyWrite, (*MOS6502).slo},
+	0x10: {"BPL", Relative, 2, true, false, kindBranch, (*MOS6502).bpl},
+	0x11: {"ORA", IndirectIndexed, 5, true, false, kindRead, (*MOS6502).ora},
+	0x12: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x13: {"SLO", IndirectIndexed, 8, false, true, kindReadModifyWrite, (*MOS6502).slo},
+	0x14: {"NOP", ZeropageX, 4, false, true, kindRead, (*MOS6502).nop},
+	0x15: {"ORA", ZeropageX, 4, false, false, kindRead, (*MOS6502).ora},
+	0x16: {"ASL", ZeropageX, 6, false, false, kindReadModifyWrite, (*MOS6502).asl},
+	0x17: {"SLO", ZeropageX, 6, false, true, kindReadModifyWrite, (*MOS6502).slo},
+	0x18: {"CLC", Implied, 2, false, false, kindImplied, (*MOS6502).clc},
+	0x19: {"ORA", AbsoluteY, 4, true, false, kindRead, (*MOS6502).ora},
+	0x1a: {"NOP", Implied, 2, false, true, kindImplied, (*MOS6502).nop},
+	0x1b: {"SLO", AbsoluteY, 7, false, true, kindReadModifyWrite, (*MOS6502).slo},
+	0x1c: {"NOP", AbsoluteX, 4, true, true, kindRead, (*MOS6502).nop},
+	0x1d: {"ORA", AbsoluteX, 4, true, false, kindRead, (*MOS6502).ora},
+	0x1e: {"ASL", AbsoluteX, 7, false, false, kindReadModifyWrite, (*MOS6502).asl},
+	0x1f: {"SLO", AbsoluteX, 7, false, true, kindReadModifyWrite, (*MOS6502).slo},
+	0x20: {"JSR", Absolute, 6, false, false, kindControl, (*MOS6502).jsr},
+	0x21: {"AND", IndexedIndirect, 6, false, false, kindRead, (*MOS6502).and},
+	0x22: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x23: {"RLA", IndexedIndirect, 8, false, true, kindReadModifyWrite, (*MOS6502).rla},
+	0x24: {"BIT", Zeropage, 3, false, false, kindRead, (*MOS6502).bit},
+	0x25: {"AND", Zeropage, 3, false, false, kindRead, (*MOS6502).and},
+	0x26: {"ROL", Zeropage, 5, false, false, kindReadModifyWrite, (*MOS6502).rol},
+	0x27: {"RLA", Zeropage, 5, false, true, kindReadModifyWrite, (*MOS6502).rla},
+	0x28: {"PLP", Implied, 4, false, false, kindControl, (*MOS6502).plp},
+	0x29: {"AND", Immediate, 2, false, false, kindRead, (*MOS6502).and},
+	0x2a: {"ROL", Accumulator, 2, false, false, kindReadModifyWrite, (*MOS6502).rol},
+	0x2b: {"ANC", Immediate, 2, false, true, kindRead, (*MOS6502).anc},
+	0x2c: {"BIT", Absolute, 4, false, false, kindRead, (*MOS6502).bit},
+	0x2d: {"AND", Absolute, 4, false, false, kindRead, (*MOS6502).and},
+	0x2e: {"ROL", Absolute, 6, false, false, kindReadModifyWrite, (*MOS6502).rol},
+	0x2f: {"RLA", Absolute, 6, false, true, kindReadModifyWrite, (*MOS6502).rla},
+	0x30: {"BMI", Relative, 2, true, false, kindBranch, (*MOS6502).bmi},
+	0x31: {"AND", IndirectIndexed, 5, true, false, kindRead, (*MOS6502).and},
+	0x32: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x33: {"RLA", IndirectIndexed, 8, false, true, kindReadModifyWrite, (*MOS6502).rla},
+	0x34: {"NOP", ZeropageX, 4, false, true, kindRead, (*MOS6502).nop},
+	0x35: {"AND", ZeropageX, 4, false, false, kindRead, (*MOS6502).and},
+	0x36: {"ROL", ZeropageX, 6, false, false, kindReadModifyWrite, (*MOS6502).rol},
+	0x37: {"RLA", ZeropageX, 6, false, true, kindReadModifyWrite, (*MOS6502).rla},
+	0x38: {"SEC", Implied, 2, false, false, kindImplied, (*MOS6502).sec},
+	0x39: {"AND", AbsoluteY, 4, true, false, kindRead, (*MOS6502).and},
+	0x3a: {"NOP", Implied, 2, false, true, kindImplied, (*MOS6502).nop},
+	0x3b: {"RLA", AbsoluteY, 7, false, true, kindReadModifyWrite, (*MOS6502).rla},
+	0x3c: {"NOP", AbsoluteX, 4, true, true, kindRead, (*MOS6502).nop},
+	0x3d: {"AND", AbsoluteX, 4, true, false, kindRead, (*MOS6502).and},
+	0x3e: {"ROL", AbsoluteX, 7, false, false, kindReadModifyWrite, (*MOS6502).rol},
+	0x3f: {"RLA", AbsoluteX, 7, false, true, kindReadModifyWrite, (*MOS6502).rla},
+	0x40: {"RTI", Implied, 6, false, false, kindControl, (*MOS6502).rti},
+	0x41: {"EOR", IndexedIndirect, 6, false, false, kindRead, (*MOS6502).eor},
+	0x42: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x43: {"SRE", IndexedIndirect, 8, false, true, kindReadModifyWrite, (*MOS6502).sre},
+	0x44: {"NOP", Zeropage, 3, false, true, kindRead, (*MOS6502).nop},
+	0x45: {"EOR", Zeropage, 3, false, false, kindRead, (*MOS6502).eor},
+	0x46: {"LSR", Zeropage, 5, false, false, kindReadModifyWrite, (*MOS6502).lsr},
+	0x47: {"SRE", Zeropage, 5, false, true, kindReadModifyWrite, (*MOS6502).sre},
+	0x48: {"PHA", Implied, 3, false, false, kindControl, (*MOS6502).pha},
+	0x49: {"EOR", Immediate, 2, false, false, kindRead, (*MOS6502).eor},
+	0x4a: {"LSR", Accumulator, 2, false, false, kindReadModifyWrite, (*MOS6502).lsr},
+	0x4b: {"ALR", Immediate, 2, false, true, kindRead, (*MOS6502).alr},
+	0x4c: {"JMP", Absolute, 3, false, false, kindControl, (*MOS6502).jmp},
+	0x4d: {"EOR", Absolute, 4, false, false, kindRead, (*MOS6502).eor},
+	0x4e: {"LSR", Absolute, 6, false, false, kindReadModifyWrite, (*MOS6502).lsr},
+	0x4f: {"SRE", Absolute, 6, false, true, kindReadModifyWrite, (*MOS6502).sre},
+	0x50: {"BVC", Relative, 2, true, false, kindBranch, (*MOS6502).bvc},
+	0x51: {"EOR", IndirectIndexed, 5, true, false, kindRead, (*MOS6502).eor},
+	0x52: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x53: {"SRE", IndirectIndexed, 8, false, true, kindReadModifyWrite, (*MOS6502).sre},
+	0x54: {"NOP", ZeropageX, 4, false, true, kindRead, (*MOS6502).nop},
+	0x55: {"EOR", ZeropageX, 4, false, false, kindRead, (*MOS6502).eor},
+	0x56: {"LSR", ZeropageX, 6, false, false, kindReadModifyWrite, (*MOS6502).lsr},
+	0x57: {"SRE", ZeropageX, 6, false, true, kindReadModifyWrite, (*MOS6502).sre},
+	0x58: {"CLI", Implied, 2, false, false, kindImplied, (*MOS6502).cli},
+	0x59: {"EOR", AbsoluteY, 4, true, false, kindRead, (*MOS6502).eor},
+	0x5a: {"NOP", Implied, 2, false, true, kindImplied, (*MOS6502).nop},
+	0x5b: {"SRE", AbsoluteY, 7, false, true, kindReadModifyWrite, (*MOS6502).sre},
+	0x5c: {"NOP", AbsoluteX, 4, true, true, kindRead, (*MOS6502).nop},
+	0x5d: {"EOR", AbsoluteX, 4, true, false, kindRead, (*MOS6502).eor},
+	0x5e: {"LSR", AbsoluteX, 7, false, false, kindReadModifyWrite, (*MOS6502).lsr},
+	0x5f: {"SRE", AbsoluteX, 7, false, true, kindReadModifyWrite, (*MOS6502).sre},
+	0x60: {"RTS", Implied, 6, false, false, kindControl, (*MOS6502).rts},
+	0x61: {"ADC", IndexedIndirect, 6, false, false, kindRead, (*MOS6502).adc},
+	0x62: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x63: {"RRA", IndexedIndirect, 8, false, true, kindReadModifyWrite, (*MOS6502).rra},
+	0x64: {"NOP", Zeropage, 3, false, true, kindRead, (*MOS6502).nop},
+	0x65: {"ADC", Zeropage, 3, false, false, kindRead, (*MOS6502).adc},
+	0x66: {"ROR", Zeropage, 5, false, false, kindReadModifyWrite, (*MOS6502).ror},
+	0x67: {"RRA", Zeropage, 5, false, true, kindReadModifyWrite, (*MOS6502).rra},
+	0x68: {"PLA", Implied, 4, false, false, kindControl, (*MOS6502).pla},
+	0x69: {"ADC", Immediate, 2, false, false, kindRead, (*MOS6502).adc},
+	0x6a: {"ROR", Accumulator, 2, false, false, kindReadModifyWrite, (*MOS6502).ror},
+	0x6b: {"ARR", Immediate, 2, false, true, kindRead, (*MOS6502).arr},
+	0x6c: {"JMP", Indirect, 5, false, false, kindControl, (*MOS6502).jmpIndirect},
+	0x6d: {"ADC", Absolute, 4, false, false, kindRead, (*MOS6502).adc},
+	0x6e: {"ROR", Absolute, 6, false, false, kindReadModifyWrite, (*MOS6502).ror},
+	0x6f: {"RRA", Absolute, 6, false, true, kindReadModifyWrite, (*MOS6502).rra},
+	0x70: {"BVS", Relative, 2, true, false, kindBranch, (*MOS6502).bvs},
+	0x71: {"ADC", IndirectIndexed, 5, true, false, kindRead, (*MOS6502).adc},
+	0x72: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x73: {"RRA", IndirectIndexed, 8, false, true, kindReadModifyWrite, (*MOS6502).rra},
+	0x74: {"NOP", ZeropageX, 4, false, true, kindRead, (*MOS6502).nop},
+	0x75: {"ADC", ZeropageX, 4, false, false, kindRead, (*MOS6502).adc},
+	0x76: {"ROR", ZeropageX, 6, false, false, kindReadModifyWrite, (*MOS6502).ror},
+	0x77: {"RRA", ZeropageX, 6, false, true, kindReadModifyWrite, (*MOS6502).rra},
+	0x78: {"SEI", Implied, 2, false, false, kindImplied, (*MOS6502).sei},
+	0x79: {"ADC", AbsoluteY, 4, true, false, kindRead, (*MOS6502).adc},
+	0x7a: {"NOP", Implied, 2, false, true, kindImplied, (*MOS6502).nop},
+	0x7b: {"RRA", AbsoluteY, 7, false, true, kindReadModifyWrite, (*MOS6502).rra},
+	0x7c: {"NOP", AbsoluteX, 4, true, true, kindRead, (*MOS6502).nop},
+	0x7d: {"ADC", AbsoluteX, 4, true, false, kindRead, (*MOS6502).adc},
+	0x7e: {"ROR", AbsoluteX, 7, false, false, kindReadModifyWrite, (*MOS6502).ror},
+	0x7f: {"RRA", AbsoluteX, 7, false, true, kindReadModifyWrite, (*MOS6502).rra},
+	0x80: {"NOP", Immediate, 2, false, true, kindRead, (*MOS6502).nop},
+	0x81: {"STA", IndexedIndirect, 6, false, false, kindWrite, (*MOS6502).sta},
+	0x82: {"NOP", Immediate, 2, false, true, kindRead, (*MOS6502).nop},
+	0x83: {"SAX", IndexedIndirect, 6, false, true, kindWrite, (*MOS6502).sax},
+	0x84: {"STY", Zeropage, 3, false, false, kindWrite, (*MOS6502).sty},
+	0x85: {"STA", Zeropage, 3, false, false, kindWrite, (*MOS6502).sta},
+	0x86: {"STX", Zeropage, 3, false, false, kindWrite, (*MOS6502).stx},
+	0x87: {"SAX", Zeropage, 3, false, true, kindWrite, (*MOS6502).sax},
+	0x88: {"DEY", Implied, 2, false, false, kindImplied, (*MOS6502).dey},
+	0x89: {"NOP", Immediate, 2, false, true, kindRead, (*MOS6502).nop},
+	0x8a: {"TXA", Implied, 2, false, false, kindImplied, (*MOS6502).txa},
+	0x8b: {"ANE", Immediate, 2, false, true, kindRead, (*MOS6502).ane},
+	0x8c: {"STY", Absolute, 4, false, false, kindWrite, (*MOS6502).sty},
+	0x8d: {"STA", Absolute, 4, false, false, kindWrite, (*MOS6502).sta},
+	0x8e: {"STX", Absolute, 4, false, false, kindWrite, (*MOS6502).stx},
+	0x8f: {"SAX", Absolute, 4, false, true, kindWrite, (*MOS6502).sax},
+	0x90: {"BCC", Relative, 2, true, false, kindBranch, (*MOS6502).bcc},
+	0x91: {"STA", IndirectIndexed, 6, false, false, kindWrite, (*MOS6502).sta},
+	0x92: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0x93: {"SHA", IndirectIndexed, 6, false, true, kindWrite, (*MOS6502).sha},
+	0x94: {"STY", ZeropageX, 4, false, false, kindWrite, (*MOS6502).sty},
+	0x95: {"STA", ZeropageX, 4, false, false, kindWrite, (*MOS6502).sta},
+	0x96: {"STX", ZeropageY, 4, false, false, kindWrite, (*MOS6502).stx},
+	0x97: {"SAX", ZeropageY, 4, false, true, kindWrite, (*MOS6502).sax},
+	0x98: {"TYA", Implied, 2, false, false, kindImplied, (*MOS6502).tya},
+	0x99: {"STA", AbsoluteY, 5, false, false, kindWrite, (*MOS6502).sta},
+	0x9a: {"TXS", Implied, 2, false, false, kindImplied, (*MOS6502).txs},
+	0x9b: {"TAS", AbsoluteY, 5, false, true, kindWrite, (*MOS6502).tas},
+	0x9c: {"SHY", AbsoluteX, 5, false, true, kindWrite, (*MOS6502).shy},
+	0x9d: {"STA", AbsoluteX, 5, false, false, kindWrite, (*MOS6502).sta},
+	0x9e: {"SHX", AbsoluteY, 5, false, true, kindWrite, (*MOS6502).shx},
+	0x9f: {"SHA", AbsoluteY, 5, false, true, kindWrite, (*MOS6502).sha},
+	0xa0: {"LDY", Immediate, 2, false, false, kindRead, (*MOS6502).ldy},
+	0xa1: {"LDA", IndexedIndirect, 6, false, false, kindRead, (*MOS6502).lda},
+	0xa2: {"LDX", Immediate, 2, false, false, kindRead, (*MOS6502).ldx},
+	0xa3: {"LAX", IndexedIndirect, 6, false, true, kindRead, (*MOS6502).lax},
+	0xa4: {"LDY", Zeropage, 3, false, false, kindRead, (*MOS6502).ldy},
+	0xa5: {"LDA", Zeropage, 3, false, false, kindRead, (*MOS6502).lda},
+	0xa6: {"LDX", Zeropage, 3, false, false, kindRead, (*MOS6502).ldx},
+	0xa7: {"LAX", Zeropage, 3, false, true, kindRead, (*MOS6502).lax},
+	0xa8: {"TAY", Implied, 2, false, false, kindImplied, (*MOS6502).tay},
+	0xa9: {"LDA", Immediate, 2, false, false, kindRead, (*MOS6502).lda},
+	0xaa: {"TAX", Implied, 2, false, false, kindImplied, (*MOS6502).tax},
+	0xab: {"LXA", Immediate, 2, false, true, kindRead, (*MOS6502).lxa},
+	0xac: {"LDY", Absolute, 4, false, false, kindRead, (*MOS6502).ldy},
+	0xad: {"LDA", Absolute, 4, false, false, kindRead, (*MOS6502).lda},
+	0xae: {"LDX", Absolute, 4, false, false, kindRead, (*MOS6502).ldx},
+	0xaf: {"LAX", Absolute, 4, false, true, kindRead, (*MOS6502).lax},
+	0xb0: {"BCS", Relative, 2, true, false, kindBranch, (*MOS6502).bcs},
+	0xb1: {"LDA", IndirectIndexed, 5, true, false, kindRead, (*MOS6502).lda},
+	0xb2: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0xb3: {"LAX", IndirectIndexed, 5, true, true, kindRead, (*MOS6502).lax},
+	0xb4: {"LDY", ZeropageX, 4, false, false, kindRead, (*MOS6502).ldy},
+	0xb5: {"LDA", ZeropageX, 4, false, false, kindRead, (*MOS6502).lda},
+	0xb6: {"LDX", ZeropageY, 4, false, false, kindRead, (*MOS6502).ldx},
+	0xb7: {"LAX", ZeropageY, 4, false, true, kindRead, (*MOS6502).lax},
+	0xb8: {"CLV", Implied, 2, false, false, kindImplied, (*MOS6502).clv},
+	0xb9: {"LDA", AbsoluteY, 4, true, false, kindRead, (*MOS6502).lda},
+	0xba: {"TSX", Implied, 2, false, false, kindImplied, (*MOS6502).tsx},
+	0xbb: {"LAS", AbsoluteY, 4, true, true, kindRead, (*MOS6502).las},
+	0xbc: {"LDY", AbsoluteX, 4, true, false, kindRead, (*MOS6502).ldy},
+	0xbd: {"LDA", AbsoluteX, 4, true, false, kindRead, (*MOS6502).lda},
+	0xbe: {"LDX", AbsoluteY, 4, true, false, kindRead, (*MOS6502).ldx},
+	0xbf: {"LAX", AbsoluteY, 4, true, true, kindRead, (*MOS6502).lax},
+	0xc0: {"CPY", Immediate, 2, false, false, kindRead, (*MOS6502).cpy},
+	0xc1: {"CMP", IndexedIndirect, 6, false, false, kindRead, (*MOS6502).cmp},
+	0xc2: {"NOP", Immediate, 2, false, true, kindRead, (*MOS6502).nop},
+	0xc3: {"DCP", IndexedIndirect, 8, false, true, kindReadModifyWrite, (*MOS6502).dcp},
+	0xc4: {"CPY", Zeropage, 3, false, false, kindRead, (*MOS6502).cpy},
+	0xc5: {"CMP", Zeropage, 3, false, false, kindRead, (*MOS6502).cmp},
+	0xc6: {"DEC", Zeropage, 5, false, false, kindReadModifyWrite, (*MOS6502).dec},
+	0xc7: {"DCP", Zeropage, 5, false, true, kindReadModifyWrite, (*MOS6502).dcp},
+	0xc8: {"INY", Implied, 2, false, false, kindImplied, (*MOS6502).iny},
+	0xc9: {"CMP", Immediate, 2, false, false, kindRead, (*MOS6502).cmp},
+	0xca: {"DEX", Implied, 2, false, false, kindImplied, (*MOS6502).dex},
+	0xcb: {"SBX", Immediate, 2, false, true, kindRead, (*MOS6502).sbx},
+	0xcc: {"CPY", Absolute, 4, false, false, kindRead, (*MOS6502).cpy},
+	0xcd: {"CMP", Absolute, 4, false, false, kindRead, (*MOS6502).cmp},
+	0xce: {"DEC", Absolute, 6, false, false, kindReadModifyWrite, (*MOS6502).dec},
+	0xcf: {"DCP", Absolute, 6, false, true, kindReadModifyWrite, (*MOS6502).dcp},
+	0xd0: {"BNE", Relative, 2, true, false, kindBranch, (*MOS6502).bne},
+	0xd1: {"CMP", IndirectIndexed, 5, true, false, kindRead, (*MOS6502).cmp},
+	0xd2: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0xd3: {"DCP", IndirectIndexed, 8, false, true, kindReadModifyWrite, (*MOS6502).dcp},
+	0xd4: {"NOP", ZeropageX, 4, false, true, kindRead, (*MOS6502).nop},
+	0xd5: {"CMP", ZeropageX, 4, false, false, kindRead, (*MOS6502).cmp},
+	0xd6: {"DEC", ZeropageX, 6, false, false, kindReadModifyWrite, (*MOS6502).dec},
+	0xd7: {"DCP", ZeropageX, 6, false, true, kindReadModifyWrite, (*MOS6502).dcp},
+	0xd8: {"CLD", Implied, 2, false, false, kindImplied, (*MOS6502).cld},
+	0xd9: {"CMP", AbsoluteY, 4, true, false, kindRead, (*MOS6502).cmp},
+	0xda: {"NOP", Implied, 2, false, true, kindImplied, (*MOS6502).nop},
+	0xdb: {"DCP", AbsoluteY, 7, false, true, kindReadModifyWrite, (*MOS6502).dcp},
+	0xdc: {"NOP", AbsoluteX, 4, true, true, kindRead, (*MOS6502).nop},
+	0xdd: {"CMP", AbsoluteX, 4, true, false, kindRead, (*MOS6502).cmp},
+	0xde: {"DEC", AbsoluteX, 7, false, false, kindReadModifyWrite, (*MOS6502).dec},
+	0xdf: {"DCP", AbsoluteX, 7, false, true, kindReadModifyWrite, (*MOS6502).dcp},
+	0xe0: {"CPX", Immediate, 2, false, false, kindRead, (*MOS6502).cpx},
+	0xe1: {"SBC", IndexedIndirect, 6, false, false, kindRead, (*MOS6502).sbc},
+	0xe2: {"NOP", Immediate, 2, false, true, kindRead, (*MOS6502).nop},
+	0xe3: {"ISC", IndexedIndirect, 8, false, true, kindReadModifyWrite, (*MOS6502).isc},
+	0xe4: {"CPX", Zeropage, 3, false, false, kindRead, (*MOS6502).cpx},
+	0xe5: {"SBC", Zeropage, 3, false, false, kindRead, (*MOS6502).sbc},
+	0xe6: {"INC", Zeropage, 5, false, false, kindReadModifyWrite, (*MOS6502).inc},
+	0xe7: {"ISC", Zeropage, 5, false, true, kindReadModifyWrite, (*MOS6502).isc},
+	0xe8: {"INX", Implied, 2, false, false, kindImplied, (*MOS6502).inx},
+	0xe9: {"SBC", Immediate, 2, false, false, kindRead, (*MOS6502).sbc},
+	0xea: {"NOP", Implied, 2, false, false, kindImplied, (*MOS6502).nop},
+	0xeb: {"SBC", Immediate, 2, false, true, kindRead, (*MOS6502).sbc},
+	0xec: {"CPX", Absolute, 4, false, false, kindRead, (*MOS6502).cpx},
+	0xed: {"SBC", Absolute, 4, false, false, kindRead, (*MOS6502).sbc},
+	0xee: {"INC", Absolute, 6, false, false, kindReadModifyWrite, (*MOS6502).inc},
+	0xef: {"ISC", Absolute, 6, false, true, kindReadModifyWrite, (*MOS6502).isc},
+	0xf0: {"BEQ", Relative, 2, true, false, kindBranch, (*MOS6502).beq},
+	0xf1: {"SBC", IndirectIndexed, 5, true, false, kindRead, (*MOS6502).sbc},
+	0xf2: {"JAM", Implied, 0, false, true, kindControl, (*MOS6502).jam},
+	0xf3: {"ISC", IndirectIndexed, 8, false, true, kindReadModifyWrite, (*MOS6502).isc},
+	0xf4: {"NOP", ZeropageX, 4, false, true, kindRead, (*MOS6502).nop},
+	0xf5: {"SBC", ZeropageX, 4, false, false, kindRead, (*MOS6502).sbc},
+	0xf6: {"INC", ZeropageX, 6, false, false, kindReadModifyWrite, (*MOS6502).inc},
+	0xf7: {"ISC", ZeropageX, 6, false, true, kindReadModifyWrite, (*MOS6502).isc},
+	0xf8: {"SED", Implied, 2, false, false, kindImplied, (*MOS6502).sed},
+	0xf9: {"SBC", AbsoluteY, 4, true, false, kindRead, (*MOS6502).sbc},
+	0xfa: {"NOP", Implied, 2, false, true, kindImplied, (*MOS6502).nop},
+	0xfb: {"ISC", AbsoluteY, 7, false, true, kindReadModifyWrite, (*MOS6502).isc},
+	0xfc: {"NOP", AbsoluteX, 4, true, true, kindRead, (*MOS6502).nop},
+	0xfd: {"SBC", AbsoluteX, 4, true, false, kindRead, (*MOS6502).sbc},
+	0xfe: {"INC", AbsoluteX, 7, false, false, kindReadModifyWrite, (*MOS6502).inc},
+	0xff: {"ISC", AbsoluteX, 7, false, true, kindReadModifyWrite, (*MOS6502).isc},
+}
@@ -0,0 +1,89 @@
+package mpu_test
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/asm"
+	"github.com/gentoomaniac/go64/pkg/cyclelock"
+	"github.com/gentoomaniac/go64/pkg/memory"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// runProgram assembles the source and runs it from the label start until it reaches the label done
+func runProgram(g *goblin.G, source string) (*mpu.MOS6502, *memory.Memory) {
+	program, err := asm.Assemble(source)
+	g.Assert(err).IsNil()
+
+	m := &memory.Memory{}
+	program.Store(m.Set)
+	cpu := &mpu.MOS6502{Memory: m}
+	cpu.Init(&cyclelock.AlwaysOpenLock{})
+	cpu.SetPC(program.Symbols["start"])
+
+	for i := 0; cpu.PC() != program.Symbols["done"]; i++ {
+		g.Assert(i < 10000).IsTrue("program didn't reach done")
+		cpu.Step()
+	}
+	return cpu, m
+}
+
+func TestPrograms(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Programs", func() {
+		g.It("sums up a table", func() {
+			cpu, m := runProgram(g, `
+				*= $1000
+		start:	ldx #len-1
+				lda #0
+				clc
+		loop:	adc table,x
+				dex
+				bpl loop
+				sta result
+		done:	nop
+
+		table:	.byte 1, 2, 3, 4, 5, 6, 7, 8, 9, 10
+		len = *-table
+		result:	.byte 0
+			`)
+			g.Assert(cpu.A()).Equal(uint8(55))
+			g.Assert(m[0x1019]).Equal(uint8(55))
+		})
+
+		g.It("passes values through subroutines and the stack", func() {
+			cpu, m := runProgram(g, `
+				*= $c000
+		start:	lda #>$1234
+				pha
+				lda #<$1234
+				jsr double
+				sta $fb
+				pla
+				sta $fc
+		done:	nop
+
+		double:	asl
+				rts
+			`)
+			g.Assert(cpu.S()).Equal(uint8(0xff))
+			g.Assert(m[0xfb]).Equal(uint8(0x68))
+			g.Assert(m[0xfc]).Equal(uint8(0x12))
+		})
+
+		g.It("adds in decimal mode", func() {
+			cpu, _ := runProgram(g, `
+				*= $0800
+		start:	sed
+				clc
+				lda #$58
+				adc #$46
+				cld
+		done:	nop
+			`)
+			g.Assert(cpu.A()).Equal(uint8(0x04))
+			g.Assert(cpu.P() & mpu.C).Equal(uint8(mpu.C))
+		})
+	})
+}
@@ -0,0 +1,455 @@
+package mpu
+
+import (
+	"fmt"
+
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+/* Cycle stepped execution */
+// Tick executes the same bus sequence as Step, but one cycle per call, so that other chips can be advanced
+// between the bus accesses of an instruction. At the start of an instruction the cycles are queued as micro
+// ops, each of them does exactly one bus access. The operations of the instruction set are shared with Step.
+
+// microOp is a single bus cycle of an instruction
+type microOp uint8
+
+const (
+	// opFetch reads the opcode and queues the cycles of the instruction
+	opFetch microOp = iota
+	// opInterrupt is the first dummy read of the interrupt sequence
+	opInterrupt
+	opJam
+	opDummyPC
+	opImplied
+	opAccumulator
+	opImmediate
+	// opOperandLo and opOperandHi fetch the operand into the effective address
+	opOperandLo
+	opOperandHi
+	// opOperandHiIndexed fetches the high byte and adds the index, the fixup is skipped if it isn't needed
+	opOperandHiIndexed
+	// opZeropageIndexed reads the unindexed zeropage address and adds the index
+	opZeropageIndexed
+	// opPointerHi and opPointerLo read the pointer at the effective address, high byte first like Step
+	opPointerHi
+	opPointerLo
+	// opFixup reads from the address with the not yet fixed high byte
+	opFixup
+	opRead
+	opWrite
+	opModifyRead
+	opModifyDummyWrite
+	opModifyWrite
+	opBranch
+	opBranchTaken
+	opBranchFixup
+	opSkipOperand
+	opDummyStack
+	opPushPCH
+	opPushPCL
+	opPushStatus
+	opPushBreakStatus
+	opPushA
+	opPushP
+	opPullA
+	opPullP
+	opPullPCL
+	opPullPCH
+	opVectorLo
+	opVectorHi
+	opJump
+	opReturn
+	microOps
+)
+
+// writes marks the micro ops writing to the bus, all others are read cycles halted by RDY
+var writes = [microOps]bool{
+	opWrite:            true,
+	opModifyDummyWrite: true,
+	opModifyWrite:      true,
+	opPushPCH:          true,
+	opPushPCL:          true,
+	opPushStatus:       true,
+	opPushBreakStatus:  true,
+	opPushA:            true,
+	opPushP:            true,
+}
+
+// tickState holds the instruction executed by Tick between the cycles
+type tickState struct {
+	ops [8]microOp
+	// next is the index of the next micro op, count the number of queued ones
+	next, count int
+	opcode      *Opcode
+	// ea is the effective address being resolved, base the address before indexing
+	ea, base uint16
+	data     byte
+	vector   uint16
+}
+
+// state saves or restores the instruction in progress
+func (t *tickState) state(s *snapshot.State) {
+	for i := range t.ops {
+		op := byte(t.ops[i])
+		s.Byte(&op)
+		t.ops[i] = microOp(op)
+	}
+	s.Int(&t.next)
+	s.Int(&t.count)
+
+	// the opcode is stored as its index into the opcode table
+	decoded := t.opcode != nil
+	var code byte
+	for i := range Opcodes {
+		if t.opcode == &Opcodes[i] {
+			code = byte(i)
+		}
+	}
+	s.Bool(&decoded)
+	s.Byte(&code)
+	s.Uint16(&t.ea)
+	s.Uint16(&t.base)
+	s.Byte(&t.data)
+	s.Uint16(&t.vector)
+
+	if !s.Loading() {
+		return
+	}
+	t.opcode = nil
+	if decoded {
+		t.opcode = &Opcodes[code]
+	}
+	if t.next < 0 || t.next > t.count || t.count > len(t.ops) {
+		s.Fail(fmt.Errorf("invalid instruction state %d/%d", t.next, t.count))
+		return
+	}
+	for _, op := range t.ops[:t.count] {
+		if op >= microOps {
+			s.Fail(fmt.Errorf("invalid micro op %d", op))
+			return
+		}
+	}
+}
+
+// queue appends micro ops to the current instruction
+func (t *tickState) queue(ops ...microOp) {
+	t.count += copy(t.ops[t.count:], ops)
+}
+
+// skip leaves out the next micro op
+func (t *tickState) skip() {
+	t.next++
+}
+
+// finish ends the instruction after the current micro op
+func (t *tickState) finish() {
+	t.next = t.count
+}
+
+// Tick runs a single clock cycle and returns true if it completed an instruction or interrupt sequence. While
+// RDY is low read cycles are halted, the call then returns without a bus access. Tick doesn't use the
+// CycleLock, the caller advances the other chips between the calls. Step must only be called between
+// instructions.
+func (m *MOS6502) Tick() bool {
+	t := &m.tick
+	if t.next >= t.count {
+		m.prepare()
+	}
+
+	op := t.ops[t.next]
+	if m.notReady && !writes[op] {
+		return false
+	}
+	t.next++
+	m.cycle(op)
+
+	if t.next >= t.count {
+		m.prepare()
+		return true
+	}
+	return false
+}
+
+// InstructionStart returns true if no instruction is in progress, e.g. to check breakpoints between Ticks
+func (m MOS6502) InstructionStart() bool {
+	return m.tick.next == 0
+}
+
+// prepare queues the next instruction or interrupt sequence. Like Step the interrupts are polled at the end of
+// the previous instruction.
+func (m *MOS6502) prepare() {
+	t := &m.tick
+	t.next, t.count = 0, 0
+
+	switch {
+	case m.jammed:
+		t.queue(opJam)
+	case m.nmiPending:
+		t.vector = NMIVector
+		t.queue(opInterrupt, opDummyPC, opPushPCH, opPushPCL, opPushStatus, opVectorLo, opVectorHi)
+	case m.irqSources != 0 && m.p&I == 0:
+		t.vector = IRQVector
+		t.queue(opInterrupt, opDummyPC, opPushPCH, opPushPCL, opPushStatus, opVectorLo, opVectorHi)
+	default:
+		t.queue(opFetch)
+	}
+}
+
+// decode queues the cycles of the instruction following the opcode fetch
+func (m *MOS6502) decode(opcode *Opcode) {
+	t := &m.tick
+	t.opcode = opcode
+
+	switch opcode.kind {
+	case kindImplied:
+		t.queue(opImplied)
+		return
+	case kindBranch:
+		t.queue(opBranch, opBranchTaken, opBranchFixup)
+		return
+	case kindControl:
+		m.decodeControl(opcode)
+		return
+	}
+
+	switch opcode.Mode {
+	case Accumulator:
+		t.queue(opAccumulator)
+		return
+	case Immediate:
+		t.queue(opImmediate)
+		return
+	case Zeropage:
+		t.queue(opOperandLo)
+	case ZeropageX, ZeropageY:
+		t.queue(opOperandLo, opZeropageIndexed)
+	case Absolute:
+		t.queue(opOperandLo, opOperandHi)
+	case AbsoluteX, AbsoluteY:
+		t.queue(opOperandLo, opOperandHiIndexed, opFixup)
+	case IndexedIndirect:
+		t.queue(opOperandLo, opZeropageIndexed, opPointerHi, opPointerLo)
+	case IndirectIndexed:
+		t.queue(opOperandLo, opPointerHi, opPointerLo, opFixup)
+	}
+
+	switch opcode.kind {
+	case kindRead:
+		t.queue(opRead)
+	case kindWrite:
+		t.queue(opWrite)
+	case kindReadModifyWrite:
+		t.queue(opModifyRead, opModifyDummyWrite, opModifyWrite)
+	}
+}
+
+// decodeControl queues the cycles of the instructions with their own bus sequence
+func (m *MOS6502) decodeControl(opcode *Opcode) {
+	t := &m.tick
+
+	switch opcode.Mnemonic {
+	case "BRK":
+		t.vector = IRQVector
+		t.queue(opSkipOperand, opPushPCH, opPushPCL, opPushBreakStatus, opVectorLo, opVectorHi)
+	case "JSR":
+		t.queue(opOperandLo, opDummyStack, opPushPCH, opPushPCL, opJump)
+	case "RTS":
+		t.queue(opDummyPC, opDummyStack, opPullPCL, opPullPCH, opReturn)
+	case "RTI":
+		t.queue(opDummyPC, opDummyStack, opPullP, opPullPCL, opPullPCH)
+	case "JMP":
+		if opcode.Mode == Indirect {
+			t.queue(opOperandLo, opOperandHi, opPointerHi, opPointerLo)
+		} else {
+			t.queue(opOperandLo, opJump)
+		}
+	case "PHA":
+		t.queue(opDummyPC, opPushA)
+	case "PHP":
+		t.queue(opDummyPC, opPushP)
+	case "PLA":
+		t.queue(opDummyPC, opDummyStack, opPullA)
+	case "PLP":
+		t.queue(opDummyPC, opDummyStack, opPullP)
+	default:
+		// JAM stops the MPU right after the opcode fetch
+		opcode.operation(m, 0, 0)
+	}
+}
+
+// index adds the index register to the base address and skips the fixup cycle if it isn't needed
+func (m *MOS6502) index(index uint8) {
+	t := &m.tick
+	t.base = t.ea
+	t.ea += uint16(index)
+	m.baseHigh = uint8(t.base >> 8)
+	if t.opcode.kind == kindRead && t.ea&0xff00 == t.base&0xff00 {
+		t.skip()
+	}
+}
+
+// indexRegister returns the index register used by the addressing mode
+func (m *MOS6502) indexRegister() uint8 {
+	switch m.tick.opcode.Mode {
+	case ZeropageY, AbsoluteY, IndirectIndexed:
+		return m.y
+	}
+	return m.x
+}
+
+// cycle runs the micro op including its bus access
+func (m *MOS6502) cycle(op microOp) {
+	t := &m.tick
+
+	switch op {
+	case opFetch:
+		if m.trapped != nil && m.trapped[m.pc/64]&(1<<(m.pc%64)) != 0 && m.traps[m.pc]() {
+			// the trap handled the instruction without using a cycle, the cycle belongs to the next one
+			m.prepare()
+			op := t.ops[t.next]
+			t.next++
+			m.cycle(op)
+			return
+		}
+		opcode := &Opcodes[m.read(m.pc)]
+		m.pc++
+		m.decode(opcode)
+
+	case opInterrupt:
+		if t.vector == NMIVector {
+			m.nmiPending = false
+		}
+		m.read(m.pc)
+	case opJam:
+		m.read(0xffff)
+	case opDummyPC:
+		m.read(m.pc)
+	case opImplied:
+		m.read(m.pc)
+		t.opcode.operation(m, 0, 0)
+	case opAccumulator:
+		m.read(m.pc)
+		m.a = t.opcode.operation(m, 0, m.a)
+	case opImmediate:
+		value := m.read(m.pc)
+		m.pc++
+		t.opcode.operation(m, 0, value)
+
+	case opOperandLo:
+		t.ea = uint16(m.read(m.pc))
+		m.pc++
+	case opOperandHi:
+		t.ea |= uint16(m.read(m.pc)) << 8
+		m.pc++
+	case opOperandHiIndexed:
+		t.ea |= uint16(m.read(m.pc)) << 8
+		m.pc++
+		m.index(m.indexRegister())
+	case opZeropageIndexed:
+		m.read(t.ea)
+		t.ea = uint16(uint8(t.ea) + m.indexRegister())
+	case opPointerHi:
+		// the high byte of the pointer is not incremented (see "The 6502 bugs")
+		t.data = m.read(t.ea&0xff00 | (t.ea+1)&0x00ff)
+	case opPointerLo:
+		t.ea = uint16(t.data)<<8 | uint16(m.read(t.ea))
+		switch {
+		case t.opcode.kind == kindControl:
+			m.pc = t.ea
+		case t.opcode.Mode == IndirectIndexed:
+			m.index(m.y)
+		}
+	case opFixup:
+		m.read(t.base&0xff00 | t.ea&0x00ff)
+
+	case opRead:
+		t.opcode.operation(m, t.ea, m.read(t.ea))
+	case opWrite:
+		m.write(t.ea, t.opcode.operation(m, t.ea, 0))
+	case opModifyRead:
+		t.data = m.read(t.ea)
+	case opModifyDummyWrite:
+		m.write(t.ea, t.data)
+	case opModifyWrite:
+		m.write(t.ea, t.opcode.operation(m, t.ea, t.data))
+
+	case opBranch:
+		t.data = m.read(m.pc)
+		m.pc++
+		if t.opcode.operation(m, 0, 0) == 0 {
+			t.finish()
+		}
+	case opBranchTaken:
+		m.read(m.pc)
+		t.ea = m.relativeAdressing(m.pc, t.data)
+		if t.data&0x80 != 0 {
+			t.ea -= 0x100
+		}
+		if t.ea&0xff00 == m.pc&0xff00 {
+			m.pc = t.ea
+			t.finish()
+		}
+	case opBranchFixup:
+		m.read(m.pc&0xff00 | t.ea&0x00ff)
+		m.pc = t.ea
+
+	case opSkipOperand:
+		m.read(m.pc)
+		m.pc++
+	case opDummyStack:
+		m.read(StackOffset + uint16(m.s))
+	case opPushPCH:
+		m.pushCycle(m.PCH())
+	case opPushPCL:
+		m.pushCycle(m.PCL())
+	case opPushStatus, opPushBreakStatus:
+		status := m.p | uint8(X)
+		if op == opPushBreakStatus {
+			status |= uint8(B)
+		} else {
+			status &^= uint8(B)
+		}
+		m.pushCycle(status)
+		// a NMI occuring during the sequence hijacks it
+		if t.vector != NMIVector && m.nmiPending {
+			m.nmiPending = false
+			t.vector = NMIVector
+		}
+		m.setProcessorStatusBit(I, true)
+	case opPushA:
+		m.pushCycle(m.a)
+	case opPushP:
+		m.pushCycle(m.p | uint8(B) | uint8(X))
+	case opPullA:
+		m.a = m.popCycle()
+		m.setNZ(m.a)
+	case opPullP:
+		m.p = m.popCycle()&^uint8(B) | uint8(X)
+	case opPullPCL:
+		m.SetPCL(m.popCycle())
+	case opPullPCH:
+		m.SetPCH(m.popCycle())
+	case opVectorLo:
+		t.ea = uint16(m.read(t.vector))
+	case opVectorHi:
+		m.pc = uint16(m.read(t.vector+1))<<8 | t.ea
+	case opJump:
+		m.pc = uint16(m.read(m.pc))<<8 | t.ea
+	case opReturn:
+		m.read(m.pc)
+		m.pc++
+	}
+}
+
+// pushCycle writes to the stack in the current cycle
+func (m *MOS6502) pushCycle(value byte) {
+	m.write(StackOffset+uint16(m.s), value)
+	m.s--
+}
+
+// popCycle reads from the stack in the current cycle
+func (m *MOS6502) popCycle() byte {
+	m.s++
+	return m.read(StackOffset + uint16(m.s))
+}
@@ -0,0 +1,179 @@
+package mpu
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/cyclelock"
+)
+
+// recordingBus logs every bus access
+type recordingBus struct {
+	memory   [0x10000]byte
+	accesses []string
+}
+
+func (b *recordingBus) Get(addr uint16) byte {
+	b.accesses = append(b.accesses, fmt.Sprintf("r %04x %02x", addr, b.memory[addr]))
+	return b.memory[addr]
+}
+
+func (b *recordingBus) Set(addr uint16, value byte) {
+	b.accesses = append(b.accesses, fmt.Sprintf("w %04x %02x", addr, value))
+	b.memory[addr] = value
+}
+
+// newRandomMPUs returns two MPUs with the same random registers and memory, the program starts at $0200
+func newRandomMPUs(random *rand.Rand, program ...byte) (*MOS6502, *recordingBus, *MOS6502, *recordingBus) {
+	bus := &recordingBus{}
+	random.Read(bus.memory[:])
+	copy(bus.memory[0x0200:], program)
+
+	m := &MOS6502{Bus: bus}
+	m.Init(&cyclelock.AlwaysOpenLock{})
+	m.pc = 0x0200
+	m.a, m.x, m.y = uint8(random.Intn(0x100)), uint8(random.Intn(0x100)), uint8(random.Intn(0x100))
+	m.s, m.p = uint8(random.Intn(0x100)), uint8(random.Intn(0x100))|uint8(I)
+
+	other, otherBus := *m, *bus
+	other.Bus = &otherBus
+	other.CycleLock = &cyclelock.AlwaysOpenLock{}
+	return m, bus, &other, &otherBus
+}
+
+// tickInstruction ticks until the instruction is complete and returns the number of cycles
+func tickInstruction(m *MOS6502) int {
+	cycles := 1
+	for !m.Tick() {
+		cycles++
+	}
+	return cycles
+}
+
+// rdyLock releases RDY of the MPU after the given number of cycles
+type rdyLock struct {
+	cyclelock.AlwaysOpenLock
+	mpu     *MOS6502
+	release int
+}
+
+func (l *rdyLock) EnterCycle() {
+	l.AlwaysOpenLock.EnterCycle()
+	if l.CycleCount() == l.release {
+		l.mpu.SetRDY(true)
+	}
+}
+
+func TestTick(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Tick", func() {
+		g.It("runs the same bus cycles as Step for every opcode", func() {
+			random := rand.New(rand.NewSource(6502))
+			for opcode := 0; opcode < 0x100; opcode++ {
+				if Opcodes[opcode].Mnemonic == "JAM" {
+					continue
+				}
+				for i := 0; i < 20; i++ {
+					operands := []byte{byte(random.Intn(0x100)), byte(random.Intn(0x100))}
+					stepped, steppedBus, ticked, tickedBus := newRandomMPUs(random, append([]byte{byte(opcode)}, operands...)...)
+
+					stepped.Step()
+					cycles := tickInstruction(ticked)
+
+					name := fmt.Sprintf("opcode %02x %v", opcode, operands)
+					g.Assert(tickedBus.accesses).Equal(steppedBus.accesses, name)
+					g.Assert(cycles).Equal(stepped.CycleLock.CycleCount(), name)
+					g.Assert(ticked.DumpRegisters()).Equal(stepped.DumpRegisters(), name)
+				}
+			}
+		})
+
+		g.It("runs the interrupt sequences like Step", func() {
+			// the IRQ handler starts with a NOP at $0201
+			stepped, steppedBus, ticked, tickedBus := newRandomMPUs(rand.New(rand.NewSource(64)), 0xea, 0xea)
+			for _, m := range []*MOS6502{stepped, ticked} {
+				m.Bus.Set(IRQVector, 0x01)
+				m.Bus.Set(IRQVector+1, 0x02)
+				m.p &^= uint8(I)
+				m.SetIRQ(0, true)
+			}
+			stepped.Step()
+			g.Assert(tickInstruction(ticked)).Equal(7)
+
+			// Tick polled the interrupts at the end of the last instruction, the NMI is taken after the NOP
+			ticked.SetNMI(0, true)
+			stepped.Step()
+			stepped.SetNMI(0, true)
+			stepped.Step()
+			g.Assert(tickInstruction(ticked)).Equal(2)
+			g.Assert(tickInstruction(ticked)).Equal(7)
+			g.Assert(tickedBus.accesses).Equal(steppedBus.accesses)
+			g.Assert(ticked.PC()).Equal(stepped.PC())
+		})
+
+		g.It("keeps jammed MPUs reading", func() {
+			m, bus, _, _ := newRandomMPUs(rand.New(rand.NewSource(1)), 0x02)
+			g.Assert(m.Tick()).IsTrue()
+			g.Assert(m.Jammed()).IsTrue()
+			g.Assert(m.Tick()).IsTrue()
+			g.Assert(bus.accesses[1]).Equal(fmt.Sprintf("r ffff %02x", bus.memory[0xffff]))
+		})
+
+		g.It("calls traps before the opcode fetch", func() {
+			// NOP, LDA #$01 at $0300
+			m, bus, _, _ := newRandomMPUs(rand.New(rand.NewSource(1)), 0xea)
+			bus.memory[0x0300], bus.memory[0x0301] = 0xa9, 0x01
+			m.SetTrap(0x0200, func() bool {
+				m.pc = 0x0300
+				return true
+			})
+			g.Assert(tickInstruction(m)).Equal(2)
+			g.Assert(m.A()).Equal(uint8(0x01))
+		})
+
+		g.It("reports the start of instructions", func() {
+			// LDA #$01
+			m, _, _, _ := newRandomMPUs(rand.New(rand.NewSource(1)), 0xa9, 0x01)
+			g.Assert(m.InstructionStart()).IsTrue()
+			m.Tick()
+			g.Assert(m.InstructionStart()).IsFalse()
+			m.Tick()
+			g.Assert(m.InstructionStart()).IsTrue()
+			g.Assert(m.A()).Equal(uint8(0x01))
+		})
+	})
+
+	g.Describe("RDY", func() {
+		g.It("halts Tick on read cycles only", func() {
+			// INC $10
+			m, bus, _, _ := newRandomMPUs(rand.New(rand.NewSource(1)), 0xe6, 0x10)
+			m.Tick()
+			m.Tick()
+			m.Tick()
+			m.SetRDY(false)
+			g.Assert(m.RDY()).IsFalse()
+			g.Assert(m.Tick()).IsFalse()
+			g.Assert(m.Tick()).IsTrue()
+			g.Assert(len(bus.accesses)).Equal(5)
+
+			g.Assert(m.Tick()).IsFalse()
+			g.Assert(len(bus.accesses)).Equal(5)
+			m.SetRDY(true)
+			m.Tick()
+			g.Assert(len(bus.accesses)).Equal(6)
+		})
+
+		g.It("lets Step wait in front of read cycles", func() {
+			// LDA #$01
+			m, _, _, _ := newRandomMPUs(rand.New(rand.NewSource(1)), 0xa9, 0x01)
+			m.CycleLock = &rdyLock{mpu: m, release: 4}
+			m.SetRDY(false)
+			m.Step()
+			g.Assert(m.A()).Equal(uint8(0x01))
+			g.Assert(m.CycleLock.CycleCount()).Equal(5)
+		})
+	})
+}
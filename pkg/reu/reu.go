@@ -0,0 +1,346 @@
+package reu
+
+import (
+	"fmt"
+
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+// REU emulates the Commodore RAM Expansion Units 1700 (128kB), 1764 (256kB), 1750 (512kB) and the larger
+// compatible expansions up to 16MB. The RAM Expansion Controller (REC) at $df00 moves data between the C64
+// and the REU memory by DMA while the MPU is halted, transferring one byte per cycle.
+// http://www.zimmers.net/anonftp/pub/cbm/documents/chipdata/8726.txt
+type REU struct {
+	ram []byte
+
+	status  byte
+	command byte
+	// the address and length registers are written to the shadow registers as well, autoload restores them
+	c64Address, c64Shadow uint16
+	reuAddress, reuShadow uint32
+	length, lengthShadow  uint16
+	irqMask               byte
+	addressControl        byte
+
+	// armed is set while an executing command waits for the write to $ff00
+	armed  bool
+	active bool
+	// swapRead is set between the two cycles of a swap
+	swapRead bool
+	swapByte byte
+	// irq is the level of the IRQ output
+	irq bool
+
+	// Memory is the address space of the C64 as seen by the DMA
+	Memory Bus
+	// IRQ is called whenever the state of the IRQ output changes
+	IRQ func(active bool)
+}
+
+// Bus is the C64 side of the DMA transfers
+type Bus interface {
+	Get(addr uint16) byte
+	Set(addr uint16, value byte)
+}
+
+// Sizes of the Commodore REUs
+const (
+	Size1700 = 128 * 1024
+	Size1764 = 256 * 1024
+	Size1750 = 512 * 1024
+	// MaxSize is the largest expansion the bank register can address
+	MaxSize = 16 * 1024 * 1024
+)
+
+// Registers, they are mirrored every 32 bytes in $df00-$dfff
+const (
+	Status uint16 = iota
+	Command
+	C64AddressLo
+	C64AddressHi
+	REUAddressLo
+	REUAddressHi
+	REUBank
+	LengthLo
+	LengthHi
+	IRQMask
+	AddressControl
+)
+
+// bits of the status register
+const (
+	StatusIRQ        byte = 0x80
+	StatusEndOfBlock byte = 0x40
+	StatusFault      byte = 0x20
+	// StatusSize is set for expansions with 256kB RAM chips, i.e. all except the 1700
+	StatusSize byte = 0x10
+)
+
+// bits of the command register
+const (
+	CommandExecute     byte = 0x80
+	CommandAutoload    byte = 0x20
+	CommandImmediately byte = 0x10
+)
+
+// Transfer types in the lower 2 bits of the command register
+const (
+	TransferStash byte = iota
+	TransferFetch
+	TransferSwap
+	TransferVerify
+)
+
+// bits of the IRQ mask and address control registers
+const (
+	irqEnable      byte = 0x80
+	irqEndOfBlock  byte = 0x40
+	irqVerifyError byte = 0x20
+	fixC64Address  byte = 0x80
+	fixREUAddress  byte = 0x40
+)
+
+// New creates an REU with the given size in bytes, it has to be a power of 2 from 128kB to 16MB
+func New(size int) (*REU, error) {
+	if size < Size1700 || size > MaxSize || size&(size-1) != 0 {
+		return nil, fmt.Errorf("invalid REU size: %d bytes", size)
+	}
+
+	r := &REU{ram: make([]byte, size)}
+	r.Reset()
+	return r, nil
+}
+
+// Size returns the size of the REU memory in bytes
+func (r *REU) Size() int {
+	return len(r.ram)
+}
+
+// RAM returns the memory of the REU
+func (r *REU) RAM() []byte {
+	return r.ram
+}
+
+// Reset puts the controller into its power on state, the RAM keeps its content
+func (r *REU) Reset() {
+	r.status = 0
+	if len(r.ram) > Size1700 {
+		r.status = StatusSize
+	}
+	r.command = CommandImmediately
+	r.c64Address, r.c64Shadow = 0, 0
+	r.reuAddress, r.reuShadow = 0, 0
+	r.length, r.lengthShadow = 0xffff, 0xffff
+	r.irqMask = 0
+	r.addressControl = 0
+	r.armed, r.active, r.swapRead = false, false, false
+	r.updateIRQ()
+}
+
+func (r *REU) updateIRQ() {
+	active := r.irqMask&irqEnable != 0 &&
+		(r.irqMask&irqEndOfBlock != 0 && r.status&StatusEndOfBlock != 0 ||
+			r.irqMask&irqVerifyError != 0 && r.status&StatusFault != 0)
+
+	r.status = setBit(r.status, StatusIRQ, active)
+	if active == r.irq {
+		return
+	}
+	r.irq = active
+	if r.IRQ != nil {
+		r.IRQ(active)
+	}
+}
+
+func setBit(value byte, mask byte, set bool) byte {
+	if set {
+		return value | mask
+	}
+	return value &^ mask
+}
+
+// Active returns true while a transfer is running and the MPU has to be halted
+func (r *REU) Active() bool {
+	return r.active
+}
+
+// TriggerFF00 has to be called for every write to $ff00, it starts transfers waiting for it
+func (r *REU) TriggerFF00() {
+	if r.armed {
+		r.armed = false
+		r.active = true
+	}
+}
+
+// Read reads a register, reading the status clears the interrupt flags
+func (r *REU) Read(register uint16) byte {
+	value := r.Peek(register)
+	if register&0x1f == Status {
+		r.status &^= StatusIRQ | StatusEndOfBlock | StatusFault
+		r.updateIRQ()
+	}
+	return value
+}
+
+// Peek returns the value of a register without any side effects, unused bits read as 1
+func (r *REU) Peek(register uint16) byte {
+	switch register & 0x1f {
+	case Status:
+		return r.status
+	case Command:
+		return r.command
+	case C64AddressLo:
+		return byte(r.c64Address)
+	case C64AddressHi:
+		return byte(r.c64Address >> 8)
+	case REUAddressLo:
+		return byte(r.reuAddress)
+	case REUAddressHi:
+		return byte(r.reuAddress >> 8)
+	case REUBank:
+		return byte(r.reuAddress>>16) | r.unusedBankBits()
+	case LengthLo:
+		return byte(r.length)
+	case LengthHi:
+		return byte(r.length >> 8)
+	case IRQMask:
+		return r.irqMask | 0x1f
+	case AddressControl:
+		return r.addressControl | 0x3f
+	}
+	return 0xff
+}
+
+// unusedBankBits returns the bits of the bank register not decoded by the Commodore REUs
+func (r *REU) unusedBankBits() byte {
+	if len(r.ram) <= Size1750 {
+		return 0xf8
+	}
+	return 0x00
+}
+
+// Write writes a register
+func (r *REU) Write(register uint16, value byte) {
+	switch register & 0x1f {
+	case Command:
+		r.command = value
+		if value&CommandExecute == 0 {
+			return
+		}
+		if value&CommandImmediately != 0 {
+			r.active = true
+		} else {
+			r.armed = true
+		}
+	case C64AddressLo:
+		r.c64Shadow = r.c64Shadow&0xff00 | uint16(value)
+		r.c64Address = r.c64Shadow
+	case C64AddressHi:
+		r.c64Shadow = r.c64Shadow&0x00ff | uint16(value)<<8
+		r.c64Address = r.c64Shadow
+	case REUAddressLo:
+		r.reuShadow = r.reuShadow&0xffff00 | uint32(value)
+		r.reuAddress = r.reuShadow
+	case REUAddressHi:
+		r.reuShadow = r.reuShadow&0xff00ff | uint32(value)<<8
+		r.reuAddress = r.reuShadow
+	case REUBank:
+		r.reuShadow = r.reuShadow&0x00ffff | uint32(value&^r.unusedBankBits())<<16
+		r.reuAddress = r.reuShadow
+	case LengthLo:
+		r.lengthShadow = r.lengthShadow&0xff00 | uint16(value)
+		r.length = r.lengthShadow
+	case LengthHi:
+		r.lengthShadow = r.lengthShadow&0x00ff | uint16(value)<<8
+		r.length = r.lengthShadow
+	case IRQMask:
+		r.irqMask = value & 0xe0
+		r.updateIRQ()
+	case AddressControl:
+		r.addressControl = value & 0xc0
+	}
+}
+
+func (r *REU) reuByte() *byte {
+	return &r.ram[r.reuAddress&uint32(len(r.ram)-1)]
+}
+
+// Cycle runs one DMA cycle of the active transfer
+func (r *REU) Cycle() {
+	if !r.active {
+		return
+	}
+
+	switch r.command & 0x03 {
+	case TransferStash:
+		*r.reuByte() = r.Memory.Get(r.c64Address)
+	case TransferFetch:
+		r.Memory.Set(r.c64Address, *r.reuByte())
+	case TransferSwap:
+		// a swap needs a read and a write cycle
+		if !r.swapRead {
+			r.swapByte = r.Memory.Get(r.c64Address)
+			r.swapRead = true
+			return
+		}
+		r.swapRead = false
+		r.Memory.Set(r.c64Address, *r.reuByte())
+		*r.reuByte() = r.swapByte
+	case TransferVerify:
+		if r.Memory.Get(r.c64Address) != *r.reuByte() {
+			r.status |= StatusFault
+			r.advance()
+			r.finish()
+			return
+		}
+	}
+
+	r.advance()
+	if r.length == 1 {
+		r.status |= StatusEndOfBlock
+		r.finish()
+		return
+	}
+	r.length--
+}
+
+// advance moves the addresses which aren't fixed to the next byte
+func (r *REU) advance() {
+	if r.addressControl&fixC64Address == 0 {
+		r.c64Address++
+	}
+	if r.addressControl&fixREUAddress == 0 {
+		r.reuAddress = (r.reuAddress + 1) & 0xffffff
+	}
+}
+
+func (r *REU) finish() {
+	r.active = false
+	r.command = r.command&^CommandExecute | CommandImmediately
+	if r.command&CommandAutoload != 0 {
+		r.c64Address = r.c64Shadow
+		r.reuAddress = r.reuShadow
+		r.length = r.lengthShadow
+	}
+	r.updateIRQ()
+}
+
+// State saves or restores the registers and the RAM, the size of the REU has to match
+func (r *REU) State(s *snapshot.State) {
+	s.Bytes(r.ram)
+	s.Byte(&r.status)
+	s.Byte(&r.command)
+	s.Uint16(&r.c64Address)
+	s.Uint16(&r.c64Shadow)
+	s.Uint32(&r.reuAddress)
+	s.Uint32(&r.reuShadow)
+	s.Uint16(&r.length)
+	s.Uint16(&r.lengthShadow)
+	s.Byte(&r.irqMask)
+	s.Byte(&r.addressControl)
+	s.Bool(&r.armed)
+	s.Bool(&r.active)
+	s.Bool(&r.swapRead)
+	s.Byte(&r.swapByte)
+	s.Bool(&r.irq)
+}
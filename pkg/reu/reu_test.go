@@ -0,0 +1,172 @@
+package reu
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+type testMemory [0x10000]byte
+
+func (m *testMemory) Get(addr uint16) byte        { return m[addr] }
+func (m *testMemory) Set(addr uint16, value byte) { m[addr] = value }
+
+func newTestREU(size int) (*REU, *testMemory) {
+	r, err := New(size)
+	if err != nil {
+		panic(err)
+	}
+	memory := &testMemory{}
+	r.Memory = memory
+	return r, memory
+}
+
+// setup writes the addresses and the length of the next transfer
+func setup(r *REU, c64Address uint16, reuAddress uint32, length uint16) {
+	r.Write(C64AddressLo, byte(c64Address))
+	r.Write(C64AddressHi, byte(c64Address>>8))
+	r.Write(REUAddressLo, byte(reuAddress))
+	r.Write(REUAddressHi, byte(reuAddress>>8))
+	r.Write(REUBank, byte(reuAddress>>16))
+	r.Write(LengthLo, byte(length))
+	r.Write(LengthHi, byte(length>>8))
+}
+
+// run executes the active transfer and returns the number of cycles used
+func run(r *REU) int {
+	cycles := 0
+	for r.Active() {
+		r.Cycle()
+		cycles++
+	}
+	return cycles
+}
+
+func TestREU(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("REU", func() {
+		g.It("accepts sizes from 128kB to 16MB", func() {
+			_, err := New(Size1700)
+			g.Assert(err).IsNil()
+			_, err = New(MaxSize)
+			g.Assert(err).IsNil()
+			_, err = New(64 * 1024)
+			g.Assert(err != nil).IsTrue()
+			_, err = New(3 * Size1700)
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("reports the RAM chip size and unused bits", func() {
+			r, _ := newTestREU(Size1700)
+			g.Assert(r.Peek(Status)).Equal(uint8(0x00))
+			g.Assert(r.Peek(REUBank)).Equal(uint8(0xf8))
+			g.Assert(r.Peek(IRQMask)).Equal(uint8(0x1f))
+			r, _ = newTestREU(Size1750)
+			g.Assert(r.Peek(Status)).Equal(StatusSize)
+			g.Assert(r.Peek(0xdf20 + Status)).Equal(StatusSize)
+		})
+
+		g.It("stashes and fetches a block", func() {
+			r, memory := newTestREU(Size1764)
+			copy(memory[0x1000:], "HELLO")
+			setup(r, 0x1000, 0x20000, 5)
+			r.Write(Command, CommandExecute|CommandImmediately|TransferStash)
+			g.Assert(run(r)).Equal(5)
+			g.Assert(string(r.RAM()[0x20000:0x20005])).Equal("HELLO")
+			g.Assert(r.Read(Status) & StatusEndOfBlock).Equal(StatusEndOfBlock)
+			g.Assert(r.Peek(Status) & StatusEndOfBlock).Equal(uint8(0))
+			g.Assert(r.Peek(Command) & CommandExecute).Equal(uint8(0))
+
+			setup(r, 0x2000, 0x20001, 3)
+			r.Write(Command, CommandExecute|CommandImmediately|TransferFetch)
+			run(r)
+			g.Assert(string(memory[0x2000:0x2003])).Equal("ELL")
+		})
+
+		g.It("swaps two blocks in two cycles per byte", func() {
+			r, memory := newTestREU(Size1700)
+			copy(memory[0x1000:], "AB")
+			copy(r.RAM()[0x100:], "XY")
+			setup(r, 0x1000, 0x100, 2)
+			r.Write(Command, CommandExecute|CommandImmediately|TransferSwap)
+			g.Assert(run(r)).Equal(4)
+			g.Assert(string(memory[0x1000:0x1002])).Equal("XY")
+			g.Assert(string(r.RAM()[0x100:0x102])).Equal("AB")
+		})
+
+		g.It("stops a verify at the first difference", func() {
+			r, memory := newTestREU(Size1700)
+			copy(memory[0x1000:], "ABCD")
+			copy(r.RAM(), "ABXD")
+			setup(r, 0x1000, 0, 4)
+			r.Write(Command, CommandExecute|CommandImmediately|TransferVerify)
+			g.Assert(run(r)).Equal(3)
+			g.Assert(r.Peek(Status) & StatusFault).Equal(StatusFault)
+			g.Assert(r.Peek(C64AddressLo)).Equal(uint8(0x03))
+		})
+
+		g.It("keeps fixed addresses", func() {
+			r, memory := newTestREU(Size1700)
+			r.RAM()[0x10] = 0x42
+			setup(r, 0x1000, 0x10, 0x100)
+			r.Write(AddressControl, fixREUAddress)
+			r.Write(Command, CommandExecute|CommandImmediately|TransferFetch)
+			run(r)
+			g.Assert(memory[0x1000]).Equal(uint8(0x42))
+			g.Assert(memory[0x10ff]).Equal(uint8(0x42))
+			g.Assert(r.Peek(REUAddressLo)).Equal(uint8(0x10))
+		})
+
+		g.It("restores the registers with autoload", func() {
+			r, _ := newTestREU(Size1700)
+			setup(r, 0x1000, 0x200, 0x10)
+			r.Write(Command, CommandExecute|CommandImmediately|CommandAutoload|TransferStash)
+			run(r)
+			g.Assert(r.Peek(C64AddressHi)).Equal(uint8(0x10))
+			g.Assert(r.Peek(REUAddressHi)).Equal(uint8(0x02))
+			g.Assert(r.Peek(LengthLo)).Equal(uint8(0x10))
+
+			r.Write(Command, CommandExecute|CommandImmediately|TransferStash)
+			run(r)
+			g.Assert(r.Peek(C64AddressHi)).Equal(uint8(0x10))
+			g.Assert(r.Peek(C64AddressLo)).Equal(uint8(0x10))
+			g.Assert(r.Peek(LengthLo)).Equal(uint8(0x01))
+		})
+
+		g.It("waits for a write to $ff00", func() {
+			r, _ := newTestREU(Size1700)
+			setup(r, 0x1000, 0, 1)
+			r.Write(Command, CommandExecute|TransferStash)
+			g.Assert(r.Active()).IsFalse()
+			r.TriggerFF00()
+			g.Assert(r.Active()).IsTrue()
+			run(r)
+			r.TriggerFF00()
+			g.Assert(r.Active()).IsFalse()
+		})
+
+		g.It("raises an IRQ at the end of the block", func() {
+			r, _ := newTestREU(Size1700)
+			irq := false
+			r.IRQ = func(active bool) { irq = active }
+			r.Write(IRQMask, irqEnable|irqEndOfBlock)
+			setup(r, 0x1000, 0, 2)
+			r.Write(Command, CommandExecute|CommandImmediately|TransferStash)
+			run(r)
+			g.Assert(irq).IsTrue()
+			g.Assert(r.Read(Status) & StatusIRQ).Equal(StatusIRQ)
+			g.Assert(irq).IsFalse()
+		})
+
+		g.It("wraps the REU address at the end of the memory", func() {
+			r, memory := newTestREU(Size1700)
+			copy(memory[0x1000:], "AB")
+			setup(r, 0x1000, Size1700-1, 2)
+			r.Write(Command, CommandExecute|CommandImmediately|TransferStash)
+			run(r)
+			g.Assert(r.RAM()[Size1700-1]).Equal(uint8('A'))
+			g.Assert(r.RAM()[0]).Equal(uint8('B'))
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package scheduler
+
+import "container/heap"
+
+// Scheduler counts the cycles of a system and calls events once their cycle is reached. The system ticks its
+// chips itself every cycle, so that the hot path doesn't need an indirect call per chip, and then ticks the
+// scheduler. Events due in the same cycle are called in the order they were scheduled. It must only be used
+// from the goroutine running the emulation.
+type Scheduler struct {
+	cycle  uint64
+	events eventQueue
+	// scheduled numbers the events so that events of the same cycle keep their order
+	scheduled uint64
+}
+
+// Event is a function called once the scheduler reaches its cycle
+type Event struct {
+	cycle    uint64
+	sequence uint64
+	call     func()
+	// index is the position in the queue or -1 once the event was called or cancelled
+	index int
+}
+
+// Cycle returns the cycle the event is due in
+func (e *Event) Cycle() uint64 {
+	return e.cycle
+}
+
+// Pending returns true until the event was called or cancelled
+func (e *Event) Pending() bool {
+	return e.index >= 0
+}
+
+// Cycle returns the number of cycles since the start
+func (s *Scheduler) Cycle() uint64 {
+	return s.cycle
+}
+
+// SetCycle moves the clock, e.g. when restoring a snapshot. The pending events keep their distance to the
+// current cycle.
+func (s *Scheduler) SetCycle(cycle uint64) {
+	for _, e := range s.events {
+		e.cycle = e.cycle - s.cycle + cycle
+	}
+	s.cycle = cycle
+}
+
+// Schedule calls the function at the end of the given cycle, events of past cycles are due in the next one
+func (s *Scheduler) Schedule(cycle uint64, call func()) *Event {
+	s.scheduled++
+	e := &Event{cycle: cycle, sequence: s.scheduled, call: call}
+	heap.Push(&s.events, e)
+	return e
+}
+
+// After calls the function the given number of cycles after the current one
+func (s *Scheduler) After(cycles uint64, call func()) *Event {
+	return s.Schedule(s.cycle+cycles, call)
+}
+
+// Cancel removes the event if it is still pending
+func (s *Scheduler) Cancel(e *Event) {
+	if e != nil && e.Pending() {
+		heap.Remove(&s.events, e.index)
+	}
+}
+
+// Tick advances the clock by one cycle and calls the events due
+func (s *Scheduler) Tick() {
+	s.cycle++
+	if len(s.events) > 0 && s.events[0].cycle <= s.cycle {
+		s.callDue()
+	}
+}
+
+// callDue calls the events due in the current cycle, it is kept out of Tick so that Tick can be inlined
+func (s *Scheduler) callDue() {
+	for len(s.events) > 0 && s.events[0].cycle <= s.cycle {
+		heap.Pop(&s.events).(*Event).call()
+	}
+}
+
+// eventQueue is a heap of the pending events ordered by their cycle
+type eventQueue []*Event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].cycle != q[j].cycle {
+		return q[i].cycle < q[j].cycle
+	}
+	return q[i].sequence < q[j].sequence
+}
+
+func (q eventQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *eventQueue) Push(x any) {
+	e := x.(*Event)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
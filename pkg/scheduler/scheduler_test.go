@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestScheduler(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Scheduler", func() {
+		g.It("counts the cycles", func() {
+			s := &Scheduler{}
+			s.Tick()
+			s.Tick()
+			g.Assert(s.Cycle()).Equal(uint64(2))
+		})
+
+		g.It("calls events at their cycle in order", func() {
+			s := &Scheduler{}
+			var calls []string
+			s.Schedule(2, func() { calls = append(calls, "second") })
+			s.After(1, func() { calls = append(calls, "first") })
+			s.Schedule(2, func() { calls = append(calls, "third") })
+			s.Tick()
+			g.Assert(calls).Equal([]string{"first"})
+			s.Tick()
+			g.Assert(calls).Equal([]string{"first", "second", "third"})
+		})
+
+		g.It("cancels events", func() {
+			s := &Scheduler{}
+			called := false
+			e := s.After(3, func() { called = true })
+			g.Assert(e.Pending()).IsTrue()
+			s.Cancel(e)
+			g.Assert(e.Pending()).IsFalse()
+			s.Cancel(e)
+			for i := 0; i < 5; i++ {
+				s.Tick()
+			}
+			g.Assert(called).IsFalse()
+		})
+
+		g.It("reschedules from events", func() {
+			s := &Scheduler{}
+			var cycles []uint64
+			var tick func()
+			tick = func() {
+				cycles = append(cycles, s.Cycle())
+				s.After(4, tick)
+			}
+			s.After(4, tick)
+			for i := 0; i < 12; i++ {
+				s.Tick()
+			}
+			g.Assert(cycles).Equal([]uint64{4, 8, 12})
+		})
+
+		g.It("keeps the distance of events when the clock is set", func() {
+			s := &Scheduler{}
+			e := s.After(10, func() {})
+			s.Tick()
+			s.SetCycle(1000)
+			g.Assert(e.Cycle()).Equal(uint64(1009))
+		})
+	})
+}
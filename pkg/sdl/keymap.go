@@ -0,0 +1,89 @@
+//go:build sdl
+
+package sdl
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+
+	"github.com/gentoomaniac/go64/pkg/c64"
+)
+
+// keymap maps the physical keys of a US keyboard to the keys of the C64 at the same position. The keys missing
+// on the C64 press the shifted ones, e.g. F2 or cursor up.
+var keymap = map[sdl.Scancode][]c64.Key{
+	sdl.SCANCODE_A: {c64.KeyA},
+	sdl.SCANCODE_B: {c64.KeyB},
+	sdl.SCANCODE_C: {c64.KeyC},
+	sdl.SCANCODE_D: {c64.KeyD},
+	sdl.SCANCODE_E: {c64.KeyE},
+	sdl.SCANCODE_F: {c64.KeyF},
+	sdl.SCANCODE_G: {c64.KeyG},
+	sdl.SCANCODE_H: {c64.KeyH},
+	sdl.SCANCODE_I: {c64.KeyI},
+	sdl.SCANCODE_J: {c64.KeyJ},
+	sdl.SCANCODE_K: {c64.KeyK},
+	sdl.SCANCODE_L: {c64.KeyL},
+	sdl.SCANCODE_M: {c64.KeyM},
+	sdl.SCANCODE_N: {c64.KeyN},
+	sdl.SCANCODE_O: {c64.KeyO},
+	sdl.SCANCODE_P: {c64.KeyP},
+	sdl.SCANCODE_Q: {c64.KeyQ},
+	sdl.SCANCODE_R: {c64.KeyR},
+	sdl.SCANCODE_S: {c64.KeyS},
+	sdl.SCANCODE_T: {c64.KeyT},
+	sdl.SCANCODE_U: {c64.KeyU},
+	sdl.SCANCODE_V: {c64.KeyV},
+	sdl.SCANCODE_W: {c64.KeyW},
+	sdl.SCANCODE_X: {c64.KeyX},
+	sdl.SCANCODE_Y: {c64.KeyY},
+	sdl.SCANCODE_Z: {c64.KeyZ},
+
+	sdl.SCANCODE_1: {c64.Key1},
+	sdl.SCANCODE_2: {c64.Key2},
+	sdl.SCANCODE_3: {c64.Key3},
+	sdl.SCANCODE_4: {c64.Key4},
+	sdl.SCANCODE_5: {c64.Key5},
+	sdl.SCANCODE_6: {c64.Key6},
+	sdl.SCANCODE_7: {c64.Key7},
+	sdl.SCANCODE_8: {c64.Key8},
+	sdl.SCANCODE_9: {c64.Key9},
+	sdl.SCANCODE_0: {c64.Key0},
+
+	sdl.SCANCODE_GRAVE:        {c64.KeyLeftArrow},
+	sdl.SCANCODE_MINUS:        {c64.KeyPlus},
+	sdl.SCANCODE_EQUALS:       {c64.KeyMinus},
+	sdl.SCANCODE_INSERT:       {c64.KeyPound},
+	sdl.SCANCODE_HOME:         {c64.KeyHome},
+	sdl.SCANCODE_BACKSPACE:    {c64.KeyDelete},
+	sdl.SCANCODE_LEFTBRACKET:  {c64.KeyAt},
+	sdl.SCANCODE_RIGHTBRACKET: {c64.KeyAsterisk},
+	sdl.SCANCODE_DELETE:       {c64.KeyUpArrow},
+	sdl.SCANCODE_SEMICOLON:    {c64.KeyColon},
+	sdl.SCANCODE_APOSTROPHE:   {c64.KeySemicolon},
+	sdl.SCANCODE_BACKSLASH:    {c64.KeyEquals},
+	sdl.SCANCODE_RETURN:       {c64.KeyReturn},
+	sdl.SCANCODE_COMMA:        {c64.KeyComma},
+	sdl.SCANCODE_PERIOD:       {c64.KeyPeriod},
+	sdl.SCANCODE_SLASH:        {c64.KeySlash},
+	sdl.SCANCODE_SPACE:        {c64.KeySpace},
+
+	sdl.SCANCODE_ESCAPE: {c64.KeyRunStop},
+	sdl.SCANCODE_TAB:    {c64.KeyControl},
+	sdl.SCANCODE_LCTRL:  {c64.KeyCommodore},
+	sdl.SCANCODE_LSHIFT: {c64.KeyLeftShift},
+	sdl.SCANCODE_RSHIFT: {c64.KeyRightShift},
+
+	sdl.SCANCODE_F1: {c64.KeyF1},
+	sdl.SCANCODE_F2: {c64.KeyLeftShift, c64.KeyF1},
+	sdl.SCANCODE_F3: {c64.KeyF3},
+	sdl.SCANCODE_F4: {c64.KeyLeftShift, c64.KeyF3},
+	sdl.SCANCODE_F5: {c64.KeyF5},
+	sdl.SCANCODE_F6: {c64.KeyLeftShift, c64.KeyF5},
+	sdl.SCANCODE_F7: {c64.KeyF7},
+	sdl.SCANCODE_F8: {c64.KeyLeftShift, c64.KeyF7},
+
+	sdl.SCANCODE_RIGHT: {c64.KeyCursorRight},
+	sdl.SCANCODE_LEFT:  {c64.KeyLeftShift, c64.KeyCursorRight},
+	sdl.SCANCODE_DOWN:  {c64.KeyCursorDown},
+	sdl.SCANCODE_UP:    {c64.KeyLeftShift, c64.KeyCursorDown},
+}
@@ -0,0 +1,224 @@
+//go:build sdl
+
+// Package sdl shows the C64 in a window of the SDL library, plays its audio and maps the host keyboard to the
+// keyboard matrix. It is only built with the sdl build tag, so headless builds don't need the library.
+package sdl
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/rs/zerolog/log"
+	"github.com/veandco/go-sdl2/sdl"
+
+	"github.com/gentoomaniac/go64/pkg/c64"
+	"github.com/gentoomaniac/go64/pkg/host"
+)
+
+const (
+	// maxQueuedSamples limits the audio collected and queued to 100ms, samples of frames arriving faster, e.g.
+	// in warp mode, are dropped
+	maxQueuedSamples = host.AudioRate / 10
+	// maxQueuedBytes is the same limit for the audio queue of SDL, which counts the bytes of the 16 bit samples
+	maxQueuedBytes = maxQueuedSamples * 2
+	// waitTimeout is the time in ms the event loop waits for events before checking for a new frame
+	waitTimeout = 2
+)
+
+func init() {
+	// SDL has to be called from the main thread
+	runtime.LockOSThread()
+}
+
+// Window is a host presenting the frames in a window
+type Window struct {
+	scale int
+
+	// mutex protects the frame, the samples and the events passed between the goroutines
+	mutex   sync.Mutex
+	frame   []byte
+	samples []int16
+	events  []host.Event
+	// frames signals a new frame to the event loop
+	frames chan struct{}
+	// closed is set once the window was closed
+	closed atomic.Bool
+
+	// pixels holds the frame converted to the format of the texture
+	pixels  []uint32
+	palette [16]uint32
+}
+
+// New returns a window scaling the screen by the given factor
+func New(scale int) *Window {
+	w := &Window{
+		scale:  scale,
+		frame:  make([]byte, c64.ScreenWidth*c64.ScreenHeight),
+		frames: make(chan struct{}, 1),
+		pixels: make([]uint32, c64.ScreenWidth*c64.ScreenHeight),
+	}
+	for i, color := range c64.Palette {
+		w.palette[i] = 0xff000000 | uint32(color.R)<<16 | uint32(color.G)<<8 | uint32(color.B)
+	}
+	return w
+}
+
+// FrameReady takes over the pixels of the frame, they are drawn by the event loop
+func (w *Window) FrameReady(frame *host.Frame) {
+	w.mutex.Lock()
+	copy(w.frame, frame.Pixels)
+	w.mutex.Unlock()
+
+	select {
+	case w.frames <- struct{}{}:
+	default:
+	}
+}
+
+// Samples collects the samples until the event loop queues them
+func (w *Window) Samples(samples []int16) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.samples) < maxQueuedSamples {
+		w.samples = append(w.samples, samples...)
+	}
+}
+
+// Events returns the keys pressed and released in the window
+func (w *Window) Events() []host.Event {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	events := w.events
+	w.events = nil
+	return events
+}
+
+// FrameDone ends the emulation once the window is closed
+func (w *Window) FrameDone() bool {
+	return !w.closed.Load()
+}
+
+// Run opens the window and handles its events until it is closed. It has to be called on the main goroutine
+// while the emulation runs on another one.
+func (w *Window) Run() error {
+	defer w.closed.Store(true)
+	if err := sdl.Init(sdl.INIT_VIDEO | sdl.INIT_AUDIO); err != nil {
+		return err
+	}
+	defer sdl.Quit()
+
+	window, err := sdl.CreateWindow("go64", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED,
+		int32(c64.ScreenWidth*w.scale), int32(c64.ScreenHeight*w.scale), sdl.WINDOW_SHOWN|sdl.WINDOW_RESIZABLE)
+	if err != nil {
+		return err
+	}
+	defer window.Destroy()
+
+	renderer, err := sdl.CreateRenderer(window, -1, sdl.RENDERER_ACCELERATED)
+	if err != nil {
+		return err
+	}
+	defer renderer.Destroy()
+	if err := renderer.SetLogicalSize(c64.ScreenWidth, c64.ScreenHeight); err != nil {
+		return err
+	}
+
+	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING,
+		c64.ScreenWidth, c64.ScreenHeight)
+	if err != nil {
+		return err
+	}
+	defer texture.Destroy()
+
+	// the emulation keeps running without audio if there is no audio device
+	device, err := sdl.OpenAudioDevice("", false, &sdl.AudioSpec{
+		Freq:     host.AudioRate,
+		Format:   sdl.AUDIO_S16LSB,
+		Channels: 1,
+		Samples:  1024,
+	}, nil, 0)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not open the audio device")
+	} else {
+		defer sdl.CloseAudioDevice(device)
+		sdl.PauseAudioDevice(device, false)
+	}
+
+	for {
+		for event := sdl.WaitEventTimeout(waitTimeout); event != nil; event = sdl.PollEvent() {
+			switch e := event.(type) {
+			case *sdl.QuitEvent:
+				return nil
+			case *sdl.KeyboardEvent:
+				w.key(e)
+			case *sdl.WindowEvent:
+				if e.Event == sdl.WINDOWEVENT_FOCUS_LOST {
+					w.event(host.Event{Type: host.AllKeysUp})
+				}
+			}
+		}
+
+		select {
+		case <-w.frames:
+		default:
+			continue
+		}
+		audio := w.takeFrame()
+		if err := texture.Update(nil, unsafe.Pointer(&w.pixels[0]), c64.ScreenWidth*4); err != nil {
+			return err
+		}
+		if err := renderer.Clear(); err != nil {
+			return err
+		}
+		if err := renderer.Copy(texture, nil, nil); err != nil {
+			return err
+		}
+		renderer.Present()
+
+		if device != 0 && sdl.GetQueuedAudioSize(device) < maxQueuedBytes {
+			if err := sdl.QueueAudio(device, audio); err != nil {
+				log.Warn().Err(err).Msg("could not queue audio")
+			}
+		}
+	}
+}
+
+// takeFrame converts the frame into the pixels of the texture and returns the collected samples
+func (w *Window) takeFrame() []byte {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for i, color := range w.frame {
+		w.pixels[i] = w.palette[color&0x0f]
+	}
+	audio := make([]byte, 2*len(w.samples))
+	for i, sample := range w.samples {
+		binary.LittleEndian.PutUint16(audio[2*i:], uint16(sample))
+	}
+	w.samples = w.samples[:0]
+	return audio
+}
+
+// key presses or releases the keys of the matrix mapped to the host key
+func (w *Window) key(e *sdl.KeyboardEvent) {
+	if e.Repeat != 0 {
+		return
+	}
+	for _, key := range keymap[e.Keysym.Scancode] {
+		if e.State == sdl.PRESSED {
+			w.event(host.Event{Type: host.KeyDown, Key: key})
+		} else {
+			w.event(host.Event{Type: host.KeyUp, Key: key})
+		}
+	}
+}
+
+// event queues the event until the emulation asks for it
+func (w *Window) event(event host.Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.events = append(w.events, event)
+}
@@ -0,0 +1,125 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A snapshot file starts with the magic and the format version followed by the modules. Every module holds
+// the state of one component and consists of its name (length byte and characters), the length of the data
+// as 32 bit little endian value and the data.
+
+const magic = "GO64SNAP"
+
+// Writer writes the modules of a snapshot
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+// NewWriter writes the header of a snapshot with the given format version
+func NewWriter(w io.Writer, version uint16) *Writer {
+	sw := &Writer{w: w}
+	header := binary.LittleEndian.AppendUint16([]byte(magic), version)
+	_, sw.err = w.Write(header)
+	return sw
+}
+
+// Module writes a module with the state serialised by save
+func (w *Writer) Module(name string, save func(s *State)) {
+	if w.err != nil {
+		return
+	}
+
+	s := &State{}
+	save(s)
+	if s.err != nil {
+		w.err = fmt.Errorf("module %s: %w", name, s.err)
+		return
+	}
+
+	header := append([]byte{byte(len(name))}, name...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(s.data)))
+	if _, w.err = w.w.Write(header); w.err != nil {
+		return
+	}
+	_, w.err = w.w.Write(s.data)
+}
+
+// Err returns the first error that occurred while writing
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Snapshot is a snapshot read into memory
+type Snapshot struct {
+	Version uint16
+	modules map[string][]byte
+	// Modules holds the names of the modules in the order of the file
+	Modules []string
+}
+
+// Read reads a complete snapshot
+func Read(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a go64 snapshot")
+	}
+	snap := &Snapshot{
+		Version: binary.LittleEndian.Uint16(header[len(magic):]),
+		modules: map[string][]byte{},
+	}
+
+	for {
+		nameLength, err := br.ReadByte()
+		if err == io.EOF {
+			return snap, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		buffer := make([]byte, int(nameLength)+4)
+		if _, err := io.ReadFull(br, buffer); err != nil {
+			return nil, fmt.Errorf("truncated module header")
+		}
+		name := string(buffer[:nameLength])
+		// the buffer only grows with the data actually read, a corrupt length can't allocate up to 4 GiB
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, br, int64(binary.LittleEndian.Uint32(buffer[nameLength:]))); err != nil {
+			return nil, fmt.Errorf("module %s truncated", name)
+		}
+
+		snap.modules[name] = data.Bytes()
+		snap.Modules = append(snap.Modules, name)
+	}
+}
+
+// Has returns true if the snapshot contains the module
+func (s *Snapshot) Has(name string) bool {
+	_, ok := s.modules[name]
+	return ok
+}
+
+// Load restores a state with the data of a module. The module has to be read completely.
+func (s *Snapshot) Load(name string, load func(s *State)) error {
+	data, ok := s.modules[name]
+	if !ok {
+		return fmt.Errorf("module %s missing", name)
+	}
+
+	state := &State{loading: true, data: data}
+	load(state)
+	if state.err == nil && len(state.data) != 0 {
+		state.err = fmt.Errorf("%d bytes left", len(state.data))
+	}
+	if state.err != nil {
+		return fmt.Errorf("module %s: %w", name, state.err)
+	}
+	return nil
+}
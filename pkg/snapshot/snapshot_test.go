@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+type testComponent struct {
+	flag    bool
+	value   byte
+	word    uint16
+	counter int
+	memory  [4]byte
+	name    string
+}
+
+func (t *testComponent) State(s *State) {
+	s.Bool(&t.flag)
+	s.Byte(&t.value)
+	s.Uint16(&t.word)
+	s.Int(&t.counter)
+	s.Bytes(t.memory[:])
+	s.String(&t.name)
+}
+
+func TestSnapshot(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Snapshot", func() {
+		g.It("restores the saved modules", func() {
+			saved := &testComponent{true, 0x42, 0x1234, -5, [4]byte{1, 2, 3, 4}, "test"}
+			var buffer bytes.Buffer
+			w := NewWriter(&buffer, 3)
+			w.Module("TEST", saved.State)
+			w.Module("EMPTY", func(s *State) {})
+			g.Assert(w.Err()).IsNil()
+
+			snap, err := Read(&buffer)
+			g.Assert(err).IsNil()
+			g.Assert(snap.Version).Equal(uint16(3))
+			g.Assert(snap.Modules).Equal([]string{"TEST", "EMPTY"})
+
+			loaded := &testComponent{}
+			g.Assert(snap.Load("TEST", loaded.State)).IsNil()
+			g.Assert(*loaded).Equal(*saved)
+		})
+
+		g.It("rejects modules that don't match the component", func() {
+			var buffer bytes.Buffer
+			w := NewWriter(&buffer, 1)
+			w.Module("SHORT", func(s *State) { v := byte(1); s.Byte(&v) })
+			w.Module("LONG", func(s *State) { s.Bytes(make([]byte, 64)) })
+			snap, _ := Read(&buffer)
+
+			g.Assert(snap.Load("SHORT", (&testComponent{}).State) != nil).IsTrue()
+			g.Assert(snap.Load("LONG", (&testComponent{}).State) != nil).IsTrue()
+			g.Assert(snap.Load("MISSING", (&testComponent{}).State) != nil).IsTrue()
+		})
+
+		g.It("rejects truncated files", func() {
+			var buffer bytes.Buffer
+			w := NewWriter(&buffer, 1)
+			w.Module("TEST", (&testComponent{}).State)
+			data := buffer.Bytes()
+
+			_, err := Read(bytes.NewReader(data[:len(data)-1]))
+			g.Assert(err != nil).IsTrue()
+			_, err = Read(bytes.NewReader([]byte("GO64")))
+			g.Assert(err != nil).IsTrue()
+
+			// a corrupt length of the data is only detected at the end of the file
+			data = append(append([]byte{}, data...), 4, 'H', 'U', 'G', 'E', 0xff, 0xff, 0xff, 0xff, 0x00)
+			_, err = Read(bytes.NewReader(data))
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+}
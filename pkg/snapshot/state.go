@@ -0,0 +1,145 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// State serialises the state of a component. Components use the same method for saving and loading: they
+// pass pointers to their fields which are either written to the module or filled from it. The first error
+// is kept, all following calls are ignored.
+type State struct {
+	loading bool
+	data    []byte
+	err     error
+}
+
+// Loading returns true if the state is read from a snapshot
+func (s *State) Loading() bool {
+	return s.loading
+}
+
+// Err returns the first error that occurred
+func (s *State) Err() error {
+	return s.err
+}
+
+// Fail stops the serialisation with an error, e.g. if a loaded value is out of range
+func (s *State) Fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *State) next(n int) []byte {
+	if s.err != nil {
+		return nil
+	}
+	if len(s.data) < n {
+		s.err = fmt.Errorf("unexpected end of module")
+		return nil
+	}
+	value := s.data[:n]
+	s.data = s.data[n:]
+	return value
+}
+
+// Byte serialises a byte
+func (s *State) Byte(v *byte) {
+	if !s.loading {
+		s.data = append(s.data, *v)
+		return
+	}
+	if b := s.next(1); b != nil {
+		*v = b[0]
+	}
+}
+
+// Bool serialises a bool as one byte
+func (s *State) Bool(v *bool) {
+	var b byte
+	if *v {
+		b = 1
+	}
+	s.Byte(&b)
+	*v = b != 0
+}
+
+// Uint16 serialises a 16 bit value in little endian order
+func (s *State) Uint16(v *uint16) {
+	if !s.loading {
+		s.data = binary.LittleEndian.AppendUint16(s.data, *v)
+		return
+	}
+	if b := s.next(2); b != nil {
+		*v = binary.LittleEndian.Uint16(b)
+	}
+}
+
+// Uint32 serialises a 32 bit value in little endian order
+func (s *State) Uint32(v *uint32) {
+	if !s.loading {
+		s.data = binary.LittleEndian.AppendUint32(s.data, *v)
+		return
+	}
+	if b := s.next(4); b != nil {
+		*v = binary.LittleEndian.Uint32(b)
+	}
+}
+
+// Uint64 serialises a 64 bit value in little endian order
+func (s *State) Uint64(v *uint64) {
+	if !s.loading {
+		s.data = binary.LittleEndian.AppendUint64(s.data, *v)
+		return
+	}
+	if b := s.next(8); b != nil {
+		*v = binary.LittleEndian.Uint64(b)
+	}
+}
+
+// Int serialises an int as a signed 64 bit value
+func (s *State) Int(v *int) {
+	value := uint64(int64(*v))
+	s.Uint64(&value)
+	*v = int(int64(value))
+}
+
+// Bytes serialises a buffer of fixed size, loading fails if the size in the snapshot differs
+func (s *State) Bytes(v []byte) {
+	size := uint32(len(v))
+	s.Uint32(&size)
+	if !s.loading {
+		s.data = append(s.data, v...)
+		return
+	}
+	if s.err == nil && int(size) != len(v) {
+		s.err = fmt.Errorf("size mismatch: expected %d bytes, got %d", len(v), size)
+		return
+	}
+	if b := s.next(len(v)); b != nil {
+		copy(v, b)
+	}
+}
+
+// Slice serialises a buffer of variable size, nil and empty slices are both loaded as nil
+func (s *State) Slice(v *[]byte) {
+	size := uint32(len(*v))
+	s.Uint32(&size)
+	if !s.loading {
+		s.data = append(s.data, *v...)
+		return
+	}
+	if b := s.next(int(size)); b != nil && size > 0 {
+		*v = append([]byte{}, b...)
+	} else {
+		*v = nil
+	}
+}
+
+// String serialises a string
+func (s *State) String(v *string) {
+	b := []byte(*v)
+	s.Slice(&b)
+	*v = string(b)
+}
@@ -0,0 +1,107 @@
+package speed
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// maxLag is how far the emulation may fall behind the wall clock before it gives up catching up, e.g. after
+// it was stopped. Catching up runs the frames in a burst.
+const maxLag = 100 * time.Millisecond
+
+// Controller paces the frames of the emulation to the wall clock. It waits after every frame until the next
+// one is due at the requested speed, in warp mode it doesn't wait at all. The speed can be changed from any
+// goroutine, Frame must only be called by the goroutine running the emulation.
+type Controller struct {
+	// frameDuration is the time of a frame at 100%
+	frameDuration time.Duration
+	percent       atomic.Int32
+	warp          atomic.Bool
+
+	// next is the time the next frame is due
+	next time.Time
+
+	// frames counts the frames since measureStart, measured holds the bits of the last measured speed
+	frames       int
+	measureStart time.Time
+	measured     atomic.Uint64
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// New returns a controller running the frames with the given duration at 100%
+func New(frameDuration time.Duration) *Controller {
+	c := &Controller{
+		frameDuration: frameDuration,
+		now:           time.Now,
+		sleep:         time.Sleep,
+	}
+	c.percent.Store(100)
+	return c
+}
+
+// SetPercent sets the speed in percent of the real machine
+func (c *Controller) SetPercent(percent int) error {
+	if percent <= 0 || percent > math.MaxInt32 {
+		return fmt.Errorf("invalid speed %d%%", percent)
+	}
+	c.percent.Store(int32(percent))
+	return nil
+}
+
+// Percent returns the requested speed in percent of the real machine
+func (c *Controller) Percent() int {
+	return int(c.percent.Load())
+}
+
+// SetWarp switches warp mode, the emulation then runs as fast as possible
+func (c *Controller) SetWarp(warp bool) {
+	c.warp.Store(warp)
+}
+
+// Warp returns true in warp mode
+func (c *Controller) Warp() bool {
+	return c.warp.Load()
+}
+
+// Measured returns the speed of the last second in percent of the real machine
+func (c *Controller) Measured() float64 {
+	return math.Float64frombits(c.measured.Load())
+}
+
+// Frame is called after every frame and waits until the next frame is due
+func (c *Controller) Frame() {
+	now := c.now()
+	c.measure(now)
+
+	if c.warp.Load() {
+		c.next = time.Time{}
+		return
+	}
+	if c.next.IsZero() || now.Sub(c.next) > maxLag {
+		c.next = now
+	}
+	c.next = c.next.Add(c.frameDuration * 100 / time.Duration(c.percent.Load()))
+	if wait := c.next.Sub(now); wait > 0 {
+		c.sleep(wait)
+	}
+}
+
+// measure updates the measured speed once per second
+func (c *Controller) measure(now time.Time) {
+	if c.measureStart.IsZero() {
+		c.measureStart = now
+		return
+	}
+	c.frames++
+	elapsed := now.Sub(c.measureStart)
+	if elapsed < time.Second {
+		return
+	}
+	percent := float64(time.Duration(c.frames)*c.frameDuration) / float64(elapsed) * 100
+	c.measured.Store(math.Float64bits(percent))
+	c.frames, c.measureStart = 0, now
+}
@@ -0,0 +1,88 @@
+package speed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+// fakeClock advances only when the controller sleeps or the test runs a frame
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func newTestController() (*Controller, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := New(20 * time.Millisecond)
+	c.now = func() time.Time { return clock.now }
+	c.sleep = func(d time.Duration) {
+		clock.slept = append(clock.slept, d)
+		clock.now = clock.now.Add(d)
+	}
+	return c, clock
+}
+
+func TestSpeed(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Speed controller", func() {
+		g.It("waits for the rest of the frame", func() {
+			c, clock := newTestController()
+			c.Frame()
+			clock.now = clock.now.Add(5 * time.Millisecond)
+			c.Frame()
+			g.Assert(clock.slept).Equal([]time.Duration{20 * time.Millisecond, 15 * time.Millisecond})
+		})
+
+		g.It("throttles to the requested percentage", func() {
+			c, clock := newTestController()
+			g.Assert(c.SetPercent(50)).IsNil()
+			c.Frame()
+			g.Assert(clock.slept).Equal([]time.Duration{40 * time.Millisecond})
+
+			g.Assert(c.SetPercent(200)).IsNil()
+			c.Frame()
+			g.Assert(clock.slept[1]).Equal(10 * time.Millisecond)
+			g.Assert(c.Percent()).Equal(200)
+		})
+
+		g.It("rejects invalid speeds", func() {
+			c, _ := newTestController()
+			g.Assert(c.SetPercent(0) != nil).IsTrue()
+			g.Assert(c.SetPercent(-5) != nil).IsTrue()
+			g.Assert(c.Percent()).Equal(100)
+		})
+
+		g.It("doesn't wait in warp mode", func() {
+			c, clock := newTestController()
+			c.SetWarp(true)
+			c.Frame()
+			c.Frame()
+			g.Assert(len(clock.slept)).Equal(0)
+			g.Assert(c.Warp()).IsTrue()
+		})
+
+		g.It("catches up small delays but not long stops", func() {
+			c, clock := newTestController()
+			c.Frame()
+			clock.now = clock.now.Add(50 * time.Millisecond)
+			c.Frame()
+			g.Assert(len(clock.slept)).Equal(1)
+
+			clock.now = clock.now.Add(time.Second)
+			c.Frame()
+			g.Assert(clock.slept[1]).Equal(20 * time.Millisecond)
+		})
+
+		g.It("measures the speed", func() {
+			c, _ := newTestController()
+			g.Assert(c.SetPercent(50)).IsNil()
+			for i := 0; i < 30; i++ {
+				c.Frame()
+			}
+			g.Assert(c.Measured()).Equal(50.0)
+		})
+	})
+}
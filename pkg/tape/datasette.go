@@ -0,0 +1,161 @@
+package tape
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+// Datasette emulates the Commodore 1530 tape drive. The tape only moves while PLAY is pressed and the computer
+// switched the motor on. The end of every pulse is signalled with Pulse, on the C64 this is the FLAG input of CIA1.
+type Datasette struct {
+	// Pulse is called for every pulse read from the tape
+	Pulse func()
+
+	// lock protects the state against the controls being used from outside the emulation goroutine
+	lock    sync.Mutex
+	tape    *TAP
+	playing bool
+	motor   bool
+	// position is the index of the next pulse, remaining the number of cycles left of the current one
+	position  int
+	remaining uint32
+	// moving is set while the tape moves, so that Tick doesn't have to take the lock on every cycle
+	moving atomic.Bool
+}
+
+// update has to be called with the lock held whenever the buttons or the motor changed
+func (d *Datasette) update() {
+	d.moving.Store(d.playing && d.motor)
+}
+
+// Insert puts a tape into the datasette, the tape is rewound
+func (d *Datasette) Insert(t *TAP) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.tape = t
+	d.playing = false
+	d.position, d.remaining = 0, 0
+	d.update()
+}
+
+// Eject removes the tape
+func (d *Datasette) Eject() {
+	d.Insert(nil)
+}
+
+// Tape returns the inserted tape or nil
+func (d *Datasette) Tape() *TAP {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.tape
+}
+
+// Play presses the PLAY button
+func (d *Datasette) Play() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.playing = d.tape != nil
+	d.update()
+}
+
+// Stop presses the STOP button
+func (d *Datasette) Stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.playing = false
+	d.update()
+}
+
+// Rewind stops playing and winds the tape back to the start
+func (d *Datasette) Rewind() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.playing = false
+	d.position, d.remaining = 0, 0
+	d.update()
+}
+
+// Position returns the index of the next pulse on the tape
+func (d *Datasette) Position() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.position
+}
+
+// Sense returns true while a button is pressed, this is the cassette sense line of the C64
+func (d *Datasette) Sense() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.playing
+}
+
+// SetMotor switches the motor on or off
+func (d *Datasette) SetMotor(on bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.motor = on
+	d.update()
+}
+
+// Tick advances the tape by one CPU cycle
+func (d *Datasette) Tick() {
+	if !d.moving.Load() {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.playing || !d.motor {
+		return
+	}
+
+	if d.remaining > 1 {
+		d.remaining--
+		return
+	}
+	if d.remaining == 1 && d.Pulse != nil {
+		d.Pulse()
+	}
+
+	if d.position >= len(d.tape.Pulses) {
+		// the PLAY button pops up at the end of the tape
+		d.playing = false
+		d.remaining = 0
+		d.update()
+		return
+	}
+	d.remaining = d.tape.Pulses[d.position]
+	d.position++
+}
+
+// State saves or restores the buttons, the motor and the tape including its position
+func (d *Datasette) State(s *snapshot.State) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	inserted := d.tape != nil
+	s.Bool(&inserted)
+	if inserted {
+		if s.Loading() {
+			d.tape = &TAP{}
+		}
+		d.tape.state(s)
+	} else {
+		d.tape = nil
+	}
+	s.Bool(&d.playing)
+	s.Bool(&d.motor)
+	s.Int(&d.position)
+	s.Uint32(&d.remaining)
+	d.update()
+}
@@ -0,0 +1,179 @@
+package tape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// T64 is a container for the files of a tape, it doesn't hold any timing information
+// http://unusedino.de/ec64/technical/formats/t64.html
+
+const (
+	t64Signature = "C64"
+	t64HeaderLen = 0x40
+	t64EntryLen  = 0x20
+)
+
+// Entry types of a T64 directory entry
+const (
+	EntryFree     byte = 0
+	EntryNormal   byte = 1
+	EntrySnapshot byte = 3
+)
+
+// T64 is a parsed T64 image
+type T64 struct {
+	Name    string
+	Entries []T64Entry
+	Path    string
+
+	data []byte
+}
+
+// T64Entry is a file in a T64 image
+type T64Entry struct {
+	Name         string
+	EntryType    byte
+	FileType     byte
+	StartAddress uint16
+	// EndAddress is the address behind the last byte, it's corrected if the image has a broken value
+	EndAddress uint16
+	// EndAddressFixed is true if the end address stored in the image was wrong
+	EndAddressFixed bool
+	Offset          int
+}
+
+// Size returns the number of data bytes of the entry
+func (e T64Entry) Size() int {
+	return int(e.EndAddress) - int(e.StartAddress)
+}
+
+// LoadT64 reads a T64 image from a file
+func LoadT64(path string) (*T64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := ParseT64(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t.Path = path
+	return t, nil
+}
+
+// ParseT64 parses a T64 image. Many tools wrote wrong end addresses, so the size of every entry is checked
+// against the offset of the next entry and the size of the image.
+func ParseT64(data []byte) (*T64, error) {
+	if len(data) < t64HeaderLen || string(data[:3]) != t64Signature {
+		return nil, fmt.Errorf("not a T64 image")
+	}
+
+	maxEntries := int(binary.LittleEndian.Uint16(data[0x22:]))
+	if maxEntries == 0 {
+		// some images only fill in the used entries
+		maxEntries = int(binary.LittleEndian.Uint16(data[0x24:]))
+	}
+	if t64HeaderLen+maxEntries*t64EntryLen > len(data) {
+		return nil, fmt.Errorf("T64 directory truncated")
+	}
+
+	t := &T64{
+		Name: petsciiName(data[0x28:0x40]),
+		data: data,
+	}
+	for i := 0; i < maxEntries; i++ {
+		raw := data[t64HeaderLen+i*t64EntryLen:]
+		if raw[0] == EntryFree {
+			continue
+		}
+
+		entry := T64Entry{
+			EntryType:    raw[0],
+			FileType:     raw[1],
+			StartAddress: binary.LittleEndian.Uint16(raw[2:]),
+			EndAddress:   binary.LittleEndian.Uint16(raw[4:]),
+			Offset:       int(binary.LittleEndian.Uint32(raw[8:])),
+			Name:         petsciiName(raw[0x10:0x20]),
+		}
+		if entry.Offset < t64HeaderLen+maxEntries*t64EntryLen || entry.Offset >= len(data) {
+			return nil, fmt.Errorf("T64 entry %d has an invalid offset: 0x%x", i, entry.Offset)
+		}
+		t.Entries = append(t.Entries, entry)
+	}
+
+	t.fixEndAddresses()
+	return t, nil
+}
+
+// fixEndAddresses limits every entry to the data up to the next entry or the end of the image
+func (t *T64) fixEndAddresses() {
+	byOffset := make([]*T64Entry, len(t.Entries))
+	for i := range t.Entries {
+		byOffset[i] = &t.Entries[i]
+	}
+	sort.SliceStable(byOffset, func(i, j int) bool { return byOffset[i].Offset < byOffset[j].Offset })
+
+	for i, entry := range byOffset {
+		available := len(t.data) - entry.Offset
+		if i+1 < len(byOffset) {
+			available = byOffset[i+1].Offset - entry.Offset
+		}
+		if available > 0x10000-int(entry.StartAddress) {
+			available = 0x10000 - int(entry.StartAddress)
+		}
+
+		// the most common error is an end address of $c3c6 written by old converters
+		if size := entry.Size(); size <= 0 || size > available {
+			entry.EndAddress = uint16(int(entry.StartAddress) + available)
+			entry.EndAddressFixed = true
+		}
+	}
+}
+
+// Find returns the first entry matching the name, an empty name matches any entry and a '*' matches the
+// rest of the name like on the C64
+func (t *T64) Find(name string) (*T64Entry, bool) {
+	for i := range t.Entries {
+		if MatchName(name, t.Entries[i].Name) {
+			return &t.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// PRG returns the entry as PRG file: the start address followed by the data
+func (t *T64) PRG(e *T64Entry) []byte {
+	prg := binary.LittleEndian.AppendUint16(nil, e.StartAddress)
+	return append(prg, t.data[e.Offset:e.Offset+e.Size()]...)
+}
+
+// MatchName compares a file name with a pattern as the KERNAL does, '?' matches any character and '*'
+// the rest of the name
+func MatchName(pattern string, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '*':
+			return true
+		case i >= len(name):
+			return false
+		case pattern[i] != '?' && pattern[i] != name[i]:
+			return false
+		}
+	}
+	return len(pattern) == len(name)
+}
+
+// petsciiName strips the padding of a file name
+func petsciiName(raw []byte) string {
+	raw = bytes.TrimRight(raw, "\x00")
+	return strings.TrimRight(string(bytes.ReplaceAll(raw, []byte{0xa0}, []byte{0x20})), " ")
+}
@@ -0,0 +1,126 @@
+package tape
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/gentoomaniac/go64/pkg/snapshot"
+)
+
+// TAP stores the length of every pulse read from a tape in CPU cycles
+// http://unusedino.de/ec64/technical/formats/tap.html
+
+const (
+	tapSignature = "C64-TAPE-RAW"
+	tapHeaderLen = 20
+	// overflowCycles is the length of a pulse stored as 0 in a version 0 image
+	overflowCycles = 256 * 8
+)
+
+// Platforms stored in the header of a TAP image
+const (
+	PlatformC64   byte = 0
+	PlatformVIC20 byte = 1
+	PlatformC16   byte = 2
+)
+
+// TAP is a parsed TAP image
+type TAP struct {
+	Version  byte
+	Platform byte
+	// Video is 0 for PAL and 1 for NTSC recordings
+	Video byte
+	// Pulses holds the length of every pulse in cycles of the recording machine
+	Pulses []uint32
+	Path   string
+}
+
+// LoadTAP reads a TAP image from a file
+func LoadTAP(path string) (*TAP, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := ParseTAP(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t.Path = path
+	return t, nil
+}
+
+// ParseTAP parses a version 0, 1 or 2 TAP image. Version 2 images store half waves, two of them are combined
+// into one pulse as only full waves trigger the FLAG input of the C64.
+func ParseTAP(data []byte) (*TAP, error) {
+	if len(data) < tapHeaderLen || string(data[:12]) != tapSignature {
+		return nil, fmt.Errorf("not a TAP image")
+	}
+
+	t := &TAP{
+		Version:  data[12],
+		Platform: data[13],
+		Video:    data[14],
+	}
+	if t.Version > 2 {
+		return nil, fmt.Errorf("unsupported TAP version %d", t.Version)
+	}
+
+	length := int(binary.LittleEndian.Uint32(data[16:]))
+	body := data[tapHeaderLen:]
+	if length < len(body) {
+		body = body[:length]
+	}
+
+	halfWave := false
+	for i := 0; i < len(body); i++ {
+		pulse := uint32(body[i]) * 8
+		if body[i] == 0 {
+			if t.Version == 0 {
+				pulse = overflowCycles
+			} else {
+				if i+3 >= len(body) {
+					return nil, fmt.Errorf("TAP pulse at offset %d truncated", tapHeaderLen+i)
+				}
+				pulse = uint32(body[i+1]) | uint32(body[i+2])<<8 | uint32(body[i+3])<<16
+				i += 3
+			}
+		}
+
+		if t.Version == 2 {
+			if halfWave {
+				t.Pulses[len(t.Pulses)-1] += pulse
+				halfWave = false
+				continue
+			}
+			halfWave = true
+		}
+		t.Pulses = append(t.Pulses, pulse)
+	}
+
+	return t, nil
+}
+
+func (t *TAP) state(s *snapshot.State) {
+	s.Byte(&t.Version)
+	s.Byte(&t.Platform)
+	s.Byte(&t.Video)
+	s.String(&t.Path)
+
+	count := uint32(len(t.Pulses))
+	s.Uint32(&count)
+	if s.Loading() {
+		t.Pulses = nil
+	}
+	for i := 0; i < int(count) && s.Err() == nil; i++ {
+		var pulse uint32
+		if !s.Loading() {
+			pulse = t.Pulses[i]
+		}
+		s.Uint32(&pulse)
+		if s.Loading() {
+			t.Pulses = append(t.Pulses, pulse)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package tape
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func newTestImage(version byte, data ...byte) []byte {
+	image := append([]byte(tapSignature), version, PlatformC64, 0, 0)
+	image = binary.LittleEndian.AppendUint32(image, uint32(len(data)))
+	return append(image, data...)
+}
+
+func TestTAP(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("TAP parser", func() {
+		g.It("rejects other files", func() {
+			_, err := ParseTAP([]byte("C64File\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+			g.Assert(err != nil).IsTrue()
+			_, err = ParseTAP(newTestImage(3, 0x30))
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("parses version 0 images", func() {
+			tap, err := ParseTAP(newTestImage(0, 0x30, 0x00, 0x42))
+			g.Assert(err).IsNil()
+			g.Assert(tap.Pulses).Equal([]uint32{0x180, overflowCycles, 0x210})
+		})
+
+		g.It("parses long pulses of version 1 images", func() {
+			tap, err := ParseTAP(newTestImage(1, 0x30, 0x00, 0x56, 0x34, 0x12, 0x42))
+			g.Assert(err).IsNil()
+			g.Assert(tap.Pulses).Equal([]uint32{0x180, 0x123456, 0x210})
+
+			_, err = ParseTAP(newTestImage(1, 0x30, 0x00, 0x56))
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("combines the half waves of version 2 images", func() {
+			tap, err := ParseTAP(newTestImage(2, 0x18, 0x18, 0x20, 0x00, 0x00, 0x01, 0x00))
+			g.Assert(err).IsNil()
+			g.Assert(tap.Pulses).Equal([]uint32{0x180, 0x200})
+		})
+
+		g.It("ignores data behind the announced length", func() {
+			image := append(newTestImage(1, 0x30), 0x40, 0x50)
+			tap, err := ParseTAP(image)
+			g.Assert(err).IsNil()
+			g.Assert(tap.Pulses).Equal([]uint32{0x180})
+		})
+	})
+}
+
+func TestDatasette(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Datasette", func() {
+		g.It("signals the end of every pulse", func() {
+			d := &Datasette{}
+			pulses := []int{}
+			cycle := 0
+			d.Pulse = func() { pulses = append(pulses, cycle) }
+			d.Insert(&TAP{Pulses: []uint32{3, 5, 2}})
+			d.Play()
+			d.SetMotor(true)
+
+			for cycle = 0; cycle < 20; cycle++ {
+				d.Tick()
+			}
+			g.Assert(pulses).Equal([]int{3, 8, 10})
+			g.Assert(d.Sense()).IsFalse()
+		})
+
+		g.It("only moves the tape with the motor on", func() {
+			d := &Datasette{}
+			count := 0
+			d.Pulse = func() { count++ }
+			d.Insert(&TAP{Pulses: []uint32{2, 2, 2}})
+			d.Play()
+			g.Assert(d.Sense()).IsTrue()
+
+			for i := 0; i < 10; i++ {
+				d.Tick()
+			}
+			g.Assert(count).Equal(0)
+
+			d.SetMotor(true)
+			for i := 0; i < 3; i++ {
+				d.Tick()
+			}
+			d.SetMotor(false)
+			for i := 0; i < 10; i++ {
+				d.Tick()
+			}
+			g.Assert(count).Equal(1)
+			g.Assert(d.Position()).Equal(2)
+		})
+
+		g.It("stops and rewinds", func() {
+			d := &Datasette{}
+			d.Insert(&TAP{Pulses: []uint32{2, 2, 2}})
+			d.Play()
+			d.SetMotor(true)
+			d.Tick()
+			d.Tick()
+			d.Tick()
+			d.Stop()
+			g.Assert(d.Sense()).IsFalse()
+			g.Assert(d.Position()).Equal(2)
+
+			d.Rewind()
+			g.Assert(d.Position()).Equal(0)
+		})
+
+		g.It("can't play without a tape", func() {
+			d := &Datasette{}
+			d.Play()
+			g.Assert(d.Sense()).IsFalse()
+		})
+	})
+}
+
+type testT64Entry struct {
+	name       string
+	start, end uint16
+	data       []byte
+}
+
+func newTestT64(entries ...testT64Entry) []byte {
+	image := make([]byte, t64HeaderLen+len(entries)*t64EntryLen)
+	copy(image, "C64 tape image file")
+	binary.LittleEndian.PutUint16(image[0x20:], 0x0101)
+	binary.LittleEndian.PutUint16(image[0x22:], uint16(len(entries)))
+	binary.LittleEndian.PutUint16(image[0x24:], uint16(len(entries)))
+	copy(image[0x28:], "TEST TAPE               ")
+
+	for i, e := range entries {
+		raw := image[t64HeaderLen+i*t64EntryLen:]
+		raw[0] = EntryNormal
+		raw[1] = 0x82
+		binary.LittleEndian.PutUint16(raw[2:], e.start)
+		binary.LittleEndian.PutUint16(raw[4:], e.end)
+		binary.LittleEndian.PutUint32(raw[8:], uint32(len(image)))
+		copy(raw[0x10:0x20], e.name+"                ")
+		image = append(image, e.data...)
+	}
+	return image
+}
+
+func TestT64(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("T64 parser", func() {
+		g.It("lists the entries", func() {
+			archive, err := ParseT64(newTestT64(
+				testT64Entry{"FIRST", 0x0801, 0x0804, []byte{1, 2, 3}},
+				testT64Entry{"SECOND", 0xc000, 0xc002, []byte{4, 5}},
+			))
+			g.Assert(err).IsNil()
+			g.Assert(archive.Name).Equal("TEST TAPE")
+			g.Assert(len(archive.Entries)).Equal(2)
+			g.Assert(archive.Entries[1].Name).Equal("SECOND")
+			g.Assert(archive.Entries[1].EndAddressFixed).IsFalse()
+		})
+
+		g.It("extracts entries as PRG", func() {
+			archive, _ := ParseT64(newTestT64(
+				testT64Entry{"FIRST", 0x0801, 0x0804, []byte{1, 2, 3}},
+				testT64Entry{"SECOND", 0xc000, 0xc002, []byte{4, 5}},
+			))
+			entry, ok := archive.Find("SEC*")
+			g.Assert(ok).IsTrue()
+			g.Assert(archive.PRG(entry)).Equal([]byte{0x00, 0xc0, 4, 5})
+		})
+
+		g.It("fixes broken end addresses", func() {
+			archive, err := ParseT64(newTestT64(
+				testT64Entry{"BROKEN", 0x0801, 0xc3c6, []byte{1, 2, 3}},
+				testT64Entry{"SHORT", 0x1000, 0x0fff, []byte{4, 5}},
+			))
+			g.Assert(err).IsNil()
+			g.Assert(archive.Entries[0].EndAddress).Equal(uint16(0x0804))
+			g.Assert(archive.Entries[0].EndAddressFixed).IsTrue()
+			g.Assert(archive.Entries[1].EndAddress).Equal(uint16(0x1002))
+			g.Assert(archive.PRG(&archive.Entries[0])).Equal([]byte{0x01, 0x08, 1, 2, 3})
+		})
+
+		g.It("rejects entries outside of the image", func() {
+			image := newTestT64(testT64Entry{"FIRST", 0x0801, 0x0804, []byte{1, 2, 3}})
+			binary.LittleEndian.PutUint32(image[t64HeaderLen+8:], 0x1000)
+			_, err := ParseT64(image)
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+
+	g.Describe("File name matching", func() {
+		g.It("matches like the KERNAL", func() {
+			g.Assert(MatchName("", "GAME")).IsTrue()
+			g.Assert(MatchName("GAME", "GAME")).IsTrue()
+			g.Assert(MatchName("GA*", "GAME")).IsTrue()
+			g.Assert(MatchName("G?ME", "GAME")).IsTrue()
+			g.Assert(MatchName("GAM", "GAME")).IsFalse()
+			g.Assert(MatchName("GAMES", "GAME")).IsFalse()
+		})
+	})
+}
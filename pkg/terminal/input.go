@@ -0,0 +1,97 @@
+package terminal
+
+import (
+	"unicode/utf8"
+
+	"github.com/gentoomaniac/go64/pkg/c64"
+)
+
+const (
+	escape = 0x1b
+	// quit is Ctrl-D, Ctrl-C is the RUN/STOP key
+	quit = 0x04
+)
+
+// characters maps the characters typed on the terminal to the keys typing them on the C64, lower case letters
+// are the unshifted ones
+var characters = map[rune][]c64.Key{
+	' ': {c64.KeySpace}, '\r': {c64.KeyReturn}, '\n': {c64.KeyReturn},
+	0x7f: {c64.KeyDelete}, 0x08: {c64.KeyDelete}, 0x03: {c64.KeyRunStop},
+
+	'!': shifted(c64.Key1), '"': shifted(c64.Key2), '#': shifted(c64.Key3), '$': shifted(c64.Key4),
+	'%': shifted(c64.Key5), '&': shifted(c64.Key6), '\'': shifted(c64.Key7), '(': shifted(c64.Key8),
+	')': shifted(c64.Key9), '<': shifted(c64.KeyComma), '>': shifted(c64.KeyPeriod), '?': shifted(c64.KeySlash),
+	'[': shifted(c64.KeyColon), ']': shifted(c64.KeySemicolon),
+
+	'+': {c64.KeyPlus}, '-': {c64.KeyMinus}, '*': {c64.KeyAsterisk}, '/': {c64.KeySlash},
+	'=': {c64.KeyEquals}, ':': {c64.KeyColon}, ';': {c64.KeySemicolon}, ',': {c64.KeyComma},
+	'.': {c64.KeyPeriod}, '@': {c64.KeyAt}, '^': {c64.KeyUpArrow}, '_': {c64.KeyLeftArrow},
+	'£': {c64.KeyPound},
+}
+
+// sequences maps the escape sequences of the special keys without the leading ESC, F2, F4, F6 and F8 are
+// the shifted function keys on the C64
+var sequences = map[string][]c64.Key{
+	"[A": shifted(c64.KeyCursorDown), "[B": {c64.KeyCursorDown},
+	"[C": {c64.KeyCursorRight}, "[D": shifted(c64.KeyCursorRight),
+	"[H": {c64.KeyHome}, "[1~": {c64.KeyHome}, "[2~": shifted(c64.KeyDelete), "[3~": {c64.KeyDelete},
+	"OP": {c64.KeyF1}, "OQ": shifted(c64.KeyF1), "OR": {c64.KeyF3}, "OS": shifted(c64.KeyF3),
+	"[15~": {c64.KeyF5}, "[17~": shifted(c64.KeyF5), "[18~": {c64.KeyF7}, "[19~": shifted(c64.KeyF7),
+}
+
+func init() {
+	letters := []c64.Key{
+		c64.KeyA, c64.KeyB, c64.KeyC, c64.KeyD, c64.KeyE, c64.KeyF, c64.KeyG, c64.KeyH, c64.KeyI,
+		c64.KeyJ, c64.KeyK, c64.KeyL, c64.KeyM, c64.KeyN, c64.KeyO, c64.KeyP, c64.KeyQ, c64.KeyR,
+		c64.KeyS, c64.KeyT, c64.KeyU, c64.KeyV, c64.KeyW, c64.KeyX, c64.KeyY, c64.KeyZ,
+	}
+	for i, key := range letters {
+		characters['a'+rune(i)] = []c64.Key{key}
+		characters['A'+rune(i)] = shifted(key)
+	}
+	digits := []c64.Key{
+		c64.Key0, c64.Key1, c64.Key2, c64.Key3, c64.Key4, c64.Key5, c64.Key6, c64.Key7, c64.Key8, c64.Key9,
+	}
+	for i, key := range digits {
+		characters['0'+rune(i)] = []c64.Key{key}
+	}
+}
+
+func shifted(key c64.Key) []c64.Key {
+	return []c64.Key{c64.KeyLeftShift, key}
+}
+
+// parse returns the keystrokes of the input read from the terminal and true if Ctrl-D was pressed. An ESC
+// alone is the RUN/STOP key, unknown characters and sequences are ignored.
+func parse(input []byte) ([][]c64.Key, bool) {
+	var keystrokes [][]c64.Key
+	for len(input) > 0 {
+		switch {
+		case input[0] == quit:
+			return keystrokes, true
+		case input[0] == escape && len(input) > 1 && (input[1] == '[' || input[1] == 'O'):
+			// the sequences end with a character from @ to ~
+			end := 2
+			for end < len(input) && (input[end] < '@' || input[end] > '~') {
+				end++
+			}
+			if end < len(input) {
+				end++
+			}
+			if keys, ok := sequences[string(input[1:end])]; ok {
+				keystrokes = append(keystrokes, keys)
+			}
+			input = input[end:]
+		case input[0] == escape:
+			keystrokes = append(keystrokes, []c64.Key{c64.KeyRunStop})
+			input = input[1:]
+		default:
+			r, size := utf8.DecodeRune(input)
+			if keys, ok := characters[r]; ok {
+				keystrokes = append(keystrokes, keys)
+			}
+			input = input[size:]
+		}
+	}
+	return keystrokes, false
+}
@@ -0,0 +1,37 @@
+package terminal
+
+// The screen codes 0 to 127 of both character sets mapped to the closest Unicode characters found in common
+// terminal fonts, the codes from 128 on are the same characters in reverse.
+// https://www.c64-wiki.com/wiki/Character_set
+
+// uppercase is the upper case and graphics set selected after power on
+var uppercase = [128]rune{
+	'@', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', '[', '£', ']', '↑', '←',
+	' ', '!', '"', '#', '$', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'─', '♠', '│', '─', '─', '─', '─', '│', '│', '╮', '╰', '╯', '└', '╲', '╱', '┌',
+	'┐', '●', '─', '♥', '│', '╭', '╳', '○', '♣', '│', '♦', '┼', '▒', '│', 'π', '◥',
+	' ', '▌', '▄', '▔', '▁', '▏', '▒', '▕', '▒', '◤', '▕', '├', '▗', '└', '┐', '▂',
+	'┌', '┴', '┬', '┤', '▎', '▍', '▐', '▔', '▀', '▃', '┘', '▖', '▝', '┘', '▘', '▚',
+}
+
+// lowercase is the set with lower and upper case letters selected with Commodore-Shift
+var lowercase = [128]rune{
+	'@', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', '[', '£', ']', '↑', '←',
+	' ', '!', '"', '#', '$', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'─', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', '┼', '▒', '│', '▒', '▒',
+	' ', '▌', '▄', '▔', '▁', '▏', '▒', '▕', '▒', '▒', '▕', '├', '▗', '└', '┐', '▂',
+	'┌', '┴', '┬', '┤', '▎', '▍', '▐', '▔', '▀', '▃', '✓', '▖', '▝', '┘', '▘', '▚',
+}
+
+// glyph returns the character of the screen code and whether it is shown in reverse
+func glyph(code byte, lower bool) (rune, bool) {
+	if lower {
+		return lowercase[code&0x7f], code&0x80 != 0
+	}
+	return uppercase[code&0x7f], code&0x80 != 0
+}
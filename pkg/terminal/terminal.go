@@ -0,0 +1,182 @@
+// Package terminal presents the text screen of the C64 on a terminal with ANSI escape sequences and types the
+// keys pressed on the terminal into the keyboard matrix, so BASIC can be used over SSH.
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gentoomaniac/go64/pkg/c64"
+	"github.com/gentoomaniac/go64/pkg/host"
+)
+
+const (
+	// holdFrames and releaseFrames are the frames a typed key is held down and released, the KERNAL scans
+	// the keyboard 60 times per second
+	holdFrames    = 2
+	releaseFrames = 1
+	// typeAhead is the number of keystrokes buffered while the previous ones are typed
+	typeAhead = 64
+)
+
+// Terminal is a host drawing the text screen on a terminal in raw mode, it can't play the audio
+type Terminal struct {
+	host.Headless
+	in  io.Reader
+	out io.Writer
+
+	// typed holds the keystrokes read from the terminal, every one is a list of keys pressed together
+	typed chan []c64.Key
+	// holding are the keys currently pressed and wait the frames until they are released or the next
+	// keystroke is pressed
+	holding []c64.Key
+	wait    int
+
+	// mutex protects the output, nothing is drawn once the terminal is closed
+	mutex  sync.Mutex
+	closed bool
+	// last is the screen on the terminal, drawn is false until the first frame
+	last  host.Text
+	drawn bool
+}
+
+// New returns a terminal drawing the screen on out and typing the keys read from in
+func New(in io.Reader, out io.Writer) *Terminal {
+	return &Terminal{
+		in:    in,
+		out:   out,
+		typed: make(chan []c64.Key, typeAhead),
+	}
+}
+
+// FrameReady draws the text screen of the frame if it changed, the pixels aren't used
+func (t *Terminal) FrameReady(frame *host.Frame) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed || t.drawn && *frame.Text == t.last {
+		return
+	}
+	if !t.drawn {
+		// hide the cursor and clear the terminal
+		fmt.Fprint(t.out, "\x1b[?25l\x1b[2J")
+	}
+	t.out.Write(render(frame.Text))
+	t.last, t.drawn = *frame.Text, true
+}
+
+// FrameDone ends the emulation once the terminal is closed
+func (t *Terminal) FrameDone() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return !t.closed
+}
+
+// Run reads the keystrokes from the terminal until Ctrl-D is pressed or the input ends
+func (t *Terminal) Run() error {
+	defer t.Close()
+
+	buffer := make([]byte, 256)
+	for {
+		n, err := t.in.Read(buffer)
+		keystrokes, quit := parse(buffer[:n])
+		for _, keys := range keystrokes {
+			t.typed <- keys
+		}
+		if quit || err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close stops drawing and restores the colors and the cursor of the terminal, e.g. before the emulator exits
+// while Run still waits for a keystroke. Only the first call writes to the terminal.
+func (t *Terminal) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	fmt.Fprint(t.out, "\x1b[0m\x1b[?25h\r\n")
+}
+
+// Events presses the next keystroke once the previous one was held and released long enough
+func (t *Terminal) Events() []host.Event {
+	if t.wait > 0 {
+		t.wait--
+		return nil
+	}
+	if t.holding != nil {
+		events := make([]host.Event, len(t.holding))
+		for i, key := range t.holding {
+			events[i] = host.Event{Type: host.KeyUp, Key: key}
+		}
+		t.holding, t.wait = nil, releaseFrames-1
+		return events
+	}
+	select {
+	case keys := <-t.typed:
+		events := make([]host.Event, len(keys))
+		for i, key := range keys {
+			events[i] = host.Event{Type: host.KeyDown, Key: key}
+		}
+		t.holding, t.wait = keys, holdFrames-1
+		return events
+	default:
+		return nil
+	}
+}
+
+// render returns the escape sequences drawing the text screen surrounded by a border of one character
+func render(text *host.Text) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x1b[H")
+	var foreground, background byte = 0xff, 0xff
+	cell := func(r rune, fg byte, bg byte) {
+		if fg != foreground {
+			color := c64.Palette[fg]
+			fmt.Fprintf(&b, "\x1b[38;2;%d;%d;%dm", color.R, color.G, color.B)
+			foreground = fg
+		}
+		if bg != background {
+			color := c64.Palette[bg]
+			fmt.Fprintf(&b, "\x1b[48;2;%d;%d;%dm", color.R, color.G, color.B)
+			background = bg
+		}
+		b.WriteRune(r)
+	}
+	// the colors of the spaces don't matter, they keep the foreground
+	borderLine := func() {
+		for column := 0; column < host.TextColumns+2; column++ {
+			cell(' ', foreground&0x0f, text.Border)
+		}
+	}
+
+	borderLine()
+	for row := 0; row < host.TextRows; row++ {
+		b.WriteString("\r\n")
+		cell(' ', foreground&0x0f, text.Border)
+		for column := 0; column < host.TextColumns; column++ {
+			if text.Blank {
+				cell(' ', foreground&0x0f, text.Border)
+				continue
+			}
+			offset := row*host.TextColumns + column
+			r, reverse := glyph(text.Codes[offset], text.Lowercase)
+			if reverse {
+				cell(r, text.Background, text.Colors[offset])
+			} else {
+				cell(r, text.Colors[offset], text.Background)
+			}
+		}
+		cell(' ', foreground&0x0f, text.Border)
+	}
+	b.WriteString("\r\n")
+	borderLine()
+	return b.Bytes()
+}
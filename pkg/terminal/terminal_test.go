@@ -0,0 +1,123 @@
+package terminal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+
+	"github.com/gentoomaniac/go64/pkg/c64"
+	"github.com/gentoomaniac/go64/pkg/host"
+)
+
+func TestTerminal(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Input", func() {
+		g.It("maps characters to keys", func() {
+			keystrokes, quit := parse([]byte("aB1!\r£"))
+			g.Assert(quit).IsFalse()
+			g.Assert(keystrokes).Equal([][]c64.Key{
+				{c64.KeyA}, {c64.KeyLeftShift, c64.KeyB}, {c64.Key1}, {c64.KeyLeftShift, c64.Key1},
+				{c64.KeyReturn}, {c64.KeyPound},
+			})
+		})
+
+		g.It("maps escape sequences to keys", func() {
+			keystrokes, _ := parse([]byte("\x1b[A\x1bOP\x1b[17~\x1b[99~\x1b"))
+			g.Assert(keystrokes).Equal([][]c64.Key{
+				{c64.KeyLeftShift, c64.KeyCursorDown}, {c64.KeyF1}, {c64.KeyLeftShift, c64.KeyF5},
+				{c64.KeyRunStop},
+			})
+		})
+
+		g.It("quits on Ctrl-D", func() {
+			keystrokes, quit := parse([]byte("x\x04y"))
+			g.Assert(quit).IsTrue()
+			g.Assert(keystrokes).Equal([][]c64.Key{{c64.KeyX}})
+		})
+
+		g.It("types the keystrokes frame by frame", func() {
+			keyboard := &c64.Keyboard{}
+			term := New(strings.NewReader("aA"), &bytes.Buffer{})
+			g.Assert(term.Run()).IsNil()
+
+			var pressed []string
+			for i := 0; i < 7; i++ {
+				for _, event := range term.Events() {
+					if event.Type == host.KeyDown {
+						keyboard.Press(event.Key)
+					} else {
+						keyboard.Release(event.Key)
+					}
+				}
+				switch {
+				case keyboard.Pressed(c64.KeyLeftShift) && keyboard.Pressed(c64.KeyA):
+					pressed = append(pressed, "A")
+				case keyboard.Pressed(c64.KeyA):
+					pressed = append(pressed, "a")
+				default:
+					pressed = append(pressed, "-")
+				}
+			}
+			g.Assert(strings.Join(pressed, "")).Equal("aa-AA--")
+		})
+	})
+
+	g.Describe("Output", func() {
+		g.It("renders the text screen with colors", func() {
+			text := &host.Text{}
+			text.Codes[0] = 0x01
+			text.Codes[1] = 0x82
+			text.Colors[0] = 0x01
+			text.Colors[1] = 0x02
+			text.Background = 0x06
+			text.Border = 0x0e
+
+			screen := string(render(text))
+			g.Assert(strings.HasPrefix(screen, "\x1b[H")).IsTrue()
+			g.Assert(strings.Count(screen, "\r\n")).Equal(host.TextRows + 1)
+			// white A on blue, reverse B as blue on red
+			g.Assert(strings.Contains(screen, "\x1b[38;2;255;255;255m\x1b[48;2;53;40;121mA")).IsTrue()
+			g.Assert(strings.Contains(screen, "\x1b[38;2;53;40;121m\x1b[48;2;104;55;43mB")).IsTrue()
+
+			text.Lowercase = true
+			g.Assert(strings.Contains(string(render(text)), "a")).IsTrue()
+			text.Blank = true
+			g.Assert(strings.ContainsAny(string(render(text)), "aAB")).IsFalse()
+		})
+
+		g.It("only draws changed screens until it is closed", func() {
+			frame := &host.Frame{Text: &host.Text{}}
+			var out bytes.Buffer
+			term := New(strings.NewReader(""), &out)
+			term.FrameReady(frame)
+			g.Assert(strings.HasPrefix(out.String(), "\x1b[?25l\x1b[2J")).IsTrue()
+			drawn := out.Len()
+			term.FrameReady(frame)
+			g.Assert(out.Len()).Equal(drawn)
+			frame.Text.Codes[0] = 0x01
+			term.FrameReady(frame)
+			g.Assert(out.Len() > drawn).IsTrue()
+			g.Assert(term.FrameDone()).IsTrue()
+
+			g.Assert(term.Run()).IsNil()
+			g.Assert(term.FrameDone()).IsFalse()
+			closed := out.Len()
+			frame.Text.Codes[0] = 0x02
+			term.FrameReady(frame)
+			g.Assert(out.Len()).Equal(closed)
+		})
+
+		g.It("restores the terminal only once", func() {
+			var out bytes.Buffer
+			term := New(strings.NewReader(""), &out)
+			term.Close()
+			g.Assert(out.String()).Equal("\x1b[0m\x1b[?25h\r\n")
+			g.Assert(term.FrameDone()).IsFalse()
+			g.Assert(term.Run()).IsNil()
+			g.Assert(out.String()).Equal("\x1b[0m\x1b[?25h\r\n")
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/gentoomaniac/go64/pkg/disasm"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+// Format selects the layout of the trace lines
+type Format int
+
+const (
+	// Default lines hold the cycle, the disassembly, the registers and the raster position:
+	//      123456  fce2  a2 ff     LDX #$ff         a:00 x:00 y:00 s:fd p:24  000/12
+	Default Format = iota
+	// VICE lines match the CPU history of the VICE monitor (chis), the cycle is the last column:
+	// .C:fce2  A2 FF       LDX #$FF       - A:00 X:00 Y:00 SP:fd ..-..I..     123456
+	VICE
+)
+
+// ParseFormat returns the format with the given name, "default" or "vice"
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "default", "":
+		return Default, nil
+	case "vice":
+		return VICE, nil
+	}
+	return Default, fmt.Errorf("unknown trace format %q", name)
+}
+
+// Tracer writes a line for every executed instruction. It is safe to flush it while the emulation runs.
+type Tracer struct {
+	Format Format
+	// Start and End limit the trace to instructions in the inclusive address range
+	Start, End uint16
+	// Triggered delays the trace until a trace breakpoint was hit
+	Triggered bool
+
+	mutex sync.Mutex
+	w     *bufio.Writer
+	err   error
+}
+
+// New returns a tracer writing all instructions to w
+func New(w io.Writer, format Format) *Tracer {
+	return &Tracer{Format: format, End: 0xffff, w: bufio.NewWriter(w)}
+}
+
+// Trace writes the instruction at the PC before it is executed, read returns the bytes of the address space
+func (t *Tracer) Trace(cycle uint64, cpu *mpu.MOS6502, read func(addr uint16) byte, rasterLine, rasterCycle int) {
+	pc := cpu.PC()
+	if pc < t.Start || pc > t.End {
+		return
+	}
+	instruction := disasm.Decode(read, pc)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.err != nil {
+		return
+	}
+	switch t.Format {
+	case VICE:
+		_, t.err = fmt.Fprintf(t.w, ".C:%04x  % -10X  %-14s - A:%02X X:%02X Y:%02X SP:%02x %s %11d\n",
+			pc, instruction.Bytes, strings.ToUpper(instruction.String()),
+			cpu.A(), cpu.X(), cpu.Y(), cpu.S(), flags(cpu.P()), cycle)
+	default:
+		_, t.err = fmt.Fprintf(t.w, "%11d  %-32s a:%02x x:%02x y:%02x s:%02x p:%02x  %03d/%02d\n",
+			cycle, instruction.Line(), cpu.A(), cpu.X(), cpu.Y(), cpu.S(), cpu.P(), rasterLine, rasterCycle)
+	}
+}
+
+// flags returns the status register as NV-BDIZC, cleared flags are shown as dots
+func flags(p byte) string {
+	names := []byte("NV-BDIZC")
+	for i := range names {
+		if i != 2 && p&(0x80>>i) == 0 {
+			names[i] = '.'
+		}
+	}
+	return string(names)
+}
+
+// Flush writes the buffered lines and returns the first error writing the trace
+func (t *Tracer) Flush() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	return t.w.Flush()
+}
@@ -0,0 +1,78 @@
+package trace
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/gentoomaniac/go64/pkg/cyclelock"
+	"github.com/gentoomaniac/go64/pkg/memory"
+	"github.com/gentoomaniac/go64/pkg/mpu"
+)
+
+func newTestCPU(program ...byte) (*mpu.MOS6502, *memory.Memory) {
+	m := &memory.Memory{}
+	m.CopyTo(0x1000, program)
+	cpu := &mpu.MOS6502{Memory: m}
+	cpu.Init(&cyclelock.AlwaysOpenLock{})
+	cpu.SetPC(0x1000)
+	cpu.SetP(0x24)
+	cpu.SetS(0xfd)
+	return cpu, m
+}
+
+func TestTracer(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Tracer", func() {
+		g.It("writes the default format", func() {
+			cpu, m := newTestCPU(0xa2, 0xff, 0x9d, 0x00, 0x04)
+			out := &bytes.Buffer{}
+			tracer := New(out, Default)
+			for i := 0; i < 2; i++ {
+				tracer.Trace(uint64(100+i*2), cpu, m.Get, 50, 12+i*2)
+				cpu.Step()
+			}
+			g.Assert(tracer.Flush()).IsNil()
+			g.Assert(out.String()).Equal(
+				"        100  1000  a2 ff     LDX #$ff         a:00 x:00 y:00 s:fd p:24  050/12\n" +
+					"        102  1002  9d 00 04  STA $0400,X      a:00 x:ff y:00 s:fd p:a4  050/14\n")
+		})
+
+		g.It("writes the format of the VICE monitor", func() {
+			cpu, m := newTestCPU(0xa2, 0xff, 0x9d, 0x00, 0x04)
+			out := &bytes.Buffer{}
+			tracer := New(out, VICE)
+			for i := 0; i < 2; i++ {
+				tracer.Trace(uint64(100+i*2), cpu, m.Get, 50, 12)
+				cpu.Step()
+			}
+			tracer.Flush()
+			g.Assert(out.String()).Equal(
+				".C:1000  A2 FF       LDX #$FF       - A:00 X:00 Y:00 SP:fd ..-..I..         100\n" +
+					".C:1002  9D 00 04    STA $0400,X    - A:00 X:FF Y:00 SP:fd N.-..I..         102\n")
+		})
+
+		g.It("only traces the address range", func() {
+			cpu, m := newTestCPU(0xe8, 0xe8, 0xe8)
+			out := &bytes.Buffer{}
+			tracer := New(out, Default)
+			tracer.Start, tracer.End = 0x1001, 0x1001
+			for i := 0; i < 3; i++ {
+				tracer.Trace(0, cpu, m.Get, 0, 0)
+				cpu.Step()
+			}
+			tracer.Flush()
+			g.Assert(bytes.Count(out.Bytes(), []byte("\n"))).Equal(1)
+			g.Assert(bytes.Contains(out.Bytes(), []byte("1001  e8"))).IsTrue()
+		})
+
+		g.It("parses format names", func() {
+			format, err := ParseFormat("VICE")
+			g.Assert(err).IsNil()
+			g.Assert(format).Equal(VICE)
+			_, err = ParseFormat("nestest")
+			g.Assert(err.Error()).Equal(`unknown trace format "nestest"`)
+		})
+	})
+}
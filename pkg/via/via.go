@@ -0,0 +1,706 @@
+package via
+
+import "github.com/gentoomaniac/go64/pkg/snapshot"
+
+// VIA emulates the MOS 6522 Versatile Interface Adapter
+// http://archive.6502.org/datasheets/mos_6522_preliminary_nov_1977.pdf
+// http://archive.6502.org/datasheets/rockwell_r6522_via.pdf
+type VIA struct {
+	ora, orb   byte
+	ddra, ddrb byte
+	// ira and irb hold the port values latched on a CA1/CB1 transition
+	ira, irb byte
+
+	t1Counter uint16
+	t1Latch   uint16
+	t1Armed   bool
+	t1Reload  bool
+	// pb7 is the timer 1 output on PB7
+	pb7 bool
+
+	t2Counter uint16
+	t2Latch   byte
+	t2Armed   bool
+
+	sr byte
+	// srBits counts the bits left to shift, srDivider the cycles until the next shift clock edge
+	srBits    int
+	srDivider byte
+
+	acr byte
+	pcr byte
+	ifr byte
+	ier byte
+
+	ca1, ca2, cb1, cb2 bool
+	// ca2Pulse and cb2Pulse are set while a control line is low for one cycle in pulse output mode
+	ca2Pulse, cb2Pulse bool
+
+	// PortAIn and PortBIn return the levels of the port pins as driven by the peripheral
+	PortAIn func() byte
+	PortBIn func() byte
+	// PortAOut and PortBOut are called whenever the output of a port changes
+	PortAOut func(value byte)
+	PortBOut func(value byte)
+	// CA2Out, CB1Out and CB2Out are called when the VIA changes the level of a control line it drives
+	CA2Out func(level bool)
+	CB1Out func(level bool)
+	CB2Out func(level bool)
+	// IRQ is called whenever the state of the IRQ output changes
+	IRQ func(active bool)
+
+	irq bool
+}
+
+// Registers
+const (
+	ORB uint16 = iota
+	ORA
+	DDRB
+	DDRA
+	T1CL
+	T1CH
+	T1LL
+	T1LH
+	T2CL
+	T2CH
+	SR
+	ACR
+	PCR
+	IFR
+	IER
+	ORANoHandshake
+)
+
+// Interrupt flags
+const (
+	FlagCA2 byte = 0x01
+	FlagCA1 byte = 0x02
+	FlagSR  byte = 0x04
+	FlagCB2 byte = 0x08
+	FlagCB1 byte = 0x10
+	FlagT2  byte = 0x20
+	FlagT1  byte = 0x40
+	FlagIRQ byte = 0x80
+)
+
+// control line modes of the PCR for CA2 and CB2
+const (
+	inputNegative byte = iota
+	independentNegative
+	inputPositive
+	independentPositive
+	handshakeOutput
+	pulseOutput
+	manualLow
+	manualHigh
+)
+
+// shift register modes of the ACR
+const (
+	srDisabled byte = iota
+	srInT2
+	srInPhi2
+	srInExternal
+	srOutFreeRunning
+	srOutT2
+	srOutPhi2
+	srOutExternal
+)
+
+// Reset puts the VIA into the power on state: all registers besides the timers and the shift register are cleared
+func (v *VIA) Reset() {
+	v.ora, v.orb, v.ddra, v.ddrb = 0, 0, 0, 0
+	v.acr, v.pcr, v.ifr, v.ier = 0, 0, 0, 0
+	v.t1Armed, v.t2Armed, v.t1Reload = false, false, false
+	v.pb7 = true
+	v.srBits = 0
+	v.ca1, v.ca2, v.cb1, v.cb2 = true, true, true, true
+	v.ca2Pulse, v.cb2Pulse = false, false
+	v.updateIRQ()
+	v.portAChanged()
+	v.portBChanged()
+}
+
+/* Interrupts */
+
+func (v *VIA) updateIRQ() {
+	irq := v.ifr&v.ier&0x7f != 0
+	if irq != v.irq {
+		v.irq = irq
+		if v.IRQ != nil {
+			v.IRQ(irq)
+		}
+	}
+}
+
+func (v *VIA) setFlag(flag byte) {
+	v.ifr |= flag
+	v.updateIRQ()
+}
+
+func (v *VIA) clearFlag(flag byte) {
+	v.ifr &^= flag
+	v.updateIRQ()
+}
+
+// IRQActive returns true if the VIA is pulling the IRQ line
+func (v *VIA) IRQActive() bool {
+	return v.irq
+}
+
+/* Ports */
+
+// OutputA returns the levels of the port A pins driven by the VIA, input pins read as 0
+func (v *VIA) OutputA() byte {
+	return v.ora & v.ddra
+}
+
+// OutputB returns the levels of the port B pins driven by the VIA including the timer 1 output on PB7,
+// input pins read as 0
+func (v *VIA) OutputB() byte {
+	value := v.orb & v.ddrb
+	if v.acr&0x80 != 0 {
+		value &^= 0x80
+		if v.pb7 {
+			value |= 0x80
+		}
+	}
+	return value
+}
+
+func (v *VIA) portAChanged() {
+	if v.PortAOut != nil {
+		v.PortAOut(v.OutputA())
+	}
+}
+
+func (v *VIA) portBChanged() {
+	if v.PortBOut != nil {
+		v.PortBOut(v.OutputB())
+	}
+}
+
+func (v *VIA) pinsA() byte {
+	pins := byte(0xff)
+	if v.PortAIn != nil {
+		pins = v.PortAIn()
+	}
+	return pins
+}
+
+func (v *VIA) pinsB() byte {
+	pins := byte(0xff)
+	if v.PortBIn != nil {
+		pins = v.PortBIn()
+	}
+	return pins
+}
+
+// readA returns the value of IRA, port A reads the pin levels even for outputs
+func (v *VIA) readA() byte {
+	if v.acr&0x01 != 0 {
+		return v.ira
+	}
+	return v.pinsA()
+}
+
+// readB returns the value of IRB, output pins read the output register
+func (v *VIA) readB() byte {
+	pins := v.pinsB()
+	if v.acr&0x02 != 0 {
+		pins = v.irb
+	}
+	value := (v.orb & v.ddrb) | (pins &^ v.ddrb)
+	if v.acr&0x80 != 0 {
+		value &^= 0x80
+		if v.pb7 {
+			value |= 0x80
+		}
+	}
+	return value
+}
+
+/* Control lines */
+
+func (v *VIA) ca2Mode() byte {
+	return (v.pcr >> 1) & 0x07
+}
+
+func (v *VIA) cb2Mode() byte {
+	return (v.pcr >> 5) & 0x07
+}
+
+// CA2 returns the level of the CA2 line
+func (v *VIA) CA2() bool {
+	return v.ca2
+}
+
+// CB1 returns the level of the CB1 line, it is driven by the VIA in the internally clocked shift register modes
+func (v *VIA) CB1() bool {
+	return v.cb1
+}
+
+// CB2 returns the level of the CB2 line
+func (v *VIA) CB2() bool {
+	return v.cb2
+}
+
+func (v *VIA) driveCA2(level bool) {
+	if level == v.ca2 {
+		return
+	}
+	v.ca2 = level
+	if v.CA2Out != nil {
+		v.CA2Out(level)
+	}
+}
+
+func (v *VIA) driveCB1(level bool) {
+	if level == v.cb1 {
+		return
+	}
+	v.cb1 = level
+	if v.CB1Out != nil {
+		v.CB1Out(level)
+	}
+}
+
+func (v *VIA) driveCB2(level bool) {
+	if level == v.cb2 {
+		return
+	}
+	v.cb2 = level
+	if v.CB2Out != nil {
+		v.CB2Out(level)
+	}
+}
+
+// updateControlOutputs sets CA2 and CB2 according to the manual output modes of the PCR
+func (v *VIA) updateControlOutputs() {
+	switch v.ca2Mode() {
+	case manualLow:
+		v.driveCA2(false)
+	case manualHigh:
+		v.driveCA2(true)
+	}
+
+	if v.cb2Output() {
+		return
+	}
+	switch v.cb2Mode() {
+	case manualLow:
+		v.driveCB2(false)
+	case manualHigh:
+		v.driveCB2(true)
+	}
+}
+
+// cb2Output returns true if CB2 is driven by the shift register
+func (v *VIA) cb2Output() bool {
+	return v.srMode() >= srOutFreeRunning
+}
+
+func activeEdge(old bool, level bool, positive bool) bool {
+	return old != level && level == positive
+}
+
+// SetCA1 sets the level of the CA1 input
+func (v *VIA) SetCA1(level bool) {
+	old := v.ca1
+	v.ca1 = level
+	if !activeEdge(old, level, v.pcr&0x01 != 0) {
+		return
+	}
+
+	v.setFlag(FlagCA1)
+	if v.acr&0x01 != 0 {
+		v.ira = v.pinsA()
+	}
+	if v.ca2Mode() == handshakeOutput {
+		v.driveCA2(true)
+	}
+}
+
+// SetCA2 sets the level of the CA2 line if it is configured as input
+func (v *VIA) SetCA2(level bool) {
+	mode := v.ca2Mode()
+	if mode >= handshakeOutput {
+		return
+	}
+	old := v.ca2
+	v.ca2 = level
+	if activeEdge(old, level, mode&0x02 != 0) {
+		v.setFlag(FlagCA2)
+	}
+}
+
+// SetCB1 sets the level of the CB1 input. It is also the external clock of the shift register.
+func (v *VIA) SetCB1(level bool) {
+	old := v.cb1
+	v.cb1 = level
+	if old == level {
+		return
+	}
+
+	if mode := v.srMode(); mode == srInExternal || mode == srOutExternal {
+		v.shiftClock(level)
+	}
+
+	if !activeEdge(old, level, v.pcr&0x10 != 0) {
+		return
+	}
+	v.setFlag(FlagCB1)
+	if v.acr&0x02 != 0 {
+		v.irb = v.pinsB()
+	}
+	if v.cb2Mode() == handshakeOutput && !v.cb2Output() {
+		v.driveCB2(true)
+	}
+}
+
+// SetCB2 sets the level of the CB2 line if it is configured as input
+func (v *VIA) SetCB2(level bool) {
+	mode := v.cb2Mode()
+	if mode >= handshakeOutput || v.cb2Output() {
+		return
+	}
+	old := v.cb2
+	v.cb2 = level
+	if activeEdge(old, level, mode&0x02 != 0) {
+		v.setFlag(FlagCB2)
+	}
+}
+
+// portAAccess handles the handshake of a read or write of ORA
+func (v *VIA) portAAccess() {
+	flags := FlagCA1
+	mode := v.ca2Mode()
+	if mode != independentNegative && mode != independentPositive {
+		flags |= FlagCA2
+	}
+	v.clearFlag(flags)
+
+	switch mode {
+	case handshakeOutput:
+		v.driveCA2(false)
+	case pulseOutput:
+		v.driveCA2(false)
+		v.ca2Pulse = true
+	}
+}
+
+// portBAccess handles the handshake of a read or write of ORB, only writes start a CB2 handshake
+func (v *VIA) portBAccess(write bool) {
+	flags := FlagCB1
+	mode := v.cb2Mode()
+	if mode != independentNegative && mode != independentPositive {
+		flags |= FlagCB2
+	}
+	v.clearFlag(flags)
+
+	if !write || v.cb2Output() {
+		return
+	}
+	switch mode {
+	case handshakeOutput:
+		v.driveCB2(false)
+	case pulseOutput:
+		v.driveCB2(false)
+		v.cb2Pulse = true
+	}
+}
+
+/* Shift register */
+
+func (v *VIA) srMode() byte {
+	return (v.acr >> 2) & 0x07
+}
+
+// shiftClock is called on every edge of the shift clock on CB1. Data is shifted out on the falling edge
+// and shifted in on the rising edge.
+func (v *VIA) shiftClock(rising bool) {
+	mode := v.srMode()
+	if mode == srDisabled || (v.srBits == 0 && mode != srOutFreeRunning) {
+		return
+	}
+
+	if !rising {
+		if mode >= srOutFreeRunning {
+			v.driveCB2(v.sr&0x80 != 0)
+		}
+		return
+	}
+
+	if mode >= srOutFreeRunning {
+		v.sr = v.sr<<1 | v.sr>>7
+	} else {
+		v.sr <<= 1
+		if v.cb2 {
+			v.sr |= 0x01
+		}
+	}
+
+	if mode == srOutFreeRunning {
+		return
+	}
+	v.srBits--
+	if v.srBits == 0 {
+		v.setFlag(FlagSR)
+	}
+}
+
+// tickShiftRegister generates the internal shift clock in the phi2 and timer 2 controlled modes
+func (v *VIA) tickShiftRegister(t2LowUnderflow bool) {
+	switch v.srMode() {
+	case srInPhi2, srOutPhi2:
+	case srInT2, srOutT2, srOutFreeRunning:
+		if !t2LowUnderflow {
+			return
+		}
+	default:
+		return
+	}
+
+	if v.srBits == 0 && v.srMode() != srOutFreeRunning {
+		return
+	}
+	v.driveCB1(!v.cb1)
+	v.shiftClock(v.cb1)
+}
+
+// startShift restarts the shift register after an access to SR
+func (v *VIA) startShift() {
+	v.clearFlag(FlagSR)
+	if v.srMode() != srDisabled {
+		v.srBits = 8
+		v.srDivider = v.t2Latch
+	}
+}
+
+/* Timers */
+
+// Tick advances the VIA by one phi2 cycle
+func (v *VIA) Tick() {
+	if v.ca2Pulse {
+		v.ca2Pulse = false
+		v.driveCA2(true)
+	}
+	if v.cb2Pulse {
+		v.cb2Pulse = false
+		v.driveCB2(true)
+	}
+
+	v.tickTimer1()
+
+	// in pulse counting mode timer 2 counts negative edges on PB6 (see CountPB6)
+	if v.acr&0x20 == 0 {
+		v.t2Counter--
+		if v.t2Counter == 0xffff && v.t2Armed {
+			v.setFlag(FlagT2)
+			v.t2Armed = false
+		}
+	}
+
+	// the shift register uses the low byte of timer 2 as its own 8 bit divider
+	underflow := false
+	v.srDivider--
+	if v.srDivider == 0xff {
+		v.srDivider = v.t2Latch
+		underflow = true
+	}
+	v.tickShiftRegister(underflow)
+}
+
+func (v *VIA) tickTimer1() {
+	if v.t1Reload {
+		v.t1Counter = v.t1Latch
+		v.t1Reload = false
+		return
+	}
+
+	v.t1Counter--
+	if v.t1Counter != 0xffff {
+		return
+	}
+
+	freeRunning := v.acr&0x40 != 0
+	if v.t1Armed {
+		v.setFlag(FlagT1)
+		if freeRunning {
+			v.pb7 = !v.pb7
+		} else {
+			v.pb7 = true
+			v.t1Armed = false
+		}
+		if v.acr&0x80 != 0 {
+			v.portBChanged()
+		}
+	}
+	// the counter is reloaded in both modes, one shot mode only suppresses the following interrupts and PB7
+	v.t1Reload = true
+}
+
+// CountPB6 has to be called on every negative edge of PB6, timer 2 counts them in pulse counting mode
+func (v *VIA) CountPB6() {
+	if v.acr&0x20 == 0 {
+		return
+	}
+	v.t2Counter--
+	if v.t2Counter == 0 && v.t2Armed {
+		v.setFlag(FlagT2)
+		v.t2Armed = false
+	}
+}
+
+/* Register access */
+
+// Read reads one of the 16 registers, only the lower 4 bits of the address are decoded
+func (v *VIA) Read(register uint16) byte {
+	switch register & 0x0f {
+	case ORB:
+		v.portBAccess(false)
+		return v.readB()
+	case ORA:
+		v.portAAccess()
+		return v.readA()
+	case T1CL:
+		v.clearFlag(FlagT1)
+		return byte(v.t1Counter)
+	case T2CL:
+		v.clearFlag(FlagT2)
+		return byte(v.t2Counter)
+	case SR:
+		v.startShift()
+		return v.sr
+	case ORANoHandshake:
+		return v.readA()
+	}
+	return v.Peek(register)
+}
+
+// Peek returns the value of a register without any side effects
+func (v *VIA) Peek(register uint16) byte {
+	switch register & 0x0f {
+	case ORB:
+		return v.readB()
+	case ORA, ORANoHandshake:
+		return v.readA()
+	case DDRB:
+		return v.ddrb
+	case DDRA:
+		return v.ddra
+	case T1CL:
+		return byte(v.t1Counter)
+	case T1CH:
+		return byte(v.t1Counter >> 8)
+	case T1LL:
+		return byte(v.t1Latch)
+	case T1LH:
+		return byte(v.t1Latch >> 8)
+	case T2CL:
+		return byte(v.t2Counter)
+	case T2CH:
+		return byte(v.t2Counter >> 8)
+	case SR:
+		return v.sr
+	case ACR:
+		return v.acr
+	case PCR:
+		return v.pcr
+	case IFR:
+		if v.irq {
+			return v.ifr | FlagIRQ
+		}
+		return v.ifr
+	default:
+		return v.ier | 0x80
+	}
+}
+
+// Write writes one of the 16 registers, only the lower 4 bits of the address are decoded
+func (v *VIA) Write(register uint16, value byte) {
+	switch register & 0x0f {
+	case ORB:
+		v.orb = value
+		v.portBAccess(true)
+		v.portBChanged()
+	case ORA:
+		v.ora = value
+		v.portAAccess()
+		v.portAChanged()
+	case DDRB:
+		v.ddrb = value
+		v.portBChanged()
+	case DDRA:
+		v.ddra = value
+		v.portAChanged()
+	case T1CL, T1LL:
+		v.t1Latch = (v.t1Latch & 0xff00) | uint16(value)
+	case T1CH:
+		v.t1Latch = (v.t1Latch & 0x00ff) | uint16(value)<<8
+		v.t1Counter = v.t1Latch
+		v.t1Armed = true
+		v.t1Reload = false
+		v.clearFlag(FlagT1)
+		if v.acr&0x80 != 0 {
+			v.pb7 = false
+			v.portBChanged()
+		}
+	case T1LH:
+		v.t1Latch = (v.t1Latch & 0x00ff) | uint16(value)<<8
+		v.clearFlag(FlagT1)
+	case T2CL:
+		v.t2Latch = value
+	case T2CH:
+		v.t2Counter = uint16(value)<<8 | uint16(v.t2Latch)
+		v.t2Armed = true
+		v.clearFlag(FlagT2)
+	case SR:
+		v.sr = value
+		v.startShift()
+	case ACR:
+		v.acr = value
+		v.updateControlOutputs()
+		v.portBChanged()
+	case PCR:
+		v.pcr = value
+		v.updateControlOutputs()
+	case IFR:
+		v.clearFlag(value & 0x7f)
+	case IER:
+		if value&0x80 != 0 {
+			v.ier |= value & 0x7f
+		} else {
+			v.ier &^= value & 0x7f
+		}
+		v.updateIRQ()
+	case ORANoHandshake:
+		v.ora = value
+		v.portAChanged()
+	}
+}
+
+// State saves or restores the registers and the internal state of the VIA
+func (v *VIA) State(s *snapshot.State) {
+	for _, r := range []*byte{&v.ora, &v.orb, &v.ddra, &v.ddrb, &v.ira, &v.irb} {
+		s.Byte(r)
+	}
+	s.Uint16(&v.t1Counter)
+	s.Uint16(&v.t1Latch)
+	s.Bool(&v.t1Armed)
+	s.Bool(&v.t1Reload)
+	s.Bool(&v.pb7)
+	s.Uint16(&v.t2Counter)
+	s.Byte(&v.t2Latch)
+	s.Bool(&v.t2Armed)
+	s.Byte(&v.sr)
+	s.Int(&v.srBits)
+	s.Byte(&v.srDivider)
+	for _, r := range []*byte{&v.acr, &v.pcr, &v.ifr, &v.ier} {
+		s.Byte(r)
+	}
+	for _, line := range []*bool{&v.ca1, &v.ca2, &v.cb1, &v.cb2, &v.ca2Pulse, &v.cb2Pulse, &v.irq} {
+		s.Bool(line)
+	}
+}
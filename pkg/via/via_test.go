@@ -0,0 +1,270 @@
+package via
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func newTestVIA() *VIA {
+	v := &VIA{}
+	v.Reset()
+	return v
+}
+
+func TestTimers(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Timer 1", func() {
+		g.It("sets its interrupt flag once in one shot mode", func() {
+			v := newTestVIA()
+			irq := false
+			v.IRQ = func(active bool) { irq = active }
+			v.Write(IER, 0x80|FlagT1)
+
+			v.Write(T1CL, 0x03)
+			v.Write(T1CH, 0x00)
+			for i := 0; i < 3; i++ {
+				v.Tick()
+			}
+			g.Assert(irq).IsFalse()
+			v.Tick()
+			g.Assert(irq).IsTrue()
+			g.Assert(v.Read(IFR)).Equal(FlagIRQ | FlagT1)
+
+			v.Read(T1CL)
+			g.Assert(irq).IsFalse()
+			for i := 0; i < 0x10000; i++ {
+				v.Tick()
+			}
+			g.Assert(irq).IsFalse()
+		})
+
+		g.It("reloads from the latch in one shot mode", func() {
+			v := newTestVIA()
+			v.Write(ACR, 0x80)
+			v.Write(T1CL, 0x03)
+			v.Write(T1CH, 0x00)
+			for i := 0; i < 4; i++ {
+				v.Tick()
+			}
+			g.Assert(v.Peek(T1CH)).Equal(uint8(0xff))
+			v.Tick()
+			g.Assert(v.Peek(T1CL)).Equal(uint8(0x03))
+			g.Assert(v.Peek(T1CH)).Equal(uint8(0x00))
+			v.Tick()
+			g.Assert(v.Peek(T1CL)).Equal(uint8(0x02))
+
+			v.Write(IFR, FlagT1)
+			for i := 0; i < 8; i++ {
+				v.Tick()
+			}
+			g.Assert(v.Peek(IFR) & FlagT1).Equal(uint8(0))
+			g.Assert(v.OutputB() & 0x80).Equal(uint8(0x80))
+		})
+
+		g.It("reloads from the latch and toggles PB7 in free running mode", func() {
+			v := newTestVIA()
+			v.Write(ACR, 0xc0)
+			v.Write(T1CL, 0x02)
+			v.Write(T1CH, 0x00)
+			g.Assert(v.OutputB() & 0x80).Equal(uint8(0x00))
+
+			timeouts := []int{}
+			for cycle := 1; cycle <= 16; cycle++ {
+				v.Tick()
+				if v.Peek(IFR)&FlagT1 != 0 {
+					timeouts = append(timeouts, cycle)
+					v.Write(IFR, FlagT1)
+				}
+			}
+			// N+1 cycles for the first timeout, N+2 for every following one
+			g.Assert(timeouts).Equal([]int{3, 7, 11, 15})
+			g.Assert(v.OutputB() & 0x80).Equal(uint8(0x00))
+			v.Tick()
+			v.Tick()
+			v.Tick()
+			g.Assert(v.OutputB() & 0x80).Equal(uint8(0x80))
+		})
+	})
+
+	g.Describe("Timer 2", func() {
+		g.It("times out once", func() {
+			v := newTestVIA()
+			v.Write(T2CL, 0x01)
+			v.Write(T2CH, 0x00)
+			v.Tick()
+			g.Assert(v.Peek(IFR) & FlagT2).Equal(uint8(0))
+			v.Tick()
+			g.Assert(v.Peek(IFR) & FlagT2).Equal(FlagT2)
+			v.Read(T2CL)
+			g.Assert(v.Peek(IFR) & FlagT2).Equal(uint8(0))
+		})
+
+		g.It("counts pulses on PB6", func() {
+			v := newTestVIA()
+			v.Write(ACR, 0x20)
+			v.Write(T2CL, 0x03)
+			v.Write(T2CH, 0x00)
+			for i := 0; i < 10; i++ {
+				v.Tick()
+			}
+			g.Assert(v.Peek(T2CL)).Equal(uint8(0x03))
+			v.CountPB6()
+			v.CountPB6()
+			g.Assert(v.Peek(IFR) & FlagT2).Equal(uint8(0))
+			v.CountPB6()
+			g.Assert(v.Peek(IFR) & FlagT2).Equal(FlagT2)
+		})
+	})
+}
+
+func TestPorts(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Ports", func() {
+		g.It("mixes output register and pins according to the data direction", func() {
+			v := newTestVIA()
+			v.PortBIn = func() byte { return 0x0f }
+			v.Write(DDRB, 0xf0)
+			v.Write(ORB, 0xa5)
+			g.Assert(v.Read(ORB)).Equal(uint8(0xaf))
+			g.Assert(v.OutputB()).Equal(uint8(0xa0))
+		})
+
+		g.It("reads the pins of port A even for outputs", func() {
+			v := newTestVIA()
+			v.PortAIn = func() byte { return 0x3c }
+			v.Write(DDRA, 0xff)
+			v.Write(ORA, 0xff)
+			g.Assert(v.Read(ORA)).Equal(uint8(0x3c))
+		})
+
+		g.It("notifies about output changes", func() {
+			v := newTestVIA()
+			out := byte(0)
+			v.PortAOut = func(value byte) { out = value }
+			v.Write(ORA, 0x55)
+			g.Assert(out).Equal(uint8(0x00))
+			v.Write(DDRA, 0x0f)
+			g.Assert(out).Equal(uint8(0x05))
+		})
+
+		g.It("latches port A on the active CA1 edge", func() {
+			v := newTestVIA()
+			pins := byte(0x11)
+			v.PortAIn = func() byte { return pins }
+			v.Write(ACR, 0x01)
+			v.Write(PCR, 0x01)
+
+			v.SetCA1(false)
+			g.Assert(v.Peek(IFR) & FlagCA1).Equal(uint8(0))
+			v.SetCA1(true)
+			g.Assert(v.Peek(IFR) & FlagCA1).Equal(FlagCA1)
+			pins = 0x22
+			g.Assert(v.Read(ORA)).Equal(uint8(0x11))
+			g.Assert(v.Peek(IFR) & FlagCA1).Equal(uint8(0))
+		})
+	})
+
+	g.Describe("Control lines", func() {
+		g.It("drives CA2 and CB2 in manual mode", func() {
+			v := newTestVIA()
+			v.Write(PCR, 0xcc)
+			g.Assert(v.CA2()).IsFalse()
+			g.Assert(v.CB2()).IsFalse()
+			v.Write(PCR, 0xee)
+			g.Assert(v.CA2()).IsTrue()
+			g.Assert(v.CB2()).IsTrue()
+		})
+
+		g.It("does a CA2 handshake on port A accesses", func() {
+			v := newTestVIA()
+			v.Write(PCR, 0x08)
+			v.Read(ORA)
+			g.Assert(v.CA2()).IsFalse()
+			v.SetCA1(false)
+			g.Assert(v.CA2()).IsTrue()
+		})
+
+		g.It("pulses CB2 for one cycle on port B writes", func() {
+			v := newTestVIA()
+			v.Write(PCR, 0xa0)
+			v.Read(ORB)
+			g.Assert(v.CB2()).IsTrue()
+			v.Write(ORB, 0x00)
+			g.Assert(v.CB2()).IsFalse()
+			v.Tick()
+			g.Assert(v.CB2()).IsTrue()
+		})
+
+		g.It("does not clear independent CA2 interrupts on port accesses", func() {
+			v := newTestVIA()
+			v.Write(PCR, 0x02)
+			v.SetCA2(false)
+			g.Assert(v.Peek(IFR) & FlagCA2).Equal(FlagCA2)
+			v.Read(ORA)
+			g.Assert(v.Peek(IFR) & FlagCA2).Equal(FlagCA2)
+
+			v.Write(PCR, 0x00)
+			v.Read(ORA)
+			g.Assert(v.Peek(IFR) & FlagCA2).Equal(uint8(0))
+		})
+	})
+}
+
+func TestShiftRegister(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Shift register", func() {
+		g.It("shifts out under phi2 control", func() {
+			v := newTestVIA()
+			bits := byte(0)
+			v.CB1Out = func(level bool) {
+				if level {
+					bits <<= 1
+					if v.CB2() {
+						bits |= 1
+					}
+				}
+			}
+			v.Write(ACR, 0x18)
+			v.Write(SR, 0xa7)
+			for i := 0; i < 16; i++ {
+				v.Tick()
+			}
+			g.Assert(bits).Equal(uint8(0xa7))
+			g.Assert(v.Peek(IFR) & FlagSR).Equal(FlagSR)
+
+			v.Tick()
+			v.Tick()
+			g.Assert(bits).Equal(uint8(0xa7))
+		})
+
+		g.It("shifts in with an external clock", func() {
+			v := newTestVIA()
+			v.Write(ACR, 0x0c)
+			v.Read(SR)
+			for _, bit := range []bool{true, false, true, true, false, false, true, false} {
+				v.SetCB2(bit)
+				v.SetCB1(false)
+				v.SetCB1(true)
+			}
+			g.Assert(v.Peek(SR)).Equal(uint8(0xb2))
+			g.Assert(v.Peek(IFR) & FlagSR).Equal(FlagSR)
+		})
+
+		g.It("shifts at the timer 2 rate", func() {
+			v := newTestVIA()
+			v.Write(T2CL, 0x02)
+			v.Write(ACR, 0x14)
+			v.Write(SR, 0xff)
+			for i := 0; i < 47; i++ {
+				v.Tick()
+			}
+			g.Assert(v.Peek(IFR) & FlagSR).Equal(uint8(0))
+			v.Tick()
+			g.Assert(v.Peek(IFR) & FlagSR).Equal(FlagSR)
+		})
+	})
+}
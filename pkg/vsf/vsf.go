@@ -0,0 +1,172 @@
+package vsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// VSF is the snapshot format of VICE: a header with the machine name followed by modules, one for every
+// emulated component. All numbers are little endian.
+// https://vice-emu.sourceforge.io/vice_toc.html#TOC353
+
+const (
+	magic        = "VICE Snapshot File\032"
+	versionMagic = "VICE Version\032"
+	nameLen      = 16
+	// moduleHeaderLen is the length of the module header, the size of a module includes it
+	moduleHeaderLen = nameLen + 6
+)
+
+// File is a parsed VSF snapshot
+type File struct {
+	Major, Minor byte
+	// Machine is the emulated machine, e.g. C64 or C64SC
+	Machine string
+	// ViceVersion is the version of VICE that wrote the file, it is only stored by newer versions
+	ViceVersion string
+	Modules     []Module
+	Path        string
+}
+
+// Module holds the state of one component
+type Module struct {
+	Name         string
+	Major, Minor byte
+	Data         []byte
+}
+
+// Load reads a VSF snapshot from a file
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.Path = path
+	return f, nil
+}
+
+// Parse parses a VSF snapshot
+func Parse(data []byte) (*File, error) {
+	headerLen := len(magic) + 2 + nameLen
+	if len(data) < headerLen || string(data[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a VICE snapshot")
+	}
+
+	f := &File{
+		Major:   data[len(magic)],
+		Minor:   data[len(magic)+1],
+		Machine: name(data[len(magic)+2 : headerLen]),
+	}
+	data = data[headerLen:]
+
+	// the version block is followed by the 4 version numbers and the SVN revision
+	if bytes.HasPrefix(data, []byte(versionMagic)) && len(data) >= len(versionMagic)+8 {
+		v := data[len(versionMagic):]
+		f.ViceVersion = fmt.Sprintf("%d.%d.%d.%d", v[0], v[1], v[2], v[3])
+		data = data[len(versionMagic)+8:]
+	}
+
+	for len(data) > 0 {
+		if len(data) < moduleHeaderLen {
+			return nil, fmt.Errorf("truncated module header")
+		}
+		m := Module{
+			Name:  name(data[:nameLen]),
+			Major: data[nameLen],
+			Minor: data[nameLen+1],
+		}
+		size := int(binary.LittleEndian.Uint32(data[nameLen+2:]))
+		if size < moduleHeaderLen || size > len(data) {
+			return nil, fmt.Errorf("module %s: invalid size %d", m.Name, size)
+		}
+		m.Data = data[moduleHeaderLen:size]
+		f.Modules = append(f.Modules, m)
+		data = data[size:]
+	}
+
+	return f, nil
+}
+
+func name(data []byte) string {
+	return string(bytes.TrimRight(data, "\x00"))
+}
+
+// Module returns the module with the given name or nil
+func (f *File) Module(name string) *Module {
+	for i := range f.Modules {
+		if f.Modules[i].Name == name {
+			return &f.Modules[i]
+		}
+	}
+	return nil
+}
+
+// Bytes returns the snapshot in VSF format
+func (f *File) Bytes() []byte {
+	data := []byte(magic)
+	data = append(data, f.Major, f.Minor)
+	data = append(data, padded(f.Machine)...)
+
+	for _, m := range f.Modules {
+		data = append(data, padded(m.Name)...)
+		data = append(data, m.Major, m.Minor)
+		data = binary.LittleEndian.AppendUint32(data, uint32(moduleHeaderLen+len(m.Data)))
+		data = append(data, m.Data...)
+	}
+	return data
+}
+
+func padded(s string) []byte {
+	b := make([]byte, nameLen)
+	copy(b, s)
+	return b
+}
+
+// Reader reads the values of a module in order. Reading past the end of the data sets an error and returns 0.
+type Reader struct {
+	data []byte
+	err  error
+}
+
+// Reader returns a reader for the data of the module
+func (m *Module) Reader() *Reader {
+	return &Reader{data: m.Data}
+}
+
+// Err returns an error if the module was too short
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Bytes returns the next n bytes
+func (r *Reader) Bytes(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = fmt.Errorf("module too short")
+		return make([]byte, n)
+	}
+	value := r.data[:n]
+	r.data = r.data[n:]
+	return value
+}
+
+// Byte reads a byte
+func (r *Reader) Byte() byte {
+	return r.Bytes(1)[0]
+}
+
+// Word reads a 16 bit value
+func (r *Reader) Word() uint16 {
+	return binary.LittleEndian.Uint16(r.Bytes(2))
+}
+
+// DWord reads a 32 bit value
+func (r *Reader) DWord() uint32 {
+	return binary.LittleEndian.Uint32(r.Bytes(4))
+}
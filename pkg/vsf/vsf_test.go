@@ -0,0 +1,60 @@
+package vsf
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestVSF(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("VSF parser", func() {
+		g.It("reads the header and the modules", func() {
+			f := &File{Major: 2, Minor: 0, Machine: "C64", Modules: []Module{
+				{Name: "MAINCPU", Major: 1, Minor: 1, Data: []byte{0x01, 0x02, 0x03}},
+				{Name: "C64MEM", Data: []byte{}},
+			}}
+			parsed, err := Parse(f.Bytes())
+			g.Assert(err).IsNil()
+			g.Assert(parsed.Machine).Equal("C64")
+			g.Assert(len(parsed.Modules)).Equal(2)
+			g.Assert(parsed.Module("MAINCPU").Minor).Equal(uint8(1))
+			g.Assert(parsed.Module("MAINCPU").Data).Equal([]byte{0x01, 0x02, 0x03})
+			g.Assert(parsed.Module("C64MEM") != nil).IsTrue()
+			g.Assert(parsed.Module("VIC-II") == nil).IsTrue()
+		})
+
+		g.It("skips the VICE version block", func() {
+			f := &File{Machine: "C64SC", Modules: []Module{{Name: "CIA1", Data: []byte{0x42}}}}
+			data := f.Bytes()
+			header := len(magic) + 2 + nameLen
+			version := append([]byte(versionMagic), 3, 5, 0, 0, 0, 0, 0, 0)
+			data = append(data[:header:header], append(version, data[header:]...)...)
+
+			parsed, err := Parse(data)
+			g.Assert(err).IsNil()
+			g.Assert(parsed.ViceVersion).Equal("3.5.0.0")
+			g.Assert(parsed.Module("CIA1").Data).Equal([]byte{0x42})
+		})
+
+		g.It("rejects broken files", func() {
+			_, err := Parse([]byte("VICE"))
+			g.Assert(err != nil).IsTrue()
+
+			data := (&File{Machine: "C64", Modules: []Module{{Name: "CIA1", Data: []byte{1, 2}}}}).Bytes()
+			_, err = Parse(data[:len(data)-1])
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("reads little endian values from modules", func() {
+			r := (&Module{Data: []byte{0x01, 0x34, 0x12, 0x78, 0x56, 0x34, 0x12}}).Reader()
+			g.Assert(r.Byte()).Equal(uint8(0x01))
+			g.Assert(r.Word()).Equal(uint16(0x1234))
+			g.Assert(r.DWord()).Equal(uint32(0x12345678))
+			g.Assert(r.Err()).IsNil()
+			r.Byte()
+			g.Assert(r.Err() != nil).IsTrue()
+		})
+	})
+}